@@ -15,6 +15,7 @@ import (
 //	"chain/core/pin"
 	"github.com/bytom/blockchain/signers"
 	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
 	"github.com/bytom/crypto/ed25519/chainkd"
 //	"chain/database/pg"
      dbm "github.com/tendermint/tmlibs/db"
@@ -31,7 +32,7 @@ var (
 	ErrBadIdentifier  = errors.New("either ID or alias must be specified, and not both")
 )
 
-func NewManager(db dbm.DB, chain *protocol.Chain/*, pinStore *pin.Store*/) *Manager {
+func NewManager(db dbm.DB, chain protocol.BlockReader/*, pinStore *pin.Store*/) *Manager {
 	return &Manager{
 		db:          db,
 		chain:       chain,
@@ -46,7 +47,7 @@ func NewManager(db dbm.DB, chain *protocol.Chain/*, pinStore *pin.Store*/) *Mana
 // Manager stores accounts and their associated control programs.
 type Manager struct {
 	db       dbm.DB
-	chain    *protocol.Chain
+	chain    protocol.BlockReader
 	utxoDB   *reserver
 	indexer  Saver
 //	pinStore *pin.Store
@@ -235,6 +236,21 @@ type controlProgram struct {
 }
 
 func (m *Manager) createControlProgram(ctx context.Context, accountID string, change bool, expiresAt time.Time) (*controlProgram, error) {
+	return m.deriveControlProgram(ctx, accountID, change, expiresAt, vmutil.P2SPMultiSigProgram)
+}
+
+// createRestrictedControlProgram derives a control program that can
+// only be spent with a co-signature from the given issuer keys, for
+// holding restricted-transfer assets.
+func (m *Manager) createRestrictedControlProgram(ctx context.Context, accountID string, issuerPubkeys []ed25519.PublicKey, issuerQuorum int) (*controlProgram, error) {
+	return m.deriveControlProgram(ctx, accountID, false, time.Time{}, func(pubkeys []ed25519.PublicKey, quorum int) ([]byte, error) {
+		return vmutil.RestrictedTransferProgram(pubkeys, quorum, issuerPubkeys, issuerQuorum)
+	})
+}
+
+// deriveControlProgram derives the account's keys at the next index
+// and builds a control program from them with build.
+func (m *Manager) deriveControlProgram(ctx context.Context, accountID string, change bool, expiresAt time.Time, build func([]ed25519.PublicKey, int) ([]byte, error)) (*controlProgram, error) {
 	account, err := m.findByID(ctx, accountID)
 	if err != nil {
 		return nil, err
@@ -248,7 +264,7 @@ func (m *Manager) createControlProgram(ctx context.Context, accountID string, ch
 	path := signers.Path(account, signers.AccountKeySpace, idx)
 	derivedXPubs := chainkd.DeriveXPubs(account.XPubs, path)
 	derivedPKs := chainkd.XPubKeys(derivedXPubs)
-	control, err := vmutil.P2SPMultiSigProgram(derivedPKs, account.Quorum)
+	control, err := build(derivedPKs, account.Quorum)
 	if err != nil {
 		return nil, err
 	}
@@ -275,6 +291,20 @@ func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, ch
 	return cp.controlProgram, nil
 }
 
+// CreateRestrictedControlProgram creates a control program tied to
+// the Account for receiving a restricted-transfer asset, whose issuer
+// holds issuerPubkeys, and stores it in the database.
+func (m *Manager) CreateRestrictedControlProgram(ctx context.Context, accountID string, issuerPubkeys []ed25519.PublicKey, issuerQuorum int) ([]byte, error) {
+	cp, err := m.createRestrictedControlProgram(ctx, accountID, issuerPubkeys, issuerQuorum)
+	if err != nil {
+		return nil, err
+	}
+	err = m.insertAccountControlProgram(ctx, cp)
+	if err != nil {
+		return nil, err
+	}
+	return cp.controlProgram, nil
+}
 
 func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*controlProgram) error {
 	/*const q = `
@@ -332,6 +362,9 @@ func (m *Manager) QueryAll(ctx context.Context) (interface{}, error){
 
 	iter := m.db.Iterator()
 	for iter.Next() {
+		if isHTLCKey(string(iter.Key())) {
+			continue
+		}
 		value := string(iter.Value())
 		if value[:3] == "acc"{
 			continue
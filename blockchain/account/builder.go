@@ -3,6 +3,7 @@ package account
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/bytom/blockchain/signers"
 	"github.com/bytom/blockchain/txbuilder"
@@ -11,6 +12,7 @@ import (
 	"github.com/bytom/log"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
 )
 
 func (m *Manager) NewSpendAction(amt bc.AssetAmount, accountID string, refData chainjson.Map, clientToken *string) txbuilder.Action {
@@ -78,7 +80,7 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	}
 
 	if res.Change > 0 {
-		acp, err := a.accounts.createControlProgram(ctx, a.AccountID, true, b.MaxTime())
+		acp, err := a.accounts.createChangeProgram(ctx, a.AccountID, res.UTXOs, b.MaxTime())
 		if err != nil {
 			return errors.Wrap(err, "creating control program")
 		}
@@ -94,6 +96,54 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	return nil
 }
 
+// createChangeProgram derives the control program receiving the
+// change from spending utxos. Change from a restricted-transfer asset
+// is held in a restricted transfer program of the same issuer, so it
+// stays restricted and the issuer can co-sign the spend.
+func (m *Manager) createChangeProgram(ctx context.Context, accountID string, utxos []*utxo, expiresAt time.Time) (*controlProgram, error) {
+	if len(utxos) > 0 {
+		_, _, issuerPubkeys, issuerQuorum, err := vmutil.ParseRestrictedTransferProgram(utxos[0].ControlProgram)
+		if err == nil {
+			acp, err := m.createRestrictedControlProgram(ctx, accountID, issuerPubkeys, issuerQuorum)
+			if err != nil {
+				return nil, err
+			}
+			acp.change = true
+			return acp, nil
+		}
+	}
+	return m.createControlProgram(ctx, accountID, true, expiresAt)
+}
+
+func (m *Manager) DecodeRetireAction(data []byte) (txbuilder.Action, error) {
+	a := &retireAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// retireAction spends funds from an account and retires them in a
+// single step, so the retired amount is recorded as a retirement
+// rather than as an ordinary output to an unspendable program.
+type retireAction struct {
+	accounts *Manager
+	bc.AssetAmount
+	AccountID     string        `json:"account_id"`
+	ReferenceData chainjson.Map `json:"reference_data"`
+	ClientToken   *string       `json:"client_token"`
+}
+
+func (a *retireAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	if a.Amount == 0 {
+		return txbuilder.MissingFieldsError("amount")
+	}
+
+	spend := a.accounts.NewSpendAction(a.AssetAmount, a.AccountID, nil, a.ClientToken)
+	if err := spend.Build(ctx, b); err != nil {
+		return err
+	}
+	return txbuilder.NewRetireAction(a.AssetAmount, a.ReferenceData).Build(ctx, b)
+}
+
 func (m *Manager) NewSpendUTXOAction(outputID bc.Hash) txbuilder.Action {
 	return &spendUTXOAction{
 		accounts: m,
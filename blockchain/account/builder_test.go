@@ -0,0 +1,65 @@
+package account
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestSpendRestrictedChange(t *testing.T) {
+	ctx := context.Background()
+	m := &Manager{
+		db:          dbm.NewMemDB(),
+		cache:       lru.New(maxAccountCache),
+		aliasCache:  lru.New(maxAccountCache),
+		delayedACPs: make(map[*txbuilder.TemplateBuilder][]*controlProgram),
+	}
+	m.utxoDB = newReserver(m.db, nil)
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.cache.Add("acc1", &signers.Signer{ID: "acc1", Type: "account", XPubs: []chainkd.XPub{xpub}, Quorum: 1})
+
+	holderPub, _, _ := ed25519.GenerateKey(nil)
+	issuerPub, _, _ := ed25519.GenerateKey(nil)
+	issuerPubkeys := []ed25519.PublicKey{issuerPub}
+	prog, err := vmutil.RestrictedTransferProgram([]ed25519.PublicKey{holderPub}, 1, issuerPubkeys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The account holds 10 units of a restricted asset in one output.
+	assetID := bc.AssetID{V0: 1}
+	u := &utxo{OutputID: bc.Hash{V0: 2}, AssetID: assetID, Amount: 10, ControlProgram: prog, AccountID: "acc1"}
+	sr := m.utxoDB.source(u.source())
+	sr.validFn = func(*utxo) bool { return true }
+	sr.cached[u.OutputID] = u
+
+	b := txbuilder.NewBuilder(time.Now().Add(time.Minute))
+	spend := m.NewSpendAction(bc.AssetAmount{AssetId: &assetID, Amount: 4}, "acc1", nil, nil)
+	if err := spend.Build(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	_, tx, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Outputs) != 1 || tx.Outputs[0].Amount != 6 {
+		t.Fatalf("outputs = %v, want change of 6", tx.Outputs)
+	}
+	_, _, changeIssuer, quorum, err := vmutil.ParseRestrictedTransferProgram(tx.Outputs[0].ControlProgram)
+	if err != nil || quorum != 1 || !vmutil.SamePubkeys(changeIssuer, issuerPubkeys) {
+		t.Errorf("change program %x is not a restricted transfer program of the issuer", tx.Outputs[0].ControlProgram)
+	}
+}
@@ -0,0 +1,451 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bytom/blockchain/blockwatch"
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+const (
+	htlcPrefix         = "htlc:"
+	htlcKeyPrefix      = "htlc_key:"
+	htlcBlockHeightKey = "htlc_block_height"
+)
+
+var (
+	ErrHTLCNotFound = errors.New("htlc not found")
+	ErrHTLCRole     = errors.New("account is not a party to this htlc branch")
+	ErrHTLCSpent    = errors.New("htlc has already been spent")
+	ErrBadPreimage  = errors.New("preimage does not match the htlc hash")
+)
+
+// HTLCKey is a set of account keys derived for one side of an HTLC.
+// A recipient gives its key to the sender, who locks funds to it.
+type HTLCKey struct {
+	AccountID string               `json:"account_id"`
+	KeyIndex  uint64               `json:"key_index"`
+	Pubkeys   []chainjson.HexBytes `json:"pubkeys"`
+	Quorum    int                  `json:"quorum"`
+}
+
+func (k *HTLCKey) pubkeys() []ed25519.PublicKey {
+	pubkeys := make([]ed25519.PublicKey, 0, len(k.Pubkeys))
+	for _, p := range k.Pubkeys {
+		pubkeys = append(pubkeys, ed25519.PublicKey(p))
+	}
+	return pubkeys
+}
+
+// HTLCOutput is an HTLC on chain in which an account of this core is
+// the recipient, the sender, or both.
+type HTLCOutput struct {
+	OutputID       bc.Hash            `json:"output_id"`
+	SourceID       bc.Hash            `json:"source_id"`
+	SourcePos      uint64             `json:"source_pos"`
+	AssetID        bc.AssetID         `json:"asset_id"`
+	Amount         uint64             `json:"amount"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	RefDataHash    bc.Hash            `json:"ref_data_hash"`
+	Hash           chainjson.HexBytes `json:"hash"`
+	Deadline       time.Time          `json:"deadline"`
+	RecipientKey   *HTLCKey           `json:"recipient_key,omitempty"`
+	SenderKey      *HTLCKey           `json:"sender_key,omitempty"`
+	BlockHeight    uint64             `json:"block_height"`
+	TxID           bc.Hash            `json:"transaction_id"`
+
+	// Spent is set once the HTLC is spent, in the block at
+	// SpentHeight.
+	Spent       bool   `json:"spent"`
+	SpentHeight uint64 `json:"spent_height,omitempty"`
+
+	// Preimage is set once the recipient has redeemed the HTLC,
+	// revealing the secret needed to complete the other side of
+	// an atomic swap. It is kept if the redeeming block is
+	// orphaned; the secret has been revealed all the same.
+	Preimage chainjson.HexBytes `json:"preimage,omitempty"`
+}
+
+// isHTLCKey reports whether key holds HTLC data rather than an
+// account.
+func isHTLCKey(key string) bool {
+	return strings.HasPrefix(key, htlcPrefix) || strings.HasPrefix(key, htlcKeyPrefix) || strings.HasPrefix(key, htlcBlockHeightKey)
+}
+
+func calcHTLCKey(outputID bc.Hash) []byte {
+	return []byte(htlcPrefix + outputID.String())
+}
+
+func calcHTLCKeyKey(pubkey []byte) []byte {
+	return []byte(htlcKeyPrefix + hex.EncodeToString(pubkey))
+}
+
+// CreateHTLCKey derives a new key for the account to use in an HTLC.
+func (m *Manager) CreateHTLCKey(ctx context.Context, accountID string) (*HTLCKey, error) {
+	account, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := m.nextIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path := signers.Path(account, signers.AccountKeySpace, idx)
+	k := &HTLCKey{AccountID: account.ID, KeyIndex: idx, Quorum: account.Quorum}
+	for _, pubkey := range chainkd.XPubKeys(chainkd.DeriveXPubs(account.XPubs, path)) {
+		k.Pubkeys = append(k.Pubkeys, chainjson.HexBytes(pubkey))
+	}
+	b, err := json.Marshal(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling htlc key")
+	}
+	m.db.SetSync(calcHTLCKeyKey(k.Pubkeys[0]), b)
+	return k, nil
+}
+
+// HTLCKeyPath returns the xpubs of k's account and the path along
+// which k was derived from them.
+func (m *Manager) HTLCKeyPath(ctx context.Context, k *HTLCKey) ([]chainkd.XPub, [][]byte, error) {
+	account, err := m.findByID(ctx, k.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account.XPubs, signers.Path(account, signers.AccountKeySpace, k.KeyIndex), nil
+}
+
+// findHTLCKey returns the account key with the given public keys, or
+// nil if it does not belong to this core.
+func (m *Manager) findHTLCKey(pubkeys []ed25519.PublicKey, quorum int) *HTLCKey {
+	if len(pubkeys) == 0 {
+		return nil
+	}
+	b := m.db.Get(calcHTLCKeyKey(pubkeys[0]))
+	if b == nil {
+		return nil
+	}
+	k := new(HTLCKey)
+	if err := json.Unmarshal(b, k); err != nil || k.Quorum != quorum || len(k.Pubkeys) != len(pubkeys) {
+		return nil
+	}
+	for i, p := range k.Pubkeys {
+		if !bytes.Equal(p, pubkeys[i]) {
+			return nil
+		}
+	}
+	return k
+}
+
+// FindHTLC returns the HTLC locked in the given output.
+func (m *Manager) FindHTLC(ctx context.Context, outputID bc.Hash) (*HTLCOutput, error) {
+	b := m.db.Get(calcHTLCKey(outputID))
+	if b == nil {
+		return nil, errors.WithDetailf(ErrHTLCNotFound, "output %s", outputID.String())
+	}
+	h := new(HTLCOutput)
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, errors.Wrap(err, "decoding htlc")
+	}
+	return h, nil
+}
+
+// HTLCs returns every HTLC in which accountID takes part, or every
+// known HTLC if accountID is empty.
+func (m *Manager) HTLCs(ctx context.Context, accountID string) ([]*HTLCOutput, error) {
+	var htlcs []*HTLCOutput
+	iter := m.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), htlcPrefix) {
+			continue
+		}
+		h := new(HTLCOutput)
+		if err := json.Unmarshal(iter.Value(), h); err != nil {
+			return nil, errors.Wrap(err, "decoding htlc")
+		}
+		if accountID == "" || (h.RecipientKey != nil && h.RecipientKey.AccountID == accountID) || (h.SenderKey != nil && h.SenderKey.AccountID == accountID) {
+			htlcs = append(htlcs, h)
+		}
+	}
+	return htlcs, nil
+}
+
+func (m *Manager) saveHTLC(h *HTLCOutput) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return errors.Wrap(err, "marshaling htlc")
+	}
+	m.db.Set(calcHTLCKey(h.OutputID), b)
+	return nil
+}
+
+// ProcessHTLCs watches each block committed to c for HTLCs involving
+// this core's accounts, starting after the last block watched in a
+// previous run. If c reorganizes, what was indexed from orphaned
+// blocks is rolled back. It returns when ctx is done.
+func (m *Manager) ProcessHTLCs(ctx context.Context, c blockwatch.Chain) {
+	w := &blockwatch.Watcher{
+		Name:     "htlc index",
+		Chain:    c,
+		DB:       m.db,
+		Key:      htlcBlockHeightKey,
+		Index:    m.indexHTLCs,
+		Rollback: m.rollbackHTLCs,
+	}
+	w.Run(ctx)
+}
+
+// indexHTLCs records new HTLCs involving this core's accounts and
+// marks spent ones, keeping the preimage of those redeemed.
+func (m *Manager) indexHTLCs(ctx context.Context, b *legacy.Block) error {
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			spentID, err := in.SpentOutputID()
+			if err != nil {
+				continue
+			}
+			h, err := m.FindHTLC(ctx, spentID)
+			if err != nil {
+				continue
+			}
+			h.Spent = true
+			h.SpentHeight = b.Height
+			if args := in.Arguments(); len(args) > 1 && len(args[1]) == 0 {
+				h.Preimage = args[0]
+			}
+			if err := m.saveHTLC(h); err != nil {
+				return err
+			}
+		}
+
+		for i, out := range tx.Outputs {
+			contract, err := vmutil.ParseHTLCProgram(out.ControlProgram)
+			if err != nil {
+				continue
+			}
+			recipient := m.findHTLCKey(contract.RecipientPubkeys, contract.RecipientQuorum)
+			sender := m.findHTLCKey(contract.SenderPubkeys, contract.SenderQuorum)
+			if recipient == nil && sender == nil {
+				continue
+			}
+			resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+			if !ok {
+				continue
+			}
+			h := &HTLCOutput{
+				OutputID:       *tx.OutputID(i),
+				SourceID:       *resOut.Source.Ref,
+				SourcePos:      resOut.Source.Position,
+				AssetID:        *out.AssetId,
+				Amount:         out.Amount,
+				ControlProgram: out.ControlProgram,
+				RefDataHash:    *resOut.Data,
+				Hash:           contract.Hash,
+				Deadline:       time.Unix(0, int64(contract.Deadline)*int64(time.Millisecond)).UTC(),
+				RecipientKey:   recipient,
+				SenderKey:      sender,
+				BlockHeight:    b.Height,
+				TxID:           tx.ID,
+			}
+			if err := m.saveHTLC(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manager) DecodeControlHTLCAction(data []byte) (txbuilder.Action, error) {
+	a := &controlHTLCAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// controlHTLCAction locks funds in an HTLC payable to the recipient's
+// keys, refundable to a new key of the sending account.
+type controlHTLCAction struct {
+	accounts *Manager
+	bc.AssetAmount
+	AccountID        string               `json:"account_id"`
+	Hash             chainjson.HexBytes   `json:"hash"`
+	Deadline         time.Time            `json:"deadline"`
+	RecipientPubkeys []chainjson.HexBytes `json:"recipient_pubkeys"`
+	RecipientQuorum  int                  `json:"recipient_quorum"`
+	ReferenceData    chainjson.Map        `json:"reference_data"`
+}
+
+func (a *controlHTLCAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	var missing []string
+	if a.AccountID == "" {
+		missing = append(missing, "account_id")
+	}
+	if a.AssetId.IsZero() {
+		missing = append(missing, "asset_id")
+	}
+	if len(a.Hash) == 0 {
+		missing = append(missing, "hash")
+	}
+	if a.Deadline.IsZero() {
+		missing = append(missing, "deadline")
+	}
+	if len(a.RecipientPubkeys) == 0 {
+		missing = append(missing, "recipient_pubkeys")
+	}
+	if len(missing) > 0 {
+		return txbuilder.MissingFieldsError(missing...)
+	}
+
+	sender, err := a.accounts.CreateHTLCKey(ctx, a.AccountID)
+	if err != nil {
+		return err
+	}
+	recipient := &HTLCKey{Pubkeys: a.RecipientPubkeys, Quorum: a.RecipientQuorum}
+	if recipient.Quorum == 0 {
+		recipient.Quorum = len(recipient.Pubkeys)
+	}
+	prog, err := vmutil.HTLCProgram(&vmutil.HTLC{
+		Hash:             a.Hash,
+		Deadline:         bc.Millis(a.Deadline),
+		RecipientPubkeys: recipient.pubkeys(),
+		RecipientQuorum:  recipient.Quorum,
+		SenderPubkeys:    sender.pubkeys(),
+		SenderQuorum:     sender.Quorum,
+	})
+	if err != nil {
+		return err
+	}
+	return b.AddOutput(legacy.NewTxOutput(*a.AssetId, a.Amount, prog, a.ReferenceData))
+}
+
+func (m *Manager) DecodeRedeemHTLCAction(data []byte) (txbuilder.Action, error) {
+	a := &redeemHTLCAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// redeemHTLCAction claims an HTLC as its recipient by revealing the
+// preimage of its hash.
+type redeemHTLCAction struct {
+	accounts      *Manager
+	OutputID      *bc.Hash           `json:"output_id"`
+	Preimage      chainjson.HexBytes `json:"preimage"`
+	ReferenceData chainjson.Map      `json:"reference_data"`
+}
+
+func (a *redeemHTLCAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	var missing []string
+	if a.OutputID == nil {
+		missing = append(missing, "output_id")
+	}
+	if len(a.Preimage) == 0 {
+		missing = append(missing, "preimage")
+	}
+	if len(missing) > 0 {
+		return txbuilder.MissingFieldsError(missing...)
+	}
+
+	h, err := a.accounts.spendableHTLC(ctx, *a.OutputID)
+	if err != nil {
+		return err
+	}
+	if h.RecipientKey == nil {
+		return errors.WithDetail(ErrHTLCRole, "no account of this core is the recipient")
+	}
+	if hash := sha256.Sum256(a.Preimage); !bytes.Equal(hash[:], h.Hash) {
+		return errors.Wrap(ErrBadPreimage)
+	}
+	return a.accounts.addHTLCInput(ctx, b, h, h.RecipientKey, []chainjson.HexBytes{a.Preimage, {}}, a.ReferenceData)
+}
+
+func (m *Manager) DecodeRefundHTLCAction(data []byte) (txbuilder.Action, error) {
+	a := &refundHTLCAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// refundHTLCAction reclaims an HTLC as its sender once its deadline
+// has passed.
+type refundHTLCAction struct {
+	accounts      *Manager
+	OutputID      *bc.Hash      `json:"output_id"`
+	ReferenceData chainjson.Map `json:"reference_data"`
+}
+
+func (a *refundHTLCAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	if a.OutputID == nil {
+		return txbuilder.MissingFieldsError("output_id")
+	}
+
+	h, err := a.accounts.spendableHTLC(ctx, *a.OutputID)
+	if err != nil {
+		return err
+	}
+	if h.SenderKey == nil {
+		return errors.WithDetail(ErrHTLCRole, "no account of this core is the sender")
+	}
+
+	// The refund branch checks the transaction's mintime, not the
+	// time of the block that includes it.
+	b.RestrictMinTime(h.Deadline)
+	return a.accounts.addHTLCInput(ctx, b, h, h.SenderKey, []chainjson.HexBytes{{}, {vmutil.HTLCRefund}}, a.ReferenceData)
+}
+
+func (m *Manager) spendableHTLC(ctx context.Context, outputID bc.Hash) (*HTLCOutput, error) {
+	h, err := m.FindHTLC(ctx, outputID)
+	if err != nil {
+		return nil, err
+	}
+	if h.Spent {
+		return nil, errors.WithDetailf(ErrHTLCSpent, "output %s", outputID.String())
+	}
+	return h, nil
+}
+
+// addHTLCInput spends h, signing with k and passing args ahead of
+// the signatures to select the branch.
+func (m *Manager) addHTLCInput(ctx context.Context, b *txbuilder.TemplateBuilder, h *HTLCOutput, k *HTLCKey, args []chainjson.HexBytes, refData []byte) error {
+	account, err := m.findByID(ctx, k.AccountID)
+	if err != nil {
+		return errors.Wrap(err, "get account info")
+	}
+
+	txInput := legacy.NewSpendInput(nil, h.SourceID, h.AssetID, h.Amount, h.SourcePos, h.ControlProgram, h.RefDataHash, refData)
+	sigInst := &txbuilder.SigningInstruction{Arguments: args}
+	path := signers.Path(account, signers.AccountKeySpace, k.KeyIndex)
+	sigInst.AddWitnessKeys(account.XPubs, path, account.Quorum)
+	return b.AddInput(txInput, sigInst)
+}
+
+// rollbackHTLCs forgets the HTLCs indexed from blocks after height
+// and marks unspent those spent after it.
+func (m *Manager) rollbackHTLCs(ctx context.Context, height uint64) error {
+	htlcs, err := m.HTLCs(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, h := range htlcs {
+		switch {
+		case h.BlockHeight > height:
+			m.db.Delete(calcHTLCKey(h.OutputID))
+		case h.Spent && h.SpentHeight > height:
+			h.Spent, h.SpentHeight = false, 0
+			if err := m.saveHTLC(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
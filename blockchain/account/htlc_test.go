@@ -0,0 +1,131 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestHTLCLifecycle(t *testing.T) {
+	ctx := context.Background()
+	m := &Manager{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAccountCache),
+		aliasCache: lru.New(maxAccountCache),
+	}
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.cache.Add("acc1", &signers.Signer{ID: "acc1", Type: "account", XPubs: []chainkd.XPub{xpub}, Quorum: 1})
+
+	recipient, err := m.CreateHTLCKey(ctx, "acc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderPub, _, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("swap secret")
+	hash := sha256.Sum256(preimage)
+	deadline := time.Now().Add(time.Hour)
+	prog, err := vmutil.HTLCProgram(&vmutil.HTLC{
+		Hash:             hash[:],
+		Deadline:         bc.Millis(deadline),
+		RecipientPubkeys: recipient.pubkeys(),
+		RecipientQuorum:  1,
+		SenderPubkeys:    []ed25519.PublicKey{senderPub},
+		SenderQuorum:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assetID := bc.AssetID{V0: 1}
+	lock := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 9}, assetID, 5, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 5, prog, nil)},
+	})
+	if err := m.indexHTLCs(ctx, &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1}, Transactions: []*legacy.Tx{lock}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := m.FindHTLC(ctx, *lock.OutputID(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.RecipientKey == nil || h.SenderKey != nil || h.Amount != 5 || h.Deadline.Unix() != deadline.Unix() {
+		t.Errorf("FindHTLC = %+v, want an incoming htlc of 5 units", h)
+	}
+
+	// Only this core's side of the contract can be taken.
+	refund := &refundHTLCAction{accounts: m, OutputID: &h.OutputID}
+	if _, err := txbuilder.Build(ctx, nil, []txbuilder.Action{refund}, time.Now().Add(time.Minute)); errors.Root(err) != txbuilder.ErrAction {
+		t.Errorf("refund by recipient: got error %v, want %v", err, txbuilder.ErrAction)
+	}
+
+	redeem := &redeemHTLCAction{accounts: m, OutputID: &h.OutputID, Preimage: []byte("guess")}
+	if err := redeem.Build(ctx, txbuilder.NewBuilder(time.Now().Add(time.Minute))); errors.Root(err) != ErrBadPreimage {
+		t.Errorf("redeem with wrong preimage: got error %v, want %v", err, ErrBadPreimage)
+	}
+	redeem.Preimage = preimage
+	tpl, err := txbuilder.Build(ctx, nil, []txbuilder.Action{redeem}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := tpl.SigningInstructions[0].Arguments
+	if len(args) != 2 || string(args[0]) != string(preimage) || len(args[1]) != 0 {
+		t.Errorf("redeem arguments = %x, want [preimage, redeem branch]", args)
+	}
+
+	// The spend reveals the preimage on chain.
+	spend := tpl.Transaction
+	if spentID, _ := spend.Inputs[0].SpentOutputID(); spentID != h.OutputID {
+		t.Fatalf("redeem spends %x, want %x", spentID.Bytes(), h.OutputID.Bytes())
+	}
+	spend.Inputs[0].SetArguments([][]byte{preimage, {}, {2}, {}, {}})
+	if err := m.indexHTLCs(ctx, &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 2}, Transactions: []*legacy.Tx{spend}}); err != nil {
+		t.Fatal(err)
+	}
+	h, err = m.FindHTLC(ctx, h.OutputID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Spent || string(h.Preimage) != string(preimage) {
+		t.Errorf("after redeem: spent=%v preimage=%q", h.Spent, h.Preimage)
+	}
+	if err := redeem.Build(ctx, txbuilder.NewBuilder(time.Now().Add(time.Minute))); errors.Root(err) != ErrHTLCSpent {
+		t.Errorf("redeem spent htlc: got error %v, want %v", err, ErrHTLCSpent)
+	}
+
+	// If the redeeming block is orphaned, the htlc is unspent again but
+	// the revealed preimage is kept; orphaning the lock forgets it.
+	if err := m.rollbackHTLCs(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	h, err = m.FindHTLC(ctx, h.OutputID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Spent || string(h.Preimage) != string(preimage) {
+		t.Errorf("after rollback to 1: spent=%v preimage=%q, want unspent with preimage", h.Spent, h.Preimage)
+	}
+	if err := m.rollbackHTLCs(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.FindHTLC(ctx, h.OutputID); errors.Root(err) != ErrHTLCNotFound {
+		t.Errorf("after rollback to 0: got error %v, want %v", err, ErrHTLCNotFound)
+	}
+}
@@ -74,7 +74,7 @@ type reservation struct {
 	ClientToken *string
 }
 
-func newReserver(db dbm.DB, c *protocol.Chain /*pinStore *pin.Store*/) *reserver {
+func newReserver(db dbm.DB, c protocol.BlockReader /*pinStore *pin.Store*/) *reserver {
 	return &reserver{
 		c:  c,
 		db: db,
@@ -95,7 +95,7 @@ func newReserver(db dbm.DB, c *protocol.Chain /*pinStore *pin.Store*/) *reserver
 // reserver ensures idempotency of reservations until the reservation
 // expiration.
 type reserver struct {
-	c  *protocol.Chain
+	c  protocol.BlockReader
 	db dbm.DB
 	//pinStore          *pin.Store
 	nextReservationID uint64
@@ -0,0 +1,324 @@
+package asset
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bytom/crypto/sha3pool"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// AliasOperationKey is the top-level key, in a transaction's
+// reference data, under which an asset alias operation is published.
+const AliasOperationKey = "asset_alias"
+
+// Alias operation types.
+const (
+	AliasRegister = "register"
+	AliasTransfer = "transfer"
+)
+
+const (
+	aliasPrefix        = "asset_alias:"
+	aliasHistoryPrefix = "asset_alias_history:"
+)
+
+var (
+	ErrBadAlias          = errors.New("invalid asset alias")
+	ErrAliasTaken        = errors.New("asset alias is already registered")
+	ErrAliasNotFound     = errors.New("asset alias is not registered")
+	ErrBadAliasSequence  = errors.New("asset alias operation has the wrong sequence number")
+	ErrBadAliasSignature = errors.New("asset alias operation is not signed by a quorum of issuance keys")
+)
+
+// Aliases are lower case so that two aliases that look alike to a
+// user cannot both be registered.
+var aliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// AliasOperation registers or transfers an on-chain asset alias.
+//
+// Aliases are first come, first served: a register operation for an
+// unregistered alias, signed by a quorum of the issuance keys of
+// AssetID, claims it with sequence number 0. Only the owner of an
+// alias can point it at another asset. A transfer operation must be
+// signed by a quorum of the issuance keys of the asset the alias
+// currently names, and carry the next sequence number, which
+// prevents old transfers from being replayed.
+type AliasOperation struct {
+	Type       string               `json:"type"`
+	Alias      string               `json:"alias"`
+	AssetID    bc.AssetID           `json:"asset_id"`
+	Sequence   uint64               `json:"sequence"`
+	Signatures []chainjson.HexBytes `json:"signatures"`
+}
+
+// SigningHash returns the message signed by the issuance keys.
+func (op *AliasOperation) SigningHash() (hash bc.Hash) {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], op.Sequence)
+
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+	h.Write([]byte(AliasOperationKey))
+	h.Write([]byte{byte(len(op.Type))})
+	h.Write([]byte(op.Type))
+	h.Write([]byte{byte(len(op.Alias))})
+	h.Write([]byte(op.Alias))
+	h.Write(op.AssetID.Bytes())
+	h.Write(seq[:])
+	hash.ReadFrom(h)
+	return hash
+}
+
+// AliasRecord is the current owner of an on-chain alias.
+type AliasRecord struct {
+	Alias       string     `json:"alias"`
+	AssetID     bc.AssetID `json:"asset_id"`
+	Sequence    uint64     `json:"sequence"`
+	BlockHeight uint64     `json:"block_height"`
+	TxID        bc.Hash    `json:"transaction_id"`
+}
+
+// ValidateAlias checks that alias is well formed.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return errors.WithDetailf(ErrBadAlias, "alias %q must be 1 to 64 lower case letters, digits, '.', '_' or '-', starting with a letter or digit", alias)
+	}
+	return nil
+}
+
+func calcAliasKey(alias string) []byte {
+	return []byte(aliasPrefix + alias)
+}
+
+func calcAliasHistoryKey(alias string, seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%s:%020d", aliasHistoryPrefix, alias, seq))
+}
+
+// ResolveAlias returns the current registration of alias.
+func (reg *Registry) ResolveAlias(ctx context.Context, alias string) (*AliasRecord, error) {
+	b := reg.db.Get(calcAliasKey(alias))
+	if b == nil {
+		return nil, errors.WithDetailf(ErrAliasNotFound, "alias %q", alias)
+	}
+	rec := new(AliasRecord)
+	if err := json.Unmarshal(b, rec); err != nil {
+		return nil, errors.Wrap(err, "decoding asset alias")
+	}
+	return rec, nil
+}
+
+// ListAliases returns every registered alias, in alphabetical order.
+func (reg *Registry) ListAliases(ctx context.Context) ([]*AliasRecord, error) {
+	var recs []*AliasRecord
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), aliasPrefix) {
+			continue
+		}
+		rec := new(AliasRecord)
+		if err := json.Unmarshal(iter.Value(), rec); err != nil {
+			return nil, errors.Wrap(err, "decoding asset alias")
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// NewAliasOperation prepares an unsigned alias operation, along with
+// the keys that must sign it. Registrations are signed by the keys of
+// the named asset, transfers by the keys of the current owner.
+func (reg *Registry) NewAliasOperation(ctx context.Context, typ, alias string, id bc.AssetID) (*AliasOperation, []SigningKey, error) {
+	if err := ValidateAlias(alias); err != nil {
+		return nil, nil, err
+	}
+	op := &AliasOperation{Type: typ, Alias: alias, AssetID: id}
+
+	signer, err := reg.aliasSigner(ctx, op)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := reg.issuerSigningKeys(ctx, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return op, keys, nil
+}
+
+// SignAliasOperation adds signatures to op for each of the signing
+// asset's keys that signFn holds.
+func (reg *Registry) SignAliasOperation(ctx context.Context, op *AliasOperation, signFn SignFunc) error {
+	signer, err := reg.aliasSigner(ctx, op)
+	if err != nil {
+		return err
+	}
+	sigs, err := reg.signAsIssuer(ctx, signer, op.SigningHash(), signFn)
+	if err != nil {
+		return err
+	}
+	op.Signatures = append(op.Signatures, sigs...)
+	return nil
+}
+
+// aliasSigner returns the asset whose issuance keys must sign op.
+// For transfers it also sets op's sequence number if it is unset.
+func (reg *Registry) aliasSigner(ctx context.Context, op *AliasOperation) (bc.AssetID, error) {
+	switch op.Type {
+	case AliasRegister:
+		if _, err := reg.ResolveAlias(ctx, op.Alias); err == nil {
+			return bc.AssetID{}, errors.WithDetailf(ErrAliasTaken, "alias %q", op.Alias)
+		}
+		return op.AssetID, nil
+	case AliasTransfer:
+		current, err := reg.ResolveAlias(ctx, op.Alias)
+		if err != nil {
+			return bc.AssetID{}, err
+		}
+		if op.Sequence == 0 {
+			op.Sequence = current.Sequence + 1
+		}
+		return current.AssetID, nil
+	}
+	return bc.AssetID{}, errors.WithDetailf(ErrBadAlias, "unknown alias operation type %q", op.Type)
+}
+
+// checkAliasOperation validates op against the current registration
+// of its alias and the issuance program of the signing asset.
+func (reg *Registry) checkAliasOperation(ctx context.Context, op *AliasOperation) error {
+	if err := ValidateAlias(op.Alias); err != nil {
+		return err
+	}
+	if _, err := reg.findByID(ctx, op.AssetID); err != nil {
+		return err
+	}
+
+	var want uint64
+	signer := op.AssetID
+	switch op.Type {
+	case AliasRegister:
+		if _, err := reg.ResolveAlias(ctx, op.Alias); err == nil {
+			return errors.WithDetailf(ErrAliasTaken, "alias %q", op.Alias)
+		}
+	case AliasTransfer:
+		current, err := reg.ResolveAlias(ctx, op.Alias)
+		if err != nil {
+			return err
+		}
+		want = current.Sequence + 1
+		signer = current.AssetID
+	default:
+		return errors.WithDetailf(ErrBadAlias, "unknown alias operation type %q", op.Type)
+	}
+	if op.Sequence != want {
+		return errors.WithDetailf(ErrBadAliasSequence, "sequence %d, want %d", op.Sequence, want)
+	}
+
+	asset, err := reg.findByID(ctx, signer)
+	if err != nil {
+		return err
+	}
+	valid, quorum, err := countIssuerSignatures(asset.IssuanceProgram, op.SigningHash(), op.Signatures)
+	if err != nil {
+		return err
+	}
+	if valid < quorum {
+		return errors.WithDetailf(ErrBadAliasSignature, "%d valid signatures, quorum is %d", valid, quorum)
+	}
+	return nil
+}
+
+// applyAliasOperation validates and stores op, recording where it
+// was published. Every registration and transfer is also kept, so
+// that the alias can be returned to its previous owner if the block
+// publishing op is orphaned.
+func (reg *Registry) applyAliasOperation(ctx context.Context, op *AliasOperation, height uint64, txID bc.Hash) error {
+	if err := reg.checkAliasOperation(ctx, op); err != nil {
+		return err
+	}
+
+	rec := &AliasRecord{
+		Alias:       op.Alias,
+		AssetID:     op.AssetID,
+		Sequence:    op.Sequence,
+		BlockHeight: height,
+		TxID:        txID,
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "marshaling asset alias")
+	}
+	reg.db.Set(calcAliasHistoryKey(op.Alias, op.Sequence), b)
+	reg.db.SetSync(calcAliasKey(op.Alias), b)
+
+	reg.cacheMu.Lock()
+	reg.aliasCache.Remove(op.Alias)
+	reg.cacheMu.Unlock()
+	return nil
+}
+
+// indexAliasOperations applies every valid alias operation published
+// in b, in transaction order. Invalid operations are ignored.
+func (reg *Registry) indexAliasOperations(ctx context.Context, b *legacy.Block) {
+	for _, tx := range b.Transactions {
+		op := new(AliasOperation)
+		if !refDataField(tx, AliasOperationKey, op) {
+			continue
+		}
+		reg.applyAliasOperation(ctx, op, b.Height, tx.ID)
+	}
+}
+
+// rollbackAliasOperations undoes the alias operations indexed from
+// blocks after height, returning each alias to its owner before the
+// fork, or unregistering it.
+func (reg *Registry) rollbackAliasOperations(ctx context.Context, height uint64) error {
+	var (
+		drop    [][]byte
+		changed = make(map[string]bool)
+		latest  = make(map[string]*AliasRecord)
+	)
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), aliasHistoryPrefix) {
+			continue
+		}
+		rec := new(AliasRecord)
+		if err := json.Unmarshal(iter.Value(), rec); err != nil {
+			return errors.Wrap(err, "decoding asset alias")
+		}
+		if rec.BlockHeight > height {
+			changed[rec.Alias] = true
+			drop = append(drop, append([]byte(nil), iter.Key()...))
+			continue
+		}
+		if l, ok := latest[rec.Alias]; !ok || rec.Sequence > l.Sequence {
+			latest[rec.Alias] = rec
+		}
+	}
+
+	for _, key := range drop {
+		reg.db.Delete(key)
+	}
+	for alias := range changed {
+		if rec, ok := latest[alias]; ok {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return errors.Wrap(err, "marshaling asset alias")
+			}
+			reg.db.Set(calcAliasKey(alias), b)
+		} else {
+			reg.db.Delete(calcAliasKey(alias))
+		}
+		reg.cacheMu.Lock()
+		reg.aliasCache.Remove(alias)
+		reg.cacheMu.Unlock()
+	}
+	return nil
+}
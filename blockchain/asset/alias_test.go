@@ -0,0 +1,126 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+)
+
+type testIssuer struct {
+	xprv  chainkd.XPrv
+	asset *Asset
+}
+
+func newTestIssuer(t *testing.T, reg *Registry, seed byte) *testIssuer {
+	xprv, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, vmver, err := multisigIssuanceProgram(chainkd.XPubKeys([]chainkd.XPub{xpub}), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Asset{
+		AssetID:         bc.NewAssetID([32]byte{seed}),
+		VMVersion:       vmver,
+		IssuanceProgram: prog,
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.db.Set([]byte(a.AssetID.String()), b)
+	return &testIssuer{xprv: xprv, asset: a}
+}
+
+func (iss *testIssuer) sign(op *AliasOperation) {
+	msg := op.SigningHash()
+	op.Signatures = append(op.Signatures, chainjson.HexBytes(iss.xprv.Sign(msg.Bytes())))
+}
+
+func TestAliasRegisterAndTransfer(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+	gold := newTestIssuer(t, reg, 1)
+	silver := newTestIssuer(t, reg, 2)
+
+	// Registration must be signed by the named asset's issuer.
+	op := &AliasOperation{Type: AliasRegister, Alias: "gold", AssetID: gold.asset.AssetID}
+	silver.sign(op)
+	if err := reg.applyAliasOperation(ctx, op, 1, bc.Hash{}); errors.Root(err) != ErrBadAliasSignature {
+		t.Fatalf("register signed by other issuer: got error %v, want %v", err, ErrBadAliasSignature)
+	}
+	op.Signatures = nil
+	gold.sign(op)
+	if err := reg.applyAliasOperation(ctx, op, 1, bc.Hash{}); err != nil {
+		t.Fatalf("register: got error %v", err)
+	}
+
+	// First come, first served.
+	op = &AliasOperation{Type: AliasRegister, Alias: "gold", AssetID: silver.asset.AssetID}
+	silver.sign(op)
+	if err := reg.applyAliasOperation(ctx, op, 2, bc.Hash{}); errors.Root(err) != ErrAliasTaken {
+		t.Fatalf("register taken alias: got error %v, want %v", err, ErrAliasTaken)
+	}
+
+	// Only the current owner can transfer the alias.
+	op = &AliasOperation{Type: AliasTransfer, Alias: "gold", AssetID: silver.asset.AssetID, Sequence: 1}
+	silver.sign(op)
+	if err := reg.applyAliasOperation(ctx, op, 2, bc.Hash{}); errors.Root(err) != ErrBadAliasSignature {
+		t.Fatalf("transfer signed by new owner: got error %v, want %v", err, ErrBadAliasSignature)
+	}
+	op.Signatures = nil
+	gold.sign(op)
+	if err := reg.applyAliasOperation(ctx, op, 2, bc.Hash{}); err != nil {
+		t.Fatalf("transfer: got error %v", err)
+	}
+
+	// Replaying the same transfer fails on the sequence number.
+	if err := reg.applyAliasOperation(ctx, op, 3, bc.Hash{}); errors.Root(err) != ErrBadAliasSequence {
+		t.Fatalf("replayed transfer: got error %v, want %v", err, ErrBadAliasSequence)
+	}
+
+	rec, err := reg.ResolveAlias(ctx, "gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.AssetID != silver.asset.AssetID || rec.Sequence != 1 || rec.BlockHeight != 2 {
+		t.Errorf("ResolveAlias = %+v, want silver at sequence 1, height 2", rec)
+	}
+	a, err := reg.FindByAlias(ctx, "gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AssetID != silver.asset.AssetID {
+		t.Errorf("FindByAlias = %x, want %x", a.AssetID.Bytes(), silver.asset.AssetID.Bytes())
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	cases := map[string]bool{
+		"gold":                   true,
+		"usd.coin-2":             true,
+		"":                       false,
+		"Gold":                   false,
+		".gold":                  false,
+		"gold coin":              false,
+		string(make([]byte, 65)): false,
+	}
+	for alias, ok := range cases {
+		if err := ValidateAlias(alias); (err == nil) != ok {
+			t.Errorf("ValidateAlias(%q) = %v, want ok=%v", alias, err, ok)
+		}
+	}
+}
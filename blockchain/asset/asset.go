@@ -3,6 +3,7 @@ package asset
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"sync"
 
 	"golang.org/x/crypto/sha3"
@@ -28,11 +29,13 @@ var (
 	ErrBadIdentifier  = errors.New("either ID or alias must be specified, and not both")
 )
 
-func NewRegistry(db dbm.DB, chain *protocol.Chain) *Registry {
+// NewRegistry returns a registry of the assets of chain, whose
+// initial block is initialBlockHash.
+func NewRegistry(db dbm.DB, chain protocol.BlockReader, initialBlockHash bc.Hash) *Registry {
 	return &Registry{
 		db:               db,
 		chain:            chain,
-		initialBlockHash: chain.InitialBlockHash,
+		initialBlockHash: initialBlockHash,
 		cache:            lru.New(maxAssetCache),
 		aliasCache:       lru.New(maxAssetCache),
 	}
@@ -41,7 +44,7 @@ func NewRegistry(db dbm.DB, chain *protocol.Chain) *Registry {
 // Registry tracks and stores all known assets on a blockchain.
 type Registry struct {
 	db               dbm.DB
-	chain            *protocol.Chain
+	chain            protocol.BlockReader
 	indexer          Saver
 	initialBlockHash bc.Hash
 
@@ -94,8 +97,11 @@ func (asset *Asset) SetDefinition(def map[string]interface{}) error {
 	return nil
 }
 
-// Define defines a new Asset.
-func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum int, definition map[string]interface{}, alias string, tags map[string]interface{}, clientToken string) (*Asset, error) {
+// Define defines a new Asset. If maxSupply is non-nil, the asset's
+// issuance program caps the total amount that can ever be issued.
+// If restricted is set, every transfer of the asset must be
+// co-signed by its issuer.
+func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum int, maxSupply *uint64, restricted bool, definition map[string]interface{}, alias string, tags map[string]interface{}, clientToken string) (*Asset, error) {
 	assetSigner, err := signers.Create(ctx, reg.db, "asset", xpubs, quorum, clientToken)
 	if err != nil {
 		return nil, err
@@ -113,6 +119,18 @@ func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum in
 	if err != nil {
 		return nil, err
 	}
+	if restricted {
+		issuanceProgram, err = vmutil.RestrictedIssuanceProgram(issuanceProgram)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if maxSupply != nil {
+		issuanceProgram, err = vmutil.IssuanceCapProgram(*maxSupply, issuanceProgram)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	defhash := bc.NewHash(sha3.Sum256(rawDefinition))
 	asset := &Asset{
@@ -216,6 +234,11 @@ func (reg *Registry) UpdateTags(ctx context.Context, id, alias *string, tags map
 
 }
 
+// FindByID retrieves an Asset record along with its signer, given an assetID.
+func (reg *Registry) FindByID(ctx context.Context, id bc.AssetID) (*Asset, error) {
+	return reg.findByID(ctx, id)
+}
+
 // findByID retrieves an Asset record along with its signer, given an assetID.
 func (reg *Registry) findByID(ctx context.Context, id bc.AssetID) (*Asset, error) {
 	reg.cacheMu.Lock()
@@ -237,13 +260,13 @@ func (reg *Registry) findByID(ctx context.Context, id bc.AssetID) (*Asset, error
 	}
 
 	reg.cacheMu.Lock()
-	reg.cache.Add(id, asset)
+	reg.cache.Add(id, &asset)
 	reg.cacheMu.Unlock()
 	return &asset, nil
 }
 
 // FindByAlias retrieves an Asset record along with its signer,
-// given an asset alias.
+// given an on-chain asset alias.
 
 func (reg *Registry) FindByAlias(ctx context.Context, alias string) (*Asset, error) {
 	reg.cacheMu.Lock()
@@ -256,7 +279,11 @@ func (reg *Registry) FindByAlias(ctx context.Context, alias string) (*Asset, err
 	untypedAsset, err := reg.aliasGroup.Do(alias, func() (interface{}, error) {
 //		asset, err := assetQuery(ctx, reg.db, "assets.alias=$1", alias)
 //		return asset, err
-		return nil,nil
+		rec, err := reg.ResolveAlias(ctx, alias)
+		if err != nil {
+			return nil, err
+		}
+		return reg.findByID(ctx, rec.AssetID)
 	})
 
 	if err != nil {
@@ -277,6 +304,9 @@ func (reg *Registry) QueryAll(ctx context.Context) (interface{}, error){
 
 	iter := reg.db.Iterator()
 	for iter.Next() {
+		if isReservedKey(iter.Key()) {
+			continue
+		}
 		value := string(iter.Value())
 		ret = append(ret,value)
 		//log.Printf(ctx,"%s\t", value)
@@ -285,6 +315,29 @@ func (reg *Registry) QueryAll(ctx context.Context) (interface{}, error){
 	return ret,nil
 }
 
+// reservedKeyPrefixes lists the prefixes of registry database keys
+// that hold something other than an asset record.
+var reservedKeyPrefixes = []string{
+	definitionPrefix,
+	latestDefinitionPrefix,
+	aliasPrefix,
+	supplyPrefix,
+	retirementPrefix,
+	ownerPrefix,
+	transferPrefix,
+	whitelistPrefix,
+	blockHeightKey,
+}
+
+func isReservedKey(key []byte) bool {
+	for _, prefix := range reservedKeyPrefixes {
+		if strings.HasPrefix(string(key), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // insertAsset adds the asset to the database. If the asset has a client token,
 // and there already exists an asset with that client token, insertAsset will
 // lookup and return the existing asset instead.
@@ -6,13 +6,15 @@ import (
 
 //	"github.com/lib/pq"
 
+	"github.com/bytom/blockchain/blockwatch"
 	"github.com/bytom/blockchain/query"
 	"github.com/bytom/blockchain/signers"
 //	"chain/database/pg"
 	chainjson "github.com/bytom/encoding/json"
-//	"github.com/bytom/errors"
-//	"github.com/bytom/protocol/bc"
-//	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
 	"github.com/bytom/protocol/vm/vmutil"
 )
 
@@ -38,6 +40,9 @@ func Annotated(a *Asset) (*query.AnnotatedAsset, error) {
 		jsonDefinition = json.RawMessage(a.RawDefinition())
 	}
 */
+	if isJSONObject(a.RawDefinition()) {
+		jsonDefinition = json.RawMessage(a.RawDefinition())
+	}
 	if a.Tags != nil {
 		b, err := json.Marshal(a.Tags)
 		if err != nil {
@@ -55,6 +60,11 @@ func Annotated(a *Asset) (*query.AnnotatedAsset, error) {
 	if a.Alias != nil {
 		aa.Alias = *a.Alias
 	}
+	if maxSupply, ok := vmutil.ParseIssuanceCap(a.IssuanceProgram); ok {
+		aa.MaxSupply = &maxSupply
+		aa.IsUnique = maxSupply == 1
+	}
+	aa.IsRestricted = query.Bool(isRestricted(a))
 	if a.Signer != nil {
 		path := signers.Path(a.Signer, signers.AssetKeySpace)
 		var jsonPath []chainjson.HexBytes
@@ -86,6 +96,34 @@ func Annotated(a *Asset) (*query.AnnotatedAsset, error) {
 	return aa, nil
 }
 
+// AnnotatedLatest is like Annotated, but reports the most recent
+// published definition of a instead of the one it was issued with.
+func (reg *Registry) AnnotatedLatest(ctx context.Context, a *Asset) (*query.AnnotatedAsset, error) {
+	aa, err := Annotated(a)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := reg.LatestDefinition(ctx, a.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	if isJSONObject(dv.RawDefinition) {
+		jsonDefinition := json.RawMessage(dv.RawDefinition)
+		aa.Definition = &jsonDefinition
+	}
+	aa.DefinitionVersion = dv.Version
+	if aa.MaxSupply != nil {
+		issued := reg.issued(a.AssetID)
+		aa.Issued = &issued
+	}
+	return aa, nil
+}
+
+func isJSONObject(b []byte) bool {
+	var v map[string]interface{}
+	return len(b) > 0 && json.Unmarshal(b, &v) == nil
+}
+
 func (reg *Registry) indexAnnotatedAsset(ctx context.Context, a *Asset) error {
 	if reg.indexer == nil {
 		return nil
@@ -96,89 +134,97 @@ func (reg *Registry) indexAnnotatedAsset(ctx context.Context, a *Asset) error {
 	}
 	return reg.indexer.SaveAnnotatedAsset(ctx, aa, a.sortID)
 }
-/*
-func (reg *Registry) ProcessBlocks(ctx context.Context) {
-	if reg.pinStore == nil {
-		return
+// blockHeightKey stores the height of the last block indexed by
+// ProcessBlocks.
+const blockHeightKey = "asset_block_height"
+
+// ProcessBlocks indexes each block as it is committed to c, starting
+// after the last block indexed in a previous run. If c reorganizes,
+// what was indexed from orphaned blocks is rolled back. It returns
+// when ctx is done.
+func (reg *Registry) ProcessBlocks(ctx context.Context, c blockwatch.Chain) {
+	w := &blockwatch.Watcher{
+		Name:  "asset index",
+		Chain: c,
+		DB:    reg.db,
+		Key:   blockHeightKey,
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			reg.indexBlock(ctx, b)
+			return nil
+		},
+		Rollback: reg.rollbackBlocks,
 	}
-	reg.pinStore.ProcessBlocks(ctx, reg.chain, PinName, reg.indexAssets)
+	w.Run(ctx)
 }
-*/
-// indexAssets is run on every block and indexes all non-local assets.
-/*
-func (reg *Registry) indexAssets(ctx context.Context, b *legacy.Block) error {
-	var (
-		assetIDs         pq.ByteaArray
-		definitions      pq.ByteaArray
-		vmVersions       pq.Int64Array
-		issuancePrograms pq.ByteaArray
-		seen             = make(map[bc.AssetID]bool)
-	)
+
+// indexBlock records the asset-level effects of b.
+func (reg *Registry) indexBlock(ctx context.Context, b *legacy.Block) {
+	reg.indexAssets(ctx, b)
+	if err := reg.indexSupply(ctx, b); err != nil {
+		log.Error(ctx, err, "at", "indexing asset supply", "height", b.Height)
+	}
+	if err := reg.indexUniqueAssets(ctx, b); err != nil {
+		log.Error(ctx, err, "at", "indexing unique assets", "height", b.Height)
+	}
+	reg.indexDefinitionUpdates(ctx, b)
+	reg.indexAliasOperations(ctx, b)
+}
+// rollbackBlocks undoes the asset-level effects of the blocks after
+// height. Non-local assets stored by indexAssets are kept; an asset
+// ID commits to its issuance program and definition, so the record
+// stays true even if the issuance is orphaned.
+func (reg *Registry) rollbackBlocks(ctx context.Context, height uint64) error {
+	if err := reg.rollbackSupply(ctx, height); err != nil {
+		return errors.Wrap(err, "rolling back asset supply")
+	}
+	if err := reg.rollbackUniqueAssets(ctx, height); err != nil {
+		return errors.Wrap(err, "rolling back unique assets")
+	}
+	if err := reg.rollbackDefinitionUpdates(ctx, height); err != nil {
+		return errors.Wrap(err, "rolling back asset definition updates")
+	}
+	if err := reg.rollbackAliasOperations(ctx, height); err != nil {
+		return errors.Wrap(err, "rolling back asset aliases")
+	}
+	return nil
+}
+
+// indexAssets is run on every block and stores every asset issued
+// in it that the registry does not already know about, so that
+// issuer-signed statements about non-local assets can be verified.
+func (reg *Registry) indexAssets(ctx context.Context, b *legacy.Block) {
+	seen := make(map[bc.AssetID]bool)
 	for _, tx := range b.Transactions {
 		for _, in := range tx.Inputs {
-			if !in.IsIssuance() {
+			ii, ok := in.TypedInput.(*legacy.IssuanceInput)
+			if !ok {
 				continue
 			}
-			assetID := in.AssetID()
+			assetID := ii.AssetID()
 			if seen[assetID] {
 				continue
 			}
-			if ii, ok := in.TypedInput.(*legacy.IssuanceInput); ok {
-				definition := ii.AssetDefinition
-				seen[assetID] = true
-				assetIDs = append(assetIDs, assetID.Bytes())
-				definitions = append(definitions, definition)
-				vmVersions = append(vmVersions, int64(ii.VMVersion))
-				issuancePrograms = append(issuancePrograms, in.IssuanceProgram())
+			seen[assetID] = true
+			if reg.db.Get([]byte(assetID.String())) != nil {
+				continue
 			}
-		}
-	}
-	if len(assetIDs) == 0 {
-		return nil
-	}
-
-	// Insert these assets into the database. If the asset already exists, don't
-	// do anything. Return the asset ID of all inserted assets so we know which
-	// ones we have to save to the query indexer.
-	//
-	// For idempotency concerns, we use `first_block_height` to ensure that this
-	// query always returns the full set of new assets at this block. This
-	// protects against a crash after inserting into `assets` but before saving
-	// the annotated asset to the query indexer.
-/*	const q = `
-		WITH new_assets AS (
-			INSERT INTO assets (id, vm_version, issuance_program, definition, created_at, initial_block_hash, first_block_height)
-			VALUES(unnest($1::bytea[]), unnest($2::bigint[]), unnest($3::bytea[]), unnest($4::bytea[]), $5, $6, $7)
-			ON CONFLICT (id) DO UPDATE SET first_block_height = $7 WHERE assets.first_block_height > $7
-			RETURNING id
-		)
-		SELECT id FROM new_assets
-			UNION
-		SELECT id FROM assets WHERE first_block_height = $7
-	`
-	var newAssetIDs []bc.AssetID
-	err := pg.ForQueryRows(ctx, reg.db, q, assetIDs, vmVersions, issuancePrograms, definitions, b.Time(), reg.initialBlockHash, b.Height,
-		func(assetID bc.AssetID) { newAssetIDs = append(newAssetIDs, assetID) })
-	if err != nil {
-		return errors.Wrap(err, "error indexing non-local assets")
-	}
 
-	if reg.indexer == nil {
-		return nil
-	}
-
-	// newAssetIDs now contains only the asset IDs of new, non-local
-	// assets. We need to index them as annotated assets too.
-	for _, assetID := range newAssetIDs {
-		// TODO(jackson): Batch the asset lookups.
-		a, err := reg.findByID(ctx, assetID)
-		if err != nil {
-			return errors.Wrap(err, "looking up new asset")
-		}
-		err = reg.indexAnnotatedAsset(ctx, a)
-		if err != nil {
-			return errors.Wrap(err, "indexing annotated asset")
+			a := &Asset{
+				AssetID:          assetID,
+				VMVersion:        ii.VMVersion,
+				IssuanceProgram:  ii.IssuanceProgram,
+				InitialBlockHash: ii.InitialBlock,
+				RawDefinition1:   ii.AssetDefinition,
+			}
+			raw, err := json.Marshal(a)
+			if err != nil {
+				log.Error(ctx, err, "at", "marshaling non-local asset", "asset", assetID)
+				continue
+			}
+			reg.db.Set([]byte(assetID.String()), raw)
+			if err := reg.indexAnnotatedAsset(ctx, a); err != nil {
+				log.Error(ctx, err, "at", "indexing non-local asset", "asset", assetID)
+			}
 		}
 	}
 }
-*/
@@ -0,0 +1,118 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestRollbackBlocks(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+	gold := newTestIssuer(t, reg, 1)
+	silver := newTestIssuer(t, reg, 2)
+
+	prog, err := vmutil.UniqueAssetProgram([]byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txin := legacy.NewIssuanceInput([]byte{1}, 1, nil, bc.Hash{}, prog, nil, nil)
+	assetID := txin.AssetID()
+	raw, err := json.Marshal(&Asset{AssetID: assetID, VMVersion: 1, IssuanceProgram: prog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.db.Set([]byte(assetID.String()), raw)
+
+	issue := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, []byte{0xaa}, nil)},
+	})
+	retire := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *issue.OutputID(0), assetID, 1, 0, []byte{0xaa}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, []byte{byte(vm.OP_FAIL)}, nil)},
+	})
+	for i, tx := range []*legacy.Tx{issue, retire} {
+		b := &legacy.Block{
+			BlockHeader:  legacy.BlockHeader{Height: uint64(i + 1)},
+			Transactions: []*legacy.Tx{tx},
+		}
+		reg.indexBlock(ctx, b)
+	}
+
+	register := &AliasOperation{Type: AliasRegister, Alias: "gold", AssetID: gold.asset.AssetID}
+	gold.sign(register)
+	if err := reg.applyAliasOperation(ctx, register, 1, bc.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	transfer := &AliasOperation{Type: AliasTransfer, Alias: "gold", AssetID: silver.asset.AssetID, Sequence: 1}
+	gold.sign(transfer)
+	if err := reg.applyAliasOperation(ctx, transfer, 2, bc.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	silverAlias := &AliasOperation{Type: AliasRegister, Alias: "silver", AssetID: silver.asset.AssetID}
+	silver.sign(silverAlias)
+	if err := reg.applyAliasOperation(ctx, silverAlias, 2, bc.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain forks after block 1.
+	if err := reg.rollbackBlocks(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	supply, err := reg.Supply(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if supply.Issued != 1 || supply.Retired != 0 || supply.Circulating != 1 || supply.BlockHeight != 1 {
+		t.Errorf("Supply = %+v, want 1 issued and none retired at height 1", *supply)
+	}
+	if history, err := reg.RetirementHistory(ctx, assetID); err != nil || len(history) != 0 {
+		t.Errorf("RetirementHistory = %v, %v, want no retirements", history, err)
+	}
+
+	owner, err := reg.Owner(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.TxID != issue.ID || owner.Retired {
+		t.Errorf("Owner = %+v, want the issuance output", owner)
+	}
+
+	rec, err := reg.ResolveAlias(ctx, "gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.AssetID != gold.asset.AssetID || rec.Sequence != 0 {
+		t.Errorf("ResolveAlias(gold) = %+v, want gold at sequence 0", rec)
+	}
+	if _, err := reg.ResolveAlias(ctx, "silver"); errors.Root(err) != ErrAliasNotFound {
+		t.Errorf("ResolveAlias(silver): got error %v, want %v", err, ErrAliasNotFound)
+	}
+
+	// Indexing the new branch counts its block 2.
+	b := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 2}, Transactions: []*legacy.Tx{retire}}
+	reg.indexBlock(ctx, b)
+	if supply, err = reg.Supply(ctx, assetID); err != nil {
+		t.Fatal(err)
+	}
+	if supply.Retired != 1 || supply.Circulating != 0 || supply.BlockHeight != 2 {
+		t.Errorf("Supply after new branch = %+v, want 1 retired at height 2", *supply)
+	}
+}
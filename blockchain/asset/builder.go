@@ -9,6 +9,7 @@ import (
 	"github.com/bytom/blockchain/signers"
 	"github.com/bytom/blockchain/txbuilder"
 	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
 	"github.com/bytom/log"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/legacy"
@@ -44,6 +45,15 @@ func (a *issueAction) Build(ctx context.Context, builder *txbuilder.TemplateBuil
 	if err != nil {
 		return err
 	}
+	if asset.Signer == nil {
+		return errors.WithDetail(ErrBadIdentifier, "asset is not local")
+	}
+	if isUnique(asset) && a.Amount != 1 {
+		return errors.WithDetailf(ErrUniqueAmount, "amount %d", a.Amount)
+	}
+	if err := a.assets.checkIssuanceCap(asset, a.Amount); err != nil {
+		return err
+	}
 
 	var nonce [8]byte
 	_, err = rand.Read(nonce[:])
@@ -66,3 +76,63 @@ func (a *issueAction) Build(ctx context.Context, builder *txbuilder.TemplateBuil
 	return builder.AddInput(txin, tplIn)
 }
 
+
+func (reg *Registry) DecodeUpdateDefinitionAction(data []byte) (txbuilder.Action, error) {
+	a := &updateDefinitionAction{assets: reg}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// updateDefinitionAction publishes a signed asset definition update
+// in the transaction's reference data.
+type updateDefinitionAction struct {
+	assets *Registry
+	Update *DefinitionUpdate `json:"update"`
+}
+
+func (a *updateDefinitionAction) Build(ctx context.Context, builder *txbuilder.TemplateBuilder) error {
+	if a.Update == nil {
+		return txbuilder.MissingFieldsError("update")
+	}
+	if a.Update.AssetID.IsZero() {
+		return txbuilder.MissingFieldsError("update.asset_id")
+	}
+
+	// Reject bad updates now rather than letting them be silently
+	// ignored by every indexer once they are on chain.
+	err := a.assets.checkDefinitionUpdate(ctx, a.Update)
+	if err != nil {
+		return err
+	}
+
+	return buildRefData(ctx, builder, DefinitionUpdateKey, a.Update)
+}
+
+func (reg *Registry) DecodePublishAliasAction(data []byte) (txbuilder.Action, error) {
+	a := &publishAliasAction{assets: reg}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// publishAliasAction publishes a signed asset alias operation in the
+// transaction's reference data.
+type publishAliasAction struct {
+	assets    *Registry
+	Operation *AliasOperation `json:"operation"`
+}
+
+func (a *publishAliasAction) Build(ctx context.Context, builder *txbuilder.TemplateBuilder) error {
+	if a.Operation == nil {
+		return txbuilder.MissingFieldsError("operation")
+	}
+	if a.Operation.AssetID.IsZero() {
+		return txbuilder.MissingFieldsError("operation.asset_id")
+	}
+
+	err := a.assets.checkAliasOperation(ctx, a.Operation)
+	if err != nil {
+		return err
+	}
+
+	return buildRefData(ctx, builder, AliasOperationKey, a.Operation)
+}
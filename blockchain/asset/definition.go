@@ -0,0 +1,289 @@
+package asset
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bytom/crypto/sha3pool"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// DefinitionUpdateKey is the top-level key, in a transaction's
+// reference data, under which an asset definition update is published.
+const DefinitionUpdateKey = "asset_definition_update"
+
+const (
+	definitionPrefix       = "asset_definition:"
+	latestDefinitionPrefix = "asset_definition_latest:"
+)
+
+var (
+	ErrStaleDefinition        = errors.New("asset definition update is not newer than the current definition")
+	ErrSkippedDefinition      = errors.New("asset definition update skips a version")
+	ErrBadDefinitionSignature = errors.New("asset definition update is not signed by a quorum of issuance keys")
+	ErrBadDefinition          = errors.New("asset definition is not a valid json object")
+)
+
+// DefinitionUpdate replaces the definition of an existing asset.
+// The asset ID never changes; it always commits to the definition
+// used at first issuance (version 0). Each update carries the next
+// version number and must be signed by a quorum of the keys in the
+// asset's issuance program.
+type DefinitionUpdate struct {
+	AssetID       bc.AssetID           `json:"asset_id"`
+	Version       uint64               `json:"version"`
+	RawDefinition chainjson.HexBytes   `json:"raw_definition"`
+	Signatures    []chainjson.HexBytes `json:"signatures"`
+}
+
+// SigningHash returns the message signed by the issuance keys.
+func (u *DefinitionUpdate) SigningHash() (hash bc.Hash) {
+	var defhash [32]byte
+	sha3pool.Sum256(defhash[:], u.RawDefinition)
+
+	var version [8]byte
+	binary.BigEndian.PutUint64(version[:], u.Version)
+
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+	h.Write([]byte(DefinitionUpdateKey))
+	h.Write(u.AssetID.Bytes())
+	h.Write(version[:])
+	h.Write(defhash[:])
+	hash.ReadFrom(h)
+	return hash
+}
+
+// Verify checks that u carries valid signatures from at least a
+// quorum of the public keys in issuanceProgram. Each key counts
+// at most once.
+func (u *DefinitionUpdate) Verify(issuanceProgram []byte) error {
+	valid, quorum, err := countIssuerSignatures(issuanceProgram, u.SigningHash(), u.Signatures)
+	if err != nil {
+		return err
+	}
+	if valid < quorum {
+		return errors.WithDetailf(ErrBadDefinitionSignature, "%d valid signatures, quorum is %d", valid, quorum)
+	}
+	return nil
+}
+
+// Definition decodes the definition carried by u.
+func (u *DefinitionUpdate) Definition() (map[string]interface{}, error) {
+	var def map[string]interface{}
+	if err := json.Unmarshal(u.RawDefinition, &def); err != nil {
+		return nil, errors.Wrap(ErrBadDefinition, err.Error())
+	}
+	return def, nil
+}
+
+// DefinitionVersion is one stored version of an asset's definition.
+type DefinitionVersion struct {
+	AssetID       bc.AssetID         `json:"asset_id"`
+	Version       uint64             `json:"version"`
+	RawDefinition chainjson.HexBytes `json:"raw_definition"`
+	BlockHeight   uint64             `json:"block_height"`
+	TxID          bc.Hash            `json:"transaction_id"`
+}
+
+func calcDefinitionKey(id bc.AssetID, version uint64) []byte {
+	return []byte(fmt.Sprintf("%s%x:%020d", definitionPrefix, id.Bytes(), version))
+}
+
+func calcLatestDefinitionKey(id bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%x", latestDefinitionPrefix, id.Bytes()))
+}
+
+// LatestDefinition returns the most recent definition of the asset.
+// Assets that were never updated return their original definition
+// as version 0.
+func (reg *Registry) LatestDefinition(ctx context.Context, id bc.AssetID) (*DefinitionVersion, error) {
+	if b := reg.db.Get(calcLatestDefinitionKey(id)); b != nil {
+		dv := new(DefinitionVersion)
+		if err := json.Unmarshal(b, dv); err != nil {
+			return nil, errors.Wrap(err, "decoding asset definition")
+		}
+		return dv, nil
+	}
+
+	asset, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &DefinitionVersion{
+		AssetID:       id,
+		RawDefinition: asset.RawDefinition(),
+	}, nil
+}
+
+// DefinitionHistory returns every published update of the asset's
+// definition, oldest first. The original definition is not included.
+func (reg *Registry) DefinitionHistory(ctx context.Context, id bc.AssetID) ([]*DefinitionVersion, error) {
+	prefix := fmt.Sprintf("%s%x:", definitionPrefix, id.Bytes())
+	var history []*DefinitionVersion
+
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), prefix) {
+			continue
+		}
+		dv := new(DefinitionVersion)
+		if err := json.Unmarshal(iter.Value(), dv); err != nil {
+			return nil, errors.Wrap(err, "decoding asset definition")
+		}
+		history = append(history, dv)
+	}
+	return history, nil
+}
+
+// NewDefinitionUpdate prepares an unsigned update of a local asset's
+// definition, along with the keys that must sign it.
+func (reg *Registry) NewDefinitionUpdate(ctx context.Context, id bc.AssetID, definition map[string]interface{}) (*DefinitionUpdate, []SigningKey, error) {
+	keys, err := reg.issuerSigningKeys(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, err := reg.LatestDefinition(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawDefinition, err := serializeAssetDef(definition)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "serializing asset definition")
+	}
+
+	update := &DefinitionUpdate{
+		AssetID:       id,
+		Version:       current.Version + 1,
+		RawDefinition: rawDefinition,
+	}
+	return update, keys, nil
+}
+
+// SignDefinitionUpdate adds signatures to u for each of the asset's
+// keys that signFn holds.
+func (reg *Registry) SignDefinitionUpdate(ctx context.Context, u *DefinitionUpdate, signFn SignFunc) error {
+	sigs, err := reg.signAsIssuer(ctx, u.AssetID, u.SigningHash(), signFn)
+	if err != nil {
+		return err
+	}
+	u.Signatures = append(u.Signatures, sigs...)
+	return nil
+}
+
+// checkDefinitionUpdate validates u against the asset's issuance
+// program and its current definition version.
+func (reg *Registry) checkDefinitionUpdate(ctx context.Context, u *DefinitionUpdate) error {
+	asset, err := reg.findByID(ctx, u.AssetID)
+	if err != nil {
+		return err
+	}
+	if _, err := u.Definition(); err != nil {
+		return err
+	}
+
+	current, err := reg.LatestDefinition(ctx, u.AssetID)
+	if err != nil {
+		return err
+	}
+	if u.Version <= current.Version {
+		return errors.WithDetailf(ErrStaleDefinition, "update version %d, current version %d", u.Version, current.Version)
+	}
+	if u.Version != current.Version+1 {
+		return errors.WithDetailf(ErrSkippedDefinition, "update version %d, current version %d", u.Version, current.Version)
+	}
+	return u.Verify(asset.IssuanceProgram)
+}
+
+// applyDefinitionUpdate validates and stores u, recording where it
+// was published.
+func (reg *Registry) applyDefinitionUpdate(ctx context.Context, u *DefinitionUpdate, height uint64, txID bc.Hash) error {
+	if err := reg.checkDefinitionUpdate(ctx, u); err != nil {
+		return err
+	}
+
+	dv := &DefinitionVersion{
+		AssetID:       u.AssetID,
+		Version:       u.Version,
+		RawDefinition: u.RawDefinition,
+		BlockHeight:   height,
+		TxID:          txID,
+	}
+	b, err := json.Marshal(dv)
+	if err != nil {
+		return errors.Wrap(err, "marshaling asset definition")
+	}
+	reg.db.Set(calcDefinitionKey(u.AssetID, u.Version), b)
+	reg.db.SetSync(calcLatestDefinitionKey(u.AssetID), b)
+	return nil
+}
+
+// indexDefinitionUpdates applies every valid definition update
+// published in b. Invalid updates are logged and skipped; anyone can
+// put arbitrary reference data on chain.
+func (reg *Registry) indexDefinitionUpdates(ctx context.Context, b *legacy.Block) {
+	for _, tx := range b.Transactions {
+		u := new(DefinitionUpdate)
+		if !refDataField(tx, DefinitionUpdateKey, u) {
+			continue
+		}
+		if err := reg.applyDefinitionUpdate(ctx, u, b.Height, tx.ID); err != nil {
+			log.Error(ctx, err, "at", "rejecting asset definition update", "asset", u.AssetID, "tx", tx.ID)
+		}
+	}
+}
+
+// rollbackDefinitionUpdates forgets the definition updates indexed
+// from blocks after height, restoring each asset's latest definition
+// from before the fork.
+func (reg *Registry) rollbackDefinitionUpdates(ctx context.Context, height uint64) error {
+	var (
+		drop    [][]byte
+		updated = make(map[bc.AssetID]bool)
+		latest  = make(map[bc.AssetID]*DefinitionVersion)
+	)
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), definitionPrefix) {
+			continue
+		}
+		dv := new(DefinitionVersion)
+		if err := json.Unmarshal(iter.Value(), dv); err != nil {
+			return errors.Wrap(err, "decoding asset definition")
+		}
+		if dv.BlockHeight > height {
+			updated[dv.AssetID] = true
+			drop = append(drop, append([]byte(nil), iter.Key()...))
+			continue
+		}
+		if l, ok := latest[dv.AssetID]; !ok || dv.Version > l.Version {
+			latest[dv.AssetID] = dv
+		}
+	}
+
+	for _, key := range drop {
+		reg.db.Delete(key)
+	}
+	for id := range updated {
+		dv, ok := latest[id]
+		if !ok {
+			reg.db.Delete(calcLatestDefinitionKey(id))
+			continue
+		}
+		b, err := json.Marshal(dv)
+		if err != nil {
+			return errors.Wrap(err, "marshaling asset definition")
+		}
+		reg.db.Set(calcLatestDefinitionKey(id), b)
+	}
+	return nil
+}
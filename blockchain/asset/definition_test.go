@@ -0,0 +1,93 @@
+package asset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+)
+
+func TestDefinitionUpdateVerify(t *testing.T) {
+	var xprvs []chainkd.XPrv
+	var xpubs []chainkd.XPub
+	for i := 0; i < 3; i++ {
+		xprv, xpub, err := chainkd.NewXKeys(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xprvs = append(xprvs, xprv)
+		xpubs = append(xpubs, xpub)
+	}
+	prog, _, err := multisigIssuanceProgram(chainkd.XPubKeys(xpubs), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &DefinitionUpdate{
+		AssetID:       bc.NewAssetID([32]byte{1}),
+		Version:       1,
+		RawDefinition: []byte(`{"name": "gold"}`),
+	}
+	msg := u.SigningHash()
+
+	u.Signatures = []chainjson.HexBytes{xprvs[0].Sign(msg.Bytes())}
+	if err := u.Verify(prog); errors.Root(err) != ErrBadDefinitionSignature {
+		t.Errorf("one of two signatures: got error %v, want %v", err, ErrBadDefinitionSignature)
+	}
+
+	// The same key signing twice must not count toward the quorum.
+	u.Signatures = append(u.Signatures, xprvs[0].Sign(msg.Bytes()))
+	if err := u.Verify(prog); errors.Root(err) != ErrBadDefinitionSignature {
+		t.Errorf("duplicate signature: got error %v, want %v", err, ErrBadDefinitionSignature)
+	}
+
+	u.Signatures = append(u.Signatures, xprvs[2].Sign(msg.Bytes()))
+	if err := u.Verify(prog); err != nil {
+		t.Errorf("quorum of signatures: got error %v", err)
+	}
+
+	// Any change to the signed fields invalidates the signatures.
+	u.Version = 2
+	if err := u.Verify(prog); errors.Root(err) != ErrBadDefinitionSignature {
+		t.Errorf("modified version: got error %v, want %v", err, ErrBadDefinitionSignature)
+	}
+}
+
+func TestCheckDefinitionUpdateVersion(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:    dbm.NewMemDB(),
+		cache: lru.New(maxAssetCache),
+	}
+	gold := newTestIssuer(t, reg, 1)
+
+	update := func(version uint64) *DefinitionUpdate {
+		u := &DefinitionUpdate{
+			AssetID:       gold.asset.AssetID,
+			Version:       version,
+			RawDefinition: []byte(`{"name": "gold"}`),
+		}
+		msg := u.SigningHash()
+		u.Signatures = []chainjson.HexBytes{gold.xprv.Sign(msg.Bytes())}
+		return u
+	}
+
+	if err := reg.applyDefinitionUpdate(ctx, update(2), 1, bc.Hash{}); errors.Root(err) != ErrSkippedDefinition {
+		t.Errorf("version 2 after 0: got error %v, want %v", err, ErrSkippedDefinition)
+	}
+	if err := reg.applyDefinitionUpdate(ctx, update(1), 1, bc.Hash{}); err != nil {
+		t.Fatalf("version 1 after 0: got error %v", err)
+	}
+	if err := reg.applyDefinitionUpdate(ctx, update(1), 2, bc.Hash{}); errors.Root(err) != ErrStaleDefinition {
+		t.Errorf("version 1 after 1: got error %v, want %v", err, ErrStaleDefinition)
+	}
+	if err := reg.applyDefinitionUpdate(ctx, update(2), 2, bc.Hash{}); err != nil {
+		t.Errorf("version 2 after 1: got error %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// Issuer-signed statements, such as definition updates and alias
+// operations, are published in transaction reference data and
+// authorized by a quorum of the keys in an asset's issuance program.
+
+// SignFunc signs msg with the key derived from xpub along path.
+// It returns a nil signature if it does not hold the key.
+type SignFunc func(xpub chainkd.XPub, path [][]byte, msg []byte) ([]byte, error)
+
+// SigningKey describes a key that must sign an issuer statement.
+type SigningKey struct {
+	XPub chainkd.XPub         `json:"xpub"`
+	Path []chainjson.HexBytes `json:"derivation_path"`
+}
+
+// countIssuerSignatures returns the number of distinct keys in
+// issuanceProgram that produced one of sigs over msg, and the
+// quorum the program requires.
+func countIssuerSignatures(issuanceProgram []byte, msg bc.Hash, sigs []chainjson.HexBytes) (valid, quorum int, err error) {
+	pubkeys, quorum, err := vmutil.ParseP2SPMultiSigProgram(issuanceProgram)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "parsing issuance program")
+	}
+
+	used := make([]bool, len(pubkeys))
+	for _, sig := range sigs {
+		for i, pubkey := range pubkeys {
+			if !used[i] && ed25519.Verify(pubkey, msg.Bytes(), sig) {
+				used[i] = true
+				valid++
+				break
+			}
+		}
+	}
+	return valid, quorum, nil
+}
+
+// localSigner returns the asset with the given ID, which must
+// have been created by this core.
+func (reg *Registry) localSigner(ctx context.Context, id bc.AssetID) (*Asset, error) {
+	asset, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Signer == nil {
+		return nil, errors.WithDetail(ErrBadIdentifier, "asset is not local")
+	}
+	return asset, nil
+}
+
+// issuerSigningKeys lists the keys that can sign for a local asset.
+func (reg *Registry) issuerSigningKeys(ctx context.Context, id bc.AssetID) ([]SigningKey, error) {
+	asset, err := reg.localSigner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	path := signers.Path(asset.Signer, signers.AssetKeySpace)
+	var jsonPath []chainjson.HexBytes
+	for _, p := range path {
+		jsonPath = append(jsonPath, p)
+	}
+	keys := make([]SigningKey, 0, len(asset.Signer.XPubs))
+	for _, xpub := range asset.Signer.XPubs {
+		keys = append(keys, SigningKey{XPub: xpub, Path: jsonPath})
+	}
+	return keys, nil
+}
+
+// signAsIssuer signs msg with every key of the local asset that
+// signFn holds.
+func (reg *Registry) signAsIssuer(ctx context.Context, id bc.AssetID, msg bc.Hash, signFn SignFunc) ([]chainjson.HexBytes, error) {
+	asset, err := reg.localSigner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sigs []chainjson.HexBytes
+	path := signers.Path(asset.Signer, signers.AssetKeySpace)
+	for _, xpub := range asset.Signer.XPubs {
+		sig, err := signFn(xpub, path, msg.Bytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "signing with xpub %s", xpub)
+		}
+		if sig != nil {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs, nil
+}
+
+// refDataField decodes the value stored under key in tx's reference
+// data into v. It reports whether such a value was present and valid.
+func refDataField(tx *legacy.Tx, key string, v interface{}) bool {
+	if len(tx.ReferenceData) == 0 {
+		return false
+	}
+	var refData map[string]json.RawMessage
+	if err := json.Unmarshal(tx.ReferenceData, &refData); err != nil {
+		return false
+	}
+	raw, ok := refData[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// buildRefData sets the transaction's reference data to an object
+// holding v under key.
+func buildRefData(ctx context.Context, builder *txbuilder.TemplateBuilder, key string, v interface{}) error {
+	refData, err := json.Marshal(map[string]interface{}{key: v})
+	if err != nil {
+		return err
+	}
+	setRefData, err := txbuilder.DecodeSetTxRefDataAction([]byte(`{"reference_data":` + string(refData) + `}`))
+	if err != nil {
+		return err
+	}
+	return setRefData.Build(ctx, builder)
+}
@@ -0,0 +1,303 @@
+// Package metadata resolves the off-chain documents that asset
+// definitions refer to, and combines them with the on-chain
+// definition into a summary of the asset.
+//
+// A definition may name a document with the fields "document_url"
+// and "document_hash". The hash is the hex-encoded SHA3-256 of the
+// document, so a document that has been fetched and verified once
+// never changes and can be cached for as long as it is wanted.
+//
+// Anyone can publish a definition, so the URL is untrusted. Documents
+// are only fetched over https, and by default never from loopback,
+// private or link-local addresses, so a definition cannot make the
+// node probe its own network.
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+
+	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/crypto/sha3pool"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+)
+
+// Definition fields that refer to an off-chain document.
+const (
+	DocumentURLKey  = "document_url"
+	DocumentHashKey = "document_hash"
+)
+
+const (
+	maxDocumentCache = 1000
+	maxDocumentSize  = 1 << 20
+	fetchTimeout     = 10 * time.Second
+	maxRedirects     = 3
+)
+
+var (
+	ErrBadDocument  = errors.New("asset document is not a valid json object")
+	ErrDocumentHash = errors.New("asset document does not match the hash in its definition")
+	ErrFetch        = errors.New("could not fetch asset document")
+)
+
+// Metadata describes an asset, as given by its latest on-chain
+// definition and, where the definition refers to one, a verified
+// off-chain document. Fields in the on-chain definition take
+// precedence over the same fields in the document.
+type Metadata struct {
+	AssetID           bc.AssetID         `json:"asset_id"`
+	DefinitionVersion uint64             `json:"definition_version"`
+	Name              string             `json:"name,omitempty"`
+	Symbol            string             `json:"symbol,omitempty"`
+	Decimals          *uint8             `json:"decimals,omitempty"`
+	IssuerURL         string             `json:"issuer_url,omitempty"`
+	DocumentURL       string             `json:"document_url,omitempty"`
+	DocumentHash      chainjson.HexBytes `json:"document_hash,omitempty"`
+	Document          json.RawMessage    `json:"document,omitempty"`
+
+	// DocumentError explains why a referenced document could not
+	// be used. The rest of the metadata is still valid.
+	DocumentError string `json:"document_error,omitempty"`
+}
+
+// DefinitionSource provides the latest on-chain definition of an
+// asset. It is implemented by *asset.Registry.
+type DefinitionSource interface {
+	LatestDefinition(ctx context.Context, id bc.AssetID) (*asset.DefinitionVersion, error)
+}
+
+// Resolver fetches, verifies and caches asset documents.
+type Resolver struct {
+	defs   DefinitionSource
+	client *http.Client
+
+	cacheMu sync.Mutex
+	cache   *lru.Cache // document hash -> verified document
+}
+
+// NewResolver returns a Resolver that reads definitions from defs and
+// fetches documents with client. If client is nil, a client with a
+// short timeout is used that only connects to public addresses and
+// follows at most a few redirects, all to https URLs.
+func NewResolver(defs DefinitionSource, client *http.Client) *Resolver {
+	if client == nil {
+		client = newClient()
+	}
+	return &Resolver{
+		defs:   defs,
+		client: client,
+		cache:  lru.New(maxDocumentCache),
+	}
+}
+
+// Resolve returns the metadata of the asset. It fails only if the
+// on-chain definition cannot be read; problems with the off-chain
+// document are reported in the result's DocumentError.
+func (r *Resolver) Resolve(ctx context.Context, id bc.AssetID) (*Metadata, error) {
+	dv, err := r.defs.LatestDefinition(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{AssetID: id, DefinitionVersion: dv.Version}
+
+	var def map[string]interface{}
+	if len(dv.RawDefinition) > 0 {
+		if err := json.Unmarshal(dv.RawDefinition, &def); err != nil {
+			return nil, errors.Wrap(asset.ErrBadDefinition, err.Error())
+		}
+	}
+
+	url, _ := def[DocumentURLKey].(string)
+	hash, _ := def[DocumentHashKey].(string)
+	if url != "" || hash != "" {
+		m.DocumentURL = url
+		doc, err := r.document(ctx, url, hash)
+		if err != nil {
+			m.DocumentError = err.Error()
+		} else {
+			m.DocumentHash, _ = hex.DecodeString(hash)
+			m.Document = doc.raw
+			m.apply(doc.fields)
+		}
+	}
+	m.apply(def)
+	return m, nil
+}
+
+// apply sets the well-known fields of m from fields.
+func (m *Metadata) apply(fields map[string]interface{}) {
+	if s, ok := fields["name"].(string); ok {
+		m.Name = s
+	}
+	if s, ok := fields["symbol"].(string); ok {
+		m.Symbol = s
+	}
+	if n, ok := fields["decimals"].(float64); ok && n >= 0 && n <= 18 && n == float64(uint8(n)) {
+		d := uint8(n)
+		m.Decimals = &d
+	}
+	if s, ok := fields["issuer_url"].(string); ok {
+		m.IssuerURL = s
+	}
+}
+
+type document struct {
+	raw    json.RawMessage
+	fields map[string]interface{}
+}
+
+// document returns the verified document at url with the given hash,
+// fetching it only if it is not already cached.
+func (r *Resolver) document(ctx context.Context, url, hash string) (*document, error) {
+	want, err := hex.DecodeString(hash)
+	if err != nil || len(want) != 32 {
+		return nil, errors.WithDetailf(ErrDocumentHash, "%s must be a hex-encoded 32-byte hash", DocumentHashKey)
+	}
+
+	r.cacheMu.Lock()
+	cached, ok := r.cache.Get(hash)
+	r.cacheMu.Unlock()
+	if ok {
+		return cached.(*document), nil
+	}
+
+	if url == "" {
+		return nil, errors.WithDetailf(ErrFetch, "definition has no %s", DocumentURLKey)
+	}
+	raw, err := r.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var got [32]byte
+	sha3pool.Sum256(got[:], raw)
+	if !bytes.Equal(got[:], want) {
+		return nil, errors.WithDetailf(ErrDocumentHash, "document hash is %x", got[:])
+	}
+	doc := &document{raw: raw}
+	if err := json.Unmarshal(raw, &doc.fields); err != nil {
+		return nil, errors.Wrap(ErrBadDocument, err.Error())
+	}
+
+	r.cacheMu.Lock()
+	r.cache.Add(hash, doc)
+	r.cacheMu.Unlock()
+	return doc, nil
+}
+
+func (r *Resolver) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.WithDetail(ErrFetch, err.Error())
+	}
+	if req.URL.Scheme != "https" {
+		return nil, errors.WithDetailf(ErrFetch, "%s is not an https URL", DocumentURLKey)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithDetail(ErrFetch, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.WithDetailf(ErrFetch, "%s returned status %d", url, resp.StatusCode)
+	}
+
+	// Read one byte more than the limit to detect documents that
+	// are too large.
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, errors.WithDetail(ErrFetch, err.Error())
+	}
+	if len(raw) > maxDocumentSize {
+		return nil, errors.WithDetailf(ErrFetch, "document is larger than %d bytes", maxDocumentSize)
+	}
+	return raw, nil
+}
+
+// newClient returns a client that connects to documents' hosts
+// directly. Through a proxy, checkPublicAddr would check the proxy's
+// address rather than the host's, so proxies are not used.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: checkPublicAddr,
+	}
+	return &http.Client{
+		Timeout: fetchTimeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: fetchTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "https" {
+				return errors.New("redirect to a URL that is not https")
+			}
+			return nil
+		},
+	}
+}
+
+// privateNets are the address ranges, besides loopback and
+// link-local ones, that documents are not fetched from.
+var privateNets = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// checkPublicAddr is called by the dialer with the address it is
+// about to connect to, after name resolution, so a name cannot
+// resolve to a private address to get past it.
+func checkPublicAddr(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.New("invalid address " + address)
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return errors.New("refusing to connect to non-public address " + host)
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return errors.New("refusing to connect to non-public address " + host)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+)
+
+type defSource map[bc.AssetID]string
+
+func (s defSource) LatestDefinition(ctx context.Context, id bc.AssetID) (*asset.DefinitionVersion, error) {
+	return &asset.DefinitionVersion{AssetID: id, Version: 2, RawDefinition: []byte(s[id])}, nil
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	doc := `{"name": "Gold Token", "symbol": "GLD", "decimals": 8, "issuer_url": "https://gold.example"}`
+	var fetches int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetches++
+		fmt.Fprint(w, doc)
+	}))
+	defer srv.Close()
+
+	var h [32]byte
+	sha3pool.Sum256(h[:], []byte(doc))
+	hash := hex.EncodeToString(h[:])
+
+	good, bad, plain := bc.AssetID{V0: 1}, bc.AssetID{V0: 2}, bc.AssetID{V0: 3}
+	defs := defSource{
+		good:  fmt.Sprintf(`{"symbol": "GOLD", "document_url": %q, "document_hash": %q}`, srv.URL, hash),
+		bad:   fmt.Sprintf(`{"document_url": %q, "document_hash": %q}`, srv.URL, strings.Repeat("00", 32)),
+		plain: `{"name": "Silver"}`,
+	}
+	r := NewResolver(defs, srv.Client())
+
+	for i := 0; i < 2; i++ {
+		m, err := r.Resolve(ctx, good)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.DocumentError != "" {
+			t.Fatalf("document error: %s", m.DocumentError)
+		}
+		// The on-chain symbol overrides the document's.
+		if m.Name != "Gold Token" || m.Symbol != "GOLD" || m.Decimals == nil || *m.Decimals != 8 || m.IssuerURL != "https://gold.example" || m.DefinitionVersion != 2 {
+			t.Errorf("Resolve = %+v", m)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched document %d times, want 1", fetches)
+	}
+
+	m, err := r.Resolve(ctx, bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.DocumentError, ErrDocumentHash.Error()) || m.Name != "" {
+		t.Errorf("document with wrong hash: got %+v", m)
+	}
+
+	m, err = r.Resolve(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Silver" || m.DocumentError != "" || m.Document != nil {
+		t.Errorf("definition without document: got %+v", m)
+	}
+}
+
+func TestFetchRestrictions(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer plain.Close()
+
+	// Only https URLs are fetched, whatever the client.
+	if _, err := NewResolver(nil, plain.Client()).fetch(ctx, plain.URL); errors.Root(err) != ErrFetch {
+		t.Errorf("fetching http URL: got error %v, want %v", err, ErrFetch)
+	}
+
+	// The default client does not connect to loopback addresses.
+	_, err := NewResolver(nil, nil).fetch(ctx, srv.URL)
+	if errors.Root(err) != ErrFetch || !strings.Contains(errors.Detail(err), "non-public address") {
+		t.Errorf("fetching from loopback: got error %v, want non-public address error", err)
+	}
+
+	// Nor through a proxy, whose address is all the dialer would see.
+	if tr := newClient().Transport.(*http.Transport); tr.Proxy != nil {
+		t.Error("default client uses a proxy")
+	}
+}
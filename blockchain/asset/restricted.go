@@ -0,0 +1,181 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+const whitelistPrefix = "asset_whitelist:"
+
+var ErrNotRestricted = errors.New("asset is not a restricted-transfer asset")
+
+// WhitelistEntry is a control program approved by the issuer to
+// receive a restricted-transfer asset.
+type WhitelistEntry struct {
+	AssetID        bc.AssetID         `json:"asset_id"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+}
+
+func calcWhitelistKey(id bc.AssetID, prog []byte) []byte {
+	return []byte(fmt.Sprintf("%s%x:%x", whitelistPrefix, id.Bytes(), prog))
+}
+
+// isRestricted reports whether a is a restricted-transfer asset.
+func isRestricted(a *Asset) bool {
+	return vmutil.IsRestrictedIssuance(a.IssuanceProgram)
+}
+
+// IssuerKeys returns the keys, and quorum, that must co-sign every
+// transfer of a restricted asset. Holders build their control
+// programs from them with vmutil.RestrictedTransferProgram.
+func (reg *Registry) IssuerKeys(ctx context.Context, id bc.AssetID) ([]ed25519.PublicKey, int, error) {
+	a, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isRestricted(a) {
+		return nil, 0, errors.WithDetailf(ErrNotRestricted, "asset %x", id.Bytes())
+	}
+	pubkeys, quorum, err := vmutil.ParseP2SPMultiSigProgram(a.IssuanceProgram)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "parsing issuance program")
+	}
+	return pubkeys, quorum, nil
+}
+
+// localRestricted returns a restricted asset created by this core.
+func (reg *Registry) localRestricted(ctx context.Context, id bc.AssetID) (*Asset, error) {
+	a, err := reg.localSigner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isRestricted(a) {
+		return nil, errors.WithDetailf(ErrNotRestricted, "asset %x", id.Bytes())
+	}
+	return a, nil
+}
+
+// AddToWhitelist approves prog to receive a local restricted asset.
+// The program must itself require the issuer's co-signature.
+func (reg *Registry) AddToWhitelist(ctx context.Context, id bc.AssetID, prog []byte) error {
+	a, err := reg.localRestricted(ctx, id)
+	if err != nil {
+		return err
+	}
+	issuerPubkeys, _, err := vmutil.ParseP2SPMultiSigProgram(a.IssuanceProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing issuance program")
+	}
+	// Checking a transfer to prog alone, with every program allowed,
+	// ensures that prog requires the issuer's co-signature.
+	err = txbuilder.CheckRestrictedTransfer(ctx, &legacy.TxData{
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(id, 1, prog, nil)},
+	}, id, issuerPubkeys, allowAll)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(&WhitelistEntry{AssetID: id, ControlProgram: prog})
+	if err != nil {
+		return errors.Wrap(err, "marshaling whitelist entry")
+	}
+	reg.db.SetSync(calcWhitelistKey(id, prog), b)
+	return nil
+}
+
+// RemoveFromWhitelist revokes the approval of prog. Assets it already
+// holds can only be moved with the issuer's co-signature, which is no
+// longer given.
+func (reg *Registry) RemoveFromWhitelist(ctx context.Context, id bc.AssetID, prog []byte) error {
+	if _, err := reg.localRestricted(ctx, id); err != nil {
+		return err
+	}
+	reg.db.DeleteSync(calcWhitelistKey(id, prog))
+	return nil
+}
+
+// Whitelist returns every control program approved to receive a
+// local restricted asset.
+func (reg *Registry) Whitelist(ctx context.Context, id bc.AssetID) ([]*WhitelistEntry, error) {
+	if _, err := reg.localRestricted(ctx, id); err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("%s%x:", whitelistPrefix, id.Bytes())
+	var entries []*WhitelistEntry
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), prefix) {
+			continue
+		}
+		e := new(WhitelistEntry)
+		if err := json.Unmarshal(iter.Value(), e); err != nil {
+			return nil, errors.Wrap(err, "decoding whitelist entry")
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// whitelisted implements txbuilder.Whitelist.
+func (reg *Registry) whitelisted(ctx context.Context, id bc.AssetID, prog []byte) (bool, error) {
+	return reg.db.Get(calcWhitelistKey(id, prog)) != nil, nil
+}
+
+func allowAll(context.Context, bc.AssetID, []byte) (bool, error) {
+	return true, nil
+}
+
+// CosignTransfers co-signs every input of tpl that spends a local
+// restricted asset, after checking that the transaction only sends
+// the asset to whitelisted programs.
+func (reg *Registry) CosignTransfers(ctx context.Context, tpl *txbuilder.Template, auth string, signFn txbuilder.SignFunc) error {
+	tx := tpl.Transaction
+	if tx == nil {
+		return errors.Wrap(txbuilder.ErrMissingRawTx)
+	}
+
+	var xpubs []chainkd.XPub
+	for _, si := range tpl.SigningInstructions {
+		in := tx.Inputs[si.Position]
+		_, _, issuerPubkeys, _, err := vmutil.ParseRestrictedTransferProgram(in.ControlProgram())
+		if err != nil {
+			continue
+		}
+		a, err := reg.localRestricted(ctx, in.AssetID())
+		if err != nil {
+			continue
+		}
+		assetPubkeys, _, err := vmutil.ParseP2SPMultiSigProgram(a.IssuanceProgram)
+		if err != nil || !vmutil.SamePubkeys(issuerPubkeys, assetPubkeys) {
+			continue
+		}
+
+		err = txbuilder.CheckRestrictedTransfer(ctx, &tx.TxData, a.AssetID, issuerPubkeys, reg.whitelisted)
+		if err != nil {
+			return err
+		}
+		path := signers.Path(a.Signer, signers.AssetKeySpace)
+		err = txbuilder.AddCosigner(tpl, si, a.Signer.XPubs, path, a.Signer.Quorum)
+		if err != nil {
+			return err
+		}
+		xpubs = append(xpubs, a.Signer.XPubs...)
+	}
+	if len(xpubs) == 0 {
+		return errors.WithDetail(ErrNotRestricted, "transaction spends no restricted assets issued by this core")
+	}
+	return txbuilder.Sign(ctx, tpl, xpubs, auth, signFn)
+}
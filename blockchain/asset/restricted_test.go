@@ -0,0 +1,123 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/signers"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestCosignTransfers(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+
+	xprv, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &signers.Signer{ID: "issuer", Type: "asset", XPubs: []chainkd.XPub{xpub}, Quorum: 1, KeyIndex: 1}
+	path := signers.Path(signer, signers.AssetKeySpace)
+	issuerPubkeys := chainkd.XPubKeys(chainkd.DeriveXPubs(signer.XPubs, path))
+	prog, vmver, err := multisigIssuanceProgram(issuerPubkeys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err = vmutil.RestrictedIssuanceProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Asset{AssetID: bc.NewAssetID([32]byte{1}), VMVersion: vmver, IssuanceProgram: prog, Signer: signer}
+	raw, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.db.Set([]byte(a.AssetID.String()), raw)
+
+	_, holderXPub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holderPub := holderXPub.PublicKey()
+	holderProg, err := vmutil.RestrictedTransferProgram([]ed25519.PublicKey{holderPub}, 1, issuerPubkeys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipientPub, _, _ := ed25519.GenerateKey(nil)
+	recipientProg, err := vmutil.RestrictedTransferProgram([]ed25519.PublicKey{recipientPub}, 1, issuerPubkeys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := vmutil.P2SPMultiSigProgram([]ed25519.PublicKey{recipientPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.AddToWhitelist(ctx, a.AssetID, plain); errors.Root(err) != txbuilder.ErrTransferNotAllowed {
+		t.Errorf("whitelisting plain program: got error %v, want %v", err, txbuilder.ErrTransferNotAllowed)
+	}
+
+	newTemplate := func() *txbuilder.Template {
+		si := &txbuilder.SigningInstruction{}
+		si.AddWitnessKeys([]chainkd.XPub{holderXPub}, nil, 1)
+		return &txbuilder.Template{
+			Transaction: legacy.NewTx(legacy.TxData{
+				Version: 1,
+				Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{}, a.AssetID, 5, 0, holderProg, bc.Hash{}, nil)},
+				Outputs: []*legacy.TxOutput{legacy.NewTxOutput(a.AssetID, 5, recipientProg, nil)},
+			}),
+			SigningInstructions: []*txbuilder.SigningInstruction{si},
+		}
+	}
+	signFn := func(ctx context.Context, xpub chainkd.XPub, path [][]byte, data [32]byte, auth string) ([]byte, error) {
+		return xprv.Derive(path).Sign(data[:]), nil
+	}
+
+	if err := reg.CosignTransfers(ctx, newTemplate(), "", signFn); errors.Root(err) != txbuilder.ErrTransferNotAllowed {
+		t.Fatalf("transfer to unlisted program: got error %v, want %v", err, txbuilder.ErrTransferNotAllowed)
+	}
+
+	if err := reg.AddToWhitelist(ctx, a.AssetID, recipientProg); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := reg.Whitelist(ctx, a.AssetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0].ControlProgram) != string(recipientProg) {
+		t.Errorf("Whitelist = %+v, want the recipient's program", entries)
+	}
+
+	tpl := newTemplate()
+	if err := reg.CosignTransfers(ctx, tpl, "", signFn); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tpl.SigningInstructions[0].SignatureWitnesses); n != 2 {
+		t.Fatalf("got %d witness components, want 2", n)
+	}
+	// Arguments are [0 <no holder sig yet> PRED N ISIG PRED].
+	args := tpl.Transaction.Inputs[0].Arguments()
+	if len(args) != 5 || len(args[3]) != ed25519.SignatureSize {
+		t.Errorf("input arguments = %x, want an issuer signature", args)
+	}
+
+	if err := reg.RemoveFromWhitelist(ctx, a.AssetID, recipientProg); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.CosignTransfers(ctx, newTemplate(), "", signFn); errors.Root(err) != txbuilder.ErrTransferNotAllowed {
+		t.Errorf("transfer after removal: got error %v, want %v", err, txbuilder.ErrTransferNotAllowed)
+	}
+}
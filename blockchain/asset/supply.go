@@ -0,0 +1,330 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/math/checked"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+const (
+	supplyPrefix     = "asset_supply:"
+	issuancePrefix   = "asset_issuance:"
+	retirementPrefix = "asset_retirement:"
+)
+
+// Supply reports how much of an asset has been issued and retired,
+// as of BlockHeight.
+type Supply struct {
+	AssetID     bc.AssetID `json:"asset_id"`
+	Issued      uint64     `json:"issued"`
+	Retired     uint64     `json:"retired"`
+	Circulating uint64     `json:"circulating"`
+	MaxSupply   *uint64    `json:"max_supply,omitempty"`
+	BlockHeight uint64     `json:"block_height"`
+}
+
+// Retirement is a single retirement of some amount of an asset.
+type Retirement struct {
+	AssetID       bc.AssetID       `json:"asset_id"`
+	Amount        uint64           `json:"amount"`
+	BlockHeight   uint64           `json:"block_height"`
+	TxID          bc.Hash          `json:"transaction_id"`
+	Position      int              `json:"position"`
+	ReferenceData *json.RawMessage `json:"reference_data,omitempty"`
+}
+
+// issuance is a single issuance of some amount of an asset. It is
+// kept so that the supply index can be rolled back.
+type issuance struct {
+	AssetID     bc.AssetID `json:"asset_id"`
+	Amount      uint64     `json:"amount"`
+	BlockHeight uint64     `json:"block_height"`
+	TxID        bc.Hash    `json:"transaction_id"`
+	Position    int        `json:"position"`
+}
+
+func calcSupplyKey(id bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%x", supplyPrefix, id.Bytes()))
+}
+
+func calcIssuanceKey(id bc.AssetID, height uint64, txID bc.Hash, pos int) []byte {
+	return []byte(fmt.Sprintf("%s%x:%020d:%x:%06d", issuancePrefix, id.Bytes(), height, txID.Bytes(), pos))
+}
+
+func calcRetirementKey(id bc.AssetID, height uint64, txID bc.Hash, pos int) []byte {
+	return []byte(fmt.Sprintf("%s%x:%020d:%x:%06d", retirementPrefix, id.Bytes(), height, txID.Bytes(), pos))
+}
+
+// Supply returns the indexed supply of the asset. Assets that have
+// not been seen on chain report zero.
+func (reg *Registry) Supply(ctx context.Context, id bc.AssetID) (*Supply, error) {
+	supply, err := reg.storedSupply(id)
+	if err != nil {
+		return nil, err
+	}
+	if a, err := reg.findByID(ctx, id); err == nil {
+		if maxSupply, ok := vmutil.ParseIssuanceCap(a.IssuanceProgram); ok {
+			supply.MaxSupply = &maxSupply
+		}
+	}
+	return supply, nil
+}
+
+func (reg *Registry) storedSupply(id bc.AssetID) (*Supply, error) {
+	supply := &Supply{AssetID: id}
+	if b := reg.db.Get(calcSupplyKey(id)); b != nil {
+		if err := json.Unmarshal(b, supply); err != nil {
+			return nil, errors.Wrap(err, "decoding asset supply")
+		}
+	}
+	return supply, nil
+}
+
+// RetirementHistory returns every retirement of the asset, oldest
+// first.
+func (reg *Registry) RetirementHistory(ctx context.Context, id bc.AssetID) ([]*Retirement, error) {
+	prefix := fmt.Sprintf("%s%x:", retirementPrefix, id.Bytes())
+	var history []*Retirement
+
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), prefix) {
+			continue
+		}
+		r := new(Retirement)
+		if err := json.Unmarshal(iter.Value(), r); err != nil {
+			return nil, errors.Wrap(err, "decoding asset retirement")
+		}
+		history = append(history, r)
+	}
+	return history, nil
+}
+
+// indexSupply adds the issuances and retirements in b to the supply
+// index. Each asset's record remembers the last block counted, so
+// reindexing a block after a crash does not count it twice.
+func (reg *Registry) indexSupply(ctx context.Context, b *legacy.Block) error {
+	supplies := make(map[bc.AssetID]*Supply)
+	get := func(id bc.AssetID) (*Supply, error) {
+		if s, ok := supplies[id]; ok {
+			return s, nil
+		}
+		s, err := reg.storedSupply(id)
+		if err != nil {
+			return nil, err
+		}
+		supplies[id] = s
+		return s, nil
+	}
+
+	var retirements []*Retirement
+	var issuances []*issuance
+	for _, tx := range b.Transactions {
+		for i, in := range tx.Inputs {
+			ii, ok := in.TypedInput.(*legacy.IssuanceInput)
+			if !ok {
+				continue
+			}
+			s, err := get(ii.AssetID())
+			if err != nil {
+				return err
+			}
+			if s.BlockHeight >= b.Height {
+				continue
+			}
+			if s.Issued, ok = checked.AddUint64(s.Issued, ii.Amount); !ok {
+				return errors.Wrap(checked.ErrOverflow, "adding to issued supply")
+			}
+			issuances = append(issuances, &issuance{
+				AssetID:     ii.AssetID(),
+				Amount:      ii.Amount,
+				BlockHeight: b.Height,
+				TxID:        tx.ID,
+				Position:    i,
+			})
+		}
+		// Count the retirement entries consensus counts, so the index
+		// agrees with the retired supply in the state snapshot.
+		for _, id := range tx.ResultIds {
+			e, ok := tx.Entries[*id].(*bc.Retirement)
+			if !ok {
+				continue
+			}
+			value := e.Source.Value
+			s, err := get(*value.AssetId)
+			if err != nil {
+				return err
+			}
+			if s.BlockHeight >= b.Height {
+				continue
+			}
+			if s.Retired, ok = checked.AddUint64(s.Retired, value.Amount); !ok {
+				s.Retired = math.MaxUint64
+			}
+
+			r := &Retirement{
+				AssetID:     *value.AssetId,
+				Amount:      value.Amount,
+				BlockHeight: b.Height,
+				TxID:        tx.ID,
+				Position:    int(e.Ordinal),
+			}
+			if out := tx.Outputs[e.Ordinal]; isJSONObject(out.ReferenceData) {
+				refData := json.RawMessage(out.ReferenceData)
+				r.ReferenceData = &refData
+			}
+			retirements = append(retirements, r)
+		}
+	}
+
+	for _, is := range issuances {
+		raw, err := json.Marshal(is)
+		if err != nil {
+			return errors.Wrap(err, "marshaling asset issuance")
+		}
+		reg.db.Set(calcIssuanceKey(is.AssetID, is.BlockHeight, is.TxID, is.Position), raw)
+	}
+	for _, r := range retirements {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return errors.Wrap(err, "marshaling asset retirement")
+		}
+		reg.db.Set(calcRetirementKey(r.AssetID, r.BlockHeight, r.TxID, r.Position), raw)
+	}
+	for _, s := range supplies {
+		if s.BlockHeight >= b.Height {
+			continue
+		}
+		s.BlockHeight = b.Height
+		if err := reg.saveSupply(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (reg *Registry) saveSupply(s *Supply) error {
+	// Assets created by coinbase transactions are retired without
+	// ever being issued; none of them count as circulating.
+	s.Circulating = 0
+	if s.Retired <= s.Issued {
+		s.Circulating = s.Issued - s.Retired
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "marshaling asset supply")
+	}
+	reg.db.Set(calcSupplyKey(s.AssetID), raw)
+	return nil
+}
+
+// rollbackSupply subtracts from the supply index the issuances and
+// retirements indexed from blocks after height.
+func (reg *Registry) rollbackSupply(ctx context.Context, height uint64) error {
+	type change struct{ issued, retired uint64 }
+	changes := make(map[bc.AssetID]*change)
+	var drop [][]byte
+
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		key := string(iter.Key())
+		var (
+			id          bc.AssetID
+			blockHeight uint64
+			issued      uint64
+			retired     uint64
+		)
+		switch {
+		case strings.HasPrefix(key, issuancePrefix):
+			is := new(issuance)
+			if err := json.Unmarshal(iter.Value(), is); err != nil {
+				return errors.Wrap(err, "decoding asset issuance")
+			}
+			id, blockHeight, issued = is.AssetID, is.BlockHeight, is.Amount
+		case strings.HasPrefix(key, retirementPrefix):
+			r := new(Retirement)
+			if err := json.Unmarshal(iter.Value(), r); err != nil {
+				return errors.Wrap(err, "decoding asset retirement")
+			}
+			id, blockHeight, retired = r.AssetID, r.BlockHeight, r.Amount
+		default:
+			continue
+		}
+		if blockHeight <= height {
+			continue
+		}
+		c, ok := changes[id]
+		if !ok {
+			c = new(change)
+			changes[id] = c
+		}
+		c.issued += issued
+		c.retired += retired
+		drop = append(drop, []byte(key))
+	}
+
+	for id, c := range changes {
+		s, err := reg.storedSupply(id)
+		if err != nil {
+			return err
+		}
+		s.Issued = subFloor(s.Issued, c.issued)
+		// A retired supply that overflowed is left saturated.
+		if s.Retired != math.MaxUint64 {
+			s.Retired = subFloor(s.Retired, c.retired)
+		}
+		if s.BlockHeight > height {
+			s.BlockHeight = height
+		}
+		if err := reg.saveSupply(s); err != nil {
+			return err
+		}
+	}
+	for _, key := range drop {
+		reg.db.Delete(key)
+	}
+	return nil
+}
+
+func subFloor(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// issued returns the amount of a capped asset issued so far, as of
+// the latest block. It is zero for assets without a cap.
+func (reg *Registry) issued(id bc.AssetID) uint64 {
+	_, snapshot := reg.chain.State()
+	if snapshot == nil {
+		return 0
+	}
+	return snapshot.Issued[id]
+}
+
+// checkIssuanceCap reports whether issuing amount more units of a
+// would exceed the maximum supply declared by its issuance program.
+// The check is advisory; consensus enforces the cap when the
+// transaction is applied.
+func (reg *Registry) checkIssuanceCap(a *Asset, amount uint64) error {
+	maxSupply, ok := vmutil.ParseIssuanceCap(a.IssuanceProgram)
+	if !ok {
+		return nil
+	}
+	issued := reg.issued(a.AssetID)
+	total, ok := checked.AddUint64(issued, amount)
+	if !ok || total > maxSupply {
+		return errors.WithDetailf(state.ErrIssuanceCap, "%d of %d units already issued", issued, maxSupply)
+	}
+	return nil
+}
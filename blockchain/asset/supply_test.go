@@ -0,0 +1,100 @@
+package asset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+)
+
+func TestIndexSupply(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+
+	txin := legacy.NewIssuanceInput([]byte{1}, 100, nil, bc.Hash{}, []byte{byte(vm.OP_TRUE)}, nil, nil)
+	assetID := txin.AssetID()
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(assetID, 70, []byte{0xbe, 0xef}, nil),
+			legacy.NewTxOutput(assetID, 30, []byte{byte(vm.OP_FAIL)}, []byte(`{"reason": "burn"}`)),
+		},
+	})
+	b := &legacy.Block{
+		BlockHeader:  legacy.BlockHeader{Height: 5},
+		Transactions: []*legacy.Tx{tx},
+	}
+
+	// Indexing the same block twice must not double count.
+	for i := 0; i < 2; i++ {
+		if err := reg.indexSupply(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	supply, err := reg.Supply(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Supply{AssetID: assetID, Issued: 100, Retired: 30, Circulating: 70, BlockHeight: 5}
+	if *supply != want {
+		t.Errorf("Supply = %+v, want %+v", *supply, want)
+	}
+
+	history, err := reg.RetirementHistory(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d retirements, want 1", len(history))
+	}
+	if r := history[0]; r.Amount != 30 || r.Position != 1 || r.TxID != tx.ID || r.ReferenceData == nil {
+		t.Errorf("retirement = %+v", r)
+	}
+}
+
+func TestIndexSupplyRetiredWithoutIssuance(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+
+	// An asset created by a coinbase transaction is never issued.
+	assetID := bc.NewAssetID([32]byte{1})
+	txin := legacy.NewSpendInput(nil, bc.Hash{}, assetID, 50, 0, []byte{0xbe, 0xef}, bc.Hash{}, nil)
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(assetID, 50, []byte{byte(vm.OP_FAIL)}, nil),
+		},
+	})
+	b := &legacy.Block{
+		BlockHeader:  legacy.BlockHeader{Height: 5},
+		Transactions: []*legacy.Tx{tx},
+	}
+	if err := reg.indexSupply(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	supply, err := reg.Supply(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Supply{AssetID: assetID, Retired: 50, BlockHeight: 5}
+	if *supply != want {
+		t.Errorf("Supply = %+v, want %+v", *supply, want)
+	}
+}
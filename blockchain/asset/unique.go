@@ -0,0 +1,189 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+const (
+	ownerPrefix    = "asset_owner:"
+	transferPrefix = "asset_transfer:"
+)
+
+var (
+	ErrNotUnique     = errors.New("asset is not unique")
+	ErrUniqueAmount  = errors.New("unique assets must be issued in an amount of one")
+	ErrUniqueNotSeen = errors.New("unique asset has not been issued")
+)
+
+// Transfer records a unique asset arriving at a new output, either
+// when it is issued or each time it is spent. The most recent
+// transfer identifies the asset's current owner.
+type Transfer struct {
+	AssetID        bc.AssetID         `json:"asset_id"`
+	OutputID       bc.Hash            `json:"output_id"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	BlockHeight    uint64             `json:"block_height"`
+	TxID           bc.Hash            `json:"transaction_id"`
+	Position       int                `json:"position"`
+	Retired        bool               `json:"retired"`
+}
+
+func calcOwnerKey(id bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%x", ownerPrefix, id.Bytes()))
+}
+
+func calcTransferKey(id bc.AssetID, height uint64, txID bc.Hash, pos int) []byte {
+	return []byte(fmt.Sprintf("%s%x:%020d:%x:%06d", transferPrefix, id.Bytes(), height, txID.Bytes(), pos))
+}
+
+// isUnique reports whether a is a non-fungible asset.
+func isUnique(a *Asset) bool {
+	return vmutil.IsUniqueAsset(a.IssuanceProgram)
+}
+
+// Owner returns the most recent transfer of a unique asset, which
+// identifies the output that currently holds it.
+func (reg *Registry) Owner(ctx context.Context, id bc.AssetID) (*Transfer, error) {
+	a, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isUnique(a) {
+		return nil, errors.WithDetailf(ErrNotUnique, "asset %x", id.Bytes())
+	}
+
+	b := reg.db.Get(calcOwnerKey(id))
+	if b == nil {
+		return nil, errors.WithDetailf(ErrUniqueNotSeen, "asset %x", id.Bytes())
+	}
+	t := new(Transfer)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrap(err, "decoding unique asset owner")
+	}
+	return t, nil
+}
+
+// TransferHistory returns every transfer of a unique asset, starting
+// with its issuance.
+func (reg *Registry) TransferHistory(ctx context.Context, id bc.AssetID) ([]*Transfer, error) {
+	a, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isUnique(a) {
+		return nil, errors.WithDetailf(ErrNotUnique, "asset %x", id.Bytes())
+	}
+
+	prefix := fmt.Sprintf("%s%x:", transferPrefix, id.Bytes())
+	var history []*Transfer
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), prefix) {
+			continue
+		}
+		t := new(Transfer)
+		if err := json.Unmarshal(iter.Value(), t); err != nil {
+			return nil, errors.Wrap(err, "decoding unique asset transfer")
+		}
+		history = append(history, t)
+	}
+	return history, nil
+}
+
+// indexUniqueAssets records every output in b that holds a unique
+// asset. Outputs of zero units carry nothing and are skipped.
+func (reg *Registry) indexUniqueAssets(ctx context.Context, b *legacy.Block) error {
+	unique := make(map[bc.AssetID]bool)
+	for _, tx := range b.Transactions {
+		for i, out := range tx.Outputs {
+			if out.Amount == 0 {
+				continue
+			}
+			assetID := *out.AssetId
+			u, ok := unique[assetID]
+			if !ok {
+				// Assets unknown to the registry were never issued on
+				// this chain and cannot be unique.
+				a, err := reg.findByID(ctx, assetID)
+				u = err == nil && isUnique(a)
+				unique[assetID] = u
+			}
+			if !u {
+				continue
+			}
+
+			t := &Transfer{
+				AssetID:        assetID,
+				OutputID:       *tx.OutputID(i),
+				ControlProgram: out.ControlProgram,
+				BlockHeight:    b.Height,
+				TxID:           tx.ID,
+				Position:       i,
+				Retired:        vmutil.IsUnspendable(out.ControlProgram),
+			}
+			raw, err := json.Marshal(t)
+			if err != nil {
+				return errors.Wrap(err, "marshaling unique asset transfer")
+			}
+			reg.db.Set(calcTransferKey(assetID, b.Height, tx.ID, i), raw)
+			reg.db.Set(calcOwnerKey(assetID), raw)
+		}
+	}
+	return nil
+}
+
+// rollbackUniqueAssets forgets the transfers indexed from blocks after
+// height, returning each unique asset they moved to its last owner
+// before the fork.
+func (reg *Registry) rollbackUniqueAssets(ctx context.Context, height uint64) error {
+	var (
+		drop   [][]byte
+		moved  = make(map[bc.AssetID]bool)
+		owners = make(map[bc.AssetID]*Transfer)
+	)
+	iter := reg.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), transferPrefix) {
+			continue
+		}
+		t := new(Transfer)
+		if err := json.Unmarshal(iter.Value(), t); err != nil {
+			return errors.Wrap(err, "decoding unique asset transfer")
+		}
+		if t.BlockHeight > height {
+			moved[t.AssetID] = true
+			drop = append(drop, append([]byte(nil), iter.Key()...))
+			continue
+		}
+		// Transfer keys sort by height, as TransferHistory lists them.
+		if o, ok := owners[t.AssetID]; !ok || string(iter.Key()) > string(calcTransferKey(o.AssetID, o.BlockHeight, o.TxID, o.Position)) {
+			owners[t.AssetID] = t
+		}
+	}
+
+	for _, key := range drop {
+		reg.db.Delete(key)
+	}
+	for id := range moved {
+		t, ok := owners[id]
+		if !ok {
+			reg.db.Delete(calcOwnerKey(id))
+			continue
+		}
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return errors.Wrap(err, "marshaling unique asset transfer")
+		}
+		reg.db.Set(calcOwnerKey(id), raw)
+	}
+	return nil
+}
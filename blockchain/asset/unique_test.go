@@ -0,0 +1,85 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestIndexUniqueAssets(t *testing.T) {
+	ctx := context.Background()
+	reg := &Registry{
+		db:         dbm.NewMemDB(),
+		cache:      lru.New(maxAssetCache),
+		aliasCache: lru.New(maxAssetCache),
+	}
+
+	prog, err := vmutil.UniqueAssetProgram([]byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txin := legacy.NewIssuanceInput([]byte{1}, 1, nil, bc.Hash{}, prog, nil, nil)
+	assetID := txin.AssetID()
+	a := &Asset{AssetID: assetID, VMVersion: 1, IssuanceProgram: prog}
+	raw, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.db.Set([]byte(assetID.String()), raw)
+
+	issue := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, []byte{0xaa}, nil)},
+	})
+	spend := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *issue.OutputID(0), assetID, 1, 0, []byte{0xaa}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, []byte{0xbb}, nil)},
+	})
+	for i, tx := range []*legacy.Tx{issue, spend} {
+		b := &legacy.Block{
+			BlockHeader:  legacy.BlockHeader{Height: uint64(i + 1)},
+			Transactions: []*legacy.Tx{tx},
+		}
+		if err := reg.indexUniqueAssets(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	owner, err := reg.Owner(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.OutputID != *spend.OutputID(0) || owner.BlockHeight != 2 || string(owner.ControlProgram) != "\xbb" {
+		t.Errorf("Owner = %+v, want output 0 of spend at height 2", owner)
+	}
+
+	history, err := reg.TransferHistory(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].TxID != issue.ID || history[1].TxID != spend.ID {
+		t.Errorf("TransferHistory = %+v, want issuance then spend", history)
+	}
+
+	// Fungible assets have no single owner.
+	other := &Asset{AssetID: bc.NewAssetID([32]byte{9}), IssuanceProgram: []byte{byte(vm.OP_TRUE)}}
+	raw, err = json.Marshal(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.db.Set([]byte(other.AssetID.String()), raw)
+	if _, err := reg.Owner(ctx, other.AssetID); errors.Root(err) != ErrNotUnique {
+		t.Errorf("Owner of fungible asset: got error %v, want %v", err, ErrNotUnique)
+	}
+}
@@ -5,17 +5,48 @@ import (
 	"sync"
 
 	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/blockchain/asset/metadata"
+	"github.com/bytom/blockchain/pseudohsm"
+	"github.com/bytom/blockchain/txbuilder"
 	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/net/http/httperror"
 	"github.com/bytom/net/http/httpjson"
 	"github.com/bytom/net/http/reqid"
 	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/state"
 )
 
+func init() {
+	errorFormatter.Errors[asset.ErrBadIdentifier] = httperror.Info{400, "BTM051", "Either an ID or alias must be provided, but not both"}
+	errorFormatter.Errors[asset.ErrStaleDefinition] = httperror.Info{400, "BTM210", "Asset definition update is not newer than the current definition"}
+	errorFormatter.Errors[asset.ErrSkippedDefinition] = httperror.Info{400, "BTM213", "Asset definition update skips a version"}
+	errorFormatter.Errors[asset.ErrBadDefinitionSignature] = httperror.Info{400, "BTM211", "Asset definition update is not signed by a quorum of issuance keys"}
+	errorFormatter.Errors[asset.ErrBadDefinition] = httperror.Info{400, "BTM212", "Asset definition is not a valid json object"}
+	errorFormatter.Errors[asset.ErrBadAlias] = httperror.Info{400, "BTM220", "Invalid asset alias"}
+	errorFormatter.Errors[asset.ErrAliasTaken] = httperror.Info{400, "BTM221", "Asset alias is already registered"}
+	errorFormatter.Errors[asset.ErrAliasNotFound] = httperror.Info{404, "BTM222", "Asset alias is not registered"}
+	errorFormatter.Errors[asset.ErrBadAliasSequence] = httperror.Info{400, "BTM223", "Asset alias operation has the wrong sequence number"}
+	errorFormatter.Errors[asset.ErrBadAliasSignature] = httperror.Info{400, "BTM224", "Asset alias operation is not signed by a quorum of issuance keys"}
+	errorFormatter.Errors[state.ErrIssuanceCap] = httperror.Info{400, "BTM230", "Issuance exceeds the asset's maximum supply"}
+	errorFormatter.Errors[asset.ErrNotUnique] = httperror.Info{400, "BTM231", "Asset is not unique"}
+	errorFormatter.Errors[asset.ErrUniqueAmount] = httperror.Info{400, "BTM232", "Unique assets must be issued in an amount of one"}
+	errorFormatter.Errors[asset.ErrUniqueNotSeen] = httperror.Info{404, "BTM233", "Unique asset has not been issued"}
+	errorFormatter.Errors[asset.ErrNotRestricted] = httperror.Info{400, "BTM240", "Asset is not a restricted-transfer asset"}
+	errorFormatter.Errors[txbuilder.ErrTransferNotAllowed] = httperror.Info{400, "BTM241", "Transfer of restricted asset is not allowed"}
+	errorFormatter.Errors[txbuilder.ErrNotCosignable] = httperror.Info{400, "BTM242", "Input cannot be co-signed"}
+}
+
 // POST /create-asset
 func (a *BlockchainReactor) createAsset(ctx context.Context, ins []struct {
 	Alias      string
 	RootXPubs  []chainkd.XPub `json:"root_xpubs"`
 	Quorum     int
+	MaxSupply  *uint64 `json:"max_supply"`
+	Unique     bool
+	Restricted bool
 	Definition map[string]interface{}
 	Tags       map[string]interface{}
 
@@ -35,10 +66,23 @@ func (a *BlockchainReactor) createAsset(ctx context.Context, ins []struct {
 			defer wg.Done()
 			defer batchRecover(subctx, &responses[i])
 
+			// A unique asset is one whose maximum supply is a single unit.
+			maxSupply := ins[i].MaxSupply
+			if ins[i].Unique {
+				if maxSupply != nil && *maxSupply != 1 {
+					responses[i] = errors.WithDetail(asset.ErrUniqueAmount, "unique assets have a maximum supply of one")
+					return
+				}
+				one := uint64(1)
+				maxSupply = &one
+			}
+
 			a, err := a.assets.Define(
 				subctx,
 				ins[i].RootXPubs,
 				ins[i].Quorum,
+				maxSupply,
+				ins[i].Restricted,
 				ins[i].Definition,
 				ins[i].Alias,
 				ins[i].Tags,
@@ -93,3 +137,207 @@ func (a *BlockchainReactor) updateAssetTags(ctx context.Context, ins []struct {
 	return responses
 }
 
+
+// POST /get-asset
+// The returned asset carries its latest published definition.
+func (a *BlockchainReactor) getAsset(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (interface{}, error) {
+	ast, err := a.assets.FindByID(ctx, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	return a.assets.AnnotatedLatest(ctx, ast)
+}
+
+// POST /list-asset-definitions
+func (a *BlockchainReactor) listAssetDefinitions(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (interface{}, error) {
+	history, err := a.assets.DefinitionHistory(ctx, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(history), nil
+}
+
+// POST /create-asset-definition-update
+// The returned update must be signed by a quorum of the listed keys
+// and then published with an update_asset_definition action.
+func (a *BlockchainReactor) createAssetDefinitionUpdate(ctx context.Context, in struct {
+	ID         bc.AssetID `json:"id"`
+	Definition map[string]interface{}
+}) (interface{}, error) {
+	update, keys, err := a.assets.NewDefinitionUpdate(ctx, in.ID, in.Definition)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"update":       update,
+		"signing_keys": keys,
+	}, nil
+}
+
+// POST /sign-asset-definition-update
+func (a *BlockchainReactor) signAssetDefinitionUpdate(ctx context.Context, in struct {
+	Update   *asset.DefinitionUpdate `json:"update"`
+	Password string
+}) (*asset.DefinitionUpdate, error) {
+	if in.Update == nil {
+		return nil, httpjson.ErrBadRequest
+	}
+	err := a.assets.SignDefinitionUpdate(ctx, in.Update, a.hsmSignFunc(in.Password))
+	if err != nil {
+		return nil, err
+	}
+	return in.Update, nil
+}
+
+// POST /resolve-asset-alias
+func (a *BlockchainReactor) resolveAssetAlias(ctx context.Context, in struct {
+	Alias string `json:"alias"`
+}) (*asset.AliasRecord, error) {
+	return a.assets.ResolveAlias(ctx, in.Alias)
+}
+
+// POST /list-asset-aliases
+func (a *BlockchainReactor) listAssetAliases(ctx context.Context) (interface{}, error) {
+	aliases, err := a.assets.ListAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(aliases), nil
+}
+
+// POST /create-asset-alias-operation
+// Type is either "register" or "transfer". The returned operation must
+// be signed by a quorum of the listed keys and then published with a
+// publish_asset_alias action.
+func (a *BlockchainReactor) createAssetAliasOperation(ctx context.Context, in struct {
+	Type  string     `json:"type"`
+	Alias string     `json:"alias"`
+	ID    bc.AssetID `json:"asset_id"`
+}) (interface{}, error) {
+	op, keys, err := a.assets.NewAliasOperation(ctx, in.Type, in.Alias, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"operation":    op,
+		"signing_keys": keys,
+	}, nil
+}
+
+// POST /sign-asset-alias-operation
+func (a *BlockchainReactor) signAssetAliasOperation(ctx context.Context, in struct {
+	Operation *asset.AliasOperation `json:"operation"`
+	Password  string
+}) (*asset.AliasOperation, error) {
+	if in.Operation == nil {
+		return nil, httpjson.ErrBadRequest
+	}
+	err := a.assets.SignAliasOperation(ctx, in.Operation, a.hsmSignFunc(in.Password))
+	if err != nil {
+		return nil, err
+	}
+	return in.Operation, nil
+}
+
+// hsmSignFunc returns an asset.SignFunc that signs with the keys held
+// in the reactor's HSM, skipping keys it does not hold.
+func (a *BlockchainReactor) hsmSignFunc(password string) asset.SignFunc {
+	return func(xpub chainkd.XPub, path [][]byte, msg []byte) ([]byte, error) {
+		sig, err := a.hsm.XSign(xpub, path, msg, password)
+		if err == pseudohsm.ErrNoKey {
+			return nil, nil
+		}
+		return sig, err
+	}
+}
+
+// POST /get-asset-supply
+func (a *BlockchainReactor) getAssetSupply(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (*asset.Supply, error) {
+	return a.assets.Supply(ctx, in.ID)
+}
+
+// POST /list-asset-retirements
+func (a *BlockchainReactor) listAssetRetirements(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (interface{}, error) {
+	history, err := a.assets.RetirementHistory(ctx, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(history), nil
+}
+
+// POST /get-unique-asset-owner
+func (a *BlockchainReactor) getUniqueAssetOwner(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (*asset.Transfer, error) {
+	return a.assets.Owner(ctx, in.ID)
+}
+
+// POST /list-unique-asset-transfers
+func (a *BlockchainReactor) listUniqueAssetTransfers(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (interface{}, error) {
+	history, err := a.assets.TransferHistory(ctx, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(history), nil
+}
+
+// POST /add-asset-whitelist
+func (a *BlockchainReactor) addAssetWhitelist(ctx context.Context, in struct {
+	AssetID        bc.AssetID         `json:"asset_id"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+}) error {
+	return a.assets.AddToWhitelist(ctx, in.AssetID, in.ControlProgram)
+}
+
+// POST /remove-asset-whitelist
+func (a *BlockchainReactor) removeAssetWhitelist(ctx context.Context, in struct {
+	AssetID        bc.AssetID         `json:"asset_id"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+}) error {
+	return a.assets.RemoveFromWhitelist(ctx, in.AssetID, in.ControlProgram)
+}
+
+// POST /list-asset-whitelist
+func (a *BlockchainReactor) listAssetWhitelist(ctx context.Context, in struct {
+	AssetID bc.AssetID `json:"asset_id"`
+}) (interface{}, error) {
+	entries, err := a.assets.Whitelist(ctx, in.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(entries), nil
+}
+
+// POST /cosign-restricted-transfers
+func (a *BlockchainReactor) cosignRestrictedTransfers(ctx context.Context, x struct {
+	Auth string
+	Txs  []*txbuilder.Template `json:"transactions"`
+}) []interface{} {
+	resp := make([]interface{}, 0, len(x.Txs))
+	for _, tx := range x.Txs {
+		err := a.assets.CosignTransfers(ctx, tx, x.Auth, a.pseudohsmSignTemplate)
+		if err != nil {
+			resp = append(resp, errorFormatter.Format(err))
+		} else {
+			resp = append(resp, tx)
+		}
+	}
+	return resp
+}
+
+// POST /get-asset-metadata
+func (a *BlockchainReactor) getAssetMetadata(ctx context.Context, in struct {
+	ID bc.AssetID `json:"id"`
+}) (*metadata.Metadata, error) {
+	return a.metadata.Resolve(ctx, in.ID)
+}
@@ -0,0 +1,15 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/protocol/audit"
+)
+
+// POST /verify-chain
+//
+// The audit replays the whole chain, so it takes a while on a long
+// one.
+func (a *BlockchainReactor) verifyChain(ctx context.Context) (*audit.Report, error) {
+	return audit.Verify(ctx, a.chain, true)
+}
@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/bytom/blockchain/blockfile"
+	"github.com/bytom/errors"
+	"github.com/bytom/net/http/httperror"
+)
+
+var errBadFileName = errors.New("invalid file name")
+
+func init() {
+	errorFormatter.Errors[blockfile.ErrBadFormat] = httperror.Info{400, "BTM295", "Invalid block file"}
+	errorFormatter.Errors[blockfile.ErrMismatch] = httperror.Info{400, "BTM296", "Block file does not match the blockchain"}
+	errorFormatter.Errors[errBadFileName] = httperror.Info{400, "BTM297", "Invalid file name"}
+}
+
+// SetExportDir sets the directory holding the files the API exports
+// and imports. The API reads and writes no files outside it.
+func (a *BlockchainReactor) SetExportDir(dir string) {
+	a.exportDir = dir
+}
+
+// exportPath returns the path of the file with the given name in the
+// export directory, creating the directory if need be.
+func (a *BlockchainReactor) exportPath(name string) (string, error) {
+	if a.exportDir == "" {
+		return "", errors.WithDetail(errBadFileName, "this core has no export directory")
+	}
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", errors.WithDetailf(errBadFileName, "%q is not a file name", name)
+	}
+	if err := os.MkdirAll(a.exportDir, 0700); err != nil {
+		return "", errors.Wrap(err, "creating export directory")
+	}
+	return filepath.Join(a.exportDir, name), nil
+}
+
+// POST /export-blocks
+//
+// The file is created in the core's export directory.
+func (a *BlockchainReactor) exportBlocks(ctx context.Context, in struct {
+	Name        string `json:"name"`
+	StartHeight uint64 `json:"start_height"`
+	EndHeight   uint64 `json:"end_height"`
+}) (map[string]interface{}, error) {
+	path, err := a.exportPath(in.Name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating block file")
+	}
+	n, err := blockfile.Export(ctx, f, a.chain, in.StartHeight, in.EndHeight)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Wrap(err, "closing block file")
+	}
+	return map[string]interface{}{"count": n}, nil
+}
+
+// POST /import-blocks
+//
+// The file is read from the core's export directory.
+func (a *BlockchainReactor) importBlocks(ctx context.Context, in struct {
+	Name string `json:"name"`
+}) (map[string]interface{}, error) {
+	path, err := a.exportPath(in.Name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening block file")
+	}
+	defer f.Close()
+
+	n, err := blockfile.Import(ctx, f, a.chain)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"count":  n,
+		"height": a.chain.Height(),
+	}, nil
+}
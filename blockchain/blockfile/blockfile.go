@@ -0,0 +1,192 @@
+// Package blockfile reads and writes blocks in a flat file, so a node
+// can be bootstrapped from a trusted local copy of the chain instead of
+// downloading it from peers.
+//
+// A block file starts with an identifying header, followed by each
+// block in turn as a uvarint length and the block's serialized bytes.
+// Blocks are written in height order.
+package blockfile
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// header starts every block file. Its last byte is the format
+// version.
+const header = "BTMBLOCKS\x01"
+
+// MaxBlockSize limits the size of a serialized block read from a
+// file.
+const MaxBlockSize = 64 << 20
+
+var (
+	// ErrBadFormat is returned when a file is not a block file, or is
+	// truncated or corrupt.
+	ErrBadFormat = errors.New("invalid block file")
+
+	// ErrMismatch is returned when a file's blocks do not extend the
+	// chain they are imported into.
+	ErrMismatch = errors.New("block file does not match chain")
+)
+
+// A Chain is the chain blocks are exported from or imported into.
+// protocol.Chain implements it.
+type Chain interface {
+	Height() uint64
+	GetBlock(height uint64) (*legacy.Block, error)
+	AddBlock(ctx context.Context, block *legacy.Block) error
+}
+
+// Writer writes blocks to a block file.
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter writes the block file header to w and returns a Writer
+// for its blocks. Call Flush when done.
+func NewWriter(w io.Writer) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(header); err != nil {
+		return nil, errors.Wrap(err, "writing header")
+	}
+	return &Writer{w: bw, buf: make([]byte, binary.MaxVarintLen64)}, nil
+}
+
+// WriteBlock appends b to the file.
+func (w *Writer) WriteBlock(b *legacy.Block) error {
+	v, err := b.Value()
+	if err != nil {
+		return errors.Wrapf(err, "serializing block %d", b.Height)
+	}
+	data := v.([]byte)
+	n := binary.PutUvarint(w.buf, uint64(len(data)))
+	if _, err := w.w.Write(w.buf[:n]); err != nil {
+		return err
+	}
+	_, err = w.w.Write(data)
+	return err
+}
+
+// Flush writes any buffered blocks to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads blocks from a block file.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader reads the block file header from r and returns a Reader
+// for its blocks.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	h := make([]byte, len(header))
+	if _, err := io.ReadFull(br, h); err != nil {
+		return nil, errors.WithDetail(ErrBadFormat, "missing header")
+	}
+	if string(h) != header {
+		return nil, errors.WithDetail(ErrBadFormat, "unrecognized header")
+	}
+	return &Reader{r: br}, nil
+}
+
+// ReadBlock returns the next block in the file, or io.EOF at the end
+// of the file.
+func (r *Reader) ReadBlock() (*legacy.Block, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.WithDetail(ErrBadFormat, "truncated block length")
+	}
+	if size > MaxBlockSize {
+		return nil, errors.WithDetailf(ErrBadFormat, "block of %d bytes exceeds the limit", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, errors.WithDetail(ErrBadFormat, "truncated block")
+	}
+	b := new(legacy.Block)
+	if err := b.Scan(data); err != nil {
+		return nil, errors.WithDetail(ErrBadFormat, err.Error())
+	}
+	return b, nil
+}
+
+// Export writes the blocks of c from height start to end inclusive to
+// w, and returns the number of blocks written. An end of 0, or past
+// the chain's height, means the chain's height.
+func Export(ctx context.Context, w io.Writer, c Chain, start, end uint64) (uint64, error) {
+	if height := c.Height(); end == 0 || end > height {
+		end = height
+	}
+	bw, err := NewWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for h := start; h <= end; h++ {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		b, err := c.GetBlock(h)
+		if err != nil {
+			return n, errors.Wrapf(err, "getting block %d", h)
+		}
+		if err := bw.WriteBlock(b); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, bw.Flush()
+}
+
+// Import adds the blocks read from r to c, validating each one, and
+// returns the number of blocks added. Blocks c already has are
+// checked against it and skipped, so an import can resume where an
+// earlier one stopped.
+func Import(ctx context.Context, r io.Reader, c Chain) (uint64, error) {
+	br, err := NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		b, err := br.ReadBlock()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		height := c.Height()
+		if b.Height <= height {
+			have, err := c.GetBlock(b.Height)
+			if err != nil {
+				return n, errors.Wrapf(err, "getting block %d", b.Height)
+			}
+			if have.Hash() != b.Hash() {
+				return n, errors.WithDetailf(ErrMismatch, "block %d differs from the chain's", b.Height)
+			}
+			continue
+		}
+		if b.Height != height+1 {
+			return n, errors.WithDetailf(ErrMismatch, "block %d does not follow the chain's height %d", b.Height, height)
+		}
+		if err := c.AddBlock(ctx, b); err != nil {
+			return n, errors.Wrapf(err, "adding block %d", b.Height)
+		}
+		n++
+	}
+}
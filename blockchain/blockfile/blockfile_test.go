@@ -0,0 +1,124 @@
+package blockfile
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/prottest"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := prottest.NewChain(t)
+	txPool := prottest.TxPool(src)
+	if _, err := mining.Generate(ctx, src, txPool, 3, []byte{0x51, 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := Export(ctx, &buf, src, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("exported %d blocks, want 4", n)
+	}
+	file := buf.Bytes()
+
+	dst := prottest.NewChain(t)
+	n, err = Import(ctx, bytes.NewReader(file), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || dst.Height() != src.Height() {
+		t.Fatalf("imported %d blocks to height %d, want 3 to height %d", n, dst.Height(), src.Height())
+	}
+	for h := uint64(0); h <= src.Height(); h++ {
+		want, _ := src.GetBlock(h)
+		got, _ := dst.GetBlock(h)
+		if got.Hash() != want.Hash() {
+			t.Errorf("block %d: got %v, want %v", h, got.Hash(), want.Hash())
+		}
+	}
+
+	// Importing again adds nothing.
+	n, err = Import(ctx, bytes.NewReader(file), dst)
+	if err != nil || n != 0 {
+		t.Errorf("reimport: got %d, %v", n, err)
+	}
+
+	// A part of the chain starting past the importing chain's height
+	// does not extend it.
+	buf.Reset()
+	if _, err := Export(ctx, &buf, src, 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	fresh := prottest.NewChain(t)
+	if _, err := Import(ctx, &buf, fresh); errors.Root(err) != ErrMismatch {
+		t.Errorf("gap: got error %v, want %v", err, ErrMismatch)
+	}
+
+	// Nor does a chain that has blocks of its own.
+	other := prottest.NewChain(t)
+	otherPool := prottest.TxPool(other)
+	if _, err := mining.Generate(ctx, other, otherPool, 1, []byte{0x51, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(ctx, bytes.NewReader(file), other); errors.Root(err) != ErrMismatch {
+		t.Errorf("fork: got error %v, want %v", err, ErrMismatch)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+	src := prottest.NewChain(t)
+	txPool := prottest.TxPool(src)
+	if _, err := mining.Generate(ctx, src, txPool, 2, []byte{0x51, 1}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := Export(ctx, &buf, src, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+
+	cases := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"empty", nil, ErrBadFormat},
+		{"header", []byte("BTMBLOCKS\x02"), ErrBadFormat},
+		{"truncated", file[:len(file)-1], ErrBadFormat},
+	}
+	for _, c := range cases {
+		dst := prottest.NewChain(t)
+		if _, err := Import(ctx, bytes.NewReader(c.file), dst); errors.Root(err) != c.want {
+			t.Errorf("%s: got error %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// A block that fails validation is not added.
+	b, _ := src.GetBlock(1)
+	bad := *b
+	bad.TransactionsMerkleRoot = bc.Hash{V0: 1}
+	buf.Reset()
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBlock(&bad); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	dst := prottest.NewChain(t)
+	if n, err := Import(ctx, &buf, dst); err == nil || n != 0 || dst.Height() != 0 {
+		t.Errorf("invalid block: imported %d blocks to height %d, error %v", n, dst.Height(), err)
+	}
+}
@@ -0,0 +1,23 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// POST /get-block-height
+func (a *BlockchainReactor) getBlockHeight(ctx context.Context) map[string]uint64 {
+	return map[string]uint64{"block_height": a.height()}
+}
+
+// POST /get-block
+func (a *BlockchainReactor) getBlock(ctx context.Context, in struct {
+	BlockHeight uint64 `json:"block_height"`
+}) (map[string]*legacy.Block, error) {
+	b, err := a.chain.GetBlock(in.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*legacy.Block{"block": b}, nil
+}
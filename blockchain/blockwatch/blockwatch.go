@@ -0,0 +1,192 @@
+// Package blockwatch feeds each block committed to a chain, in order,
+// to an indexer, resuming where a previous run stopped.
+//
+// A Watcher stores its progress, the height of the last block it
+// indexed, in a database. It retries a block it cannot get, backing
+// off, rather than giving up. Before indexing a block it checks that
+// the block builds on the last one indexed. If not, the chain has
+// reorganized: the watcher finds the fork and has the indexer roll
+// back what it indexed after it.
+package blockwatch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	// keepHashes is how many hashes of the latest blocks indexed are
+	// kept to find a fork.
+	keepHashes = 1000
+)
+
+var (
+	// ErrReorg is returned when the chain reorganizes and the
+	// watcher cannot roll back to the fork.
+	ErrReorg = errors.New("chain reorganized")
+)
+
+// A Chain is a chain whose blocks are watched. *protocol.Chain
+// implements it.
+type Chain interface {
+	BlockWaiter(height uint64) <-chan struct{}
+	GetBlock(height uint64) (*legacy.Block, error)
+}
+
+// A CancelableChain is a Chain that can stop waiting for a block when
+// a context is done. A watcher uses WaitForBlock, if its chain has
+// it, so that a chain waiting by polling stops with the watcher.
+type CancelableChain interface {
+	Chain
+	WaitForBlock(ctx context.Context, height uint64) <-chan struct{}
+}
+
+// Watcher feeds the blocks of Chain to Index.
+type Watcher struct {
+	// Name describes the watcher in log messages.
+	Name string
+
+	Chain Chain
+	DB    dbm.DB
+
+	// Key is the database key holding the height of the last block
+	// indexed. The hashes of the latest blocks indexed are kept under
+	// keys beginning with it.
+	Key string
+
+	// Index indexes a block. An error is logged, and the block is not
+	// indexed again.
+	Index func(ctx context.Context, b *legacy.Block) error
+
+	// Rollback undoes the indexing of the blocks after height, when
+	// the chain forks after it. If Rollback is nil or fails, the
+	// watcher does not index the new branch; it logs the error and
+	// tries again later.
+	Rollback func(ctx context.Context, height uint64) error
+}
+
+// Height returns the height of the last block indexed.
+func (w *Watcher) Height() uint64 {
+	b := w.DB.Get([]byte(w.Key))
+	if b == nil {
+		return 0
+	}
+	height, _ := strconv.ParseUint(string(b), 10, 64)
+	return height
+}
+
+// Run indexes each block after the last one indexed as it is
+// committed to the chain. It returns when ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	height := w.Height()
+	backoff := minBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wait(ctx, height+1):
+		}
+
+		next, err := w.next(ctx, height)
+		if err != nil {
+			log.Printkv(ctx, log.KeyError, err, "at", w.Name, "height", height+1, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+		height = next
+	}
+}
+
+func (w *Watcher) wait(ctx context.Context, height uint64) <-chan struct{} {
+	if c, ok := w.Chain.(CancelableChain); ok {
+		return c.WaitForBlock(ctx, height)
+	}
+	return w.Chain.BlockWaiter(height)
+}
+
+// next indexes the block after height, or rolls back if the chain
+// has forked. It returns the new height indexed.
+func (w *Watcher) next(ctx context.Context, height uint64) (uint64, error) {
+	b, err := w.Chain.GetBlock(height + 1)
+	if err != nil {
+		return height, errors.Wrapf(err, "getting block %d", height+1)
+	}
+	if prev, ok := w.hash(height); ok && b.PreviousBlockHash != prev {
+		return w.rollback(ctx, height)
+	}
+
+	if err := w.Index(ctx, b); err != nil {
+		log.Printkv(ctx, log.KeyError, err, "at", w.Name, "height", b.Height)
+	}
+	w.DB.Set(w.hashKey(b.Height), b.Hash().Bytes())
+	if b.Height > keepHashes {
+		w.DB.Delete(w.hashKey(b.Height - keepHashes))
+	}
+	w.DB.SetSync([]byte(w.Key), []byte(strconv.FormatUint(b.Height, 10)))
+	return b.Height, nil
+}
+
+// rollback finds where the chain forked from the blocks indexed up to
+// height and rolls back to it.
+func (w *Watcher) rollback(ctx context.Context, height uint64) (uint64, error) {
+	fork := height
+	for ; fork > 0; fork-- {
+		indexed, ok := w.hash(fork)
+		if !ok {
+			return height, errors.WithDetailf(ErrReorg, "fork is more than %d blocks deep", height-fork)
+		}
+		b, err := w.Chain.GetBlock(fork)
+		if err != nil {
+			return height, errors.Wrapf(err, "getting block %d", fork)
+		}
+		if b.Hash() == indexed {
+			break
+		}
+	}
+	if w.Rollback == nil {
+		return height, errors.WithDetailf(ErrReorg, "chain forks after block %d", fork)
+	}
+	if err := w.Rollback(ctx, fork); err != nil {
+		return height, errors.Wrapf(err, "rolling back to block %d", fork)
+	}
+	for h := fork + 1; h <= height; h++ {
+		w.DB.Delete(w.hashKey(h))
+	}
+	w.DB.SetSync([]byte(w.Key), []byte(strconv.FormatUint(fork, 10)))
+	log.Printf(ctx, "%s: chain reorganized, rolled back from block %d to %d", w.Name, height, fork)
+	return fork, nil
+}
+
+func (w *Watcher) hashKey(height uint64) []byte {
+	return []byte(fmt.Sprintf("%s:%d", w.Key, height))
+}
+
+func (w *Watcher) hash(height uint64) (bc.Hash, bool) {
+	b := w.DB.Get(w.hashKey(height))
+	if len(b) != 32 {
+		return bc.Hash{}, false
+	}
+	var b32 [32]byte
+	copy(b32[:], b)
+	return bc.NewHash(b32), true
+}
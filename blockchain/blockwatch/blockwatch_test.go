@@ -0,0 +1,173 @@
+package blockwatch
+
+import (
+	"context"
+	"testing"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+type testChain struct {
+	blocks []*legacy.Block // blocks[i] has height i
+	fail   int             // number of GetBlock calls left to fail
+}
+
+var errTest = errors.New("test error")
+
+func (c *testChain) BlockWaiter(height uint64) <-chan struct{} {
+	ch := make(chan struct{})
+	if height < uint64(len(c.blocks)) {
+		close(ch)
+	}
+	return ch
+}
+
+func (c *testChain) GetBlock(height uint64) (*legacy.Block, error) {
+	if c.fail > 0 {
+		c.fail--
+		return nil, errTest
+	}
+	if height >= uint64(len(c.blocks)) {
+		return nil, errors.New("no such block")
+	}
+	return c.blocks[height], nil
+}
+
+// extend appends n blocks to c after the block at height, dropping
+// any blocks above it. The salt distinguishes the new blocks from
+// blocks previously at the same heights.
+func (c *testChain) extend(height uint64, n int, salt uint64) {
+	c.blocks = c.blocks[:height+1]
+	for i := 0; i < n; i++ {
+		prev := c.blocks[len(c.blocks)-1]
+		c.blocks = append(c.blocks, &legacy.Block{BlockHeader: legacy.BlockHeader{
+			Height:            prev.Height + 1,
+			PreviousBlockHash: prev.Hash(),
+			Nonce:             salt,
+		}})
+	}
+}
+
+func newTestChain(n int) *testChain {
+	c := &testChain{blocks: []*legacy.Block{{}}}
+	c.extend(0, n, 0)
+	return c
+}
+
+func TestWatcherRetries(t *testing.T) {
+	ctx := context.Background()
+	c := newTestChain(2)
+	var indexed []uint64
+	w := &Watcher{
+		Chain: c,
+		DB:    dbm.NewMemDB(),
+		Key:   "test_height",
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			indexed = append(indexed, b.Height)
+			return nil
+		},
+	}
+
+	c.fail = 1
+	if _, err := w.next(ctx, 0); errors.Root(err) != errTest {
+		t.Fatalf("got error %v, want %v", err, errTest)
+	}
+	if w.Height() != 0 {
+		t.Fatalf("height after failure = %d, want 0", w.Height())
+	}
+	for h := uint64(0); h < 2; h++ {
+		if _, err := w.next(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(indexed) != 2 || indexed[0] != 1 || indexed[1] != 2 {
+		t.Errorf("indexed %v, want [1 2]", indexed)
+	}
+	if w.Height() != 2 {
+		t.Errorf("height = %d, want 2", w.Height())
+	}
+}
+
+func TestWatcherReorg(t *testing.T) {
+	ctx := context.Background()
+	c := newTestChain(4)
+	indexed := make(map[uint64]bc.Hash)
+	w := &Watcher{
+		Chain: c,
+		DB:    dbm.NewMemDB(),
+		Key:   "test_height",
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			indexed[b.Height] = b.Hash()
+			return nil
+		},
+	}
+	height := uint64(0)
+	for height < 4 {
+		var err error
+		height, err = w.next(ctx, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The chain forks after block 2 and the new branch is longer.
+	c.extend(2, 3, 1)
+
+	if _, err := w.next(ctx, height); errors.Root(err) != ErrReorg {
+		t.Fatalf("without Rollback: got error %v, want %v", err, ErrReorg)
+	}
+	if w.Height() != 4 {
+		t.Fatalf("height after failed rollback = %d, want 4", w.Height())
+	}
+
+	w.Rollback = func(ctx context.Context, height uint64) error {
+		for h := range indexed {
+			if h > height {
+				delete(indexed, h)
+			}
+		}
+		return nil
+	}
+	height, err := w.next(ctx, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 2 || w.Height() != 2 {
+		t.Fatalf("rolled back to %d (stored %d), want 2", height, w.Height())
+	}
+	for height < 5 {
+		height, err = w.next(ctx, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := uint64(1); h <= 5; h++ {
+		if indexed[h] != c.blocks[h].Hash() {
+			t.Errorf("block %d indexed from the wrong branch", h)
+		}
+	}
+}
+
+func TestWatcherRunStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newTestChain(3)
+	w := &Watcher{
+		Chain: c,
+		DB:    dbm.NewMemDB(),
+		Key:   "test_height",
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			if b.Height == 3 {
+				cancel()
+			}
+			return nil
+		},
+	}
+	w.Run(ctx)
+	if w.Height() != 3 {
+		t.Errorf("height = %d, want 3", w.Height())
+	}
+}
@@ -0,0 +1,454 @@
+// Package channel implements bidirectional payment channels between
+// accounts on two cores.
+//
+// A channel is opened by paying its capacity to a funding output that
+// can only be spent with signatures from both parties. Payments are
+// then made off chain: the parties sign new commitment transactions
+// spending the funding output with the new balances, and revoke the
+// old ones. Either party can close the channel at any time, together
+// by signing a transaction paying each its balance, or alone by
+// submitting its latest commitment.
+//
+// Commitments are asymmetric. In the commitment held by each party,
+// the other party's balance is paid straight to it, and the holder's
+// own balance is locked in an HTLC whose hash is a revocation hash
+// chosen by the holder:
+//
+//   - the holder can claim it, as the HTLC's sender, once the
+//     channel's dispute deadline has passed;
+//   - the other party can claim it at any time, as the HTLC's
+//     recipient, with the preimage of the revocation hash.
+//
+// When a commitment is replaced, its holder reveals the preimage to
+// the other party, which can then take the whole balance if the
+// revoked commitment is ever submitted. Commitments expire when the
+// channel does, so there is always a dispute period between the last
+// commitment and the dispute deadline.
+//
+// Channel keys are HTLC keys of the parties' accounts, so the
+// account manager's HTLC index finds the outputs of a commitment on
+// chain and they can be claimed with the redeem_htlc and refund_htlc
+// actions.
+package channel
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/account"
+	"github.com/bytom/blockchain/rpc"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/consensus"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Channel statuses.
+const (
+	StatusOpening  = "opening"  // funding transaction not yet on chain
+	StatusOpen     = "open"     // funded; payments can be made
+	StatusClosing  = "closing"  // closing transaction submitted
+	StatusClosed   = "closed"   // funding output spent
+	StatusBreached = "breached" // a revoked commitment was submitted
+)
+
+const (
+	channelPrefix  = "channel:"
+	proposalPrefix = "channel_proposal:"
+	blockHeightKey = "channel_block_height"
+
+	defaultDisputePeriod = 24 * time.Hour
+	defaultFee           = 10000000
+	fundingTTL           = 5 * time.Minute
+
+	// forceCloseMargin is how long before a channel expires the
+	// manager closes it alone, so that the latest commitment is on
+	// chain before it stops being valid.
+	forceCloseMargin = 10 * time.Minute
+)
+
+var (
+	ErrChannelNotFound = errors.New("channel not found")
+	ErrBadChannel      = errors.New("invalid channel parameters")
+	ErrChannelState    = errors.New("channel is not in a state that allows this")
+	ErrChannelBusy     = errors.New("channel has an update in progress")
+	ErrBalance         = errors.New("channel balance too low")
+	ErrLocked          = errors.New("channel account is locked")
+	ErrBadRevocation   = errors.New("revocation secret does not match")
+)
+
+// A Chain is the blockchain on which channels are funded.
+// *protocol.Chain implements it.
+type Chain interface {
+	BlockWaiter(height uint64) <-chan struct{}
+	GetBlock(height uint64) (*legacy.Block, error)
+}
+
+// A Submitter sends a fully signed transaction to the chain.
+type Submitter interface {
+	Submit(ctx context.Context, tx *legacy.Tx) error
+}
+
+// A Wallet holds the accounts that fund channels and receive their
+// payouts. *account.Manager implements it.
+type Wallet interface {
+	CreateHTLCKey(ctx context.Context, accountID string) (*account.HTLCKey, error)
+	HTLCKeyPath(ctx context.Context, k *account.HTLCKey) ([]chainkd.XPub, [][]byte, error)
+	CreateControlProgram(ctx context.Context, accountID string, change bool, expiresAt time.Time) ([]byte, error)
+	NewSpendAction(amt bc.AssetAmount, accountID string, refData chainjson.Map, clientToken *string) txbuilder.Action
+}
+
+// A Signer signs with the keys of this core. *pseudohsm.HSM
+// implements it.
+type Signer interface {
+	XSign(xpub chainkd.XPub, path [][]byte, msg []byte, auth string) ([]byte, error)
+}
+
+// A Peer is the core of the other party to a channel. *rpc.Client
+// implements it.
+type Peer interface {
+	Call(ctx context.Context, path string, request, response interface{}) error
+}
+
+// Key is one party's keys in a channel: its account's xpubs, the
+// path along which they are derived, and the number of signatures
+// required.
+type Key struct {
+	XPubs  []chainkd.XPub       `json:"xpubs"`
+	Path   []chainjson.HexBytes `json:"derivation_path"`
+	Quorum int                  `json:"quorum"`
+}
+
+func (k *Key) path() [][]byte {
+	path := make([][]byte, 0, len(k.Path))
+	for _, p := range k.Path {
+		path = append(path, p)
+	}
+	return path
+}
+
+func (k *Key) pubkeys() []ed25519.PublicKey {
+	return chainkd.XPubKeys(chainkd.DeriveXPubs(k.XPubs, k.path()))
+}
+
+func (k *Key) check() error {
+	if k == nil || len(k.XPubs) == 0 || k.Quorum < 1 || k.Quorum > len(k.XPubs) {
+		return errors.WithDetail(ErrBadChannel, "bad channel key")
+	}
+	return nil
+}
+
+// Funding is the output that funds a channel. BlockHeight is the
+// height of the block that includes it, once one does.
+type Funding struct {
+	OutputID    bc.Hash `json:"output_id"`
+	SourceID    bc.Hash `json:"source_id"`
+	SourcePos   uint64  `json:"source_pos"`
+	RefDataHash bc.Hash `json:"ref_data_hash"`
+	TxID        bc.Hash `json:"transaction_id"`
+	BlockHeight uint64  `json:"block_height,omitempty"`
+}
+
+// Breach is a revoked commitment submitted by the other party. The
+// local account can take the other party's balance from OutputID by
+// redeeming it as an HTLC with Preimage. The manager does so as soon
+// as it sees the breach, while the account is unlocked.
+type Breach struct {
+	TxID     bc.Hash            `json:"transaction_id"`
+	State    uint64             `json:"state"`
+	OutputID bc.Hash            `json:"output_id"`
+	Preimage chainjson.HexBytes `json:"preimage"`
+
+	// The breached output, to spend it.
+	SourceID       bc.Hash            `json:"source_id"`
+	SourcePos      uint64             `json:"source_pos"`
+	RefDataHash    bc.Hash            `json:"ref_data_hash"`
+	Amount         uint64             `json:"amount"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+
+	// RedeemTxID is the transaction taking the output, once
+	// submitted.
+	RedeemTxID *bc.Hash `json:"redeem_transaction_id,omitempty"`
+}
+
+// Channel is one side of a payment channel, as seen by the party
+// whose account is AccountID.
+type Channel struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"account_id"`
+	Opener    bool       `json:"opener"`
+	Status    string     `json:"status"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Capacity  uint64     `json:"capacity"`
+
+	// Fee is left unspent by every transaction spending the funding
+	// output, to pay for its gas. It comes out of the opener's side,
+	// so the balances always add up to Capacity less Fee.
+	Fee uint64 `json:"fee"`
+
+	// No commitment is valid after ExpiresAt, and a party that
+	// closes alone can claim its balance after DisputeDeadline.
+	ExpiresAt       time.Time `json:"expires_at"`
+	DisputeDeadline time.Time `json:"dispute_deadline"`
+
+	LocalKey     *Key               `json:"local_key"`
+	RemoteKey    *Key               `json:"remote_key"`
+	LocalPayout  chainjson.HexBytes `json:"local_control_program"`
+	RemotePayout chainjson.HexBytes `json:"remote_control_program"`
+	Funding      *Funding           `json:"funding,omitempty"`
+
+	// State counts the commitments signed so far.
+	State         uint64 `json:"state"`
+	LocalBalance  uint64 `json:"local_balance"`
+	RemoteBalance uint64 `json:"remote_balance"`
+
+	// Commitment is the local party's latest commitment, signed by
+	// the other party.
+	Commitment *txbuilder.Template `json:"commitment,omitempty"`
+
+	// LocalSecret is the preimage of the revocation hash in
+	// Commitment, and NextLocalSecret that of the next commitment.
+	LocalSecret     chainjson.HexBytes `json:"local_secret"`
+	NextLocalSecret chainjson.HexBytes `json:"next_local_secret"`
+
+	// RemoteHash is the revocation hash in the other party's oldest
+	// unrevoked commitment, and NextRemoteHash that of the one after.
+	RemoteHash     chainjson.HexBytes `json:"remote_hash"`
+	NextRemoteHash chainjson.HexBytes `json:"next_remote_hash"`
+
+	// AwaitingRevocation is set after the other party pays, until it
+	// revokes its previous commitment. UnsentRevocation is set after
+	// the local party pays, until the other party has received the
+	// revocation of its previous commitment.
+	AwaitingRevocation bool        `json:"awaiting_revocation"`
+	UnsentRevocation   *Revocation `json:"unsent_revocation,omitempty"`
+
+	// RemoteSecrets are the secrets revoking each of the other
+	// party's commitments, by state.
+	RemoteSecrets []chainjson.HexBytes `json:"remote_secrets"`
+
+	PeerURL         string `json:"peer_url"`
+	PeerAccessToken string `json:"-"`
+
+	// ClosingTxID is the transaction spending the funding output,
+	// once submitted; ClosingHeight is the height of the block that
+	// includes it.
+	ClosingTxID   *bc.Hash `json:"closing_transaction_id,omitempty"`
+	ClosingHeight uint64   `json:"closing_block_height,omitempty"`
+	Breach        *Breach  `json:"breach,omitempty"`
+}
+
+// record is how a channel is stored. Unlike its JSON form in the
+// API, it keeps the peer's access token.
+type record struct {
+	*Channel
+	PeerAccessToken string `json:"peer_access_token"`
+}
+
+// Manager keeps this core's side of its channels.
+type Manager struct {
+	db        dbm.DB
+	chain     Chain
+	submitter Submitter
+	wallet    Wallet
+	signer    Signer
+
+	// Dial returns the peer at url. The default dials it over RPC.
+	Dial func(url, accessToken string) Peer
+
+	mu   sync.Mutex
+	auth map[string]string // account ID -> signing password
+	busy map[string]bool   // channel ID -> update in progress
+}
+
+// NewManager returns a manager storing channels in db.
+func NewManager(db dbm.DB, chain Chain, submitter Submitter, wallet Wallet, signer Signer) *Manager {
+	return &Manager{
+		db:        db,
+		chain:     chain,
+		submitter: submitter,
+		wallet:    wallet,
+		signer:    signer,
+		Dial:      dialRPC,
+		auth:      make(map[string]string),
+		busy:      make(map[string]bool),
+	}
+}
+
+func dialRPC(url, accessToken string) Peer {
+	return &rpc.Client{BaseURL: url, AccessToken: accessToken, Client: new(http.Client)}
+}
+
+// Unlock lets the manager sign with accountID's keys using password
+// until the core restarts. The other party to a channel asks for
+// signatures at any time, so an account's channels can only be used
+// while it is unlocked.
+func (m *Manager) Unlock(ctx context.Context, accountID, password string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auth[accountID] = password
+}
+
+func (m *Manager) password(accountID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	password, ok := m.auth[accountID]
+	if !ok {
+		return "", errors.WithDetailf(ErrLocked, "account %s", accountID)
+	}
+	return password, nil
+}
+
+// acquire marks the channel as having an update in progress, failing
+// if it already has one. Updates are not serialized with a lock, as
+// both parties may start one at once, each waiting on the other.
+func (m *Manager) acquire(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy[id] {
+		return errors.WithDetailf(ErrChannelBusy, "channel %s", id)
+	}
+	m.busy[id] = true
+	return nil
+}
+
+func (m *Manager) release(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.busy, id)
+}
+
+// sign adds the local party's signatures to tpl.
+func (m *Manager) sign(ctx context.Context, c *Channel, tpl *txbuilder.Template) error {
+	password, err := m.password(c.AccountID)
+	if err != nil {
+		return err
+	}
+	return txbuilder.Sign(ctx, tpl, c.LocalKey.XPubs, password, func(ctx context.Context, xpub chainkd.XPub, path [][]byte, data [32]byte, auth string) ([]byte, error) {
+		return m.signer.XSign(xpub, path, data[:], auth)
+	})
+}
+
+// newKey derives a new channel key for accountID.
+func (m *Manager) newKey(ctx context.Context, accountID string) (*Key, error) {
+	hk, err := m.wallet.CreateHTLCKey(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	xpubs, path, err := m.wallet.HTLCKeyPath(ctx, hk)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{XPubs: xpubs, Quorum: hk.Quorum}
+	for _, p := range path {
+		k.Path = append(k.Path, p)
+	}
+	return k, nil
+}
+
+// newSecret returns a random revocation secret.
+func newSecret() (chainjson.HexBytes, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "generating revocation secret")
+	}
+	return secret, nil
+}
+
+func revocationHash(secret []byte) chainjson.HexBytes {
+	h := sha256.Sum256(secret)
+	return h[:]
+}
+
+// checkParams checks the terms of a new channel. Only BTM can pay
+// for the gas of the channel's transactions, so channels hold BTM.
+func checkParams(assetID bc.AssetID, capacity, fee uint64, expiresAt, disputeDeadline time.Time) error {
+	if assetID != *consensus.BTMAssetID {
+		return errors.WithDetail(ErrBadChannel, "channels must hold BTM")
+	}
+	if fee == 0 || capacity <= fee {
+		return errors.WithDetailf(ErrBadChannel, "capacity %d does not cover the fee of %d", capacity, fee)
+	}
+	if !expiresAt.After(time.Now()) || disputeDeadline.Before(expiresAt) {
+		return errors.WithDetail(ErrBadChannel, "a channel needs a future expiry followed by a dispute period")
+	}
+	return nil
+}
+
+func channelID(outputID bc.Hash) string {
+	return hex.EncodeToString(outputID.Bytes())
+}
+
+func calcChannelKey(id string) []byte {
+	return []byte(channelPrefix + id)
+}
+
+func (m *Manager) get(key []byte) (*Channel, error) {
+	b := m.db.Get(key)
+	if b == nil {
+		return nil, errors.Wrap(ErrChannelNotFound)
+	}
+	r := &record{Channel: new(Channel)}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrap(err, "decoding channel")
+	}
+	r.Channel.PeerAccessToken = r.PeerAccessToken
+	return r.Channel, nil
+}
+
+func (m *Manager) put(key []byte, c *Channel) error {
+	b, err := json.Marshal(record{Channel: c, PeerAccessToken: c.PeerAccessToken})
+	if err != nil {
+		return errors.Wrap(err, "marshaling channel")
+	}
+	m.db.SetSync(key, b)
+	return nil
+}
+
+func (m *Manager) save(c *Channel) error {
+	return m.put(calcChannelKey(c.ID), c)
+}
+
+// Find returns the channel with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*Channel, error) {
+	c, err := m.get(calcChannelKey(id))
+	return c, errors.WithDetailf(err, "channel %q", id)
+}
+
+// Channels returns the channels of accountID, or every channel if
+// accountID is empty.
+func (m *Manager) Channels(ctx context.Context, accountID string) ([]*Channel, error) {
+	var channels []*Channel
+	iter := m.db.Iterator()
+	for iter.Next() {
+		key := string(iter.Key())
+		if !strings.HasPrefix(key, channelPrefix) {
+			continue
+		}
+		c, err := m.get([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		if accountID == "" || c.AccountID == accountID {
+			channels = append(channels, c)
+		}
+	}
+	return channels, nil
+}
+
+func (m *Manager) peer(c *Channel) Peer {
+	return m.Dial(c.PeerURL, c.PeerAccessToken)
+}
@@ -0,0 +1,411 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/account"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/consensus"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/validation"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+var assetID = *consensus.BTMAssetID
+
+// testWallet is a single-key account that funds channels from a
+// made-up output.
+type testWallet struct {
+	xpub chainkd.XPub
+	next uint64
+}
+
+func (w *testWallet) path(idx uint64) [][]byte {
+	return [][]byte{{byte(idx)}}
+}
+
+func (w *testWallet) CreateHTLCKey(ctx context.Context, accountID string) (*account.HTLCKey, error) {
+	w.next++
+	pubkey := w.xpub.Derive(w.path(w.next)).PublicKey()
+	return &account.HTLCKey{AccountID: accountID, KeyIndex: w.next, Pubkeys: []chainjson.HexBytes{chainjson.HexBytes(pubkey)}, Quorum: 1}, nil
+}
+
+func (w *testWallet) HTLCKeyPath(ctx context.Context, k *account.HTLCKey) ([]chainkd.XPub, [][]byte, error) {
+	return []chainkd.XPub{w.xpub}, w.path(k.KeyIndex), nil
+}
+
+func (w *testWallet) CreateControlProgram(ctx context.Context, accountID string, change bool, expiresAt time.Time) ([]byte, error) {
+	w.next++
+	return vmutil.P2SPMultiSigProgram([]ed25519.PublicKey{w.xpub.Derive(w.path(w.next)).PublicKey()}, 1)
+}
+
+func (w *testWallet) NewSpendAction(amt bc.AssetAmount, accountID string, refData chainjson.Map, clientToken *string) txbuilder.Action {
+	return spendFixture{amt, w.xpub}
+}
+
+type spendFixture struct {
+	amt  bc.AssetAmount
+	xpub chainkd.XPub
+}
+
+func (a spendFixture) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	si := &txbuilder.SigningInstruction{}
+	si.AddWitnessKeys([]chainkd.XPub{a.xpub}, nil, 1)
+	return b.AddInput(legacy.NewSpendInput(nil, bc.Hash{V0: 9}, *a.amt.AssetId, a.amt.Amount, 0, []byte{1}, bc.Hash{}, nil), si)
+}
+
+type testSigner struct {
+	xprv chainkd.XPrv
+}
+
+func (s testSigner) XSign(xpub chainkd.XPub, path [][]byte, msg []byte, auth string) ([]byte, error) {
+	if xpub != s.xprv.XPub() || auth != "password" {
+		return nil, errors.New("cannot sign")
+	}
+	return s.xprv.Derive(path).Sign(msg), nil
+}
+
+type testSubmitter struct {
+	txs []*legacy.Tx
+}
+
+func (s *testSubmitter) Submit(ctx context.Context, tx *legacy.Tx) error {
+	s.txs = append(s.txs, tx)
+	return nil
+}
+
+// testPeer delivers messages to another manager, through JSON as
+// they would be over RPC.
+type testPeer struct {
+	m *Manager
+}
+
+func (p testPeer) Call(ctx context.Context, path string, request, response interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	var resp interface{}
+	switch path {
+	case "/channel-propose":
+		msg := new(Proposal)
+		json.Unmarshal(b, msg)
+		resp, err = p.m.HandlePropose(ctx, msg)
+	case "/channel-fund":
+		msg := new(FundingOffer)
+		json.Unmarshal(b, msg)
+		resp, err = p.m.HandleFund(ctx, msg)
+	case "/channel-update":
+		msg := new(Update)
+		json.Unmarshal(b, msg)
+		resp, err = p.m.HandleUpdate(ctx, msg)
+	case "/channel-revoke":
+		msg := new(Revocation)
+		json.Unmarshal(b, msg)
+		err = p.m.HandleRevoke(ctx, msg)
+	case "/channel-close":
+		msg := new(CloseOffer)
+		json.Unmarshal(b, msg)
+		resp, err = p.m.HandleClose(ctx, msg)
+	}
+	if err != nil || response == nil {
+		return err
+	}
+	b, err = json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, response)
+}
+
+type party struct {
+	m         *Manager
+	accountID string
+	submitted *testSubmitter
+}
+
+func newParty(t *testing.T, ctx context.Context, alias string) *party {
+	xprv, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted := new(testSubmitter)
+	m := NewManager(dbm.NewMemDB(), nil, submitted, &testWallet{xpub: xpub}, testSigner{xprv})
+	m.Unlock(ctx, alias, "password")
+	return &party{m: m, accountID: alias, submitted: submitted}
+}
+
+func TestChannelLifecycle(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, ctx, "alice"), newParty(t, ctx, "bob")
+	alice.m.Dial = func(string, string) Peer { return testPeer{bob.m} }
+	bob.m.Dial = func(string, string) Peer { return testPeer{alice.m} }
+
+	c, err := alice.m.Open(ctx, &OpenRequest{
+		AccountID:     alice.accountID,
+		AssetID:       assetID,
+		Amount:        100 + defaultFee,
+		ExpiresAt:     time.Now().Add(time.Hour),
+		PeerURL:       "http://bob",
+		PeerAccountID: bob.accountID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.submitted.txs) != 1 {
+		t.Fatalf("submitted %d transactions, want the funding transaction", len(alice.submitted.txs))
+	}
+	funding := alice.submitted.txs[0]
+	if _, err := bob.m.Pay(ctx, c.ID, 1); errors.Root(err) != ErrChannelState {
+		t.Errorf("pay before funding is confirmed: got error %v, want %v", err, ErrChannelState)
+	}
+
+	block := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1}, Transactions: []*legacy.Tx{funding}}
+	for _, p := range []*party{alice, bob} {
+		if err := p.m.indexBlock(ctx, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Payments in both directions.
+	if _, err := alice.m.Pay(ctx, c.ID, 30); err != nil {
+		t.Fatal(err)
+	}
+	b, err := bob.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.m.sign(ctx, b, b.Commitment); err != nil {
+		t.Fatal(err)
+	}
+	revoked := b.Commitment.Transaction
+	validate(t, revoked)
+	if _, err := bob.m.Pay(ctx, c.ID, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.m.Pay(ctx, c.ID, 50); errors.Root(err) != ErrBalance {
+		t.Errorf("overpay: got error %v, want %v", err, ErrBalance)
+	}
+
+	a, err := alice.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = bob.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.State != 2 || b.State != 2 || a.LocalBalance != 80 || a.RemoteBalance != 20 || b.LocalBalance != 20 || b.RemoteBalance != 80 {
+		t.Fatalf("balances: alice %d/%d at state %d, bob %d/%d at state %d", a.LocalBalance, a.RemoteBalance, a.State, b.LocalBalance, b.RemoteBalance, b.State)
+	}
+	if len(a.RemoteSecrets) != 2 || len(b.RemoteSecrets) != 2 || b.AwaitingRevocation || a.AwaitingRevocation {
+		t.Errorf("revocations: alice holds %d, bob holds %d", len(a.RemoteSecrets), len(b.RemoteSecrets))
+	}
+
+	// Alice's latest commitment pays Bob his balance at once and
+	// locks hers for the dispute period.
+	outs := a.Commitment.Transaction.Outputs
+	if len(outs) != 2 || outs[0].Amount != 80 || outs[1].Amount != 20 || string(outs[1].ControlProgram) != string(a.RemotePayout) {
+		t.Fatalf("commitment outputs = %+v", outs)
+	}
+	contract, err := vmutil.ParseHTLCProgram(outs[0].ControlProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contract.Hash) != string(revocationHash(a.LocalSecret)) || contract.Deadline != bc.Millis(a.DisputeDeadline) {
+		t.Errorf("commitment htlc = %+v", contract)
+	}
+
+	// Bob submitting a revoked commitment is a breach Alice can
+	// punish with the secret he revealed.
+	block = &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 2}, Transactions: []*legacy.Tx{revoked}}
+	if err := alice.m.indexBlock(ctx, block); err != nil {
+		t.Fatal(err)
+	}
+	breached, err := alice.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached.Status != StatusBreached || breached.Breach == nil || breached.Breach.State != 1 {
+		t.Errorf("after revoked commitment: status %s, breach %+v", breached.Status, breached.Breach)
+	}
+	// Undo the breach to test a cooperative close.
+	if err := alice.m.save(a); err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := alice.m.Close(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.Status != StatusClosing || len(bob.submitted.txs) != 1 {
+		t.Fatalf("close: status %s, bob submitted %d transactions", closed.Status, len(bob.submitted.txs))
+	}
+	closing := bob.submitted.txs[0]
+	if *closed.ClosingTxID != closing.ID {
+		t.Errorf("closing transaction %x, want %x", closed.ClosingTxID.Bytes(), closing.ID.Bytes())
+	}
+	outs = closing.Outputs
+	if len(outs) != 2 || outs[0].Amount != 80 || string(outs[0].ControlProgram) != string(a.LocalPayout) || outs[1].Amount != 20 {
+		t.Errorf("closing outputs = %+v", outs)
+	}
+	validate(t, closing)
+}
+
+// openChannel opens a channel from alice to bob holding amount, and
+// confirms its funding.
+func openChannel(t *testing.T, ctx context.Context, alice, bob *party, amount uint64, expiresAt time.Time) *Channel {
+	alice.m.Dial = func(string, string) Peer { return testPeer{bob.m} }
+	bob.m.Dial = func(string, string) Peer { return testPeer{alice.m} }
+	c, err := alice.m.Open(ctx, &OpenRequest{
+		AccountID:     alice.accountID,
+		AssetID:       assetID,
+		Amount:        amount,
+		ExpiresAt:     expiresAt,
+		PeerURL:       "http://bob",
+		PeerAccountID: bob.accountID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1}, Transactions: []*legacy.Tx{alice.submitted.txs[0]}}
+	for _, p := range []*party{alice, bob} {
+		if err := p.m.indexBlock(ctx, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestBreachRedeemed(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, ctx, "alice"), newParty(t, ctx, "bob")
+	c := openChannel(t, ctx, alice, bob, 4*defaultFee, time.Now().Add(time.Hour))
+
+	if _, err := alice.m.Pay(ctx, c.ID, 2*defaultFee); err != nil {
+		t.Fatal(err)
+	}
+	b, err := bob.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.m.sign(ctx, b, b.Commitment); err != nil {
+		t.Fatal(err)
+	}
+	revoked := b.Commitment.Transaction
+	if _, err := bob.m.Pay(ctx, c.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice takes Bob's balance in the revoked commitment as soon as
+	// she sees it.
+	block := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 2}, Transactions: []*legacy.Tx{revoked}}
+	if err := alice.m.indexBlock(ctx, block); err != nil {
+		t.Fatal(err)
+	}
+	alice.m.enforce(ctx)
+	breached, err := alice.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached.Breach == nil || breached.Breach.RedeemTxID == nil {
+		t.Fatalf("breach not redeemed: %+v", breached.Breach)
+	}
+	redeem := alice.submitted.txs[len(alice.submitted.txs)-1]
+	if redeem.ID != *breached.Breach.RedeemTxID {
+		t.Fatalf("last submitted transaction is not the redemption")
+	}
+	outs := redeem.Outputs
+	if len(outs) != 1 || outs[0].Amount != defaultFee || string(outs[0].ControlProgram) != string(breached.LocalPayout) {
+		t.Errorf("redemption outputs = %+v", outs)
+	}
+	validate(t, redeem)
+
+	// It is not redeemed twice.
+	n := len(alice.submitted.txs)
+	alice.m.enforce(ctx)
+	if len(alice.submitted.txs) != n {
+		t.Error("breach redeemed again")
+	}
+}
+
+func TestForceCloseBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, ctx, "alice"), newParty(t, ctx, "bob")
+	c := openChannel(t, ctx, alice, bob, 100+defaultFee, time.Now().Add(forceCloseMargin/2))
+
+	// Bob's account is locked, so only Alice can close.
+	bob.m.auth = make(map[string]string)
+	for _, p := range []*party{alice, bob} {
+		p.m.enforce(ctx)
+	}
+	a, err := alice.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != StatusClosing || len(alice.submitted.txs) != 2 || alice.submitted.txs[1].ID != *a.ClosingTxID {
+		t.Fatalf("alice: status %s, submitted %d transactions", a.Status, len(alice.submitted.txs))
+	}
+	validate(t, alice.submitted.txs[1])
+	if b, _ := bob.m.Find(ctx, c.ID); b.Status != StatusOpen || len(bob.submitted.txs) != 0 {
+		t.Errorf("bob: status %s, submitted %d transactions", b.Status, len(bob.submitted.txs))
+	}
+}
+
+func TestRollbackBlocks(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t, ctx, "alice"), newParty(t, ctx, "bob")
+	c := openChannel(t, ctx, alice, bob, 100+defaultFee, time.Now().Add(time.Hour))
+	if _, err := alice.m.Close(ctx, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	closing := bob.submitted.txs[0]
+	block := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 2}, Transactions: []*legacy.Tx{closing}}
+	if err := alice.m.indexBlock(ctx, block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The closing block is orphaned: the channel waits for its closing
+	// transaction again.
+	if err := alice.m.rollbackBlocks(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	a, err := alice.m.Find(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != StatusClosing || a.ClosingHeight != 0 || *a.ClosingTxID != closing.ID || a.Funding.BlockHeight != 1 {
+		t.Errorf("alice after rollback to 1: status %s, closing %x at %d, funded at %d", a.Status, a.ClosingTxID.Bytes(), a.ClosingHeight, a.Funding.BlockHeight)
+	}
+
+	// The funding block is orphaned: the channel cannot be used until
+	// it is funded again.
+	alice, bob = newParty(t, ctx, "alice"), newParty(t, ctx, "bob")
+	c = openChannel(t, ctx, alice, bob, 100+defaultFee, time.Now().Add(time.Hour))
+	if err := bob.m.rollbackBlocks(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := bob.m.Find(ctx, c.ID); b.Status != StatusOpening || b.Funding.BlockHeight != 0 {
+		t.Errorf("bob after rollback to 0: status %s, funded at %d", b.Status, b.Funding.BlockHeight)
+	}
+	if _, err := bob.m.Pay(ctx, c.ID, 1); errors.Root(err) != ErrChannelState {
+		t.Errorf("pay after funding is orphaned: got error %v, want %v", err, ErrChannelState)
+	}
+}
+
+func validate(t *testing.T, tx *legacy.Tx) {
+	block := &bc.Block{BlockHeader: &bc.BlockHeader{Height: 1, TimestampMs: bc.Millis(time.Now())}}
+	if _, err := validation.ValidateTx(tx.Tx, block); err != nil {
+		t.Errorf("transaction %x: %v", tx.ID.Bytes(), err)
+	}
+}
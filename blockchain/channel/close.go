@@ -0,0 +1,160 @@
+package channel
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytom/blockchain/txbuilder"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Close closes the channel together with the peer, paying each party
+// its balance at once.
+func (m *Manager) Close(ctx context.Context, id string) (*Channel, error) {
+	if err := m.acquire(id); err != nil {
+		return nil, err
+	}
+	defer m.release(id)
+
+	c, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sendRevocation(ctx, c); err != nil {
+		return nil, err
+	}
+	if c.Status != StatusOpen || c.AwaitingRevocation {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s is %s", id, c.Status)
+	}
+
+	tpl, err := c.closing()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, tpl); err != nil {
+		return nil, err
+	}
+	ack := new(CloseAck)
+	if err := m.peer(c).Call(ctx, "/channel-close", &CloseOffer{ChannelID: id, Template: tpl}, ack); err != nil {
+		return nil, errors.Wrap(err, "closing channel")
+	}
+	c.Status = StatusClosing
+	c.ClosingTxID = &ack.TxID
+	return c, m.save(c)
+}
+
+// HandleClose signs and submits the closing transaction offered by
+// the peer.
+func (m *Manager) HandleClose(ctx context.Context, offer *CloseOffer) (*CloseAck, error) {
+	if offer.Template == nil {
+		return nil, txbuilder.MissingFieldsError("template")
+	}
+	if err := m.acquire(offer.ChannelID); err != nil {
+		return nil, err
+	}
+	defer m.release(offer.ChannelID)
+
+	c, err := m.Find(ctx, offer.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != StatusOpen || c.AwaitingRevocation || c.UnsentRevocation != nil {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s is %s", c.ID, c.Status)
+	}
+
+	tpl, err := c.closing()
+	if err != nil {
+		return nil, err
+	}
+	if err := txbuilder.MergeSignatures(tpl, offer.Template); err != nil {
+		return nil, errors.Wrap(err, "checking closing transaction")
+	}
+	if err := m.sign(ctx, c, tpl); err != nil {
+		return nil, err
+	}
+	if err := m.submitter.Submit(ctx, tpl.Transaction); err != nil {
+		return nil, errors.Wrap(err, "submitting closing transaction")
+	}
+	c.Status = StatusClosing
+	c.ClosingTxID = &tpl.Transaction.ID
+	return &CloseAck{TxID: tpl.Transaction.ID}, m.save(c)
+}
+
+// ForceClose closes the channel without the peer by submitting the
+// local party's latest commitment. The peer's balance is paid at
+// once; the local balance can be claimed with the refund_htlc action
+// after the dispute deadline. It must be done before the channel
+// expires; the manager does it itself shortly before then.
+func (m *Manager) ForceClose(ctx context.Context, id string) (*Channel, error) {
+	if err := m.acquire(id); err != nil {
+		return nil, err
+	}
+	defer m.release(id)
+
+	c, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != StatusOpening && c.Status != StatusOpen {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s is %s", id, c.Status)
+	}
+	if !time.Now().Before(c.ExpiresAt) {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s expired at %s", id, c.ExpiresAt)
+	}
+
+	if err := m.sign(ctx, c, c.Commitment); err != nil {
+		return nil, err
+	}
+	if err := m.submitter.Submit(ctx, c.Commitment.Transaction); err != nil {
+		return nil, errors.Wrap(err, "submitting commitment")
+	}
+	c.Status = StatusClosing
+	c.ClosingTxID = &c.Commitment.Transaction.ID
+	return c, m.save(c)
+}
+
+// redeemBreach takes the other party's balance from the revoked
+// commitment it submitted, paying it to the local payout program
+// less the channel's fee. It must be on chain before the dispute
+// deadline, after which the other party can refund the output to
+// itself.
+func (m *Manager) redeemBreach(ctx context.Context, id string) error {
+	if err := m.acquire(id); err != nil {
+		return err
+	}
+	defer m.release(id)
+
+	c, err := m.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+	br := c.Breach
+	if c.Status != StatusBreached || br.RedeemTxID != nil {
+		return nil
+	}
+	if br.Amount <= c.Fee {
+		return errors.WithDetailf(ErrBalance, "breached output of %d does not cover the fee of %d", br.Amount, c.Fee)
+	}
+
+	txdata := legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, br.SourceID, c.AssetID, br.Amount, br.SourcePos, br.ControlProgram, br.RefDataHash, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(c.AssetID, br.Amount-c.Fee, c.LocalPayout, nil)},
+	}
+	si := &txbuilder.SigningInstruction{Arguments: []chainjson.HexBytes{br.Preimage, {}}}
+	si.AddWitnessKeys(c.LocalKey.XPubs, c.LocalKey.path(), c.LocalKey.Quorum)
+	tpl := &txbuilder.Template{
+		Transaction:         legacy.NewTx(txdata),
+		SigningInstructions: []*txbuilder.SigningInstruction{si},
+	}
+	if err := m.sign(ctx, c, tpl); err != nil {
+		return err
+	}
+	if err := m.submitter.Submit(ctx, tpl.Transaction); err != nil {
+		return errors.Wrap(err, "submitting breach redemption")
+	}
+	br.RedeemTxID = &tpl.Transaction.ID
+	return m.save(c)
+}
@@ -0,0 +1,104 @@
+package channel
+
+import (
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// Channel transactions are built from the channel's state alone, so
+// that both parties build the same transaction and can check each
+// other's signatures before merging them.
+
+// parties returns the opener's key and the acceptor's key.
+func (c *Channel) parties() (opener, acceptor *Key) {
+	if c.Opener {
+		return c.LocalKey, c.RemoteKey
+	}
+	return c.RemoteKey, c.LocalKey
+}
+
+func (c *Channel) fundingProgram() ([]byte, error) {
+	opener, acceptor := c.parties()
+	return vmutil.ChannelFundingProgram(opener.pubkeys(), opener.Quorum, acceptor.pubkeys(), acceptor.Quorum)
+}
+
+// template returns an unsigned template spending the funding output
+// in txdata's only input. Signatures commit to the whole transaction.
+func (c *Channel) template(txdata *legacy.TxData) (*txbuilder.Template, error) {
+	prog, err := c.fundingProgram()
+	if err != nil {
+		return nil, err
+	}
+	f := c.Funding
+	txdata.Version = 1
+	txdata.Inputs = []*legacy.TxInput{legacy.NewSpendInput(nil, f.SourceID, c.AssetID, c.Capacity, f.SourcePos, prog, f.RefDataHash, nil)}
+
+	opener, acceptor := c.parties()
+	si := &txbuilder.SigningInstruction{}
+	si.AddWitnessKeys(opener.XPubs, opener.path(), opener.Quorum)
+	si.AddWitnessKeys(acceptor.XPubs, acceptor.path(), acceptor.Quorum)
+	return &txbuilder.Template{
+		Transaction:         legacy.NewTx(*txdata),
+		SigningInstructions: []*txbuilder.SigningInstruction{si},
+	}, nil
+}
+
+// commitment returns the unsigned commitment transaction held by the
+// local party if local is true, or by the remote party otherwise,
+// with the holder's balance locked under revocationHash.
+func (c *Channel) commitment(local bool, holderBalance, otherBalance uint64, revocationHash []byte) (*txbuilder.Template, error) {
+	holder, other, otherPayout := c.LocalKey, c.RemoteKey, c.RemotePayout
+	if !local {
+		holder, other, otherPayout = c.RemoteKey, c.LocalKey, c.LocalPayout
+	}
+
+	txdata := &legacy.TxData{MaxTime: bc.Millis(c.ExpiresAt)}
+	if holderBalance > 0 {
+		prog, err := vmutil.HTLCProgram(&vmutil.HTLC{
+			Hash:             revocationHash,
+			Deadline:         bc.Millis(c.DisputeDeadline),
+			RecipientPubkeys: other.pubkeys(),
+			RecipientQuorum:  other.Quorum,
+			SenderPubkeys:    holder.pubkeys(),
+			SenderQuorum:     holder.Quorum,
+		})
+		if err != nil {
+			return nil, err
+		}
+		txdata.Outputs = append(txdata.Outputs, legacy.NewTxOutput(c.AssetID, holderBalance, prog, nil))
+	}
+	if otherBalance > 0 {
+		txdata.Outputs = append(txdata.Outputs, legacy.NewTxOutput(c.AssetID, otherBalance, otherPayout, nil))
+	}
+	return c.template(txdata)
+}
+
+// localCommitment and remoteCommitment return the commitments each
+// party would hold at the given local and remote balances.
+func (c *Channel) localCommitment(localBalance, remoteBalance uint64) (*txbuilder.Template, error) {
+	return c.commitment(true, localBalance, remoteBalance, revocationHash(c.NextLocalSecret))
+}
+
+func (c *Channel) remoteCommitment(localBalance, remoteBalance uint64) (*txbuilder.Template, error) {
+	return c.commitment(false, remoteBalance, localBalance, c.NextRemoteHash)
+}
+
+// closing returns the unsigned transaction closing the channel
+// cooperatively, paying each party its balance, the opener first.
+func (c *Channel) closing() (*txbuilder.Template, error) {
+	balances := []uint64{c.LocalBalance, c.RemoteBalance}
+	payouts := [][]byte{c.LocalPayout, c.RemotePayout}
+	if !c.Opener {
+		balances[0], balances[1] = balances[1], balances[0]
+		payouts[0], payouts[1] = payouts[1], payouts[0]
+	}
+	txdata := new(legacy.TxData)
+	for i, amount := range balances {
+		if amount > 0 {
+			txdata.Outputs = append(txdata.Outputs, legacy.NewTxOutput(c.AssetID, amount, payouts[i], nil))
+		}
+	}
+	return c.template(txdata)
+}
@@ -0,0 +1,584 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/bytom/blockchain/txbuilder"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Messages between the two parties' cores. Each party's API exposes
+// a handler for each message; the party making a change calls the
+// other's handler and acts on its response.
+//
+//	open:   Proposal -> Acceptance, FundingOffer -> FundingAck
+//	pay:    Update -> UpdateAck, then Revocation
+//	close:  CloseOffer -> CloseAck
+
+// Proposal asks the peer to open a channel with one of its accounts.
+type Proposal struct {
+	AccountID       string             `json:"account_id"`
+	AssetID         bc.AssetID         `json:"asset_id"`
+	Capacity        uint64             `json:"capacity"`
+	Fee             uint64             `json:"fee"`
+	ExpiresAt       time.Time          `json:"expires_at"`
+	DisputeDeadline time.Time          `json:"dispute_deadline"`
+	Key             *Key               `json:"key"`
+	ControlProgram  chainjson.HexBytes `json:"control_program"`
+	Hash            chainjson.HexBytes `json:"hash"`
+
+	// URL and AccessToken let the peer call back the proposer's
+	// core, to make payments and close the channel.
+	URL         string `json:"url"`
+	AccessToken string `json:"access_token"`
+}
+
+// Acceptance is the peer's side of a proposed channel.
+type Acceptance struct {
+	ProposalID     string             `json:"proposal_id"`
+	Key            *Key               `json:"key"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	Hash           chainjson.HexBytes `json:"hash"`
+}
+
+// FundingOffer gives the peer the funding output of an accepted
+// channel and its first commitment.
+type FundingOffer struct {
+	ProposalID string              `json:"proposal_id"`
+	Funding    *Funding            `json:"funding"`
+	Commitment *txbuilder.Template `json:"commitment"`
+	NextHash   chainjson.HexBytes  `json:"next_hash"`
+}
+
+// FundingAck returns the opener's first commitment.
+type FundingAck struct {
+	Commitment *txbuilder.Template `json:"commitment"`
+	NextHash   chainjson.HexBytes  `json:"next_hash"`
+}
+
+// Update pays Amount to the peer, giving it its new commitment.
+type Update struct {
+	ChannelID  string              `json:"channel_id"`
+	State      uint64              `json:"state"`
+	Amount     uint64              `json:"amount"`
+	Commitment *txbuilder.Template `json:"commitment"`
+}
+
+// UpdateAck returns the payer's new commitment and revokes the
+// peer's previous one.
+type UpdateAck struct {
+	Commitment *txbuilder.Template `json:"commitment"`
+	Secret     chainjson.HexBytes  `json:"secret"`
+	NextHash   chainjson.HexBytes  `json:"next_hash"`
+}
+
+// Revocation revokes the payer's previous commitment.
+type Revocation struct {
+	ChannelID string             `json:"channel_id"`
+	State     uint64             `json:"state"`
+	Secret    chainjson.HexBytes `json:"secret"`
+	NextHash  chainjson.HexBytes `json:"next_hash"`
+}
+
+// CloseOffer gives the peer the closing transaction, signed by the
+// party closing the channel.
+type CloseOffer struct {
+	ChannelID string              `json:"channel_id"`
+	Template  *txbuilder.Template `json:"template"`
+}
+
+// CloseAck reports the closing transaction the peer submitted.
+type CloseAck struct {
+	TxID bc.Hash `json:"transaction_id"`
+}
+
+// OpenRequest describes a channel to open.
+type OpenRequest struct {
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Amount    uint64     `json:"amount"`
+	ExpiresAt time.Time  `json:"expires_at"`
+
+	// Fee is the amount of Amount reserved for the gas of the
+	// channel's transactions. The default is 10000000.
+	Fee uint64 `json:"fee"`
+
+	// DisputePeriod is how long after ExpiresAt the other party has
+	// to take the balance of a revoked commitment. The default is a
+	// day.
+	DisputePeriod chainjson.Duration `json:"dispute_period"`
+
+	PeerURL         string `json:"peer_url"`
+	PeerAccessToken string `json:"peer_access_token"`
+	PeerAccountID   string `json:"peer_account_id"`
+
+	// URL and AccessToken are how the peer reaches this core.
+	URL         string `json:"url"`
+	AccessToken string `json:"access_token"`
+}
+
+// Open opens a channel funded with req.Amount from req.AccountID to
+// an account on the peer's core, and submits its funding
+// transaction. The channel is open once the funding transaction is
+// on chain.
+func (m *Manager) Open(ctx context.Context, req *OpenRequest) (*Channel, error) {
+	var missing []string
+	if req.AccountID == "" {
+		missing = append(missing, "account_id")
+	}
+	if req.AssetID.IsZero() {
+		missing = append(missing, "asset_id")
+	}
+	if req.ExpiresAt.IsZero() {
+		missing = append(missing, "expires_at")
+	}
+	if req.PeerURL == "" {
+		missing = append(missing, "peer_url")
+	}
+	if req.PeerAccountID == "" {
+		missing = append(missing, "peer_account_id")
+	}
+	if len(missing) > 0 {
+		return nil, txbuilder.MissingFieldsError(missing...)
+	}
+	disputePeriod := req.DisputePeriod.Duration
+	if disputePeriod <= 0 {
+		disputePeriod = defaultDisputePeriod
+	}
+	fee := req.Fee
+	if fee == 0 {
+		fee = defaultFee
+	}
+	if err := checkParams(req.AssetID, req.Amount, fee, req.ExpiresAt, req.ExpiresAt.Add(disputePeriod)); err != nil {
+		return nil, err
+	}
+	if _, err := m.password(req.AccountID); err != nil {
+		return nil, err
+	}
+
+	c := &Channel{
+		AccountID:       req.AccountID,
+		Opener:          true,
+		Status:          StatusOpening,
+		AssetID:         req.AssetID,
+		Capacity:        req.Amount,
+		Fee:             fee,
+		ExpiresAt:       req.ExpiresAt.UTC(),
+		DisputeDeadline: req.ExpiresAt.Add(disputePeriod).UTC(),
+		LocalBalance:    req.Amount - fee,
+		PeerURL:         req.PeerURL,
+		PeerAccessToken: req.PeerAccessToken,
+	}
+	if err := m.initLocal(ctx, c); err != nil {
+		return nil, err
+	}
+
+	proposal := &Proposal{
+		AccountID:       req.PeerAccountID,
+		AssetID:         c.AssetID,
+		Capacity:        c.Capacity,
+		Fee:             c.Fee,
+		ExpiresAt:       c.ExpiresAt,
+		DisputeDeadline: c.DisputeDeadline,
+		Key:             c.LocalKey,
+		ControlProgram:  c.LocalPayout,
+		Hash:            revocationHash(c.NextLocalSecret),
+		URL:             req.URL,
+		AccessToken:     req.AccessToken,
+	}
+	acceptance := new(Acceptance)
+	if err := m.peer(c).Call(ctx, "/channel-propose", proposal, acceptance); err != nil {
+		return nil, errors.Wrap(err, "proposing channel")
+	}
+	if err := acceptance.Key.check(); err != nil {
+		return nil, err
+	}
+	c.RemoteKey = acceptance.Key
+	c.RemotePayout = acceptance.ControlProgram
+	c.NextRemoteHash = acceptance.Hash
+
+	funding, err := m.buildFunding(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := c.remoteCommitment(c.LocalBalance, c.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, remote); err != nil {
+		return nil, err
+	}
+	local, err := c.localCommitment(c.LocalBalance, c.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	nextSecret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	offer := &FundingOffer{ProposalID: acceptance.ProposalID, Funding: c.Funding, Commitment: remote, NextHash: revocationHash(nextSecret)}
+	ack := new(FundingAck)
+	if err := m.peer(c).Call(ctx, "/channel-fund", offer, ack); err != nil {
+		return nil, errors.Wrap(err, "funding channel")
+	}
+	if err := txbuilder.MergeSignatures(local, ack.Commitment); err != nil {
+		return nil, errors.Wrap(err, "checking commitment")
+	}
+	c.Commitment = local
+	c.LocalSecret, c.NextLocalSecret = c.NextLocalSecret, nextSecret
+	c.RemoteHash, c.NextRemoteHash = c.NextRemoteHash, ack.NextHash
+
+	// The channel is saved before the funding transaction is
+	// submitted, so the commitment that returns the funds is never
+	// lost.
+	if err := m.save(c); err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, funding); err != nil {
+		return nil, err
+	}
+	if err := m.submitter.Submit(ctx, funding.Transaction); err != nil {
+		return nil, errors.Wrap(err, "submitting funding transaction")
+	}
+	return c, nil
+}
+
+// initLocal derives the local party's key, payout program and first
+// revocation secret for a new channel.
+func (m *Manager) initLocal(ctx context.Context, c *Channel) error {
+	var err error
+	c.LocalKey, err = m.newKey(ctx, c.AccountID)
+	if err != nil {
+		return err
+	}
+	c.LocalPayout, err = m.wallet.CreateControlProgram(ctx, c.AccountID, false, time.Time{})
+	if err != nil {
+		return err
+	}
+	c.NextLocalSecret, err = newSecret()
+	return err
+}
+
+// buildFunding builds the unsigned funding transaction of c from its
+// account and sets c's ID and funding output.
+func (m *Manager) buildFunding(ctx context.Context, c *Channel) (*txbuilder.Template, error) {
+	prog, err := c.fundingProgram()
+	if err != nil {
+		return nil, err
+	}
+	out := legacy.NewTxOutput(c.AssetID, c.Capacity, prog, nil)
+	actions := []txbuilder.Action{
+		m.wallet.NewSpendAction(bc.AssetAmount{AssetId: &c.AssetID, Amount: c.Capacity}, c.AccountID, nil, nil),
+		outputAction{out},
+	}
+	tpl, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(fundingTTL))
+	if err != nil {
+		return nil, errors.Wrap(err, "building funding transaction")
+	}
+
+	tx := tpl.Transaction
+	for i, o := range tx.Outputs {
+		if !bytes.Equal(o.ControlProgram, prog) {
+			continue
+		}
+		resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+		if !ok {
+			continue
+		}
+		c.Funding = &Funding{
+			OutputID:    *tx.OutputID(i),
+			SourceID:    *resOut.Source.Ref,
+			SourcePos:   resOut.Source.Position,
+			RefDataHash: *resOut.Data,
+			TxID:        tx.ID,
+		}
+		c.ID = channelID(c.Funding.OutputID)
+		return tpl, nil
+	}
+	return nil, errors.New("funding transaction has no funding output")
+}
+
+// outputAction adds a fixed output to a transaction.
+type outputAction struct {
+	out *legacy.TxOutput
+}
+
+func (a outputAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	return b.AddOutput(a.out)
+}
+
+// HandlePropose accepts a channel proposed by a peer.
+func (m *Manager) HandlePropose(ctx context.Context, p *Proposal) (*Acceptance, error) {
+	if p.AccountID == "" {
+		return nil, txbuilder.MissingFieldsError("account_id")
+	}
+	if err := p.Key.check(); err != nil {
+		return nil, err
+	}
+	if err := checkParams(p.AssetID, p.Capacity, p.Fee, p.ExpiresAt, p.DisputeDeadline); err != nil {
+		return nil, err
+	}
+	if len(p.Hash) != 32 {
+		return nil, errors.WithDetail(ErrBadChannel, "bad revocation hash")
+	}
+	if _, err := m.password(p.AccountID); err != nil {
+		return nil, err
+	}
+
+	c := &Channel{
+		AccountID:       p.AccountID,
+		Status:          StatusOpening,
+		AssetID:         p.AssetID,
+		Capacity:        p.Capacity,
+		Fee:             p.Fee,
+		ExpiresAt:       p.ExpiresAt.UTC(),
+		DisputeDeadline: p.DisputeDeadline.UTC(),
+		RemoteKey:       p.Key,
+		RemotePayout:    p.ControlProgram,
+		RemoteBalance:   p.Capacity - p.Fee,
+		NextRemoteHash:  p.Hash,
+		PeerURL:         p.URL,
+		PeerAccessToken: p.AccessToken,
+	}
+	if err := m.initLocal(ctx, c); err != nil {
+		return nil, err
+	}
+	id, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	proposalID := hex.EncodeToString(id[:16])
+	if err := m.put([]byte(proposalPrefix+proposalID), c); err != nil {
+		return nil, err
+	}
+	return &Acceptance{
+		ProposalID:     proposalID,
+		Key:            c.LocalKey,
+		ControlProgram: c.LocalPayout,
+		Hash:           revocationHash(c.NextLocalSecret),
+	}, nil
+}
+
+// HandleFund records the funding output of a channel accepted with
+// HandlePropose and signs the opener's first commitment.
+func (m *Manager) HandleFund(ctx context.Context, offer *FundingOffer) (*FundingAck, error) {
+	if offer.Funding == nil || offer.Commitment == nil {
+		return nil, txbuilder.MissingFieldsError("funding", "commitment")
+	}
+	proposalKey := []byte(proposalPrefix + offer.ProposalID)
+	c, err := m.get(proposalKey)
+	if err != nil {
+		return nil, errors.WithDetailf(err, "proposal %q", offer.ProposalID)
+	}
+	c.Funding = offer.Funding
+	c.ID = channelID(c.Funding.OutputID)
+
+	local, err := c.localCommitment(c.LocalBalance, c.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := txbuilder.MergeSignatures(local, offer.Commitment); err != nil {
+		return nil, errors.Wrap(err, "checking commitment")
+	}
+	remote, err := c.remoteCommitment(c.LocalBalance, c.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, remote); err != nil {
+		return nil, err
+	}
+
+	nextSecret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	c.Commitment = local
+	c.LocalSecret, c.NextLocalSecret = c.NextLocalSecret, nextSecret
+	c.RemoteHash, c.NextRemoteHash = c.NextRemoteHash, offer.NextHash
+	if err := m.save(c); err != nil {
+		return nil, err
+	}
+	m.db.Delete(proposalKey)
+	return &FundingAck{Commitment: remote, NextHash: revocationHash(nextSecret)}, nil
+}
+
+// Pay pays amount to the peer over the channel.
+func (m *Manager) Pay(ctx context.Context, id string, amount uint64) (*Channel, error) {
+	if err := m.acquire(id); err != nil {
+		return nil, err
+	}
+	defer m.release(id)
+
+	c, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sendRevocation(ctx, c); err != nil {
+		return nil, err
+	}
+	if c.Status != StatusOpen || c.AwaitingRevocation {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s is %s", id, c.Status)
+	}
+	if amount == 0 || amount > c.LocalBalance {
+		return nil, errors.WithDetailf(ErrBalance, "paying %d from a balance of %d", amount, c.LocalBalance)
+	}
+
+	localBalance, remoteBalance := c.LocalBalance-amount, c.RemoteBalance+amount
+	remote, err := c.remoteCommitment(localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, remote); err != nil {
+		return nil, err
+	}
+	local, err := c.localCommitment(localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &Update{ChannelID: id, State: c.State + 1, Amount: amount, Commitment: remote}
+	ack := new(UpdateAck)
+	if err := m.peer(c).Call(ctx, "/channel-update", update, ack); err != nil {
+		return nil, errors.Wrap(err, "updating channel")
+	}
+	if err := txbuilder.MergeSignatures(local, ack.Commitment); err != nil {
+		return nil, errors.Wrap(err, "checking commitment")
+	}
+	if err := c.addRemoteSecret(ack.Secret, ack.NextHash); err != nil {
+		return nil, err
+	}
+
+	revocation := &Revocation{ChannelID: id, State: c.State + 1, Secret: c.LocalSecret}
+	if err := c.advance(local, localBalance, remoteBalance); err != nil {
+		return nil, err
+	}
+	revocation.NextHash = revocationHash(c.NextLocalSecret)
+	c.UnsentRevocation = revocation
+	if err := m.save(c); err != nil {
+		return nil, err
+	}
+	return c, m.sendRevocation(ctx, c)
+}
+
+// sendRevocation sends the peer the revocation of the local party's
+// previous commitment, if it has not been sent yet.
+func (m *Manager) sendRevocation(ctx context.Context, c *Channel) error {
+	if c.UnsentRevocation == nil {
+		return nil
+	}
+	if err := m.peer(c).Call(ctx, "/channel-revoke", c.UnsentRevocation, nil); err != nil {
+		return errors.Wrap(err, "revoking commitment")
+	}
+	c.UnsentRevocation = nil
+	return m.save(c)
+}
+
+// advance makes local, at the given balances, the local party's
+// latest commitment.
+func (c *Channel) advance(local *txbuilder.Template, localBalance, remoteBalance uint64) error {
+	nextSecret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	c.State++
+	c.Commitment = local
+	c.LocalBalance, c.RemoteBalance = localBalance, remoteBalance
+	c.LocalSecret, c.NextLocalSecret = c.NextLocalSecret, nextSecret
+	return nil
+}
+
+// addRemoteSecret records the secret revoking the peer's latest
+// commitment, whose hash is RemoteHash, and the hash of the
+// commitment after its next one.
+func (c *Channel) addRemoteSecret(secret, nextHash chainjson.HexBytes) error {
+	if !bytes.Equal(revocationHash(secret), c.RemoteHash) {
+		return errors.WithDetailf(ErrBadRevocation, "state %d", len(c.RemoteSecrets))
+	}
+	if len(nextHash) != 32 {
+		return errors.WithDetail(ErrBadChannel, "bad next revocation hash")
+	}
+	c.RemoteSecrets = append(c.RemoteSecrets, secret)
+	c.RemoteHash, c.NextRemoteHash = c.NextRemoteHash, nextHash
+	return nil
+}
+
+// HandleUpdate accepts a payment from the peer.
+func (m *Manager) HandleUpdate(ctx context.Context, u *Update) (*UpdateAck, error) {
+	if u.Commitment == nil {
+		return nil, txbuilder.MissingFieldsError("commitment")
+	}
+	if err := m.acquire(u.ChannelID); err != nil {
+		return nil, err
+	}
+	defer m.release(u.ChannelID)
+
+	c, err := m.Find(ctx, u.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != StatusOpen || c.AwaitingRevocation || c.UnsentRevocation != nil || u.State != c.State+1 {
+		return nil, errors.WithDetailf(ErrChannelState, "channel %s is %s at state %d", c.ID, c.Status, c.State)
+	}
+	if u.Amount == 0 || u.Amount > c.RemoteBalance {
+		return nil, errors.WithDetailf(ErrBalance, "peer paying %d from a balance of %d", u.Amount, c.RemoteBalance)
+	}
+
+	localBalance, remoteBalance := c.LocalBalance+u.Amount, c.RemoteBalance-u.Amount
+	local, err := c.localCommitment(localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := txbuilder.MergeSignatures(local, u.Commitment); err != nil {
+		return nil, errors.Wrap(err, "checking commitment")
+	}
+	remote, err := c.remoteCommitment(localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sign(ctx, c, remote); err != nil {
+		return nil, err
+	}
+
+	ack := &UpdateAck{Commitment: remote, Secret: c.LocalSecret}
+	if err := c.advance(local, localBalance, remoteBalance); err != nil {
+		return nil, err
+	}
+	ack.NextHash = revocationHash(c.NextLocalSecret)
+
+	// No new commitment can be signed for the peer until it revokes
+	// its previous one, telling us the revocation hash to use.
+	c.AwaitingRevocation = true
+	return ack, m.save(c)
+}
+
+// HandleRevoke records the secret revoking the peer's previous
+// commitment after a payment it made.
+func (m *Manager) HandleRevoke(ctx context.Context, r *Revocation) error {
+	if err := m.acquire(r.ChannelID); err != nil {
+		return err
+	}
+	defer m.release(r.ChannelID)
+
+	c, err := m.Find(ctx, r.ChannelID)
+	if err != nil {
+		return err
+	}
+	if r.State > 0 && r.State == c.State && uint64(len(c.RemoteSecrets)) == r.State && bytes.Equal(c.RemoteSecrets[r.State-1], r.Secret) {
+		return nil // already revoked; the peer is retrying
+	}
+	if !c.AwaitingRevocation || r.State != c.State {
+		return errors.WithDetailf(ErrChannelState, "channel %s is not waiting for a revocation", c.ID)
+	}
+	if err := c.addRemoteSecret(r.Secret, r.NextHash); err != nil {
+		return err
+	}
+	c.AwaitingRevocation = false
+	return m.save(c)
+}
@@ -0,0 +1,174 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/bytom/blockchain/blockwatch"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// ProcessBlocks watches each block committed to the chain for the
+// funding and closing of this core's channels, starting after the
+// last block watched in a previous run. After each block it redeems
+// breached outputs and closes channels about to expire. If the chain
+// reorganizes, what was indexed from orphaned blocks is rolled back.
+// It returns when ctx is done.
+func (m *Manager) ProcessBlocks(ctx context.Context) {
+	w := &blockwatch.Watcher{
+		Name:  "channel index",
+		Chain: m.chain,
+		DB:    m.db,
+		Key:   blockHeightKey,
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			err := m.indexBlock(ctx, b)
+			m.enforce(ctx)
+			return err
+		},
+		Rollback: m.rollbackBlocks,
+	}
+	w.Run(ctx)
+}
+
+// enforce acts on channels that cannot wait for the user: it redeems
+// each breach not yet redeemed, and force closes each channel that
+// expires within forceCloseMargin, so that funds are not left locked
+// in the funding output. Failures, such as a locked account, are
+// logged and retried after the next block.
+func (m *Manager) enforce(ctx context.Context) {
+	channels, err := m.Channels(ctx, "")
+	if err != nil {
+		log.Error(ctx, err, "at", "listing channels")
+		return
+	}
+	for _, c := range channels {
+		switch {
+		case c.Status == StatusBreached && c.Breach.RedeemTxID == nil:
+			if err := m.redeemBreach(ctx, c.ID); err != nil {
+				log.Error(ctx, err, "at", "redeeming breached channel", "channel", c.ID)
+			}
+		case (c.Status == StatusOpening || c.Status == StatusOpen) && time.Now().Add(forceCloseMargin).After(c.ExpiresAt):
+			if _, err := m.ForceClose(ctx, c.ID); err != nil {
+				log.Error(ctx, err, "at", "closing expiring channel", "channel", c.ID)
+			}
+		}
+	}
+}
+
+// indexBlock opens channels whose funding output is in b and closes
+// those whose funding output b spends, recording a breach if it was
+// spent by a revoked commitment.
+func (m *Manager) indexBlock(ctx context.Context, b *legacy.Block) error {
+	for _, tx := range b.Transactions {
+		for i := range tx.Outputs {
+			c, err := m.get(calcChannelKey(channelID(*tx.OutputID(i))))
+			if errors.Root(err) == ErrChannelNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if c.Status == StatusOpening {
+				c.Status = StatusOpen
+				c.Funding.BlockHeight = b.Height
+				if err := m.save(c); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, in := range tx.Inputs {
+			spentID, err := in.SpentOutputID()
+			if err != nil {
+				continue
+			}
+			c, err := m.get(calcChannelKey(channelID(spentID)))
+			if errors.Root(err) == ErrChannelNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			c.Status = StatusClosed
+			c.ClosingTxID = &tx.ID
+			c.ClosingHeight = b.Height
+			if breach := c.findBreach(tx); breach != nil {
+				log.Printf(ctx, "channel %s: peer submitted revoked commitment %d", c.ID, breach.State)
+				c.Status = StatusBreached
+				c.Breach = breach
+			}
+			if err := m.save(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollbackBlocks undoes what was indexed from blocks after height. A
+// channel closed after it is closing again, waiting for its closing
+// transaction, or a breach, to be included in the new branch. A
+// channel funded after it is opening again.
+func (m *Manager) rollbackBlocks(ctx context.Context, height uint64) error {
+	channels, err := m.Channels(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, c := range channels {
+		var changed bool
+		if c.ClosingHeight > height {
+			c.Status = StatusClosing
+			c.ClosingHeight = 0
+			c.Breach = nil
+			changed = true
+		}
+		if c.Funding != nil && c.Funding.BlockHeight > height {
+			if c.Status == StatusOpen {
+				c.Status = StatusOpening
+			}
+			c.Funding.BlockHeight = 0
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := m.save(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findBreach returns the breach if tx is a commitment of the peer
+// that it has revoked.
+func (c *Channel) findBreach(tx *legacy.Tx) *Breach {
+	for i, out := range tx.Outputs {
+		contract, err := vmutil.ParseHTLCProgram(out.ControlProgram)
+		if err != nil {
+			continue
+		}
+		resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+		if !ok {
+			continue
+		}
+		for state, secret := range c.RemoteSecrets {
+			if bytes.Equal(revocationHash(secret), contract.Hash) {
+				return &Breach{
+					TxID:           tx.ID,
+					State:          uint64(state),
+					OutputID:       *tx.OutputID(i),
+					Preimage:       secret,
+					SourceID:       *resOut.Source.Ref,
+					SourcePos:      resOut.Source.Position,
+					RefDataHash:    *resOut.Data,
+					Amount:         out.Amount,
+					ControlProgram: out.ControlProgram,
+				}
+			}
+		}
+	}
+	return nil
+}
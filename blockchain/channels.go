@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/blockchain/channel"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/net/http/httpjson"
+)
+
+func init() {
+	errorFormatter.Errors[channel.ErrChannelNotFound] = httperror.Info{404, "BTM270", "Channel not found"}
+	errorFormatter.Errors[channel.ErrBadChannel] = httperror.Info{400, "BTM271", "Invalid channel parameters"}
+	errorFormatter.Errors[channel.ErrChannelState] = httperror.Info{400, "BTM272", "Channel is not in a state that allows this"}
+	errorFormatter.Errors[channel.ErrChannelBusy] = httperror.Info{409, "BTM273", "Channel has an update in progress"}
+	errorFormatter.Errors[channel.ErrBalance] = httperror.Info{400, "BTM274", "Channel balance too low"}
+	errorFormatter.Errors[channel.ErrLocked] = httperror.Info{400, "BTM275", "Channel account is locked"}
+	errorFormatter.Errors[channel.ErrBadRevocation] = httperror.Info{400, "BTM276", "Revocation secret does not match"}
+}
+
+// SetChannels sets the manager of this core's payment channels.
+func (a *BlockchainReactor) SetChannels(m *channel.Manager) {
+	a.channels = m
+}
+
+func (a *BlockchainReactor) accountID(ctx context.Context, id, alias string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	acc, err := a.accounts.FindByAlias(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	return acc.ID, nil
+}
+
+// POST /unlock-channel-account
+func (a *BlockchainReactor) unlockChannelAccount(ctx context.Context, in struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+	Password     string `json:"password"`
+}) error {
+	accountID, err := a.accountID(ctx, in.AccountID, in.AccountAlias)
+	if err != nil {
+		return err
+	}
+	a.channels.Unlock(ctx, accountID, in.Password)
+	return nil
+}
+
+// POST /open-channel
+func (a *BlockchainReactor) openChannel(ctx context.Context, in struct {
+	channel.OpenRequest
+	AccountAlias string `json:"account_alias"`
+}) (*channel.Channel, error) {
+	accountID, err := a.accountID(ctx, in.AccountID, in.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	in.AccountID = accountID
+	return a.channels.Open(ctx, &in.OpenRequest)
+}
+
+// POST /pay-channel
+func (a *BlockchainReactor) payChannel(ctx context.Context, in struct {
+	ChannelID string `json:"channel_id"`
+	Amount    uint64 `json:"amount"`
+}) (*channel.Channel, error) {
+	return a.channels.Pay(ctx, in.ChannelID, in.Amount)
+}
+
+// POST /close-channel
+func (a *BlockchainReactor) closeChannel(ctx context.Context, in struct {
+	ChannelID string `json:"channel_id"`
+	Force     bool   `json:"force"`
+}) (*channel.Channel, error) {
+	if in.Force {
+		return a.channels.ForceClose(ctx, in.ChannelID)
+	}
+	return a.channels.Close(ctx, in.ChannelID)
+}
+
+// POST /get-channel
+func (a *BlockchainReactor) getChannel(ctx context.Context, in struct {
+	ChannelID string `json:"channel_id"`
+}) (*channel.Channel, error) {
+	return a.channels.Find(ctx, in.ChannelID)
+}
+
+// POST /list-channels
+func (a *BlockchainReactor) listChannels(ctx context.Context, in struct {
+	AccountID string `json:"account_id"`
+}) (interface{}, error) {
+	channels, err := a.channels.Channels(ctx, in.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(channels), nil
+}
+
+// The endpoints below are called by the core of the other party to
+// a channel.
+
+// POST /channel-propose
+func (a *BlockchainReactor) channelPropose(ctx context.Context, p channel.Proposal) (*channel.Acceptance, error) {
+	return a.channels.HandlePropose(ctx, &p)
+}
+
+// POST /channel-fund
+func (a *BlockchainReactor) channelFund(ctx context.Context, offer channel.FundingOffer) (*channel.FundingAck, error) {
+	return a.channels.HandleFund(ctx, &offer)
+}
+
+// POST /channel-update
+func (a *BlockchainReactor) channelUpdate(ctx context.Context, u channel.Update) (*channel.UpdateAck, error) {
+	return a.channels.HandleUpdate(ctx, &u)
+}
+
+// POST /channel-revoke
+func (a *BlockchainReactor) channelRevoke(ctx context.Context, r channel.Revocation) error {
+	return a.channels.HandleRevoke(ctx, &r)
+}
+
+// POST /channel-close
+func (a *BlockchainReactor) channelClose(ctx context.Context, offer channel.CloseOffer) (*channel.CloseAck, error) {
+	return a.channels.HandleClose(ctx, &offer)
+}
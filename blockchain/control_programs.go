@@ -11,6 +11,7 @@ import (
 	"github.com/bytom/net/http/httpjson"
 	"github.com/bytom/net/http/reqid"
 	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
 )
 
 // POST /create-control-program
@@ -36,6 +37,8 @@ func (a *BlockchainReactor) createControlProgram(ctx context.Context, ins []stru
 			switch ins[i].Type {
 			case "account":
 				prog, err = a.createAccountControlProgram(subctx, ins[i].Params)
+			case "restricted_account":
+				prog, err = a.createRestrictedAccountControlProgram(subctx, ins[i].Params)
 			default:
 				err = errors.WithDetailf(httpjson.ErrBadRequest, "unknown control program type %q", ins[i].Type)
 			}
@@ -74,6 +77,46 @@ func (a *BlockchainReactor) createAccountControlProgram(ctx context.Context, inp
 	if err != nil {
 		return nil, err
 	}
+	a.watch(controlProgram)
+
+	ret := map[string]interface{}{
+		"control_program": json.HexBytes(controlProgram),
+	}
+	return ret, nil
+}
+
+// createRestrictedAccountControlProgram creates an account control
+// program for receiving a restricted-transfer asset. Spending from it
+// requires a co-signature from the asset's issuer.
+func (a *BlockchainReactor) createRestrictedAccountControlProgram(ctx context.Context, input []byte) (interface{}, error) {
+	var parsed struct {
+		AccountAlias string     `json:"account_alias"`
+		AccountID    string     `json:"account_id"`
+		AssetID      bc.AssetID `json:"asset_id"`
+	}
+	err := stdjson.Unmarshal(input, &parsed)
+	if err != nil {
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "bad parameters for restricted account control program")
+	}
+
+	accountID := parsed.AccountID
+	if accountID == "" {
+		acc, err := a.accounts.FindByAlias(ctx, parsed.AccountAlias)
+		if err != nil {
+			return nil, err
+		}
+		accountID = acc.ID
+	}
+
+	issuerPubkeys, issuerQuorum, err := a.assets.IssuerKeys(ctx, parsed.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	controlProgram, err := a.accounts.CreateRestrictedControlProgram(ctx, accountID, issuerPubkeys, issuerQuorum)
+	if err != nil {
+		return nil, err
+	}
+	a.watch(controlProgram)
 
 	ret := map[string]interface{}{
 		"control_program": json.HexBytes(controlProgram),
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/blockchain/federation"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/errors"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/net/http/httpjson"
+)
+
+var errFederationDisabled = errors.New("this core is not a federation functionary")
+
+func init() {
+	errorFormatter.Errors[errFederationDisabled] = httperror.Info{400, "BTM260", "This core is not a federation functionary"}
+	errorFormatter.Errors[federation.ErrProposalNotFound] = httperror.Info{404, "BTM261", "Federation proposal not found"}
+	errorFormatter.Errors[federation.ErrProposalNotReady] = httperror.Info{400, "BTM262", "Federation proposal is not signed by a quorum"}
+	errorFormatter.Errors[txbuilder.ErrTemplateMismatch] = httperror.Info{400, "BTM263", "Templates do not match"}
+}
+
+// SetFederation makes this core a functionary of f.
+func (a *BlockchainReactor) SetFederation(f *federation.Federation) {
+	a.federation = f
+}
+
+// POST /get-federation
+func (a *BlockchainReactor) getFederation(ctx context.Context) (*federation.Info, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	return a.federation.Info(), nil
+}
+
+// POST /list-peg-ins
+func (a *BlockchainReactor) listPegIns(ctx context.Context, in struct {
+	Status string `json:"status"`
+}) (interface{}, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	pegIns, err := a.federation.PegIns(ctx, in.Status)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(pegIns), nil
+}
+
+// POST /list-peg-outs
+func (a *BlockchainReactor) listPegOuts(ctx context.Context, in struct {
+	Status string `json:"status"`
+}) (interface{}, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	pegOuts, err := a.federation.PegOuts(ctx, in.Status)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(pegOuts), nil
+}
+
+// POST /list-federation-proposals
+func (a *BlockchainReactor) listFederationProposals(ctx context.Context, in struct {
+	Status string `json:"status"`
+}) (interface{}, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	proposals, err := a.federation.Proposals(ctx, in.Status)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(proposals), nil
+}
+
+// POST /sign-federation-proposal
+func (a *BlockchainReactor) signFederationProposal(ctx context.Context, in struct {
+	ID   string `json:"id"`
+	Auth string `json:"auth"`
+}) (*federation.Proposal, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	return a.federation.Sign(ctx, in.ID, in.Auth, a.pseudohsmSignTemplate)
+}
+
+// POST /add-federation-signatures
+func (a *BlockchainReactor) addFederationSignatures(ctx context.Context, in struct {
+	ID       string              `json:"id"`
+	Template *txbuilder.Template `json:"template"`
+}) (*federation.Proposal, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	if in.Template == nil {
+		return nil, txbuilder.MissingFieldsError("template")
+	}
+	return a.federation.AddSignatures(ctx, in.ID, in.Template)
+}
+
+// POST /submit-federation-proposal
+func (a *BlockchainReactor) submitFederationProposal(ctx context.Context, in struct {
+	ID string `json:"id"`
+}) (*federation.Proposal, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	return a.federation.Submit(ctx, in.ID)
+}
+
+// POST /audit-federation
+func (a *BlockchainReactor) auditFederation(ctx context.Context) (interface{}, error) {
+	if a.federation == nil {
+		return nil, errors.Wrap(errFederationDisabled)
+	}
+	entries, err := a.federation.Audit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(entries), nil
+}
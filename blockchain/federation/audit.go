@@ -0,0 +1,195 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+)
+
+const (
+	supplyPrefix       = "fed_supply:"
+	supplyChangePrefix = "fed_supply_change:"
+)
+
+// peggedSupply is the amount of a pegged asset issued and retired on
+// the sidechain.
+type peggedSupply struct {
+	Issued  uint64 `json:"issued"`
+	Retired uint64 `json:"retired"`
+}
+
+// supplyChange is what one sidechain block changed of the supply of
+// a pegged asset. It is kept so that the supply can be rolled back.
+type supplyChange struct {
+	PeggedAssetID bc.AssetID `json:"pegged_asset_id"`
+	BlockHeight   uint64     `json:"block_height"`
+	Issued        uint64     `json:"issued"`
+	Retired       uint64     `json:"retired"`
+}
+
+func calcSupplyKey(pegged bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%x", supplyPrefix, pegged.Bytes()))
+}
+
+func calcSupplyChangeKey(height uint64, pegged bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%020d:%x", supplyChangePrefix, height, pegged.Bytes()))
+}
+
+func (f *Federation) supply(pegged bc.AssetID) (*peggedSupply, error) {
+	s := new(peggedSupply)
+	_, err := f.get(calcSupplyKey(pegged), s)
+	return s, err
+}
+
+// addSupply adds to the supply of a pegged asset what the sidechain
+// block at height issued and retired of it.
+func (f *Federation) addSupply(pegged bc.AssetID, issued, retired, height uint64) error {
+	s, err := f.supply(pegged)
+	if err != nil {
+		return err
+	}
+	s.Issued += issued
+	s.Retired += retired
+	if err := f.put(calcSupplyKey(pegged), s); err != nil {
+		return err
+	}
+
+	c := &supplyChange{PeggedAssetID: pegged, BlockHeight: height}
+	if _, err := f.get(calcSupplyChangeKey(height, pegged), c); err != nil {
+		return err
+	}
+	c.Issued += issued
+	c.Retired += retired
+	return f.put(calcSupplyChangeKey(height, pegged), c)
+}
+
+// rollbackSupply subtracts from the supply of pegged assets what the
+// sidechain blocks after height issued and retired.
+func (f *Federation) rollbackSupply(ctx context.Context, height uint64) error {
+	var changes []*supplyChange
+	err := f.list(supplyChangePrefix, func(b []byte) error {
+		c := new(supplyChange)
+		if err := json.Unmarshal(b, c); err != nil {
+			return err
+		}
+		if c.BlockHeight > height {
+			changes = append(changes, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		s, err := f.supply(c.PeggedAssetID)
+		if err != nil {
+			return err
+		}
+		s.Issued -= c.Issued
+		s.Retired -= c.Retired
+		if err := f.put(calcSupplyKey(c.PeggedAssetID), s); err != nil {
+			return err
+		}
+		f.db.Delete(calcSupplyChangeKey(c.BlockHeight, c.PeggedAssetID))
+	}
+	return nil
+}
+
+// AuditEntry compares the federation's reserves of one mainchain
+// asset with what it owes.
+type AuditEntry struct {
+	AssetID       bc.AssetID `json:"asset_id"`
+	PeggedAssetID bc.AssetID `json:"pegged_asset_id"`
+
+	// Reserves is the amount held in unspent federation outputs on
+	// the mainchain.
+	Reserves uint64 `json:"reserves"`
+
+	// Issued and Retired are the amounts of the pegged asset issued
+	// and retired on the sidechain.
+	Issued  uint64 `json:"issued"`
+	Retired uint64 `json:"retired"`
+
+	// PendingMint is the amount pegged in but not yet minted, and
+	// PendingRelease the amount pegged out but not yet released.
+	PendingMint    uint64 `json:"pending_mint"`
+	PendingRelease uint64 `json:"pending_release"`
+
+	// Unclaimed is the amount paid to the federation with no valid
+	// peg-in claim. It is held in reserve but owed to no one.
+	Unclaimed uint64 `json:"unclaimed"`
+
+	// Backed reports whether the reserves cover the pegged asset in
+	// circulation plus everything pending.
+	Backed bool `json:"backed"`
+}
+
+// Audit returns an audit entry for every mainchain asset the
+// federation has received, in asset ID order.
+func (f *Federation) Audit(ctx context.Context) ([]*AuditEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries := make(map[bc.AssetID]*AuditEntry)
+	entry := func(id, pegged bc.AssetID) *AuditEntry {
+		e, ok := entries[id]
+		if !ok {
+			e = &AuditEntry{AssetID: id, PeggedAssetID: pegged}
+			entries[id] = e
+		}
+		return e
+	}
+
+	pegIns, err := f.PegIns(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pegIns {
+		e := entry(p.AssetID, p.PeggedAssetID)
+		if !p.Spent {
+			e.Reserves += p.Amount
+		}
+		switch p.Status {
+		case PegInPending, PegInConfirmed:
+			e.PendingMint += p.Amount
+		case PegInUnclaimed:
+			e.Unclaimed += p.Amount
+		}
+	}
+
+	pegOuts, err := f.PegOuts(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pegOuts {
+		if p.Status != PegOutReleased {
+			entry(p.AssetID, p.PeggedAssetID).PendingRelease += p.Amount
+		}
+	}
+
+	var result []*AuditEntry
+	for _, e := range entries {
+		s, err := f.supply(e.PeggedAssetID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pegged asset %x", e.PeggedAssetID.Bytes())
+		}
+		e.Issued, e.Retired = s.Issued, s.Retired
+		e.Backed = s.Issued >= s.Retired && e.Reserves >= s.Issued-s.Retired+e.PendingMint+e.PendingRelease
+		result = append(result, e)
+	}
+	sort.Sort(auditByAsset(result))
+	return result, nil
+}
+
+type auditByAsset []*AuditEntry
+
+func (a auditByAsset) Len() int      { return len(a) }
+func (a auditByAsset) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a auditByAsset) Less(i, j int) bool {
+	return bytes.Compare(a[i].AssetID.Bytes(), a[j].AssetID.Bytes()) < 0
+}
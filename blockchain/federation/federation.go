@@ -0,0 +1,395 @@
+// Package federation implements the functionary side of a federated
+// two-way peg between a mainchain and a sidechain run by this core.
+//
+// Funds are pegged in by paying them, on the mainchain, to the
+// federation's multisig program with output reference data naming a
+// control program on the sidechain:
+//
+//	{"peg_in": {"control_program": "<hex>"}}
+//
+// Once the peg-in is buried under enough mainchain blocks, the
+// functionaries mint the same amount of a pegged asset to that
+// program on the sidechain. Each mainchain asset has one pegged
+// asset, issued by the federation's keys, whose definition names the
+// mainchain asset it stands for.
+//
+// Funds are pegged out by retiring a pegged asset on the sidechain
+// with output reference data naming a control program on the
+// mainchain:
+//
+//	{"peg_out": {"control_program": "<hex>"}}
+//
+// The functionaries then release the same amount of the mainchain
+// asset from the federation's outputs to that program, paying any
+// change back to the federation.
+//
+// Every functionary watches both chains and builds the same mint and
+// release transactions. Each signs its own copy of a proposal, and
+// the signatures are exchanged until a quorum has signed and the
+// transaction can be submitted.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// Reference data keys.
+const (
+	// PegInKey and PegOutKey name the output reference data field in
+	// which a user claims pegged funds on the other chain.
+	PegInKey  = "peg_in"
+	PegOutKey = "peg_out"
+
+	// MintKey and ReleaseKey name the transaction reference data
+	// field in which a federation transaction records the peg it
+	// completes.
+	MintKey    = "federation_mint"
+	ReleaseKey = "federation_release"
+
+	// MainchainAssetKey is the field of a pegged asset's definition
+	// holding the ID of the mainchain asset it stands for.
+	MainchainAssetKey = "mainchain_asset_id"
+)
+
+// Peg-in statuses.
+const (
+	PegInPending   = "pending"   // waiting for confirmations
+	PegInConfirmed = "confirmed" // mint proposed
+	PegInMinted    = "minted"    // mint on the sidechain
+	PegInUnclaimed = "unclaimed" // no valid peg_in claim
+	PegInChange    = "change"    // change from a release
+)
+
+// Peg-out statuses.
+const (
+	PegOutPending  = "pending"  // waiting for reserves
+	PegOutProposed = "proposed" // release proposed
+	PegOutReleased = "released" // release on the mainchain
+)
+
+// Proposal types and statuses.
+const (
+	ProposalMint    = "mint"
+	ProposalRelease = "release"
+
+	ProposalSigning   = "signing"
+	ProposalReady     = "ready"
+	ProposalSubmitted = "submitted"
+	ProposalConfirmed = "confirmed"
+)
+
+const (
+	pegInPrefix        = "fed_pegin:"
+	pegOutPrefix       = "fed_pegout:"
+	proposalPrefix     = "fed_proposal:"
+	peggedAssetPrefix  = "fed_pegged:"
+	mainchainHeightKey = "fed_mainchain_height"
+	sidechainHeightKey = "fed_sidechain_height"
+
+	defaultMintWindow = time.Hour
+)
+
+var (
+	ErrBadConfig            = errors.New("invalid federation configuration")
+	ErrProposalNotFound     = errors.New("federation proposal not found")
+	ErrProposalNotReady     = errors.New("federation proposal is not signed by a quorum")
+	ErrInsufficientReserves = errors.New("federation reserves cannot cover the peg-out")
+)
+
+// A Chain is a blockchain watched by the federation. *protocol.Chain
+// implements it for the local chain, and RemoteChain for a chain
+// reached over RPC.
+type Chain interface {
+	BlockWaiter(height uint64) <-chan struct{}
+	GetBlock(height uint64) (*legacy.Block, error)
+}
+
+// A Submitter sends a fully signed transaction to a chain.
+type Submitter interface {
+	Submit(ctx context.Context, tx *legacy.Tx) error
+}
+
+// Config describes the federation. Every functionary must use the
+// same XPubs, in the same order, and the same Quorum.
+type Config struct {
+	XPubs  []chainkd.XPub
+	Quorum int
+
+	// Confirmations is the number of mainchain blocks that must be
+	// built on top of a peg-in before it is minted.
+	Confirmations uint64
+
+	// SidechainInitialBlock is the hash of the sidechain's first
+	// block, to which pegged asset IDs commit.
+	SidechainInitialBlock bc.Hash
+
+	// MintWindow is the length of the time window of mint
+	// transactions. Functionaries signing in the same window sign the
+	// same transaction. It must not exceed the sidechain's maximum
+	// issuance window. The default is an hour.
+	MintWindow time.Duration
+}
+
+// Federation watches a mainchain and a sidechain for pegs and
+// coordinates the transactions that complete them.
+type Federation struct {
+	db         dbm.DB
+	cfg        Config
+	pegProgram []byte
+
+	mainchain     Chain
+	sidechain     Chain
+	mainSubmitter Submitter
+	sideSubmitter Submitter
+
+	// mu serializes updates to pegs and proposals between the
+	// watchers and API calls.
+	mu sync.Mutex
+}
+
+// New returns a federation storing its state in db.
+func New(db dbm.DB, cfg Config, mainchain, sidechain Chain, mainSubmitter, sideSubmitter Submitter) (*Federation, error) {
+	if len(cfg.XPubs) == 0 || cfg.Quorum < 1 || cfg.Quorum > len(cfg.XPubs) {
+		return nil, errors.WithDetailf(ErrBadConfig, "quorum %d of %d keys", cfg.Quorum, len(cfg.XPubs))
+	}
+	if cfg.MintWindow <= 0 {
+		cfg.MintWindow = defaultMintWindow
+	}
+	prog, err := vmutil.P2SPMultiSigProgram(chainkd.XPubKeys(cfg.XPubs), cfg.Quorum)
+	if err != nil {
+		return nil, errors.Sub(ErrBadConfig, err)
+	}
+	return &Federation{
+		db:            db,
+		cfg:           cfg,
+		pegProgram:    prog,
+		mainchain:     mainchain,
+		sidechain:     sidechain,
+		mainSubmitter: mainSubmitter,
+		sideSubmitter: sideSubmitter,
+	}, nil
+}
+
+// Info describes the federation to users and other functionaries.
+type Info struct {
+	XPubs         []chainkd.XPub     `json:"xpubs"`
+	Quorum        int                `json:"quorum"`
+	Confirmations uint64             `json:"confirmations"`
+	PegProgram    chainjson.HexBytes `json:"peg_program"`
+}
+
+// Info returns the federation's keys and the mainchain program to
+// which peg-ins are paid.
+func (f *Federation) Info() *Info {
+	return &Info{
+		XPubs:         f.cfg.XPubs,
+		Quorum:        f.cfg.Quorum,
+		Confirmations: f.cfg.Confirmations,
+		PegProgram:    f.pegProgram,
+	}
+}
+
+// Claim names the control program that receives pegged funds on the
+// other chain.
+type Claim struct {
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+}
+
+// PegIn is an output paying the federation on the mainchain. Outputs
+// without a valid claim, including the change from releases, are
+// tracked too; they are part of the federation's reserves.
+type PegIn struct {
+	OutputID         bc.Hash            `json:"output_id"`
+	TxID             bc.Hash            `json:"transaction_id"`
+	BlockHeight      uint64             `json:"block_height"`
+	SourceID         bc.Hash            `json:"source_id"`
+	SourcePos        uint64             `json:"source_pos"`
+	AssetID          bc.AssetID         `json:"asset_id"`
+	Amount           uint64             `json:"amount"`
+	RefDataHash      bc.Hash            `json:"ref_data_hash"`
+	SidechainProgram chainjson.HexBytes `json:"sidechain_control_program,omitempty"`
+	PeggedAssetID    bc.AssetID         `json:"pegged_asset_id"`
+	Status           string             `json:"status"`
+	MintTxID         *bc.Hash           `json:"mint_transaction_id,omitempty"`
+	MintHeight       uint64             `json:"mint_block_height,omitempty"`
+
+	// Spent is set once a release spends the output, in the block at
+	// SpentHeight. ReservedBy names the release proposal that will
+	// spend it.
+	Spent       bool   `json:"spent"`
+	SpentHeight uint64 `json:"spent_height,omitempty"`
+	ReservedBy  string `json:"reserved_by,omitempty"`
+}
+
+// PegOut is a retirement of a pegged asset on the sidechain claiming
+// the mainchain asset it stands for.
+type PegOut struct {
+	OutputID         bc.Hash            `json:"output_id"`
+	TxID             bc.Hash            `json:"transaction_id"`
+	BlockHeight      uint64             `json:"block_height"`
+	PeggedAssetID    bc.AssetID         `json:"pegged_asset_id"`
+	AssetID          bc.AssetID         `json:"asset_id"`
+	Amount           uint64             `json:"amount"`
+	MainchainProgram chainjson.HexBytes `json:"mainchain_control_program"`
+	Status           string             `json:"status"`
+	ReleaseTxID      *bc.Hash           `json:"release_transaction_id,omitempty"`
+	ReleaseHeight    uint64             `json:"release_block_height,omitempty"`
+}
+
+// Proposal is a federation transaction being signed.
+type Proposal struct {
+	ID       string              `json:"id"`
+	Type     string              `json:"type"`
+	PegID    bc.Hash             `json:"peg_id"`
+	Template *txbuilder.Template `json:"template"`
+	Status   string              `json:"status"`
+}
+
+// PeggedAsset returns the ID of the sidechain asset standing for the
+// mainchain asset id, and the definition it is issued with.
+func (f *Federation) PeggedAsset(id bc.AssetID) (bc.AssetID, []byte) {
+	def := peggedDefinition(id)
+	txin := legacy.NewIssuanceInput(nil, 0, nil, f.cfg.SidechainInitialBlock, f.pegProgram, nil, def)
+	return txin.AssetID(), def
+}
+
+func peggedDefinition(id bc.AssetID) []byte {
+	// Field order is fixed so that every functionary computes the
+	// same asset ID.
+	b, _ := json.Marshal(map[string]bc.AssetID{MainchainAssetKey: id})
+	return b
+}
+
+func calcPeggedAssetKey(pegged bc.AssetID) []byte {
+	return []byte(fmt.Sprintf("%s%x", peggedAssetPrefix, pegged.Bytes()))
+}
+
+// mainchainAsset returns the mainchain asset for which pegged is the
+// pegged asset, if it has been seen.
+func (f *Federation) mainchainAsset(pegged bc.AssetID) (bc.AssetID, bool) {
+	b := f.db.Get(calcPeggedAssetKey(pegged))
+	if b == nil {
+		return bc.AssetID{}, false
+	}
+	var id bc.AssetID
+	if err := id.UnmarshalText(b); err != nil {
+		return bc.AssetID{}, false
+	}
+	return id, true
+}
+
+func calcPegInKey(id bc.Hash) []byte   { return []byte(fmt.Sprintf("%s%x", pegInPrefix, id.Bytes())) }
+func calcPegOutKey(id bc.Hash) []byte  { return []byte(fmt.Sprintf("%s%x", pegOutPrefix, id.Bytes())) }
+func calcProposalKey(id string) []byte { return []byte(proposalPrefix + id) }
+
+func mintProposalID(id bc.Hash) string    { return fmt.Sprintf("%s-%x", ProposalMint, id.Bytes()) }
+func releaseProposalID(id bc.Hash) string { return fmt.Sprintf("%s-%x", ProposalRelease, id.Bytes()) }
+
+func (f *Federation) get(key []byte, v interface{}) (bool, error) {
+	b := f.db.Get(key)
+	if b == nil {
+		return false, nil
+	}
+	return true, errors.Wrap(json.Unmarshal(b, v), "decoding federation record")
+}
+
+func (f *Federation) put(key []byte, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshaling federation record")
+	}
+	f.db.Set(key, b)
+	return nil
+}
+
+func (f *Federation) list(prefix string, decode func([]byte) error) error {
+	iter := f.db.Iterator()
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), prefix) {
+			continue
+		}
+		if err := decode(iter.Value()); err != nil {
+			return errors.Wrap(err, "decoding federation record")
+		}
+	}
+	return nil
+}
+
+// PegIns returns every output paying the federation, with status
+// status if it is not empty.
+func (f *Federation) PegIns(ctx context.Context, status string) ([]*PegIn, error) {
+	var pegIns []*PegIn
+	err := f.list(pegInPrefix, func(b []byte) error {
+		p := new(PegIn)
+		if err := json.Unmarshal(b, p); err != nil {
+			return err
+		}
+		if status == "" || p.Status == status {
+			pegIns = append(pegIns, p)
+		}
+		return nil
+	})
+	return pegIns, err
+}
+
+// PegOuts returns every peg-out, with status status if it is not
+// empty.
+func (f *Federation) PegOuts(ctx context.Context, status string) ([]*PegOut, error) {
+	var pegOuts []*PegOut
+	err := f.list(pegOutPrefix, func(b []byte) error {
+		p := new(PegOut)
+		if err := json.Unmarshal(b, p); err != nil {
+			return err
+		}
+		if status == "" || p.Status == status {
+			pegOuts = append(pegOuts, p)
+		}
+		return nil
+	})
+	return pegOuts, err
+}
+
+// Proposals returns every proposal, with status status if it is not
+// empty.
+func (f *Federation) Proposals(ctx context.Context, status string) ([]*Proposal, error) {
+	var proposals []*Proposal
+	err := f.list(proposalPrefix, func(b []byte) error {
+		p := new(Proposal)
+		if err := json.Unmarshal(b, p); err != nil {
+			return err
+		}
+		if status == "" || p.Status == status {
+			proposals = append(proposals, p)
+		}
+		return nil
+	})
+	return proposals, err
+}
+
+// FindProposal returns the proposal with the given ID.
+func (f *Federation) FindProposal(ctx context.Context, id string) (*Proposal, error) {
+	p := new(Proposal)
+	ok, err := f.get(calcProposalKey(id), p)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.WithDetailf(ErrProposalNotFound, "proposal %q", id)
+	}
+	return p, nil
+}
@@ -0,0 +1,394 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+)
+
+type functionary struct {
+	xprv chainkd.XPrv
+	fed  *Federation
+}
+
+func (fn *functionary) sign(ctx context.Context, xpub chainkd.XPub, path [][]byte, data [32]byte, auth string) ([]byte, error) {
+	if xpub != fn.xprv.XPub() {
+		return nil, nil
+	}
+	return fn.xprv.Derive(path).Sign(data[:]), nil
+}
+
+func newFunctionaries(t *testing.T, n, quorum int) []*functionary {
+	var (
+		xprvs []chainkd.XPrv
+		xpubs []chainkd.XPub
+	)
+	for i := 0; i < n; i++ {
+		xprv, xpub, err := chainkd.NewXKeys(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xprvs = append(xprvs, xprv)
+		xpubs = append(xpubs, xpub)
+	}
+	cfg := Config{XPubs: xpubs, Quorum: quorum, Confirmations: 1, SidechainInitialBlock: bc.Hash{V0: 7}}
+
+	var fns []*functionary
+	for _, xprv := range xprvs {
+		fed, err := New(dbm.NewMemDB(), cfg, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fns = append(fns, &functionary{xprv: xprv, fed: fed})
+	}
+	return fns
+}
+
+func block(height uint64, txs ...*legacy.Tx) *legacy.Block {
+	return &legacy.Block{
+		BlockHeader:  legacy.BlockHeader{Height: height, TimestampMS: bc.Millis(time.Now())},
+		Transactions: txs,
+	}
+}
+
+func TestPegInAndOut(t *testing.T) {
+	ctx := context.Background()
+	fns := newFunctionaries(t, 3, 2)
+	pegProgram := fns[0].fed.Info().PegProgram
+	sideProgram := []byte{byte(vm.OP_TRUE)}
+	mainProgram := []byte{byte(vm.OP_TRUE), byte(vm.OP_TRUE)}
+	assetID := bc.AssetID{V0: 1}
+
+	pegInTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 9}, assetID, 100, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 100, pegProgram, []byte(`{"peg_in": {"control_program": "51"}}`))},
+	})
+	unclaimedTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 10}, assetID, 10, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 10, pegProgram, nil)},
+	})
+	mainBlocks := []*legacy.Block{block(1, pegInTx), block(2, unclaimedTx)}
+
+	for _, fn := range fns {
+		for _, b := range mainBlocks {
+			if err := fn.fed.indexMainchainBlock(ctx, b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The peg-in is confirmed by block 2; the unclaimed payment is
+	// only held in reserve.
+	pegInID := *pegInTx.OutputID(0)
+	mintID := mintProposalID(pegInID)
+	mint, err := fns[0].fed.FindProposal(ctx, mintID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pegged, _ := fns[0].fed.PeggedAsset(assetID)
+	outs := mint.Template.Transaction.Outputs
+	if len(outs) != 1 || *outs[0].AssetId != pegged || outs[0].Amount != 100 || string(outs[0].ControlProgram) != string(sideProgram) {
+		t.Fatalf("mint outputs = %+v, want 100 of the pegged asset to the claimed program", outs)
+	}
+	if _, err := fns[0].fed.Submit(ctx, mintID); errors.Root(err) != ErrProposalNotReady {
+		t.Errorf("submit unsigned mint: got error %v, want %v", err, ErrProposalNotReady)
+	}
+
+	// Each functionary signs its own copy; one of them collects a
+	// quorum of signatures.
+	var copies []*txbuilder.Template
+	for _, fn := range fns[:2] {
+		p, err := fn.fed.Sign(ctx, mintID, "", fn.sign)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != ProposalSigning {
+			t.Errorf("proposal signed by one functionary has status %q", p.Status)
+		}
+		// Copies travel between functionaries as JSON.
+		b, err := json.Marshal(p.Template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl := new(txbuilder.Template)
+		if err := json.Unmarshal(b, tpl); err != nil {
+			t.Fatal(err)
+		}
+		copies = append(copies, tpl)
+	}
+
+	// The signed program survives storing the proposal.
+	stored, err := fns[0].fed.FindProposal(ctx, mintID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, si := range stored.Template.SigningInstructions {
+		for _, sw := range si.SignatureWitnesses {
+			if len(sw.Program) == 0 {
+				t.Fatal("stored proposal lost its signature program")
+			}
+		}
+	}
+	mint, err = fns[0].fed.AddSignatures(ctx, mintID, copies[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mint.Status != ProposalReady {
+		t.Errorf("proposal signed by a quorum has status %q, want %q", mint.Status, ProposalReady)
+	}
+
+	// A signature over another transaction is rejected.
+	other := *copies[1]
+	other.Transaction = pegInTx
+	if _, err := fns[2].fed.AddSignatures(ctx, mintID, &other); errors.Root(err) != txbuilder.ErrTemplateMismatch {
+		t.Errorf("merge mismatched template: got error %v, want %v", err, txbuilder.ErrTemplateMismatch)
+	}
+
+	fed := fns[0].fed
+	fed.db.Set([]byte(mainchainHeightKey), []byte("2"))
+	pegOutTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 11}, pegged, 30, 0, sideProgram, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(pegged, 30, []byte{byte(vm.OP_FAIL)}, []byte(`{"peg_out": {"control_program": "5151"}}`))},
+	})
+	for _, b := range []*legacy.Block{block(1, mint.Template.Transaction), block(2, pegOutTx)} {
+		if err := fed.indexSidechainBlock(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pegIns, err := fed.PegIns(ctx, PegInMinted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pegIns) != 1 || pegIns[0].OutputID != pegInID {
+		t.Errorf("minted peg-ins = %+v, want the peg-in", pegIns)
+	}
+
+	// The release spends the confirmed peg-in, not the unconfirmed
+	// unclaimed payment, and returns the change.
+	pegOutID := *pegOutTx.OutputID(0)
+	release, err := fed.FindProposal(ctx, releaseProposalID(pegOutID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := release.Template.Transaction
+	if spent, _ := tx.Inputs[0].SpentOutputID(); len(tx.Inputs) != 1 || spent != pegInID {
+		t.Errorf("release inputs = %+v, want the peg-in", tx.Inputs)
+	}
+	if len(tx.Outputs) != 2 || tx.Outputs[0].Amount != 30 || string(tx.Outputs[0].ControlProgram) != string(mainProgram) || tx.Outputs[1].Amount != 70 {
+		t.Errorf("release outputs = %+v, want 30 to the claimed program and 70 change", tx.Outputs)
+	}
+
+	audit, err := fed.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AuditEntry{AssetID: assetID, PeggedAssetID: pegged, Reserves: 110, Issued: 100, Retired: 30, PendingRelease: 30, Unclaimed: 10, Backed: true}
+	if len(audit) != 1 || *audit[0] != want {
+		t.Errorf("audit = %+v, want %+v", audit[0], want)
+	}
+
+	if err := fed.indexMainchainBlock(ctx, block(3, tx)); err != nil {
+		t.Fatal(err)
+	}
+	audit, err = fed.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Reserves, want.PendingRelease = 80, 0
+	if *audit[0] != want {
+		t.Errorf("audit after release = %+v, want %+v", audit[0], want)
+	}
+	release, err = fed.FindProposal(ctx, release.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Status != ProposalConfirmed {
+		t.Errorf("release status = %q, want %q", release.Status, ProposalConfirmed)
+	}
+
+	// The mainchain forks after block 2, orphaning the release.
+	if err := fed.rollbackMainchain(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	audit, err = fed.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Reserves, want.PendingRelease = 110, 30
+	if *audit[0] != want {
+		t.Errorf("audit after rollback = %+v, want %+v", audit[0], want)
+	}
+	release, err = fed.FindProposal(ctx, release.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Status != ProposalSubmitted {
+		t.Errorf("release status after rollback = %q, want %q", release.Status, ProposalSubmitted)
+	}
+
+	// Forking after block 1 forgets the unclaimed payment; the
+	// minted peg-in stays.
+	if err := fed.rollbackMainchain(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	pegIns, err = fed.PegIns(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pegIns) != 1 || pegIns[0].OutputID != pegInID {
+		t.Errorf("peg-ins after rollback = %+v, want the minted peg-in", pegIns)
+	}
+}
+
+func TestRenewMint(t *testing.T) {
+	ctx := context.Background()
+	fns := newFunctionaries(t, 2, 2)
+	pegProgram := fns[0].fed.Info().PegProgram
+	assetID := bc.AssetID{V0: 1}
+
+	pegInTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 9}, assetID, 100, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 100, pegProgram, []byte(`{"peg_in": {"control_program": "51"}}`))},
+	})
+	start := time.Unix(1500000000, 0)
+	at := func(height uint64, d time.Duration, txs ...*legacy.Tx) *legacy.Block {
+		b := block(height, txs...)
+		b.TimestampMS = bc.Millis(start.Add(d))
+		return b
+	}
+	for _, fn := range fns {
+		for _, b := range []*legacy.Block{at(1, 0, pegInTx), at(2, time.Minute)} {
+			if err := fn.fed.indexMainchainBlock(ctx, b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The first functionary signs before the window passes, the second
+	// after. Both renew the mint when they index the same block.
+	mintID := mintProposalID(*pegInTx.OutputID(0))
+	if _, err := fns[0].fed.Sign(ctx, mintID, "", fns[0].sign); err != nil {
+		t.Fatal(err)
+	}
+	late := at(3, 3*time.Hour)
+	var copies []*txbuilder.Template
+	for _, fn := range fns {
+		if err := fn.fed.indexMainchainBlock(ctx, late); err != nil {
+			t.Fatal(err)
+		}
+		p, err := fn.fed.Sign(ctx, mintID, "", fn.sign)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copies = append(copies, p.Template)
+	}
+	if got, want := copies[0].Transaction.MaxTime, bc.Millis(late.Time().Truncate(time.Hour).Add(time.Hour)); got != want {
+		t.Errorf("renewed mint max time = %d, want %d", got, want)
+	}
+	p, err := fns[0].fed.AddSignatures(ctx, mintID, copies[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != ProposalReady {
+		t.Errorf("renewed mint signed by both functionaries has status %q, want %q", p.Status, ProposalReady)
+	}
+}
+
+func TestRollbackSidechain(t *testing.T) {
+	ctx := context.Background()
+	fn := newFunctionaries(t, 1, 1)[0]
+	fed := fn.fed
+	pegProgram := fed.Info().PegProgram
+	assetID := bc.AssetID{V0: 1}
+
+	pegInTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 9}, assetID, 100, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 100, pegProgram, []byte(`{"peg_in": {"control_program": "51"}}`))},
+	})
+	for _, b := range []*legacy.Block{block(1, pegInTx), block(2)} {
+		if err := fed.indexMainchainBlock(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pegInID := *pegInTx.OutputID(0)
+	mint, err := fed.Sign(ctx, mintProposalID(pegInID), "", fn.sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fed.db.Set([]byte(mainchainHeightKey), []byte("2"))
+
+	pegged, _ := fed.PeggedAsset(assetID)
+	pegOutTx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: 11}, pegged, 30, 0, []byte{byte(vm.OP_TRUE)}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(pegged, 30, []byte{byte(vm.OP_FAIL)}, []byte(`{"peg_out": {"control_program": "5151"}}`))},
+	})
+	for _, b := range []*legacy.Block{block(1, mint.Template.Transaction), block(2, pegOutTx)} {
+		if err := fed.indexSidechainBlock(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pegOutID := *pegOutTx.OutputID(0)
+	if _, err := fed.FindProposal(ctx, releaseProposalID(pegOutID)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Orphaning the peg-out forgets it and frees the reserves its
+	// release would spend.
+	if err := fed.rollbackSidechain(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pegOuts, err := fed.PegOuts(ctx, ""); err != nil || len(pegOuts) != 0 {
+		t.Errorf("peg-outs after rollback to 1 = %v, %v, want none", pegOuts, err)
+	}
+	if _, err := fed.FindProposal(ctx, releaseProposalID(pegOutID)); errors.Root(err) != ErrProposalNotFound {
+		t.Errorf("release after rollback to 1: got error %v, want %v", err, ErrProposalNotFound)
+	}
+	audit, err := fed.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != 1 || audit[0].Issued != 100 || audit[0].Retired != 0 || audit[0].PendingRelease != 0 {
+		t.Errorf("audit after rollback to 1 = %+v, want 100 issued and nothing retired", audit[0])
+	}
+
+	// Orphaning the mint leaves the peg-in waiting for it again.
+	if err := fed.rollbackSidechain(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	pegIns, err := fed.PegIns(ctx, PegInConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pegIns) != 1 || pegIns[0].ReservedBy != "" || pegIns[0].MintTxID != nil {
+		t.Errorf("confirmed peg-ins after rollback to 0 = %+v, want the unminted peg-in", pegIns)
+	}
+	if mint, err = fed.FindProposal(ctx, mint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if mint.Status != ProposalSubmitted {
+		t.Errorf("mint after rollback to 0 has status %q, want %q", mint.Status, ProposalSubmitted)
+	}
+	if audit, err = fed.Audit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if audit[0].Issued != 0 || audit[0].PendingMint != 100 {
+		t.Errorf("audit after rollback to 0 = %+v, want 100 pending mint", audit[0])
+	}
+}
@@ -0,0 +1,294 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Federation transactions are built from the indexed state of the
+// chains alone, so that every functionary builds the same
+// transaction and their signatures can be merged.
+
+// proposeMint proposes minting the pegged asset for p, with a time
+// window starting at the window containing at.
+func (f *Federation) proposeMint(ctx context.Context, p *PegIn, at time.Time) error {
+	id := mintProposalID(p.OutputID)
+	if f.db.Get(calcProposalKey(id)) != nil {
+		return nil
+	}
+	tpl, err := f.mintTemplate(p, at)
+	if err != nil {
+		return err
+	}
+	proposal := &Proposal{ID: id, Type: ProposalMint, PegID: p.OutputID, Template: tpl, Status: ProposalSigning}
+	if err := f.put(calcProposalKey(id), proposal); err != nil {
+		return err
+	}
+	p.Status = PegInConfirmed
+	return f.put(calcPegInKey(p.OutputID), p)
+}
+
+func (f *Federation) mintTemplate(p *PegIn, at time.Time) (*txbuilder.Template, error) {
+	refData, err := json.Marshal(map[string]bc.Hash{MintKey: p.OutputID})
+	if err != nil {
+		return nil, err
+	}
+	_, def := f.PeggedAsset(p.AssetID)
+	start := at.Truncate(f.cfg.MintWindow)
+	return f.template(&legacy.TxData{
+		Version:       1,
+		Inputs:        []*legacy.TxInput{legacy.NewIssuanceInput(p.OutputID.Bytes(), p.Amount, nil, f.cfg.SidechainInitialBlock, f.pegProgram, nil, def)},
+		Outputs:       []*legacy.TxOutput{legacy.NewTxOutput(p.PeggedAssetID, p.Amount, p.SidechainProgram, nil)},
+		MinTime:       bc.Millis(start),
+		MaxTime:       bc.Millis(start.Add(f.cfg.MintWindow)),
+		ReferenceData: refData,
+	}), nil
+}
+
+// renewMints rebuilds each mint still being signed whose time window
+// ended before at, for the window containing at, discarding its
+// signatures. It is called with the time of each mainchain block
+// indexed, so every functionary rebuilds a mint at the same block and
+// for the same window.
+func (f *Federation) renewMints(ctx context.Context, at time.Time) error {
+	proposals, err := f.Proposals(ctx, ProposalSigning)
+	if err != nil {
+		return err
+	}
+	for _, p := range proposals {
+		if p.Type != ProposalMint || p.Template.Transaction.MaxTime >= bc.Millis(at) {
+			continue
+		}
+		pegIn := new(PegIn)
+		if _, err := f.get(calcPegInKey(p.PegID), pegIn); err != nil {
+			return err
+		}
+		p.Template, err = f.mintTemplate(pegIn, at)
+		if err != nil {
+			return err
+		}
+		if err := f.put(calcProposalKey(p.ID), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proposeReleases proposes a release for each pending peg-out, oldest
+// first, while there are reserves with enough confirmations at
+// mainchain height mainHeight to cover it.
+func (f *Federation) proposeReleases(ctx context.Context, mainHeight uint64) error {
+	pegOuts, err := f.PegOuts(ctx, PegOutPending)
+	if err != nil {
+		return err
+	}
+	sort.Sort(pegOutsByHeight(pegOuts))
+
+	for _, p := range pegOuts {
+		err := f.proposeRelease(ctx, p, mainHeight)
+		if errors.Root(err) == ErrInsufficientReserves {
+			log.Printf(ctx, "federation: peg-out %x waiting for reserves", p.OutputID.Bytes())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Federation) proposeRelease(ctx context.Context, p *PegOut, mainHeight uint64) error {
+	reserves, err := f.availableReserves(ctx, p.AssetID, mainHeight)
+	if err != nil {
+		return err
+	}
+	var (
+		selected []*PegIn
+		total    uint64
+	)
+	for _, r := range reserves {
+		if total >= p.Amount {
+			break
+		}
+		selected = append(selected, r)
+		total += r.Amount
+	}
+	if total < p.Amount {
+		return errors.WithDetailf(ErrInsufficientReserves, "%d available, %d needed", total, p.Amount)
+	}
+
+	refData, err := json.Marshal(map[string]bc.Hash{ReleaseKey: p.OutputID})
+	if err != nil {
+		return err
+	}
+	txdata := &legacy.TxData{Version: 1, ReferenceData: refData}
+	for _, r := range selected {
+		txdata.Inputs = append(txdata.Inputs, legacy.NewSpendInput(nil, r.SourceID, r.AssetID, r.Amount, r.SourcePos, f.pegProgram, r.RefDataHash, nil))
+	}
+	txdata.Outputs = append(txdata.Outputs, legacy.NewTxOutput(p.AssetID, p.Amount, p.MainchainProgram, nil))
+	if total > p.Amount {
+		txdata.Outputs = append(txdata.Outputs, legacy.NewTxOutput(p.AssetID, total-p.Amount, f.pegProgram, nil))
+	}
+
+	id := releaseProposalID(p.OutputID)
+	proposal := &Proposal{ID: id, Type: ProposalRelease, PegID: p.OutputID, Template: f.template(txdata), Status: ProposalSigning}
+	if err := f.put(calcProposalKey(id), proposal); err != nil {
+		return err
+	}
+	for _, r := range selected {
+		r.ReservedBy = id
+		if err := f.put(calcPegInKey(r.OutputID), r); err != nil {
+			return err
+		}
+	}
+	p.Status = PegOutProposed
+	return f.put(calcPegOutKey(p.OutputID), p)
+}
+
+// availableReserves returns the unspent, unreserved federation
+// outputs of assetID with enough confirmations, oldest first.
+func (f *Federation) availableReserves(ctx context.Context, assetID bc.AssetID, mainHeight uint64) ([]*PegIn, error) {
+	pegIns, err := f.PegIns(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var reserves []*PegIn
+	for _, p := range pegIns {
+		if p.AssetID != assetID || p.Spent || p.ReservedBy != "" || p.BlockHeight+f.cfg.Confirmations > mainHeight {
+			continue
+		}
+		reserves = append(reserves, p)
+	}
+	sort.Sort(pegInsByHeight(reserves))
+	return reserves, nil
+}
+
+// pegInsByHeight and pegOutsByHeight order pegs by the block that
+// made them, breaking ties by output ID, so that every functionary
+// handles them in the same order.
+type pegInsByHeight []*PegIn
+
+func (a pegInsByHeight) Len() int      { return len(a) }
+func (a pegInsByHeight) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a pegInsByHeight) Less(i, j int) bool {
+	if a[i].BlockHeight != a[j].BlockHeight {
+		return a[i].BlockHeight < a[j].BlockHeight
+	}
+	return bytes.Compare(a[i].OutputID.Bytes(), a[j].OutputID.Bytes()) < 0
+}
+
+type pegOutsByHeight []*PegOut
+
+func (a pegOutsByHeight) Len() int      { return len(a) }
+func (a pegOutsByHeight) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a pegOutsByHeight) Less(i, j int) bool {
+	if a[i].BlockHeight != a[j].BlockHeight {
+		return a[i].BlockHeight < a[j].BlockHeight
+	}
+	return bytes.Compare(a[i].OutputID.Bytes(), a[j].OutputID.Bytes()) < 0
+}
+
+// template returns an unsigned template for txdata in which every
+// input is signed by the federation's keys. Signatures commit to the
+// whole transaction.
+func (f *Federation) template(txdata *legacy.TxData) *txbuilder.Template {
+	tpl := &txbuilder.Template{Transaction: legacy.NewTx(*txdata), Local: true}
+	for i := range txdata.Inputs {
+		si := &txbuilder.SigningInstruction{Position: uint32(i)}
+		si.AddWitnessKeys(f.cfg.XPubs, nil, f.cfg.Quorum)
+		tpl.SigningInstructions = append(tpl.SigningInstructions, si)
+	}
+	return tpl
+}
+
+// Sign adds signatures to the proposal from every federation key that
+// signFn holds.
+func (f *Federation) Sign(ctx context.Context, id, auth string, signFn txbuilder.SignFunc) (*Proposal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.FindProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := txbuilder.Sign(ctx, p.Template, f.cfg.XPubs, auth, signFn); err != nil {
+		return nil, err
+	}
+	return p, f.saveSigned(p)
+}
+
+// AddSignatures merges into the proposal the signatures in another
+// functionary's copy of it.
+func (f *Federation) AddSignatures(ctx context.Context, id string, tpl *txbuilder.Template) (*Proposal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.FindProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := txbuilder.MergeSignatures(p.Template, tpl); err != nil {
+		return nil, err
+	}
+	return p, f.saveSigned(p)
+}
+
+func (f *Federation) saveSigned(p *Proposal) error {
+	if p.Status == ProposalSigning && quorumSigned(p.Template) {
+		p.Status = ProposalReady
+	}
+	return f.put(calcProposalKey(p.ID), p)
+}
+
+func quorumSigned(tpl *txbuilder.Template) bool {
+	for _, si := range tpl.SigningInstructions {
+		for _, sw := range si.SignatureWitnesses {
+			var n int
+			for _, sig := range sw.Sigs {
+				if len(sig) > 0 {
+					n++
+				}
+			}
+			if n < sw.Quorum {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Submit sends a proposal signed by a quorum to the chain it belongs
+// to: mints to the sidechain, releases to the mainchain.
+func (f *Federation) Submit(ctx context.Context, id string) (*Proposal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.FindProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == ProposalSigning {
+		return nil, errors.WithDetailf(ErrProposalNotReady, "proposal %q", id)
+	}
+
+	submitter := f.mainSubmitter
+	if p.Type == ProposalMint {
+		submitter = f.sideSubmitter
+	}
+	if err := submitter.Submit(ctx, p.Template.Transaction); err != nil {
+		return nil, errors.Wrapf(err, "submitting proposal %q", id)
+	}
+	if p.Status == ProposalReady {
+		p.Status = ProposalSubmitted
+	}
+	return p, f.put(calcProposalKey(id), p)
+}
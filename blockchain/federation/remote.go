@@ -0,0 +1,110 @@
+package federation
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytom/blockchain/rpc"
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+const defaultPollInterval = 5 * time.Second
+
+// RemoteChain is a Chain reached through the API of another core,
+// usually the mainchain.
+type RemoteChain struct {
+	Client *rpc.Client
+
+	// PollInterval is how often WaitForBlock asks the remote core for
+	// its height. The default is five seconds.
+	PollInterval time.Duration
+}
+
+// Height returns the height of the remote chain.
+func (c *RemoteChain) Height(ctx context.Context) (uint64, error) {
+	var resp struct {
+		BlockHeight uint64 `json:"block_height"`
+	}
+	err := c.Client.Call(ctx, "/get-block-height", nil, &resp)
+	return resp.BlockHeight, errors.Wrap(err, "getting remote block height")
+}
+
+// BlockWaiter returns a channel that receives a value once the remote
+// chain reaches height. It polls until then; use WaitForBlock to be
+// able to stop it.
+func (c *RemoteChain) BlockWaiter(height uint64) <-chan struct{} {
+	return c.WaitForBlock(context.Background(), height)
+}
+
+// WaitForBlock returns a channel that receives a value once the remote
+// chain reaches height. It stops polling the remote core when ctx is
+// done.
+func (c *RemoteChain) WaitForBlock(ctx context.Context, height uint64) <-chan struct{} {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		for {
+			h, err := c.Height(ctx)
+			if err == nil && h >= height {
+				ch <- struct{}{}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+	return ch
+}
+
+// GetBlock returns the remote block at height.
+func (c *RemoteChain) GetBlock(height uint64) (*legacy.Block, error) {
+	req := struct {
+		BlockHeight uint64 `json:"block_height"`
+	}{height}
+	var resp struct {
+		Block *legacy.Block `json:"block"`
+	}
+	err := c.Client.Call(context.Background(), "/get-block", req, &resp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting remote block %d", height)
+	}
+	return resp.Block, nil
+}
+
+// Submit submits a fully signed transaction to the remote core.
+func (c *RemoteChain) Submit(ctx context.Context, tx *legacy.Tx) error {
+	req := struct {
+		Transactions []*txbuilder.Template `json:"transactions"`
+	}{[]*txbuilder.Template{{Transaction: tx}}}
+	var resp []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	err := c.Client.Call(ctx, "/submit-transaction", req, &resp)
+	if err != nil {
+		return errors.Wrap(err, "submitting to remote core")
+	}
+	if len(resp) != 1 || resp[0].ID == "" {
+		return errors.WithDetail(txbuilder.ErrRejected, "remote core rejected the transaction")
+	}
+	return nil
+}
+
+// LocalSubmitter submits transactions to a chain run by this core.
+type LocalSubmitter struct {
+	Chain *protocol.Chain
+}
+
+// Submit validates tx and adds it to the chain's pool.
+func (s LocalSubmitter) Submit(ctx context.Context, tx *legacy.Tx) error {
+	return txbuilder.FinalizeTx(ctx, s.Chain, tx)
+}
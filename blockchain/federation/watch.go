@@ -0,0 +1,439 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/bytom/blockchain/blockwatch"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// WatchMainchain indexes each mainchain block, starting after the
+// last block indexed in a previous run, recording peg-ins and
+// releases, proposing mints as peg-ins are confirmed and renewing
+// mints whose time window has passed. If the mainchain reorganizes,
+// what was indexed from orphaned blocks is rolled back. It returns when ctx is done.
+func (f *Federation) WatchMainchain(ctx context.Context) {
+	f.watch(ctx, "federation mainchain", f.mainchain, mainchainHeightKey, f.indexMainchainBlock, f.rollbackMainchain)
+}
+
+// WatchSidechain indexes each sidechain block, starting after the
+// last block indexed in a previous run, recording mints and peg-outs
+// and proposing releases. If the sidechain reorganizes, what was
+// indexed from orphaned blocks is rolled back. It returns when ctx is
+// done.
+func (f *Federation) WatchSidechain(ctx context.Context) {
+	f.watch(ctx, "federation sidechain", f.sidechain, sidechainHeightKey, f.indexSidechainBlock, f.rollbackSidechain)
+}
+
+func (f *Federation) watch(ctx context.Context, name string, c Chain, heightKey string, index func(context.Context, *legacy.Block) error, rollback func(context.Context, uint64) error) {
+	w := &blockwatch.Watcher{
+		Name:  name,
+		Chain: c,
+		DB:    f.db,
+		Key:   heightKey,
+		Index: func(ctx context.Context, b *legacy.Block) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return index(ctx, b)
+		},
+	}
+	if rollback != nil {
+		w.Rollback = func(ctx context.Context, height uint64) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return rollback(ctx, height)
+		}
+	}
+	w.Run(ctx)
+}
+
+func (f *Federation) indexedHeight(key string) uint64 {
+	b := f.db.Get([]byte(key))
+	if b == nil {
+		return 0
+	}
+	height, _ := strconv.ParseUint(string(b), 10, 64)
+	return height
+}
+
+// indexMainchainBlock records outputs paying the federation and
+// spends of them, then renews the mints that expired before b,
+// proposes a mint for every peg-in that b confirms and a release for
+// every peg-out still waiting for reserves.
+func (f *Federation) indexMainchainBlock(ctx context.Context, b *legacy.Block) error {
+	for _, tx := range b.Transactions {
+		var spendsReserves bool
+		for _, in := range tx.Inputs {
+			spentID, err := in.SpentOutputID()
+			if err != nil {
+				continue
+			}
+			p := new(PegIn)
+			ok, err := f.get(calcPegInKey(spentID), p)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			p.Spent = true
+			p.SpentHeight = b.Height
+			if err := f.put(calcPegInKey(spentID), p); err != nil {
+				return err
+			}
+			spendsReserves = true
+		}
+
+		// Only the federation can spend its reserves, so only its
+		// transactions can claim to be releases.
+		var release bc.Hash
+		isRelease := spendsReserves && refDataField(tx.ReferenceData, ReleaseKey, &release)
+		if isRelease {
+			if err := f.recordRelease(ctx, release, tx.ID, b.Height); err != nil {
+				return err
+			}
+		}
+
+		for i, out := range tx.Outputs {
+			if !bytes.Equal(out.ControlProgram, f.pegProgram) {
+				continue
+			}
+			if err := f.recordPegIn(ctx, b, tx, i, isRelease); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.renewMints(ctx, b.Time()); err != nil {
+		return err
+	}
+	pending, err := f.PegIns(ctx, PegInPending)
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		if p.BlockHeight+f.cfg.Confirmations > b.Height {
+			continue
+		}
+		if err := f.proposeMint(ctx, p, b.Time()); err != nil {
+			return err
+		}
+	}
+	return f.proposeReleases(ctx, b.Height)
+}
+
+func (f *Federation) recordPegIn(ctx context.Context, b *legacy.Block, tx *legacy.Tx, i int, isRelease bool) error {
+	out := tx.Outputs[i]
+	resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+	if !ok {
+		return nil
+	}
+	pegged, _ := f.PeggedAsset(*out.AssetId)
+	p := &PegIn{
+		OutputID:      *tx.OutputID(i),
+		TxID:          tx.ID,
+		BlockHeight:   b.Height,
+		SourceID:      *resOut.Source.Ref,
+		SourcePos:     resOut.Source.Position,
+		AssetID:       *out.AssetId,
+		Amount:        out.Amount,
+		RefDataHash:   *resOut.Data,
+		PeggedAssetID: pegged,
+		Status:        PegInUnclaimed,
+	}
+
+	var claim Claim
+	switch {
+	case isRelease:
+		p.Status = PegInChange
+	case refDataField(out.ReferenceData, PegInKey, &claim) && len(claim.ControlProgram) > 0 && !vmutil.IsUnspendable(claim.ControlProgram):
+		p.Status = PegInPending
+		p.SidechainProgram = claim.ControlProgram
+	}
+
+	// Remember which mainchain asset the pegged asset stands for,
+	// so that peg-outs of it can be recognized.
+	assetID, _ := out.AssetId.MarshalText()
+	f.db.Set(calcPeggedAssetKey(pegged), assetID)
+	return f.put(calcPegInKey(p.OutputID), p)
+}
+
+func (f *Federation) recordRelease(ctx context.Context, pegOutID, txID bc.Hash, height uint64) error {
+	p := new(PegOut)
+	ok, err := f.get(calcPegOutKey(pegOutID), p)
+	if err != nil || !ok {
+		return err
+	}
+	p.Status = PegOutReleased
+	p.ReleaseTxID = &txID
+	p.ReleaseHeight = height
+	if err := f.put(calcPegOutKey(pegOutID), p); err != nil {
+		return err
+	}
+	return f.confirmProposal(releaseProposalID(pegOutID))
+}
+
+// rollbackMainchain undoes what was indexed from mainchain blocks
+// after height, when the mainchain forks after it. Peg-ins made after
+// the fork are forgotten, with the mint and release proposals built
+// on them; they are indexed again if the new branch includes them.
+// Spends and releases after the fork are undone. A peg-in already
+// minted on the sidechain cannot be undone, and is only logged.
+func (f *Federation) rollbackMainchain(ctx context.Context, height uint64) error {
+	pegOuts, err := f.PegOuts(ctx, PegOutReleased)
+	if err != nil {
+		return err
+	}
+	for _, p := range pegOuts {
+		if p.ReleaseHeight <= height {
+			continue
+		}
+		p.Status = PegOutProposed
+		p.ReleaseTxID = nil
+		p.ReleaseHeight = 0
+		if err := f.put(calcPegOutKey(p.OutputID), p); err != nil {
+			return err
+		}
+		if err := f.setProposalStatus(releaseProposalID(p.OutputID), ProposalSubmitted); err != nil {
+			return err
+		}
+	}
+
+	pegIns, err := f.PegIns(ctx, "")
+	if err != nil {
+		return err
+	}
+	var dropReleases []string
+	for _, p := range pegIns {
+		if p.BlockHeight <= height {
+			if p.Spent && p.SpentHeight > height {
+				p.Spent, p.SpentHeight = false, 0
+				if err := f.put(calcPegInKey(p.OutputID), p); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if p.Status == PegInMinted {
+			log.Printf(ctx, "federation: peg-in %x was minted but its mainchain block %d is orphaned", p.OutputID.Bytes(), p.BlockHeight)
+			continue
+		}
+		if p.ReservedBy != "" {
+			dropReleases = append(dropReleases, p.ReservedBy)
+		}
+		f.db.Delete(calcProposalKey(mintProposalID(p.OutputID)))
+		f.db.Delete(calcPegInKey(p.OutputID))
+	}
+	for _, id := range dropReleases {
+		if err := f.dropRelease(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropRelease deletes a release proposal spending an orphaned peg-in,
+// freeing the other reserves it spends, so that the peg-out is
+// proposed again.
+func (f *Federation) dropRelease(ctx context.Context, id string) error {
+	proposal := new(Proposal)
+	ok, err := f.get(calcProposalKey(id), proposal)
+	if err != nil || !ok {
+		return err
+	}
+	pegIns, err := f.PegIns(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range pegIns {
+		if p.ReservedBy != id {
+			continue
+		}
+		p.ReservedBy = ""
+		if err := f.put(calcPegInKey(p.OutputID), p); err != nil {
+			return err
+		}
+	}
+	p := new(PegOut)
+	if ok, err := f.get(calcPegOutKey(proposal.PegID), p); err != nil {
+		return err
+	} else if ok {
+		p.Status = PegOutPending
+		if err := f.put(calcPegOutKey(p.OutputID), p); err != nil {
+			return err
+		}
+	}
+	f.db.Delete(calcProposalKey(id))
+	return nil
+}
+
+// indexSidechainBlock records issuances and retirements of pegged
+// assets, marking mints and proposing a release for each new peg-out.
+func (f *Federation) indexSidechainBlock(ctx context.Context, b *legacy.Block) error {
+	var newPegOuts bool
+	for _, tx := range b.Transactions {
+		var mints bool
+		for _, in := range tx.Inputs {
+			ii, ok := in.TypedInput.(*legacy.IssuanceInput)
+			if !ok || !bytes.Equal(ii.IssuanceProgram, f.pegProgram) {
+				continue
+			}
+			if err := f.addSupply(ii.AssetID(), ii.Amount, 0, b.Height); err != nil {
+				return err
+			}
+			mints = true
+		}
+
+		// Only the federation can issue pegged assets, so only its
+		// transactions can claim to be mints.
+		var pegInID bc.Hash
+		if mints && refDataField(tx.ReferenceData, MintKey, &pegInID) {
+			if err := f.recordMint(ctx, pegInID, tx.ID, b.Height); err != nil {
+				return err
+			}
+		}
+
+		for i, out := range tx.Outputs {
+			if !vmutil.IsUnspendable(out.ControlProgram) {
+				continue
+			}
+			assetID, ok := f.mainchainAsset(*out.AssetId)
+			if !ok {
+				continue
+			}
+			if err := f.addSupply(*out.AssetId, 0, out.Amount, b.Height); err != nil {
+				return err
+			}
+			var claim Claim
+			if !refDataField(out.ReferenceData, PegOutKey, &claim) || len(claim.ControlProgram) == 0 {
+				continue
+			}
+			p := &PegOut{
+				OutputID:         *tx.OutputID(i),
+				TxID:             tx.ID,
+				BlockHeight:      b.Height,
+				PeggedAssetID:    *out.AssetId,
+				AssetID:          assetID,
+				Amount:           out.Amount,
+				MainchainProgram: claim.ControlProgram,
+				Status:           PegOutPending,
+			}
+			if err := f.put(calcPegOutKey(p.OutputID), p); err != nil {
+				return err
+			}
+			newPegOuts = true
+		}
+	}
+	if !newPegOuts {
+		return nil
+	}
+	return f.proposeReleases(ctx, f.indexedHeight(mainchainHeightKey))
+}
+
+func (f *Federation) recordMint(ctx context.Context, pegInID, txID bc.Hash, height uint64) error {
+	p := new(PegIn)
+	ok, err := f.get(calcPegInKey(pegInID), p)
+	if err != nil || !ok {
+		return err
+	}
+	p.Status = PegInMinted
+	p.MintTxID = &txID
+	p.MintHeight = height
+	if err := f.put(calcPegInKey(pegInID), p); err != nil {
+		return err
+	}
+	return f.confirmProposal(mintProposalID(pegInID))
+}
+
+// rollbackSidechain undoes what was indexed from sidechain blocks
+// after height, when the sidechain forks after it. Mints after the
+// fork are undone, and submitted again if their time window allows.
+// Peg-outs after the fork are forgotten, with the releases proposed
+// for them. A peg-out whose release has already been submitted to the
+// mainchain cannot be undone, and is only logged.
+func (f *Federation) rollbackSidechain(ctx context.Context, height uint64) error {
+	if err := f.rollbackSupply(ctx, height); err != nil {
+		return err
+	}
+
+	pegIns, err := f.PegIns(ctx, PegInMinted)
+	if err != nil {
+		return err
+	}
+	for _, p := range pegIns {
+		if p.MintHeight <= height {
+			continue
+		}
+		p.Status = PegInConfirmed
+		p.MintTxID = nil
+		p.MintHeight = 0
+		if err := f.put(calcPegInKey(p.OutputID), p); err != nil {
+			return err
+		}
+		if err := f.setProposalStatus(mintProposalID(p.OutputID), ProposalSubmitted); err != nil {
+			return err
+		}
+	}
+
+	pegOuts, err := f.PegOuts(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range pegOuts {
+		if p.BlockHeight <= height {
+			continue
+		}
+		id := releaseProposalID(p.OutputID)
+		release := new(Proposal)
+		if _, err := f.get(calcProposalKey(id), release); err != nil {
+			return err
+		}
+		if p.Status == PegOutReleased || release.Status == ProposalSubmitted {
+			log.Printf(ctx, "federation: peg-out %x was released but its sidechain block %d is orphaned", p.OutputID.Bytes(), p.BlockHeight)
+			continue
+		}
+		if err := f.dropRelease(ctx, id); err != nil {
+			return err
+		}
+		f.db.Delete(calcPegOutKey(p.OutputID))
+	}
+	return nil
+}
+
+func (f *Federation) confirmProposal(id string) error {
+	return f.setProposalStatus(id, ProposalConfirmed)
+}
+
+func (f *Federation) setProposalStatus(id, status string) error {
+	p := new(Proposal)
+	ok, err := f.get(calcProposalKey(id), p)
+	if err != nil || !ok {
+		return err
+	}
+	p.Status = status
+	return f.put(calcProposalKey(id), p)
+}
+
+// refDataField decodes the value stored under key in the reference
+// data refData into v. It reports whether such a value was present
+// and valid.
+func refDataField(refData []byte, key string, v interface{}) bool {
+	if len(refData) == 0 {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(refData, &fields); err != nil {
+		return false
+	}
+	raw, ok := fields[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
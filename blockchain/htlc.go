@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/blockchain/account"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/net/http/httpjson"
+)
+
+func init() {
+	errorFormatter.Errors[account.ErrHTLCNotFound] = httperror.Info{404, "BTM250", "HTLC not found"}
+	errorFormatter.Errors[account.ErrHTLCRole] = httperror.Info{400, "BTM251", "Account is not a party to this HTLC branch"}
+	errorFormatter.Errors[account.ErrHTLCSpent] = httperror.Info{400, "BTM252", "HTLC has already been spent"}
+	errorFormatter.Errors[account.ErrBadPreimage] = httperror.Info{400, "BTM253", "Preimage does not match the HTLC hash"}
+}
+
+// POST /create-htlc-key
+func (a *BlockchainReactor) createHTLCKey(ctx context.Context, in struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+}) (*account.HTLCKey, error) {
+	accountID := in.AccountID
+	if accountID == "" {
+		acc, err := a.accounts.FindByAlias(ctx, in.AccountAlias)
+		if err != nil {
+			return nil, err
+		}
+		accountID = acc.ID
+	}
+	return a.accounts.CreateHTLCKey(ctx, accountID)
+}
+
+// POST /list-htlcs
+func (a *BlockchainReactor) listHTLCs(ctx context.Context, in struct {
+	AccountID string `json:"account_id"`
+}) (interface{}, error) {
+	htlcs, err := a.accounts.HTLCs(ctx, in.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	return httpjson.Array(htlcs), nil
+}
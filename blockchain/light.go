@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/blockchain/light"
+	"github.com/bytom/blockchain/txbuilder"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+func init() {
+	errorFormatter.Errors[light.ErrBadHeader] = httperror.Info{400, "BTM280", "Invalid block header"}
+	errorFormatter.Errors[light.ErrBadProof] = httperror.Info{400, "BTM281", "Invalid transaction proof"}
+}
+
+// SetLight runs this core as a light client: transactions are
+// submitted through c and confirmed by the blocks it syncs, and new
+// control programs are added to its watchlist.
+func (a *BlockchainReactor) SetLight(c *light.Client) {
+	a.light = c
+}
+
+// watch adds control programs created by this core to the light
+// client's watchlist.
+func (a *BlockchainReactor) watch(progs ...[]byte) {
+	if a.light != nil {
+		a.light.Watch(progs...)
+	}
+}
+
+// height returns the height of the local chain, or of the light
+// client's synced headers.
+func (a *BlockchainReactor) height() uint64 {
+	if a.light != nil {
+		return a.light.Height()
+	}
+	return a.chain.Height()
+}
+
+func (a *BlockchainReactor) blockWaiter(height uint64) <-chan struct{} {
+	if a.light != nil {
+		return a.light.BlockWaiter(height)
+	}
+	return a.chain.BlockWaiter(height)
+}
+
+// syncedBlock returns the block at height. A light client has only the
+// block's watched transactions.
+func (a *BlockchainReactor) syncedBlock(height uint64) (*legacy.Block, error) {
+	if a.light != nil {
+		return a.light.GetBlock(height)
+	}
+	return a.chain.GetBlock(height)
+}
+
+// finalizeTx adds tx to the local pool, or relays it to the light
+// client's full node.
+func (a *BlockchainReactor) finalizeTx(ctx context.Context, tx *legacy.Tx) error {
+	if a.light != nil {
+		return a.light.Submit(ctx, tx)
+	}
+	return txbuilder.FinalizeTx(ctx, a.chain, tx)
+}
+
+type headerRange struct {
+	StartHeight uint64 `json:"start_height"`
+	Count       uint64 `json:"count"`
+}
+
+// blocks returns the blocks in r that are on the chain, at most
+// light.MaxHeaders of them.
+func (a *BlockchainReactor) blocks(r headerRange) ([]*legacy.Block, error) {
+	if r.Count > light.MaxHeaders {
+		r.Count = light.MaxHeaders
+	}
+	var blocks []*legacy.Block
+	for h := r.StartHeight; h < r.StartHeight+r.Count && h <= a.chain.Height(); h++ {
+		b, err := a.chain.GetBlock(h)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// POST /get-block-headers
+func (a *BlockchainReactor) getBlockHeaders(ctx context.Context, in headerRange) (map[string]interface{}, error) {
+	blocks, err := a.blocks(in)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*legacy.BlockHeader, len(blocks))
+	for i, b := range blocks {
+		headers[i] = &b.BlockHeader
+	}
+	return map[string]interface{}{"headers": headers}, nil
+}
+
+// POST /get-block-filters
+func (a *BlockchainReactor) getBlockFilters(ctx context.Context, in headerRange) (map[string]interface{}, error) {
+	blocks, err := a.blocks(in)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]chainjson.HexBytes, len(blocks))
+	for i, b := range blocks {
+		filters[i] = light.BuildFilter(b)
+	}
+	return map[string]interface{}{"filters": filters}, nil
+}
+
+// POST /get-filtered-block
+func (a *BlockchainReactor) getFilteredBlock(ctx context.Context, in struct {
+	BlockHeight uint64               `json:"block_height"`
+	Items       []chainjson.HexBytes `json:"items"`
+}) (*light.FilteredBlock, error) {
+	b, err := a.chain.GetBlock(in.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]byte, len(in.Items))
+	for i, item := range in.Items {
+		items[i] = item
+	}
+	return light.FilterBlock(b, items)
+}
@@ -0,0 +1,204 @@
+package light
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Filters are Golomb-coded sets with the parameters of BIP 158: a
+// false positive rate of about 1 in 784931 per item.
+const (
+	filterP = 19
+	filterM = 784931
+)
+
+var errFilterEnd = errors.New("unexpected end of filter")
+
+// BuildFilter returns the compact filter of b, which matches the
+// control programs of the outputs b creates and the IDs of the
+// outputs it spends.
+func BuildFilter(b *legacy.Block) []byte {
+	return buildFilter(filterKey(b.Hash()), blockItems(b))
+}
+
+// MatchFilter reports whether the filter of the block with the given
+// hash may contain any of items. It may return false positives but
+// never false negatives.
+func MatchFilter(blockHash bc.Hash, filter []byte, items [][]byte) (bool, error) {
+	n, read := binary.Uvarint(filter)
+	if read <= 0 {
+		return false, errFilterEnd
+	}
+	if n == 0 || len(items) == 0 {
+		return false, nil
+	}
+
+	f := n * filterM
+	key := filterKey(blockHash)
+	targets := make(uint64s, len(items))
+	for i, item := range items {
+		targets[i] = hashItem(key, item, f)
+	}
+	sort.Sort(targets)
+
+	r := &bitReader{buf: filter[read:]}
+	var value uint64
+	for i := uint64(0); i < n; i++ {
+		delta, err := r.readGolomb()
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for len(targets) > 0 && targets[0] < value {
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			return false, nil
+		}
+		if targets[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// blockItems returns the items the filter of b is built from.
+func blockItems(b *legacy.Block) [][]byte {
+	var items [][]byte
+	for _, tx := range b.Transactions {
+		items = append(items, txItems(tx)...)
+	}
+	return items
+}
+
+func txItems(tx *legacy.Tx) [][]byte {
+	var items [][]byte
+	for _, in := range tx.Inputs {
+		if spentID, err := in.SpentOutputID(); err == nil {
+			items = append(items, spentID.Bytes())
+		}
+	}
+	for _, out := range tx.Outputs {
+		items = append(items, out.ControlProgram)
+	}
+	return items
+}
+
+func buildFilter(key []byte, items [][]byte) []byte {
+	unique := make(map[string]bool)
+	for _, item := range items {
+		unique[string(item)] = true
+	}
+
+	n := uint64(len(unique))
+	f := n * filterM
+	values := make(uint64s, 0, len(unique))
+	for item := range unique {
+		values = append(values, hashItem(key, []byte(item), f))
+	}
+	sort.Sort(values)
+
+	var buf [binary.MaxVarintLen64]byte
+	w := &bitWriter{buf: append([]byte(nil), buf[:binary.PutUvarint(buf[:], n)]...)}
+	var last uint64
+	for _, v := range values {
+		w.writeGolomb(v - last)
+		last = v
+	}
+	return w.buf
+}
+
+// filterKey keys the hash of filter items to the block so that
+// collisions in one block don't repeat in others.
+func filterKey(blockHash bc.Hash) []byte {
+	return blockHash.Bytes()[:16]
+}
+
+// hashItem maps item uniformly onto [0, f).
+func hashItem(key, item []byte, f uint64) uint64 {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	h.Write(key)
+	h.Write(item)
+	var sum [8]byte
+	h.Read(sum[:])
+	return binary.BigEndian.Uint64(sum[:]) % f
+}
+
+type uint64s []uint64
+
+func (a uint64s) Len() int           { return len(a) }
+func (a uint64s) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a uint64s) Less(i, j int) bool { return a[i] < a[j] }
+
+type bitWriter struct {
+	buf  []byte
+	used uint // bits used in the last byte of buf, 8 when it is full
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.used == 0 || w.used == 8 {
+		w.buf = append(w.buf, 0)
+		w.used = 0
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 0x80 >> w.used
+	}
+	w.used++
+}
+
+// writeGolomb writes v in Golomb-Rice coding: the quotient in unary,
+// then the low filterP bits.
+func (w *bitWriter) writeGolomb(v uint64) {
+	for q := v >> filterP; q > 0; q-- {
+		w.writeBit(true)
+	}
+	w.writeBit(false)
+	for i := uint(filterP); i > 0; i-- {
+		w.writeBit(v>>(i-1)&1 == 1)
+	}
+}
+
+type bitReader struct {
+	buf []byte
+	pos uint // in bits
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.buf))*8 {
+		return false, errFilterEnd
+	}
+	bit := r.buf[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readGolomb() (uint64, error) {
+	var v uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		v += 1 << filterP
+	}
+	for i := uint(filterP); i > 0; i-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			v |= 1 << (i - 1)
+		}
+	}
+	return v, nil
+}
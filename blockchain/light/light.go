@@ -0,0 +1,562 @@
+// Package light implements a light client that follows the chain
+// without downloading full blocks or keeping the UTXO set.
+//
+// A full node serves block headers, a compact filter for each block
+// and, on request, the transactions of a block that touch a given set
+// of control programs and outputs, with the IDs of all the block's
+// transactions. The client checks that each header extends the
+// previous one at the required difficulty, tests the block's filter
+// against the programs and outputs it watches, and fetches the
+// matching transactions only when the filter matches. It checks the
+// transaction IDs against the header's merkle root, and that each
+// transaction fetched is among them.
+//
+// When the full node's chain forks from the headers synced, the
+// client checks the full node's branch from the fork, and switches to
+// it only if it has more work than the blocks synced after the fork.
+//
+// The client presents what it has synced as a chain of filtered
+// blocks, each holding a header and only the watched transactions, so
+// watchers written for full blocks work unchanged. It cannot tell if
+// the full node leaves a transaction out of a filter; it can only
+// detect transactions that were not included in a block.
+package light
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/txbuilder"
+	"github.com/bytom/consensus"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+const (
+	blockPrefix = "light_block:"
+	watchPrefix = "light_watch:"
+	heightKey   = "light_height"
+
+	// MaxHeaders is the most headers or filters a full node returns
+	// in one request.
+	MaxHeaders = 500
+
+	defaultPollInterval = 5 * time.Second
+)
+
+var (
+	ErrBadHeader = errors.New("invalid block header")
+	ErrBadProof  = errors.New("invalid transaction proof")
+)
+
+// A Peer is a full node the client syncs from. *rpc.Client
+// implements it.
+type Peer interface {
+	Call(ctx context.Context, path string, request, response interface{}) error
+}
+
+// A FilteredBlock holds the transactions of a block that touch some
+// set of control programs and outputs. TxIDs, the IDs of all the
+// block's transactions in order, prove that they are in the block.
+type FilteredBlock struct {
+	Height       uint64       `json:"block_height"`
+	TxIDs        []bc.Hash    `json:"transaction_ids"`
+	Transactions []*legacy.Tx `json:"transactions"`
+}
+
+// FilterBlock returns the transactions of b that spend an output
+// whose ID is in items or pay to a control program in items.
+func FilterBlock(b *legacy.Block, items [][]byte) (*FilteredBlock, error) {
+	want := make(map[string]bool)
+	for _, item := range items {
+		want[string(item)] = true
+	}
+
+	fb := &FilteredBlock{Height: b.Height}
+	for _, tx := range b.Transactions {
+		fb.TxIDs = append(fb.TxIDs, tx.ID)
+		matched := false
+		for _, item := range txItems(tx) {
+			matched = matched || want[string(item)]
+		}
+		if matched {
+			fb.Transactions = append(fb.Transactions, tx)
+		}
+	}
+	return fb, nil
+}
+
+// Client is a light client syncing from a single full node.
+type Client struct {
+	db   dbm.DB
+	peer Peer
+
+	// PollInterval is how often Run asks the full node for new
+	// headers. The default is five seconds.
+	PollInterval time.Duration
+
+	// Regtest makes the client expect blocks at the difficulty of a
+	// regression test network, consensus.RegtestBits.
+	Regtest bool
+
+	watchMu sync.Mutex
+	watched map[string]bool
+
+	cond   sync.Cond // protects height and tip
+	height uint64
+	tip    *legacy.BlockHeader
+}
+
+// NewClient returns a client that stores what it syncs in db, trusting
+// the initial block header if db is empty.
+func NewClient(db dbm.DB, peer Peer, initial *legacy.BlockHeader) (*Client, error) {
+	c := &Client{
+		db:      db,
+		peer:    peer,
+		watched: make(map[string]bool),
+		cond:    sync.Cond{L: new(sync.Mutex)},
+	}
+
+	iter := db.Iterator()
+	for iter.Next() {
+		key := string(iter.Key())
+		if !strings.HasPrefix(key, watchPrefix) {
+			continue
+		}
+		item, err := hex.DecodeString(key[len(watchPrefix):])
+		if err != nil {
+			return nil, errors.Wrap(err, "reading watchlist")
+		}
+		c.watched[string(item)] = true
+	}
+
+	if b := db.Get([]byte(heightKey)); b != nil {
+		height, err := strconv.ParseUint(string(b), 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading light client height")
+		}
+		tip, err := c.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		c.height, c.tip = height, &tip.BlockHeader
+		return c, nil
+	}
+
+	if err := c.save(&legacy.Block{BlockHeader: *initial}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func calcBlockKey(height uint64) []byte {
+	return []byte(fmt.Sprintf("%s%016x", blockPrefix, height))
+}
+
+// Watch adds control programs and output IDs to the client's
+// watchlist. Transactions touching them are synced from the next
+// block on.
+func (c *Client) Watch(items ...[]byte) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	for _, item := range items {
+		if c.watched[string(item)] {
+			continue
+		}
+		c.watched[string(item)] = true
+		c.db.Set([]byte(watchPrefix+hex.EncodeToString(item)), []byte{1})
+	}
+}
+
+func (c *Client) watchlist() [][]byte {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	items := make([][]byte, 0, len(c.watched))
+	for item := range c.watched {
+		items = append(items, []byte(item))
+	}
+	return items
+}
+
+// Height returns the height of the last block synced.
+func (c *Client) Height() uint64 {
+	c.cond.L.Lock()
+	defer c.cond.L.Unlock()
+	return c.height
+}
+
+// BlockWaiter returns a channel that receives a value once the block
+// at height is synced.
+func (c *Client) BlockWaiter(height uint64) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		c.cond.L.Lock()
+		defer c.cond.L.Unlock()
+		for c.height < height {
+			c.cond.Wait()
+		}
+		ch <- struct{}{}
+	}()
+	return ch
+}
+
+// GetBlock returns the synced block at height. It has the block's
+// full header but only the transactions touching the watchlist.
+func (c *Client) GetBlock(height uint64) (*legacy.Block, error) {
+	data := c.db.Get(calcBlockKey(height))
+	if data == nil {
+		return nil, errors.WithDetailf(ErrBadHeader, "block %d is not synced", height)
+	}
+	b := new(legacy.Block)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, errors.Wrapf(err, "reading block %d", height)
+	}
+	return b, nil
+}
+
+func (c *Client) save(b *legacy.Block) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	c.db.Set(calcBlockKey(b.Height), data)
+	c.db.SetSync([]byte(heightKey), []byte(strconv.FormatUint(b.Height, 10)))
+
+	c.cond.L.Lock()
+	defer c.cond.L.Unlock()
+	c.height, c.tip = b.Height, &b.BlockHeader
+	c.cond.Broadcast()
+	return nil
+}
+
+// Submit sends a fully signed transaction to the full node, watching
+// the outputs it spends so the block that confirms it is synced.
+func (c *Client) Submit(ctx context.Context, tx *legacy.Tx) error {
+	for _, in := range tx.Inputs {
+		if spentID, err := in.SpentOutputID(); err == nil {
+			c.Watch(spentID.Bytes())
+		}
+	}
+
+	req := struct {
+		Transactions []*txbuilder.Template `json:"transactions"`
+	}{[]*txbuilder.Template{{Transaction: tx}}}
+	var resp []struct {
+		ID string `json:"id"`
+	}
+	if err := c.peer.Call(ctx, "/submit-transaction", req, &resp); err != nil {
+		return errors.Wrap(err, "submitting to full node")
+	}
+	if len(resp) != 1 || resp[0].ID == "" {
+		return errors.WithDetail(txbuilder.ErrRejected, "full node rejected the transaction")
+	}
+	return nil
+}
+
+// Run syncs from the full node until ctx is done.
+func (c *Client) Run(ctx context.Context) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	for {
+		if err := c.Sync(ctx); err != nil {
+			log.Error(ctx, err, "at", "syncing light client", "height", c.Height())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Sync syncs the headers the full node has past the client's height,
+// with the watched transactions of each block.
+func (c *Client) Sync(ctx context.Context) error {
+	for {
+		c.cond.L.Lock()
+		tip := c.tip
+		c.cond.L.Unlock()
+
+		headers, err := c.getHeaders(ctx, tip.Height+1, MaxHeaders)
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+		if h := headers[0]; h.Height == tip.Height+1 && h.PreviousBlockHash != tip.Hash() {
+			if err := c.reorganize(ctx, tip); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.syncHeaders(ctx, tip, headers); err != nil {
+			return err
+		}
+	}
+}
+
+// syncHeaders checks that headers extend tip, at most MaxHeaders of
+// them, and saves the filtered block of each.
+func (c *Client) syncHeaders(ctx context.Context, tip *legacy.BlockHeader, headers []*legacy.BlockHeader) error {
+	req := headerRange{headers[0].Height, uint64(len(headers))}
+	var filters struct {
+		Filters []chainjson.HexBytes `json:"filters"`
+	}
+	if err := c.peer.Call(ctx, "/get-block-filters", req, &filters); err != nil {
+		return errors.Wrap(err, "getting block filters")
+	}
+	if len(filters.Filters) != len(headers) {
+		return errors.Wrapf(ErrBadHeader, "got %d filters for %d headers", len(filters.Filters), len(headers))
+	}
+
+	for i, h := range headers {
+		if err := c.checkHeader(h, tip, nil); err != nil {
+			return err
+		}
+		b, err := c.syncBlock(ctx, h, filters.Filters[i])
+		if err != nil {
+			return err
+		}
+		if err := c.save(b); err != nil {
+			return err
+		}
+		tip = h
+	}
+	return nil
+}
+
+type headerRange struct {
+	StartHeight uint64 `json:"start_height"`
+	Count       uint64 `json:"count"`
+}
+
+// getHeaders gets at most count headers from the full node, starting
+// at height start.
+func (c *Client) getHeaders(ctx context.Context, start, count uint64) ([]*legacy.BlockHeader, error) {
+	var resp struct {
+		Headers []*legacy.BlockHeader `json:"headers"`
+	}
+	if err := c.peer.Call(ctx, "/get-block-headers", headerRange{start, count}, &resp); err != nil {
+		return nil, errors.Wrap(err, "getting block headers")
+	}
+	return resp.Headers, nil
+}
+
+// reorganize finds where the full node's chain forks from the headers
+// synced up to tip, and fetches the full node's branch from the fork.
+// If every header of the branch is valid and the branch has more work
+// than the blocks synced after the fork, it replaces them.
+func (c *Client) reorganize(ctx context.Context, tip *legacy.BlockHeader) error {
+	start := uint64(0)
+	if tip.Height >= MaxHeaders {
+		start = tip.Height - MaxHeaders + 1
+	}
+	headers, err := c.getHeaders(ctx, start, tip.Height-start+1)
+	if err != nil {
+		return err
+	}
+	fork := -1
+	for i := len(headers) - 1; i >= 0 && fork < 0; i-- {
+		b, err := c.GetBlock(headers[i].Height)
+		if err != nil {
+			// Blocks before the initial header are not synced.
+			break
+		}
+		if b.Hash() == headers[i].Hash() {
+			fork = i
+		}
+	}
+	if fork < 0 {
+		return errors.WithDetailf(ErrBadHeader, "full node's chain forks before the blocks synced after %d", start)
+	}
+	forkHeader := headers[fork]
+	if forkHeader.Height == tip.Height {
+		return errors.WithDetailf(ErrBadHeader, "block %d does not extend the synced chain", tip.Height+1)
+	}
+
+	syncedWork := new(big.Int)
+	for h := forkHeader.Height + 1; h <= tip.Height; h++ {
+		b, err := c.GetBlock(h)
+		if err != nil {
+			return err
+		}
+		syncedWork.Add(syncedWork, consensus.CalcWork(b.Bits))
+	}
+
+	// Fetch and check the branch until it has more work.
+	var branch []*legacy.BlockHeader
+	branchWork := new(big.Int)
+	prev := forkHeader
+	for branchWork.Cmp(syncedWork) <= 0 {
+		headers, err := c.getHeaders(ctx, prev.Height+1, MaxHeaders)
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			return errors.WithDetailf(ErrBadHeader, "full node's branch from block %d has no more work than the blocks synced", forkHeader.Height+1)
+		}
+		for _, h := range headers {
+			if err := c.checkHeader(h, prev, branch); err != nil {
+				return err
+			}
+			branch = append(branch, h)
+			branchWork.Add(branchWork, consensus.CalcWork(h.Bits))
+			prev = h
+		}
+	}
+
+	for h := forkHeader.Height + 1; h <= tip.Height; h++ {
+		c.db.Delete(calcBlockKey(h))
+	}
+	c.db.SetSync([]byte(heightKey), []byte(strconv.FormatUint(forkHeader.Height, 10)))
+	c.cond.L.Lock()
+	c.height, c.tip = forkHeader.Height, forkHeader
+	c.cond.L.Unlock()
+	log.Printf(ctx, "light client: chain forked, rolled back from block %d to %d", tip.Height, forkHeader.Height)
+
+	// Sync the branch checked, not whatever the full node serves
+	// next, so that the client never holds less work than before.
+	for prev = forkHeader; len(branch) > 0; {
+		n := len(branch)
+		if n > MaxHeaders {
+			n = MaxHeaders
+		}
+		if err := c.syncHeaders(ctx, prev, branch[:n]); err != nil {
+			return err
+		}
+		prev, branch = branch[n-1], branch[n:]
+	}
+	return nil
+}
+
+// checkHeader checks that h extends prev with valid proof of work at
+// the required difficulty. If h is on a branch not yet synced, branch
+// holds the headers of the branch before it.
+func (c *Client) checkHeader(h, prev *legacy.BlockHeader, branch []*legacy.BlockHeader) error {
+	if h.Height != prev.Height+1 {
+		return errors.WithDetailf(ErrBadHeader, "height %d follows %d", h.Height, prev.Height)
+	}
+	if h.PreviousBlockHash != prev.Hash() {
+		return errors.WithDetailf(ErrBadHeader, "block %d does not extend the synced chain", h.Height)
+	}
+	if h.TimestampMS < prev.TimestampMS {
+		return errors.WithDetailf(ErrBadHeader, "block %d is older than its parent", h.Height)
+	}
+	bits, err := c.requiredBits(prev, branch)
+	if err != nil {
+		return err
+	}
+	if h.Bits != bits {
+		return errors.WithDetailf(ErrBadHeader, "block %d has difficulty %d, want %d", h.Height, h.Bits, bits)
+	}
+	hash := h.Hash()
+	if !consensus.CheckProofOfWork(&hash, h.Bits) {
+		return errors.WithDetailf(ErrBadHeader, "block %d has insufficient proof of work", h.Height)
+	}
+	return nil
+}
+
+// requiredBits returns the difficulty of the block after prev. At a
+// retarget, it depends on the first block of the period ending with
+// prev, which must be synced or in branch.
+func (c *Client) requiredBits(prev *legacy.BlockHeader, branch []*legacy.BlockHeader) (uint64, error) {
+	if c.Regtest {
+		return consensus.RegtestBits, nil
+	}
+	var first *legacy.BlockHeader
+	if (prev.Height+1)%consensus.BlocksPerRetarget == 0 {
+		height := prev.Height + 1 - consensus.BlocksPerRetarget
+		if len(branch) > 0 && height >= branch[0].Height {
+			first = branch[height-branch[0].Height]
+		} else {
+			b, err := c.GetBlock(height)
+			if err != nil {
+				return 0, errors.Wrapf(err, "checking difficulty of block %d", prev.Height+1)
+			}
+			first = &b.BlockHeader
+		}
+	}
+	return consensus.CalcNextRequiredDifficulty(prev, first), nil
+}
+
+// syncBlock returns the filtered block for h, fetching the watched
+// transactions if the block's filter matches the watchlist.
+func (c *Client) syncBlock(ctx context.Context, h *legacy.BlockHeader, filter []byte) (*legacy.Block, error) {
+	b := &legacy.Block{BlockHeader: *h}
+	items := c.watchlist()
+	matched, err := MatchFilter(h.Hash(), filter, items)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading filter of block %d", h.Height)
+	}
+	if !matched {
+		return b, nil
+	}
+
+	req := struct {
+		BlockHeight uint64               `json:"block_height"`
+		Items       []chainjson.HexBytes `json:"items"`
+	}{BlockHeight: h.Height}
+	for _, item := range items {
+		req.Items = append(req.Items, item)
+	}
+	fb := new(FilteredBlock)
+	if err := c.peer.Call(ctx, "/get-filtered-block", req, fb); err != nil {
+		return nil, errors.Wrapf(err, "getting transactions of block %d", h.Height)
+	}
+	if fb.Height != h.Height {
+		return nil, errors.WithDetailf(ErrBadProof, "got transactions of block %d for block %d", fb.Height, h.Height)
+	}
+
+	txs := make([]*bc.Tx, len(fb.TxIDs))
+	inBlock := make(map[bc.Hash]bool)
+	for i, id := range fb.TxIDs {
+		txs[i] = &bc.Tx{ID: id}
+		inBlock[id] = true
+	}
+	root, err := bc.MerkleRoot(txs)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if root != h.TransactionsMerkleRoot {
+		return nil, errors.WithDetailf(ErrBadProof, "transaction IDs of block %d do not match its header", h.Height)
+	}
+	for _, tx := range fb.Transactions {
+		if tx == nil || !inBlock[tx.ID] {
+			return nil, errors.WithDetailf(ErrBadProof, "transaction not in block %d", h.Height)
+		}
+		// Each transaction is synced once.
+		delete(inBlock, tx.ID)
+		b.Transactions = append(b.Transactions, tx)
+		c.watchOutputs(tx)
+	}
+	return b, nil
+}
+
+// watchOutputs watches the outputs of tx paying to watched control
+// programs, so that spending them is synced too.
+func (c *Client) watchOutputs(tx *legacy.Tx) {
+	c.watchMu.Lock()
+	var ids [][]byte
+	for i, out := range tx.Outputs {
+		if c.watched[string(out.ControlProgram)] {
+			ids = append(ids, tx.OutputID(i).Bytes())
+		}
+	}
+	c.watchMu.Unlock()
+	c.Watch(ids...)
+}
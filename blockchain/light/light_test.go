@@ -0,0 +1,347 @@
+package light
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/consensus"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// testNode serves blocks the way a full node's API does, through
+// JSON.
+type testNode struct {
+	blocks    []*legacy.Block // blocks[i] is at height i+1
+	submitted []*legacy.Tx
+
+	// tamper, if set, changes the filtered blocks served.
+	tamper func(*FilteredBlock)
+}
+
+func (n *testNode) addBlock(t *testing.T, txs ...*legacy.Tx) *legacy.Block {
+	b := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1, Bits: consensus.RegtestBits}, Transactions: txs}
+	if len(n.blocks) > 0 {
+		prev := n.blocks[len(n.blocks)-1]
+		b.Height = prev.Height + 1
+		b.PreviousBlockHash = prev.Hash()
+		b.TimestampMS = prev.TimestampMS + 1000
+	}
+	var bctxs []*bc.Tx
+	for _, tx := range txs {
+		bctxs = append(bctxs, tx.Tx)
+	}
+	root, err := bc.MerkleRoot(bctxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.TransactionsMerkleRoot = root
+	n.blocks = append(n.blocks, b)
+	return b
+}
+
+func (n *testNode) Call(ctx context.Context, path string, request, response interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	var resp interface{}
+	switch path {
+	case "/get-block-headers", "/get-block-filters":
+		var req struct {
+			StartHeight uint64 `json:"start_height"`
+			Count       uint64 `json:"count"`
+		}
+		json.Unmarshal(b, &req)
+		var headers []*legacy.BlockHeader
+		var filters []chainjson.HexBytes
+		for h := req.StartHeight; h < req.StartHeight+req.Count && h <= uint64(len(n.blocks)); h++ {
+			if h == 0 {
+				continue // the test chain starts at height 1
+			}
+			headers = append(headers, &n.blocks[h-1].BlockHeader)
+			filters = append(filters, BuildFilter(n.blocks[h-1]))
+		}
+		if path == "/get-block-headers" {
+			resp = map[string]interface{}{"headers": headers}
+		} else {
+			resp = map[string]interface{}{"filters": filters}
+		}
+	case "/get-filtered-block":
+		var req struct {
+			BlockHeight uint64               `json:"block_height"`
+			Items       []chainjson.HexBytes `json:"items"`
+		}
+		json.Unmarshal(b, &req)
+		var items [][]byte
+		for _, item := range req.Items {
+			items = append(items, item)
+		}
+		fb, err := FilterBlock(n.blocks[req.BlockHeight-1], items)
+		if err != nil {
+			return err
+		}
+		if n.tamper != nil {
+			n.tamper(fb)
+		}
+		resp = fb
+	case "/submit-transaction":
+		var req struct {
+			Transactions []struct {
+				Transaction *legacy.Tx `json:"raw_transaction"`
+			} `json:"transactions"`
+		}
+		json.Unmarshal(b, &req)
+		n.submitted = append(n.submitted, req.Transactions[0].Transaction)
+		resp = []map[string]string{{"id": req.Transactions[0].Transaction.ID.String()}}
+	}
+	b, err = json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, response)
+}
+
+func payTx(n byte, prog []byte) *legacy.Tx {
+	return legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.Hash{V0: uint64(n)}, *consensus.BTMAssetID, 100, 0, []byte{1}, bc.Hash{}, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(*consensus.BTMAssetID, 100, prog, nil)},
+	})
+}
+
+func spendTx(t *testing.T, from *legacy.Tx, prog []byte) *legacy.Tx {
+	out, err := from.Output(*from.ResultIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := out.Source.Value
+	return legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *out.Source.Ref, *value.AssetId, value.Amount, out.Source.Position, out.ControlProgram.Code, *out.Data, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(*value.AssetId, value.Amount, prog, nil)},
+	})
+}
+
+func TestFilter(t *testing.T) {
+	node := new(testNode)
+	b := node.addBlock(t, payTx(1, []byte{1}), payTx(2, []byte{2}), payTx(3, []byte{3}))
+	filter := BuildFilter(b)
+
+	for _, item := range blockItems(b) {
+		ok, err := MatchFilter(b.Hash(), filter, [][]byte{{9}, item})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("filter does not match %x", item)
+		}
+	}
+	ok, err := MatchFilter(b.Hash(), filter, [][]byte{{9}, {10}, {11}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("filter matches items not in the block")
+	}
+
+	empty := node.addBlock(t)
+	ok, err = MatchFilter(empty.Hash(), BuildFilter(empty), [][]byte{{1}})
+	if err != nil || ok {
+		t.Errorf("empty filter: got %v, %v", ok, err)
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	ctx := context.Background()
+	mine, other := []byte{0x51, 1}, []byte{0x51, 2}
+
+	node := new(testNode)
+	node.addBlock(t)
+	c, err := NewClient(dbm.NewMemDB(), node, &node.blocks[0].BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Regtest = true
+	c.Watch(mine)
+
+	received := payTx(1, mine)
+	node.addBlock(t, payTx(2, other), received, payTx(3, other))
+	node.addBlock(t, payTx(4, other))
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Height() != 3 {
+		t.Fatalf("synced to height %d, want 3", c.Height())
+	}
+	b, err := c.GetBlock(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Hash() != node.blocks[1].Hash() || len(b.Transactions) != 1 || b.Transactions[0].ID != received.ID {
+		t.Errorf("block 2 has %d transactions, want only the payment", len(b.Transactions))
+	}
+	if b, _ := c.GetBlock(3); len(b.Transactions) != 0 {
+		t.Errorf("block 3 has %d transactions, want none", len(b.Transactions))
+	}
+
+	// Spending the received output is synced.
+	spent := spendTx(t, received, other)
+	if err := c.Submit(ctx, spent); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.submitted) != 1 || node.submitted[0].ID != spent.ID {
+		t.Fatal("transaction not submitted to the full node")
+	}
+	node.addBlock(t, payTx(5, other), spent)
+	<-c.BlockWaiter(3)
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := c.GetBlock(4); len(b.Transactions) != 1 || b.Transactions[0].ID != spent.ID {
+		t.Errorf("block 4 has %d transactions, want the spend", len(b.Transactions))
+	}
+
+	// A transaction that is not in the block is rejected.
+	node.addBlock(t, payTx(6, mine))
+	node.tamper = func(fb *FilteredBlock) { fb.Transactions[0] = payTx(7, mine) }
+	if err := c.Sync(ctx); errors.Root(err) != ErrBadProof {
+		t.Errorf("forged transaction: got error %v, want %v", err, ErrBadProof)
+	}
+	// So are transaction IDs that are not the block's.
+	node.tamper = func(fb *FilteredBlock) {
+		fb.TxIDs = append(fb.TxIDs, fb.TxIDs[0])
+		fb.Transactions = append(fb.Transactions, fb.Transactions[0])
+	}
+	if err := c.Sync(ctx); errors.Root(err) != ErrBadProof {
+		t.Errorf("forged transaction IDs: got error %v, want %v", err, ErrBadProof)
+	}
+	node.tamper = nil
+
+	// So is a header that does not extend the chain.
+	node.blocks[4].PreviousBlockHash = bc.Hash{}
+	if err := c.Sync(ctx); errors.Root(err) != ErrBadHeader {
+		t.Errorf("forged header: got error %v, want %v", err, ErrBadHeader)
+	}
+
+	// The client picks up where it left off.
+	c, err = NewClient(c.db, node, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Height() != 4 || !c.watched[string(received.OutputID(0).Bytes())] {
+		t.Errorf("reopened client at height %d", c.Height())
+	}
+}
+
+func TestClientDifficulty(t *testing.T) {
+	ctx := context.Background()
+	node := new(testNode)
+	node.addBlock(t)
+	c, err := NewClient(dbm.NewMemDB(), node, &node.blocks[0].BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.addBlock(t)
+
+	// The test chain's blocks are at the difficulty of a regression
+	// test network.
+	if err := c.Sync(ctx); errors.Root(err) != ErrBadHeader {
+		t.Errorf("got error %v, want %v", err, ErrBadHeader)
+	}
+	c.Regtest = true
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Height() != 2 {
+		t.Errorf("synced to height %d, want 2", c.Height())
+	}
+}
+
+func TestClientReorg(t *testing.T) {
+	ctx := context.Background()
+	mine := []byte{0x51, 1}
+
+	node := new(testNode)
+	node.addBlock(t)
+	c, err := NewClient(dbm.NewMemDB(), node, &node.blocks[0].BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Regtest = true
+	c.Watch(mine)
+	node.addBlock(t)
+	node.addBlock(t, payTx(1, mine))
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The full node switches to a longer branch forking after block 2.
+	node.blocks = node.blocks[:2]
+	confirmed := payTx(2, mine)
+	node.addBlock(t, confirmed)
+	node.addBlock(t)
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Height() != 4 {
+		t.Fatalf("synced to height %d, want 4", c.Height())
+	}
+	for h := uint64(1); h <= 4; h++ {
+		b, err := c.GetBlock(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Hash() != node.blocks[h-1].Hash() {
+			t.Errorf("block %d is not on the full node's branch", h)
+		}
+	}
+	if b, _ := c.GetBlock(3); len(b.Transactions) != 1 || b.Transactions[0].ID != confirmed.ID {
+		t.Errorf("block 3 has %d transactions, want the new branch's payment", len(b.Transactions))
+	}
+}
+
+func TestClientReorgChecksBranch(t *testing.T) {
+	ctx := context.Background()
+
+	node := new(testNode)
+	node.addBlock(t)
+	c, err := NewClient(dbm.NewMemDB(), node, &node.blocks[0].BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Regtest = true
+	node.addBlock(t)
+	node.addBlock(t)
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	synced := node.blocks[2].Hash()
+
+	// A longer branch with a block at the wrong difficulty is
+	// invalid; the client keeps its blocks.
+	node.blocks = node.blocks[:1]
+	node.addBlock(t, payTx(1, []byte{1}))
+	node.addBlock(t)
+	node.addBlock(t)
+	node.blocks[3].Bits = 1
+	if err := c.Sync(ctx); errors.Root(err) != ErrBadHeader {
+		t.Errorf("sync invalid branch: got error %v, want %v", err, ErrBadHeader)
+	}
+	if b, err := c.GetBlock(3); err != nil || b.Hash() != synced || c.Height() != 3 {
+		t.Errorf("client switched branches: height %d", c.Height())
+	}
+
+	node.blocks[3].Bits = consensus.RegtestBits
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.GetBlock(4); err != nil || b.Hash() != node.blocks[3].Hash() {
+		t.Errorf("client did not switch to the branch with more work")
+	}
+}
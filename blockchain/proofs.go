@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+)
+
+func init() {
+	errorFormatter.Errors[protocol.ErrTxNotFound] = httperror.Info{404, "BTM292", "Transaction not found in block"}
+	errorFormatter.Errors[protocol.ErrOutputNotFound] = httperror.Info{404, "BTM293", "Output not found in state"}
+}
+
+// POST /get-transaction-proof
+func (a *BlockchainReactor) getTransactionProof(ctx context.Context, in struct {
+	BlockHeight   uint64  `json:"block_height"`
+	TransactionID bc.Hash `json:"transaction_id"`
+}) (*protocol.TxProof, error) {
+	return a.chain.ProveTx(in.BlockHeight, in.TransactionID)
+}
+
+// POST /get-output-proof
+func (a *BlockchainReactor) getOutputProof(ctx context.Context, in struct {
+	OutputID bc.Hash `json:"output_id"`
+}) (*protocol.OutputProof, error) {
+	return a.chain.ProveOutput(in.OutputID)
+}
@@ -88,6 +88,24 @@ type AnnotatedAsset struct {
 	Definition      *json.RawMessage   `json:"definition"`
 	Tags            *json.RawMessage   `json:"tags"`
 	IsLocal         Bool               `json:"is_local"`
+
+	// DefinitionVersion is zero until the issuer publishes an
+	// updated definition.
+	DefinitionVersion uint64 `json:"definition_version"`
+
+	// MaxSupply is set if the issuance program caps the total
+	// amount that can ever be issued. Issued is the amount issued
+	// so far, as of the latest block.
+	MaxSupply *uint64 `json:"max_supply,omitempty"`
+	Issued    *uint64 `json:"issued,omitempty"`
+
+	// IsUnique is set for non-fungible assets, whose maximum
+	// supply is a single unit.
+	IsUnique Bool `json:"is_unique"`
+
+	// IsRestricted is set for assets whose transfers must be
+	// co-signed by the issuer.
+	IsRestricted Bool `json:"is_restricted"`
 }
 
 type AssetKey struct {
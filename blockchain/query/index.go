@@ -22,7 +22,7 @@ const (
 )
 
 // NewIndexer constructs a new indexer for indexing transactions.
-func NewIndexer(db dbm.DB, c *protocol.Chain/*, pinStore *pin.Store*/) *Indexer {
+func NewIndexer(db dbm.DB, c protocol.BlockReader/*, pinStore *pin.Store*/) *Indexer {
 	indexer := &Indexer{
 		db:       db,
 		c:        c,
@@ -34,7 +34,7 @@ func NewIndexer(db dbm.DB, c *protocol.Chain/*, pinStore *pin.Store*/) *Indexer
 // Indexer creates, updates and queries against indexes.
 type Indexer struct {
 	db         dbm.DB
-	c          *protocol.Chain
+	c          protocol.BlockReader
 	//pinStore   *pin.Store
 	annotators []Annotator
 }
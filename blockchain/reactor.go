@@ -11,11 +11,17 @@ import (
 	"github.com/bytom/blockchain/accesstoken"
 	"github.com/bytom/blockchain/account"
 	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/blockchain/asset/metadata"
+	"github.com/bytom/blockchain/channel"
+	"github.com/bytom/blockchain/federation"
+	"github.com/bytom/blockchain/light"
 	"github.com/bytom/blockchain/pseudohsm"
+	"github.com/bytom/blockchain/relay"
 	"github.com/bytom/blockchain/txdb"
 	"github.com/bytom/blockchain/txfeed"
 	"github.com/bytom/encoding/json"
 	"github.com/bytom/log"
+	"github.com/bytom/log/slowlog"
 	"github.com/bytom/mining/cpuminer"
 	"github.com/bytom/p2p"
 	"github.com/bytom/protocol"
@@ -55,10 +61,15 @@ const (
 type BlockchainReactor struct {
 	p2p.BaseReactor
 
-	chain       *protocol.Chain
+	chain       protocol.Interface
 	store       *txdb.Store
 	accounts    *account.Manager
 	assets      *asset.Registry
+	metadata    *metadata.Resolver
+	federation  *federation.Federation
+	channels    *channel.Manager
+	light       *light.Client
+	relayer     *relay.Relayer
 	accesstoken *accesstoken.Token
 	txFeeds     *txfeed.TxFeed
 	pool        *BlockPool
@@ -68,6 +79,8 @@ type BlockchainReactor struct {
 	mux         *http.ServeMux
 	handler     http.Handler
 	fastSync    bool
+	regtest     bool
+	exportDir   string
 	requestsCh  chan BlockRequest
 	timeoutsCh  chan string
 	evsw        types.EventSwitch
@@ -158,9 +171,55 @@ func (bcr *BlockchainReactor) BuildHander() {
 	m.Handle("/create-asset", jsonHandler(bcr.createAsset))
 	m.Handle("/update-account-tags", jsonHandler(bcr.updateAccountTags))
 	m.Handle("/update-asset-tags", jsonHandler(bcr.updateAssetTags))
+	m.Handle("/get-asset", jsonHandler(bcr.getAsset))
+	m.Handle("/list-asset-definitions", jsonHandler(bcr.listAssetDefinitions))
+	m.Handle("/create-asset-definition-update", jsonHandler(bcr.createAssetDefinitionUpdate))
+	m.Handle("/sign-asset-definition-update", jsonHandler(bcr.signAssetDefinitionUpdate))
+	m.Handle("/resolve-asset-alias", jsonHandler(bcr.resolveAssetAlias))
+	m.Handle("/list-asset-aliases", jsonHandler(bcr.listAssetAliases))
+	m.Handle("/create-asset-alias-operation", jsonHandler(bcr.createAssetAliasOperation))
+	m.Handle("/sign-asset-alias-operation", jsonHandler(bcr.signAssetAliasOperation))
+	m.Handle("/get-asset-supply", jsonHandler(bcr.getAssetSupply))
+	m.Handle("/list-asset-retirements", jsonHandler(bcr.listAssetRetirements))
+	m.Handle("/get-unique-asset-owner", jsonHandler(bcr.getUniqueAssetOwner))
+	m.Handle("/list-unique-asset-transfers", jsonHandler(bcr.listUniqueAssetTransfers))
+	m.Handle("/add-asset-whitelist", jsonHandler(bcr.addAssetWhitelist))
+	m.Handle("/remove-asset-whitelist", jsonHandler(bcr.removeAssetWhitelist))
+	m.Handle("/list-asset-whitelist", jsonHandler(bcr.listAssetWhitelist))
+	m.Handle("/cosign-restricted-transfers", jsonHandler(bcr.cosignRestrictedTransfers))
+	m.Handle("/get-asset-metadata", jsonHandler(bcr.getAssetMetadata))
 	m.Handle("/build-transaction", jsonHandler(bcr.build))
 	m.Handle("/create-control-program", jsonHandler(bcr.createControlProgram))
 	m.Handle("/create-account-receiver", jsonHandler(bcr.createAccountReceiver))
+	m.Handle("/create-htlc-key", jsonHandler(bcr.createHTLCKey))
+	m.Handle("/list-htlcs", jsonHandler(bcr.listHTLCs))
+	m.Handle("/get-federation", jsonHandler(bcr.getFederation))
+	m.Handle("/list-peg-ins", jsonHandler(bcr.listPegIns))
+	m.Handle("/list-peg-outs", jsonHandler(bcr.listPegOuts))
+	m.Handle("/list-federation-proposals", jsonHandler(bcr.listFederationProposals))
+	m.Handle("/sign-federation-proposal", jsonHandler(bcr.signFederationProposal))
+	m.Handle("/add-federation-signatures", jsonHandler(bcr.addFederationSignatures))
+	m.Handle("/submit-federation-proposal", jsonHandler(bcr.submitFederationProposal))
+	m.Handle("/audit-federation", jsonHandler(bcr.auditFederation))
+	m.Handle("/prove-foreign-transaction", jsonHandler(bcr.proveForeignTransaction))
+	m.Handle("/get-transaction-proof", jsonHandler(bcr.getTransactionProof))
+	m.Handle("/get-output-proof", jsonHandler(bcr.getOutputProof))
+	m.Handle("/generate", jsonHandler(bcr.generate))
+	m.Handle("/export-blocks", jsonHandler(bcr.exportBlocks))
+	m.Handle("/import-blocks", jsonHandler(bcr.importBlocks))
+	m.Handle("/verify-chain", jsonHandler(bcr.verifyChain))
+	m.Handle("/export-snapshot", jsonHandler(bcr.exportSnapshot))
+	m.Handle("/unlock-channel-account", jsonHandler(bcr.unlockChannelAccount))
+	m.Handle("/open-channel", jsonHandler(bcr.openChannel))
+	m.Handle("/pay-channel", jsonHandler(bcr.payChannel))
+	m.Handle("/close-channel", jsonHandler(bcr.closeChannel))
+	m.Handle("/get-channel", jsonHandler(bcr.getChannel))
+	m.Handle("/list-channels", jsonHandler(bcr.listChannels))
+	m.Handle("/channel-propose", jsonHandler(bcr.channelPropose))
+	m.Handle("/channel-fund", jsonHandler(bcr.channelFund))
+	m.Handle("/channel-update", jsonHandler(bcr.channelUpdate))
+	m.Handle("/channel-revoke", jsonHandler(bcr.channelRevoke))
+	m.Handle("/channel-close", jsonHandler(bcr.channelClose))
 	m.Handle("/create-transaction-feed", jsonHandler(bcr.createTxFeed))
 	m.Handle("/get-transaction-feed", jsonHandler(bcr.getTxFeed))
 	m.Handle("/update-transaction-feed", jsonHandler(bcr.updateTxFeed))
@@ -173,6 +232,11 @@ func (bcr *BlockchainReactor) BuildHander() {
 	m.Handle("/list-unspent-outputs", jsonHandler(bcr.listUnspentOutputs))
 	m.Handle("/", alwaysError(errors.New("not Found")))
 	m.Handle("/info", jsonHandler(bcr.info))
+	m.Handle("/get-block-height", jsonHandler(bcr.getBlockHeight))
+	m.Handle("/get-block", jsonHandler(bcr.getBlock))
+	m.Handle("/get-block-headers", jsonHandler(bcr.getBlockHeaders))
+	m.Handle("/get-block-filters", jsonHandler(bcr.getBlockFilters))
+	m.Handle("/get-filtered-block", jsonHandler(bcr.getFilteredBlock))
 	m.Handle("/create-block-key", jsonHandler(bcr.createblockkey))
 	m.Handle("/submit-transaction", jsonHandler(bcr.submit))
 	m.Handle("/create-access-token", jsonHandler(bcr.createAccessToken))
@@ -190,6 +254,8 @@ func (bcr *BlockchainReactor) BuildHander() {
 		if l := latency(m, req); l != nil {
 			defer l.RecordSince(time.Now())
 		}
+		timer := slowlog.Start(slowlog.APIRequest, "path", req.URL.Path, "remote-addr", req.RemoteAddr, "content-length", req.ContentLength)
+		defer timer.Finish(req.Context())
 		m.ServeHTTP(w, req)
 	})
 	handler := maxBytes(latencyHandler) // TODO(tessr): consider moving this to non-core specific mux
@@ -249,7 +315,7 @@ type page struct {
 	LastPage bool         `json:"last_page"`
 }
 
-func NewBlockchainReactor(store *txdb.Store, chain *protocol.Chain, txPool *protocol.TxPool, accounts *account.Manager, assets *asset.Registry, hsm *pseudohsm.HSM, fastSync bool) *BlockchainReactor {
+func NewBlockchainReactor(store *txdb.Store, chain protocol.Interface, txPool *protocol.TxPool, accounts *account.Manager, assets *asset.Registry, hsm *pseudohsm.HSM, fastSync bool) *BlockchainReactor {
 	requestsCh := make(chan BlockRequest, defaultChannelCapacity)
 	timeoutsCh := make(chan string, defaultChannelCapacity)
 	pool := NewBlockPool(
@@ -263,6 +329,7 @@ func NewBlockchainReactor(store *txdb.Store, chain *protocol.Chain, txPool *prot
 		store:      store,
 		accounts:   accounts,
 		assets:     assets,
+		metadata:   metadata.NewResolver(assets, nil),
 		pool:       pool,
 		txPool:     txPool,
 		mining:     mining,
@@ -342,8 +409,14 @@ func (bcR *BlockchainReactor) Receive(chID byte, src *p2p.Peer, msgBytes []byte)
 			// TODO peer is asking for things we don't have.
 		}
 	case *bcBlockResponseMessage:
-		// Got a block.
-		bcR.pool.AddBlock(src.Key, msg.GetBlock(), len(msgBytes))
+		// Got a block. One below the pool's height was not requested
+		// by it: it is the parent of a block on another branch.
+		block := msg.GetBlock()
+		if height, _, _ := bcR.pool.GetStatus(); block.Height < height {
+			bcR.addParentBlock(block)
+		} else {
+			bcR.pool.AddBlock(src.Key, block, len(msgBytes))
+		}
 	case *bcStatusRequestMessage:
 		// Send peer our state.
 		queued := src.TrySend(BlockchainChannel, struct{ BlockchainMessage }{&bcStatusResponseMessage{bcR.chain.Height()}})
@@ -411,9 +484,13 @@ FOR_LOOP:
 				}
 				bcR.pool.PopRequest()
 
-				if err := bcR.chain.AddBlock(nil, block); err == nil {
+				err := bcR.chain.AddBlock(nil, block)
+				switch errors.Root(err) {
+				case nil:
 					bcR.Logger.Info("finish to sync commit block", "blockHeigh", block.BlockHeader.Height)
-				} else {
+				case protocol.ErrOrphanBlock:
+					bcR.requestParent(block)
+				default:
 					bcR.Logger.Info("fail to sync commit block", "blockHeigh", block.BlockHeader.Height, "error", err)
 				}
 			}
@@ -421,13 +498,35 @@ FOR_LOOP:
 		case <-bcR.Quit:
 			break FOR_LOOP
 		}
-		if bcR.pool.IsCaughtUp() && !bcR.mining.IsMining() {
+		if !bcR.regtest && bcR.pool.IsCaughtUp() && !bcR.mining.IsMining() {
 			bcR.Logger.Info("start to mining")
 			bcR.mining.Start()
 		}
 	}
 }
 
+// addParentBlock adds block, requested as the parent of an orphan,
+// to the chain, and requests its own parent if it is an orphan too.
+func (bcR *BlockchainReactor) addParentBlock(block *legacy.Block) {
+	err := bcR.chain.AddBlock(nil, block)
+	switch errors.Root(err) {
+	case nil, protocol.ErrKnownBlock:
+	case protocol.ErrOrphanBlock:
+		bcR.requestParent(block)
+	default:
+		bcR.Logger.Info("fail to add parent block", "blockHeigh", block.BlockHeader.Height, "error", err)
+	}
+}
+
+// requestParent asks every peer for the block below the orphan
+// block. Peers on the orphan's branch answer with its parent, and the
+// chain ignores the others' answers as blocks it has.
+func (bcR *BlockchainReactor) requestParent(block *legacy.Block) {
+	if block.Height > 0 {
+		bcR.Switch.Broadcast(BlockchainChannel, struct{ BlockchainMessage }{&bcBlockRequestMessage{block.Height - 1}})
+	}
+}
+
 // BroadcastStatusRequest broadcasts `BlockStore` height.
 func (bcR *BlockchainReactor) BroadcastStatusRequest() error {
 	bcR.Switch.Broadcast(BlockchainChannel, struct{ BlockchainMessage }{&bcStatusRequestMessage{bcR.chain.Height()}})
@@ -469,6 +568,9 @@ var _ = wire.RegisterInterface(
 // DecodeMessage decodes BlockchainMessage.
 // TODO: ensure that bz is completely read.
 func DecodeMessage(bz []byte) (msgType byte, msg BlockchainMessage, err error) {
+	if len(bz) == 0 {
+		return 0, nil, errors.New("DecodeMessage() got an empty message")
+	}
 	msgType = bz[0]
 	n := int(0)
 	r := bytes.NewReader(bz)
@@ -30,6 +30,7 @@ func (a *BlockchainReactor) createAccountReceiver(ctx context.Context, ins []str
 			if err != nil {
 				responses[i] = err
 			} else {
+				a.watch(receiver.ControlProgram)
 				responses[i] = receiver
 			}
 		}(i)
@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/net/http/httpjson"
+	"github.com/bytom/protocol/bc"
+)
+
+// maxGenerate limits the number of blocks one call to /generate
+// makes.
+const maxGenerate = 1000
+
+var errRegtestDisabled = errors.New("this core is not running a regression test network")
+
+func init() {
+	errorFormatter.Errors[errRegtestDisabled] = httperror.Info{400, "BTM294", "This core is not running a regression test network"}
+}
+
+// SetRegtest runs this core on a regression test network: the CPU
+// miner stays off, and blocks are made on demand through /generate.
+// Blocks and transactions are still exchanged with peers.
+func (a *BlockchainReactor) SetRegtest() {
+	a.regtest = true
+}
+
+// POST /generate
+func (a *BlockchainReactor) generate(ctx context.Context, in struct {
+	Count        int    `json:"count"`
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+}) (map[string]interface{}, error) {
+	if !a.regtest {
+		return nil, errors.Wrap(errRegtestDisabled)
+	}
+	if in.Count < 1 || in.Count > maxGenerate {
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "count must be between 1 and %d", maxGenerate)
+	}
+
+	accountID := in.AccountID
+	if accountID == "" {
+		acc, err := a.accounts.FindByAlias(ctx, in.AccountAlias)
+		if err != nil {
+			return nil, err
+		}
+		accountID = acc.ID
+	}
+	prog, err := a.accounts.CreateControlProgram(ctx, accountID, false, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := mining.Generate(ctx, a.chain, a.txPool, in.Count, prog)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]bc.Hash, len(blocks))
+	for i, b := range blocks {
+		hashes[i] = b.Hash()
+	}
+	return map[string]interface{}{
+		"block_hashes": hashes,
+		"height":       a.chain.Height(),
+	}, nil
+}
@@ -0,0 +1,35 @@
+package blockchain
+
+import (
+	"context"
+
+	"github.com/bytom/blockchain/relay"
+	"github.com/bytom/errors"
+	"github.com/bytom/net/http/httperror"
+	"github.com/bytom/protocol/bc"
+)
+
+var errRelayDisabled = errors.New("this core does not relay a foreign chain")
+
+func init() {
+	errorFormatter.Errors[errRelayDisabled] = httperror.Info{400, "BTM290", "This core does not relay a foreign chain"}
+	errorFormatter.Errors[relay.ErrTxNotFound] = httperror.Info{404, "BTM291", "Transaction not found in block"}
+}
+
+// SetRelayer makes this core prove transactions on the foreign chain
+// r reads.
+func (a *BlockchainReactor) SetRelayer(r *relay.Relayer) {
+	a.relayer = r
+}
+
+// POST /prove-foreign-transaction
+func (a *BlockchainReactor) proveForeignTransaction(ctx context.Context, in struct {
+	BlockHeight   uint64  `json:"block_height"`
+	Depth         uint64  `json:"depth"`
+	TransactionID bc.Hash `json:"transaction_id"`
+}) (*relay.Proof, error) {
+	if a.relayer == nil {
+		return nil, errors.Wrap(errRelayDisabled)
+	}
+	return a.relayer.Prove(ctx, in.BlockHeight, in.Depth, in.TransactionID)
+}
@@ -0,0 +1,132 @@
+// Package relay proves that transactions are included in blocks of
+// another chain, for programs on this chain that check such proofs
+// with the CHECKTXPROOF instruction.
+//
+// A proof carries the header of the block with the transaction and
+// those of the blocks built on it, and CHECKTXPROOF checks that they
+// chain and that each meets the target the program requires. Forging
+// a proof therefore costs as much as mining that many blocks at that
+// target, which a program chooses to outweigh what it guards.
+package relay
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/bytom/encoding/blockchain"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+)
+
+var ErrTxNotFound = errors.New("transaction not found in block")
+
+// A Chain is the chain proofs are made for. federation.RemoteChain
+// implements it for a chain reached over RPC.
+type Chain interface {
+	GetBlock(height uint64) (*legacy.Block, error)
+}
+
+// Proof shows that a transaction is included in a block.
+type Proof struct {
+	BlockHeight   uint64             `json:"block_height"`
+	BlockHash     bc.Hash            `json:"block_hash"`
+	BlockHeader   chainjson.HexBytes `json:"block_header"`
+	TransactionID bc.Hash            `json:"transaction_id"`
+	Index         uint64             `json:"index"`
+	Count         uint64             `json:"transaction_count"`
+	Proof         []bc.Hash          `json:"proof"`
+
+	// ConfirmingHeaders are the headers of the blocks built on the
+	// block, in order.
+	ConfirmingHeaders []chainjson.HexBytes `json:"confirming_headers"`
+
+	// Arguments are the witness arguments, ahead of the signatures,
+	// that spend a program built with vmutil.TxProofProgram.
+	Arguments []chainjson.HexBytes `json:"arguments"`
+}
+
+// NewProof returns the proof that the transaction txID is included
+// in b, confirmed by the blocks built on it.
+func NewProof(b *legacy.Block, txID bc.Hash, confirming []*legacy.Block) (*Proof, error) {
+	txs := make([]*bc.Tx, len(b.Transactions))
+	index := -1
+	for i, tx := range b.Transactions {
+		txs[i] = tx.Tx
+		if tx.ID == txID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, errors.WithDetailf(ErrTxNotFound, "transaction %x, block %d", txID.Bytes(), b.Height)
+	}
+	branch, err := bc.MerkleProof(txs, index)
+	if err != nil {
+		return nil, err
+	}
+	header, err := b.BlockHeader.Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "serializing block header")
+	}
+
+	p := &Proof{
+		BlockHeight:   b.Height,
+		BlockHash:     b.Hash(),
+		BlockHeader:   header.([]byte),
+		TransactionID: txID,
+		Index:         uint64(index),
+		Count:         uint64(len(txs)),
+		Proof:         branch,
+	}
+	headers := new(bytes.Buffer)
+	blockchain.WriteVarstr31(headers, p.BlockHeader)
+	for _, cb := range confirming {
+		h, err := cb.BlockHeader.Value()
+		if err != nil {
+			return nil, errors.Wrap(err, "serializing block header")
+		}
+		p.ConfirmingHeaders = append(p.ConfirmingHeaders, h.([]byte))
+		blockchain.WriteVarstr31(headers, h.([]byte))
+	}
+	var concat []byte
+	for _, h := range branch {
+		concat = append(concat, h.Bytes()...)
+	}
+	p.Arguments = []chainjson.HexBytes{
+		headers.Bytes(),
+		concat,
+		vm.Int64Bytes(int64(p.Index)),
+		vm.Int64Bytes(int64(p.Count)),
+	}
+	return p, nil
+}
+
+// Relayer makes proofs for transactions on another chain.
+type Relayer struct {
+	chain Chain
+}
+
+// New returns a relayer making proofs for transactions on chain.
+func New(chain Chain) *Relayer {
+	return &Relayer{chain: chain}
+}
+
+// Prove returns the proof that the transaction txID is included in
+// the block at height, confirmed by the depth blocks built on it.
+func (r *Relayer) Prove(ctx context.Context, height, depth uint64, txID bc.Hash) (*Proof, error) {
+	b, err := r.chain.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	var confirming []*legacy.Block
+	for h := height + 1; h <= height+depth; h++ {
+		cb, err := r.chain.GetBlock(h)
+		if err != nil {
+			return nil, err
+		}
+		confirming = append(confirming, cb)
+	}
+	return NewProof(b, txID, confirming)
+}
@@ -0,0 +1,121 @@
+package relay
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/validation"
+	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+type testChain []*legacy.Block
+
+func (c testChain) GetBlock(height uint64) (*legacy.Block, error) {
+	if height < 1 || height > uint64(len(c)) {
+		return nil, errors.New("no such block")
+	}
+	return c[height-1], nil
+}
+
+func TestProve(t *testing.T) {
+	var txs []*legacy.Tx
+	var bctxs []*bc.Tx
+	for i := 0; i < 5; i++ {
+		tx := legacy.NewTx(legacy.TxData{Version: 1, ReferenceData: []byte{byte(i)}})
+		txs = append(txs, tx)
+		bctxs = append(bctxs, tx.Tx)
+	}
+	root, err := bc.MerkleRoot(bctxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	easy := consensus.BigToCompact(new(big.Int).Lsh(big.NewInt(1), 256))
+	block := &legacy.Block{
+		BlockHeader: legacy.BlockHeader{
+			Height:          1,
+			Bits:            easy,
+			BlockCommitment: legacy.BlockCommitment{TransactionsMerkleRoot: root},
+		},
+		Transactions: txs,
+	}
+	chain := testChain{block}
+	for h := uint64(2); h <= 3; h++ {
+		chain = append(chain, &legacy.Block{BlockHeader: legacy.BlockHeader{
+			Height:            h,
+			PreviousBlockHash: chain[h-2].Hash(),
+			Bits:              easy,
+		}})
+	}
+
+	r := New(chain)
+	proof, err := r.Prove(context.Background(), 1, 2, txs[3].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Index != 3 || proof.Count != 5 || proof.BlockHash != block.Hash() || len(proof.ConfirmingHeaders) != 2 {
+		t.Errorf("proof = %+v", proof)
+	}
+	if _, err := r.Prove(context.Background(), 1, 0, bc.Hash{V0: 1}); errors.Root(err) != ErrTxNotFound {
+		t.Errorf("proving missing transaction: got error %v, want %v", err, ErrTxNotFound)
+	}
+	if _, err := r.Prove(context.Background(), 1, 3, txs[3].ID); err == nil {
+		t.Error("proving with more confirmations than the chain has: got no error")
+	}
+
+	// A proof whose headers do not chain is rejected.
+	unchained, err := NewProof(block, txs[3].ID, []*legacy.Block{chain[2], chain[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate := []byte{byte(vm.OP_TRUE)}
+	var predicateHash [32]byte
+	sha3pool.Sum256(predicateHash[:], predicate)
+	cases := []struct {
+		proof *Proof
+		txID  bc.Hash
+		bits  uint64
+		depth uint64
+		want  error
+	}{
+		{proof, txs[3].ID, easy, 2, nil},
+		{proof, txs[3].ID, easy, 1, nil},
+		{proof, txs[2].ID, easy, 2, vm.ErrVerifyFailed},
+		// The program wants more blocks on top than the proof has.
+		{proof, txs[3].ID, easy, 3, vm.ErrVerifyFailed},
+		{unchained, txs[3].ID, easy, 2, vm.ErrVerifyFailed},
+		// No hash meets a zero target.
+		{proof, txs[3].ID, 0, 2, vm.ErrVerifyFailed},
+	}
+	for i, c := range cases {
+		prog, err := vmutil.TxProofProgram(c.txID.Bytes(), c.bits, c.depth, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var args [][]byte
+		for _, arg := range c.proof.Arguments {
+			args = append(args, arg)
+		}
+		args = append(args, vm.Int64Bytes(int64(len(args))), predicate)
+
+		_, err = vm.Verify(&vm.Context{
+			VMVersion:    1,
+			Code:         prog,
+			Arguments:    args,
+			CheckTxProof: validation.CheckTxProof,
+		}, 100000)
+		if e, ok := err.(vm.Error); ok {
+			err = e.Err
+		}
+		if errors.Root(err) != c.want {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.want)
+		}
+	}
+}
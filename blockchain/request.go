@@ -22,7 +22,7 @@ type BuildRequest struct {
 
 func (a *BlockchainReactor) filterAliases(ctx context.Context, br *BuildRequest) error {
 	for i, m := range br.Actions {
-		id, _ := m["assset_id"].(string)
+		id, _ := m["asset_id"].(string)
 		alias, _ := m["asset_alias"].(string)
 		if id == "" && alias != "" {
 			asset, err := a.assets.FindByAlias(ctx, alias)
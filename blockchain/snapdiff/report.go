@@ -0,0 +1,201 @@
+package snapdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+)
+
+// A Chain is a chain whose blocks resolve output IDs to the values
+// they hold. protocol.Chain implements it.
+type Chain interface {
+	Height() uint64
+	GetBlock(height uint64) (*legacy.Block, error)
+}
+
+// Report is the difference between two snapshot files, A and B.
+type Report struct {
+	A, B *File
+	Diff *state.Diff
+
+	// Assets summarizes the difference per asset. Outputs are only
+	// counted in it once resolved.
+	Assets []*AssetSummary
+
+	// Unresolved counts the outputs in Diff not found in the chain
+	// searched by Resolve.
+	Unresolved int
+
+	values map[bc.Hash]*bc.AssetAmount
+}
+
+// AssetSummary is how an asset differs between two snapshots.
+type AssetSummary struct {
+	AssetID            bc.AssetID
+	IssuedA, IssuedB   uint64
+	RetiredA, RetiredB uint64
+
+	OutputsAdded   int    // outputs of the asset in B only
+	AmountAdded    uint64 // the amount they hold
+	OutputsRemoved int    // outputs of the asset in A only
+	AmountRemoved  uint64 // the amount they hold
+}
+
+// Compare compares a with b.
+func Compare(a, b *File) *Report {
+	r := &Report{A: a, B: b, Diff: state.Compare(a.Snapshot, b.Snapshot)}
+	r.summarize()
+	return r
+}
+
+// Resolve looks up the outputs in r's diff in c's blocks, up to its
+// tip, adding their values to r's asset summaries. An output created
+// only on another node's fork of the chain remains unresolved.
+func (r *Report) Resolve(ctx context.Context, c Chain) error {
+	want := make(map[bc.Hash]bool)
+	for _, id := range r.Diff.AddedOutputs {
+		want[id] = true
+	}
+	for _, id := range r.Diff.RemovedOutputs {
+		want[id] = true
+	}
+	r.values = make(map[bc.Hash]*bc.AssetAmount)
+	for h := uint64(0); h <= c.Height() && len(r.values) < len(want); h++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := c.GetBlock(h)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d", h)
+		}
+		for _, tx := range b.Transactions {
+			for _, id := range tx.ResultIds {
+				if !want[*id] {
+					continue
+				}
+				if out, ok := tx.Entries[*id].(*bc.Output); ok {
+					r.values[*id] = out.Source.Value
+				}
+			}
+		}
+	}
+	r.summarize()
+	return nil
+}
+
+// summarize recomputes r's asset summaries.
+func (r *Report) summarize() {
+	assets := make(map[bc.AssetID]*AssetSummary)
+	summary := func(id bc.AssetID) *AssetSummary {
+		s := assets[id]
+		if s == nil {
+			s = &AssetSummary{AssetID: id}
+			assets[id] = s
+		}
+		return s
+	}
+	for _, d := range r.Diff.Issued {
+		s := summary(d.AssetID)
+		s.IssuedA, s.IssuedB = d.A, d.B
+	}
+	for _, d := range r.Diff.Retired {
+		s := summary(d.AssetID)
+		s.RetiredA, s.RetiredB = d.A, d.B
+	}
+
+	r.Unresolved = 0
+	for _, id := range r.Diff.AddedOutputs {
+		if v, ok := r.values[id]; ok {
+			s := summary(*v.AssetId)
+			s.OutputsAdded++
+			s.AmountAdded += v.Amount
+		} else {
+			r.Unresolved++
+		}
+	}
+	for _, id := range r.Diff.RemovedOutputs {
+		if v, ok := r.values[id]; ok {
+			s := summary(*v.AssetId)
+			s.OutputsRemoved++
+			s.AmountRemoved += v.Amount
+		} else {
+			r.Unresolved++
+		}
+	}
+
+	r.Assets = r.Assets[:0]
+	for _, s := range assets {
+		r.Assets = append(r.Assets, s)
+	}
+	sort.Sort(byAssetID(r.Assets))
+}
+
+// WriteText writes r to w for people to read, listing at most max
+// IDs of each kind of difference.
+func (r *Report) WriteText(w io.Writer, max int) error {
+	ew := errors.NewWriter(w)
+	fmt.Fprintf(ew, "A: height %d, block %x\n", r.A.Height, r.A.BlockHash.Bytes())
+	fmt.Fprintf(ew, "B: height %d, block %x\n", r.B.Height, r.B.BlockHash.Bytes())
+	if r.Diff.Empty() {
+		fmt.Fprintln(ew, "snapshots are the same")
+		return ew.Err()
+	}
+
+	list := func(what string, ids []bc.Hash) {
+		if len(ids) == 0 {
+			return
+		}
+		fmt.Fprintf(ew, "%d %s\n", len(ids), what)
+		for i, id := range ids {
+			if i == max {
+				fmt.Fprintf(ew, "\t... %d more\n", len(ids)-max)
+				break
+			}
+			if v, ok := r.values[id]; ok {
+				fmt.Fprintf(ew, "\t%x (%d of asset %x)\n", id.Bytes(), v.Amount, v.AssetId.Bytes())
+			} else {
+				fmt.Fprintf(ew, "\t%x\n", id.Bytes())
+			}
+		}
+	}
+	list("outputs in B only:", r.Diff.AddedOutputs)
+	list("outputs in A only:", r.Diff.RemovedOutputs)
+	list("nonces in B only:", r.Diff.AddedNonces)
+	list("nonces in A only:", r.Diff.RemovedNonces)
+	list("nonces expiring at different times:", r.Diff.ChangedNonces)
+	if r.Unresolved > 0 {
+		fmt.Fprintf(ew, "%d outputs not resolved to an asset\n", r.Unresolved)
+	}
+
+	for _, s := range r.Assets {
+		fmt.Fprintf(ew, "asset %x:\n", s.AssetID.Bytes())
+		if s.IssuedA != s.IssuedB {
+			fmt.Fprintf(ew, "\tissued:  A %d, B %d\n", s.IssuedA, s.IssuedB)
+		}
+		if s.RetiredA != s.RetiredB {
+			fmt.Fprintf(ew, "\tretired: A %d, B %d\n", s.RetiredA, s.RetiredB)
+		}
+		if s.OutputsAdded > 0 {
+			fmt.Fprintf(ew, "\t%d outputs holding %d in B only\n", s.OutputsAdded, s.AmountAdded)
+		}
+		if s.OutputsRemoved > 0 {
+			fmt.Fprintf(ew, "\t%d outputs holding %d in A only\n", s.OutputsRemoved, s.AmountRemoved)
+		}
+	}
+	return ew.Err()
+}
+
+type byAssetID []*AssetSummary
+
+func (a byAssetID) Len() int      { return len(a) }
+func (a byAssetID) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byAssetID) Less(i, j int) bool {
+	return bytes.Compare(a[i].AssetID.Bytes(), a[j].AssetID.Bytes()) < 0
+}
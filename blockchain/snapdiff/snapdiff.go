@@ -0,0 +1,85 @@
+// Package snapdiff compares state snapshots exported from two nodes,
+// to debug state that diverges between nodes claiming the same
+// height.
+//
+// A snapshot file starts with an identifying header, followed by the
+// height and hash of the block the snapshot is the state after, and
+// the snapshot in the protobuf encoding the node stores it in.
+package snapdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/bytom/blockchain/txdb"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/state"
+)
+
+// header starts every snapshot file. Its last byte is the format
+// version.
+const header = "BTMSNAP\x01"
+
+// MaxSnapshotSize limits the size of an encoded snapshot read from a
+// file.
+const MaxSnapshotSize = 1 << 30
+
+// ErrBadFormat is returned when a file is not a snapshot file, or is
+// truncated or corrupt.
+var ErrBadFormat = errors.New("invalid snapshot file")
+
+// File is a snapshot file's contents.
+type File struct {
+	Height    uint64
+	BlockHash bc.Hash
+	Snapshot  *state.Snapshot
+}
+
+// Write writes f to w as a snapshot file.
+func Write(w io.Writer, f *File) error {
+	data, err := txdb.EncodeSnapshot(f.Snapshot)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header)
+	var height [8]byte
+	binary.BigEndian.PutUint64(height[:], f.Height)
+	bw.Write(height[:])
+	bw.Write(f.BlockHash.Bytes())
+	bw.Write(data)
+	return errors.Wrap(bw.Flush(), "writing snapshot file")
+}
+
+// Read reads a snapshot file from r.
+func Read(r io.Reader) (*File, error) {
+	buf := make([]byte, len(header)+8+32)
+	if _, err := io.ReadFull(r, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errors.Wrap(ErrBadFormat, "truncated header")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading header")
+	}
+	if string(buf[:len(header)]) != header {
+		return nil, errors.Wrap(ErrBadFormat, "unknown header")
+	}
+	f := &File{Height: binary.BigEndian.Uint64(buf[len(header):])}
+	var b32 [32]byte
+	copy(b32[:], buf[len(header)+8:])
+	f.BlockHash = bc.NewHash(b32)
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxSnapshotSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading snapshot")
+	}
+	if len(data) > MaxSnapshotSize {
+		return nil, errors.Wrapf(ErrBadFormat, "snapshot larger than %d bytes", MaxSnapshotSize)
+	}
+	f.Snapshot, err = txdb.DecodeSnapshot(data)
+	if err != nil {
+		return nil, errors.Sub(ErrBadFormat, err)
+	}
+	return f, nil
+}
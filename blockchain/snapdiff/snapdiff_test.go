@@ -0,0 +1,137 @@
+package snapdiff
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest"
+	"github.com/bytom/protocol/state"
+)
+
+// snapshotFile returns a copy of c's state as a snapshot file.
+func snapshotFile(c *protocol.Chain) *File {
+	b, s := c.State()
+	return &File{Height: b.Height, BlockHash: b.Hash(), Snapshot: state.Copy(s)}
+}
+
+func TestReadWrite(t *testing.T) {
+	c := prottest.NewChain(t)
+	txPool := prottest.TxPool(c)
+	if _, err := mining.Generate(context.Background(), c, txPool, 1, []byte{0x51}); err != nil {
+		t.Fatal(err)
+	}
+	want := snapshotFile(c)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	got, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Height != want.Height || got.BlockHash != want.BlockHash {
+		t.Errorf("read height %d block %x, want %d %x", got.Height, got.BlockHash.Bytes(), want.Height, want.BlockHash.Bytes())
+	}
+	if d := state.Compare(want.Snapshot, got.Snapshot); !d.Empty() {
+		t.Errorf("read snapshot differs: %+v", d)
+	}
+
+	for _, bad := range [][]byte{nil, data[:5], []byte("BTMBLOCKS\x01" + string(data[10:]))} {
+		if _, err := Read(bytes.NewReader(bad)); errors.Root(err) != ErrBadFormat {
+			t.Errorf("Read(%x...) error = %v, want %v", bad[:len(bad)%16], err, ErrBadFormat)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	txPool := prottest.TxPool(c)
+	blocks, err := mining.Generate(ctx, c, txPool, 1, []byte{0x51})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := snapshotFile(c)
+
+	// Spend the coinbase, retiring some of it, in the next block.
+	cb := blocks[0].Transactions[0]
+	out, err := cb.Output(*cb.ResultIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := out.Source.Value
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *out.Source.Ref, *value.AssetId, value.Amount, out.Source.Position, out.ControlProgram.Code, *out.Data, nil)},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(*value.AssetId, value.Amount-2000000, []byte{0x53}, nil),
+			legacy.NewTxOutput(*value.AssetId, 1000000, []byte{0x6a}, nil),
+		},
+	})
+	raw, err := tx.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx = new(legacy.Tx)
+	if err := tx.UnmarshalText(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ValidateTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mining.Generate(ctx, c, txPool, 1, []byte{0x52}); err != nil {
+		t.Fatal(err)
+	}
+	b := snapshotFile(c)
+
+	if r := Compare(a, a); !r.Diff.Empty() || len(r.Assets) != 0 {
+		t.Errorf("snapshot differs from itself: %+v", r.Diff)
+	}
+
+	r := Compare(a, b)
+	// B spent A's newest coinbase, and added its own and the spend's
+	// output.
+	if len(r.Diff.RemovedOutputs) != 1 || len(r.Diff.AddedOutputs) != 2 {
+		t.Fatalf("diff = %+v, want 1 output removed and 2 added", r.Diff)
+	}
+	if r.Unresolved != 3 {
+		t.Errorf("unresolved = %d before resolving, want 3", r.Unresolved)
+	}
+	if err := r.Resolve(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if r.Unresolved != 0 || len(r.Assets) != 1 {
+		t.Fatalf("resolved report: %d unresolved, assets %+v", r.Unresolved, r.Assets)
+	}
+	s := r.Assets[0]
+	added := value.Amount - 2000000
+	blockB, err := c.GetBlock(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added += blockB.Transactions[0].Outputs[0].Amount
+	if s.AssetID != *consensus.BTMAssetID || s.RetiredA != 0 || s.RetiredB != 1000000 ||
+		s.OutputsRemoved != 1 || s.AmountRemoved != value.Amount ||
+		s.OutputsAdded != 2 || s.AmountAdded != added {
+		t.Errorf("asset summary = %+v", s)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2 outputs in B only:", "... 1 more", "retired: A 0, B 1000000"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"context"
+	"os"
+
+	"github.com/bytom/blockchain/snapdiff"
+	"github.com/bytom/errors"
+)
+
+// POST /export-snapshot
+//
+// The file is created in the core's export directory. Compare
+// snapshots exported from two cores with the snapdiff command.
+func (a *BlockchainReactor) exportSnapshot(ctx context.Context, in struct {
+	Name string `json:"name"`
+}) (map[string]interface{}, error) {
+	path, err := a.exportPath(in.Name)
+	if err != nil {
+		return nil, err
+	}
+	block, snapshot := a.chain.State()
+	if block == nil {
+		return nil, errors.New("chain has no state")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating snapshot file")
+	}
+	err = snapdiff.Write(f, &snapdiff.File{Height: block.Height, BlockHash: block.Hash(), Snapshot: snapshot})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Wrap(err, "closing snapshot file")
+	}
+	return map[string]interface{}{
+		"height":     block.Height,
+		"block_hash": block.Hash(),
+	}, nil
+}
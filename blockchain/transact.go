@@ -22,6 +22,8 @@ func (a *BlockchainReactor) actionDecoder(action string) (func([]byte) (txbuilde
 	switch action {
 	case "control_account":
 		decoder = a.accounts.DecodeControlAction
+	case "control_htlc":
+		decoder = a.accounts.DecodeControlHTLCAction
 	case "control_program":
 		decoder = txbuilder.DecodeControlProgramAction
 	case "control_receiver":
@@ -30,12 +32,22 @@ func (a *BlockchainReactor) actionDecoder(action string) (func([]byte) (txbuilde
 		decoder = a.assets.DecodeIssueAction
 	case "retire":
 		decoder = txbuilder.DecodeRetireAction
+	case "retire_from_account":
+		decoder = a.accounts.DecodeRetireAction
 	case "spend_account":
 		decoder = a.accounts.DecodeSpendAction
 	case "spend_account_unspent_output":
 		decoder = a.accounts.DecodeSpendUTXOAction
 	case "set_transaction_reference_data":
 		decoder = txbuilder.DecodeSetTxRefDataAction
+	case "update_asset_definition":
+		decoder = a.assets.DecodeUpdateDefinitionAction
+	case "publish_asset_alias":
+		decoder = a.assets.DecodePublishAliasAction
+	case "redeem_htlc":
+		decoder = a.accounts.DecodeRedeemHTLCAction
+	case "refund_htlc":
+		decoder = a.accounts.DecodeRefundHTLCAction
 	default:
 		return nil, false
 	}
@@ -206,7 +218,7 @@ func cleanUpSubmittedTxs(ctx context.Context, db pg.DB) {
 func (a *BlockchainReactor) finalizeTxWait(ctx context.Context, txTemplate *txbuilder.Template, waitUntil string) error {
 	// Use the current generator height as the lower bound of the block height
 	// that the transaction may appear in.
-	localHeight := a.chain.Height()
+	localHeight := a.height()
 	generatorHeight := localHeight
 
 	log.Printf(ctx, "localHeight:%v\n", localHeight)
@@ -216,7 +228,7 @@ func (a *BlockchainReactor) finalizeTxWait(ctx context.Context, txTemplate *txbu
 		return errors.Wrap(err, "saving tx submitted height")
 	}*/
 
-	err := txbuilder.FinalizeTx(ctx, a.chain, txTemplate.Transaction)
+	err := a.finalizeTx(ctx, txTemplate.Transaction)
 	if err != nil {
 		return err
 	}
@@ -251,8 +263,8 @@ func (a *BlockchainReactor) waitForTxInBlock(ctx context.Context, tx *legacy.Tx,
 		case <-ctx.Done():
 			return 0, ctx.Err()
 
-		case <-a.chain.BlockWaiter(height):
-			b, err := a.chain.GetBlock(height)
+		case <-a.blockWaiter(height):
+			b, err := a.syncedBlock(height)
 			if err != nil {
 				return 0, errors.Wrap(err, "getting block that just landed")
 			}
@@ -271,7 +283,7 @@ func (a *BlockchainReactor) waitForTxInBlock(ctx context.Context, tx *legacy.Tx,
 			// tell definitively until its max time elapses.
 
 			// Re-insert into the pool in case it was dropped.
-			err = txbuilder.FinalizeTx(ctx, a.chain, tx)
+			err = a.finalizeTx(ctx, tx)
 			if err != nil {
 				return 0, err
 			}
@@ -93,6 +93,15 @@ func (a *setTxRefDataAction) Build(ctx context.Context, b *TemplateBuilder) erro
 	return b.setReferenceData(a.Data)
 }
 
+// NewRetireAction returns an action that permanently removes
+// amt from circulation.
+func NewRetireAction(amt bc.AssetAmount, referenceData json.Map) Action {
+	return &retireAction{
+		AssetAmount:   amt,
+		ReferenceData: referenceData,
+	}
+}
+
 func DecodeRetireAction(data []byte) (Action, error) {
 	a := new(retireAction)
 	err := stdjson.Unmarshal(data, a)
@@ -18,10 +18,17 @@ var (
 	ErrBadInstructionCount = errors.New("too many signing instructions in template")
 )
 
+// A Chain is the chain FinalizeTx checks transactions against.
+// protocol.Interface implements it.
+type Chain interface {
+	TimestampMS() uint64
+	ValidateTx(tx *legacy.Tx) error
+}
+
 // FinalizeTx validates a transaction signature template,
 // assembles a fully signed tx, and stores the effects of
 // its changes on the UTXO set.
-func FinalizeTx(ctx context.Context, c *protocol.Chain, tx *legacy.Tx) error {
+func FinalizeTx(ctx context.Context, c Chain, tx *legacy.Tx) error {
 	err := checkTxSighashCommitment(tx)
 	if err != nil {
 		return err
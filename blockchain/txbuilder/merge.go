@@ -0,0 +1,90 @@
+package txbuilder
+
+import (
+	"bytes"
+
+	"github.com/bytom/crypto/sha3pool"
+	chainjson "github.com/bytom/encoding/json"
+	"github.com/bytom/errors"
+)
+
+// ErrTemplateMismatch is returned when merging signatures from a
+// template that does not describe the same transaction and keys.
+var ErrTemplateMismatch = errors.New("templates do not match")
+
+// MergeSignatures copies into dst every signature in src that dst
+// lacks. Both templates must be for the same transaction with the
+// same signing instructions, as when several parties each sign
+// their own copy of a deterministically built transaction. Each
+// copied signature is checked against its key and predicate.
+func MergeSignatures(dst, src *Template) error {
+	if dst.Transaction == nil || src.Transaction == nil {
+		return errors.Wrap(ErrMissingRawTx)
+	}
+	if dst.Transaction.ID != src.Transaction.ID {
+		return errors.WithDetailf(ErrTemplateMismatch, "transaction %s, want %s", src.Transaction.ID.String(), dst.Transaction.ID.String())
+	}
+	if len(dst.SigningInstructions) != len(src.SigningInstructions) {
+		return errors.WithDetailf(ErrTemplateMismatch, "%d signing instructions, want %d", len(src.SigningInstructions), len(dst.SigningInstructions))
+	}
+
+	for i, dstInst := range dst.SigningInstructions {
+		srcInst := src.SigningInstructions[i]
+		if srcInst.Position != dstInst.Position || len(srcInst.SignatureWitnesses) != len(dstInst.SignatureWitnesses) {
+			return errors.WithDetailf(ErrTemplateMismatch, "signing instruction %d", i)
+		}
+		for j, sw := range dstInst.SignatureWitnesses {
+			err := sw.merge(srcInst.SignatureWitnesses[j], dst, dstInst.Position)
+			if err != nil {
+				return errors.WithDetailf(err, "witness component %d of input %d", j, i)
+			}
+		}
+	}
+	return materializeWitnesses(dst)
+}
+
+func (sw *signatureWitness) merge(src *signatureWitness, tpl *Template, index uint32) error {
+	if sw.Quorum != src.Quorum || len(sw.Keys) != len(src.Keys) {
+		return ErrTemplateMismatch
+	}
+	for i, k := range sw.Keys {
+		if k.XPub != src.Keys[i].XPub {
+			return ErrTemplateMismatch
+		}
+	}
+	if len(sw.Program) == 0 {
+		sw.Program = src.Program
+	}
+	if len(sw.Program) == 0 {
+		// Neither copy has been signed, or src came from a core
+		// that does not send programs: compute the program as Sign
+		// would, so that any signatures in src can be checked.
+		sw.Program = buildSigProgram(tpl, index)
+	}
+	if len(src.Program) > 0 && !bytes.Equal(sw.Program, src.Program) {
+		return ErrTemplateMismatch
+	}
+	if len(sw.Sigs) < len(sw.Keys) {
+		newSigs := make([]chainjson.HexBytes, len(sw.Keys))
+		copy(newSigs, sw.Sigs)
+		sw.Sigs = newSigs
+	}
+
+	var h [32]byte
+	sha3pool.Sum256(h[:], sw.Program)
+	for i, sig := range src.Sigs {
+		if i >= len(sw.Keys) || len(sig) == 0 || len(sw.Sigs[i]) > 0 {
+			continue
+		}
+		k := sw.Keys[i]
+		path := make([][]byte, 0, len(k.DerivationPath))
+		for _, p := range k.DerivationPath {
+			path = append(path, p)
+		}
+		if !k.XPub.Derive(path).Verify(h[:], sig) {
+			return errors.WithDetailf(ErrBadWitnessComponent, "invalid signature %d", i)
+		}
+		sw.Sigs[i] = sig
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package txbuilder
+
+import (
+	"context"
+
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// Restricted-transfer assets are held in control programs built with
+// vmutil.RestrictedTransferProgram, which cannot be spent without a
+// co-signature from the asset's issuer. The issuer decides whether to
+// co-sign by checking where the transaction sends the asset.
+
+var (
+	ErrTransferNotAllowed = errors.New("transfer of restricted asset is not allowed")
+	ErrNotCosignable      = errors.New("input cannot be co-signed")
+)
+
+// Whitelist reports whether controlProgram may receive the restricted
+// asset assetID.
+type Whitelist func(ctx context.Context, assetID bc.AssetID, controlProgram []byte) (bool, error)
+
+// CheckRestrictedTransfer checks that every output of assetID in tx
+// either retires it or pays a whitelisted restricted transfer program
+// co-signed by issuerPubkeys, so that the restriction carries over to
+// the new holder.
+func CheckRestrictedTransfer(ctx context.Context, tx *legacy.TxData, assetID bc.AssetID, issuerPubkeys []ed25519.PublicKey, whitelisted Whitelist) error {
+	for i, out := range tx.Outputs {
+		if *out.AssetId != assetID || vmutil.IsUnspendable(out.ControlProgram) {
+			continue
+		}
+		_, _, pubkeys, _, err := vmutil.ParseRestrictedTransferProgram(out.ControlProgram)
+		if err != nil || !vmutil.SamePubkeys(pubkeys, issuerPubkeys) {
+			return errors.WithDetailf(ErrTransferNotAllowed, "output %d is not a restricted transfer program of the issuer", i)
+		}
+		ok, err := whitelisted(ctx, assetID, out.ControlProgram)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.WithDetailf(ErrTransferNotAllowed, "output %d pays a control program that is not whitelisted", i)
+		}
+	}
+	return nil
+}
+
+// AddCosigner adds a witness component to si for the issuer keys of
+// the restricted transfer program it spends. The program requires the
+// issuer to sign the same predicate as the holder, so the component
+// reuses the holder's predicate, computing it from tpl if the holder
+// has not signed yet. Adding the issuer twice has no effect.
+func AddCosigner(tpl *Template, si *SigningInstruction, xpubs []chainkd.XPub, path [][]byte, quorum int) error {
+	switch len(si.SignatureWitnesses) {
+	case 1:
+	case 2:
+		return nil
+	default:
+		return errors.WithDetailf(ErrNotCosignable, "input %d has %d witness components, want 1", si.Position, len(si.SignatureWitnesses))
+	}
+
+	program := si.SignatureWitnesses[0].Program
+	if len(program) == 0 {
+		program = buildSigProgram(tpl, si.Position)
+	}
+	si.AddWitnessKeys(xpubs, path, quorum)
+	si.SignatureWitnesses[1].Program = program
+	return nil
+}
@@ -0,0 +1,103 @@
+package txbuilder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+func TestCheckRestrictedTransfer(t *testing.T) {
+	ctx := context.Background()
+	holderPub, _, _ := ed25519.GenerateKey(nil)
+	issuerPub, _, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	issuer := []ed25519.PublicKey{issuerPub}
+
+	restricted, err := vmutil.RestrictedTransferProgram([]ed25519.PublicKey{holderPub}, 1, issuer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := vmutil.RestrictedTransferProgram([]ed25519.PublicKey{holderPub}, 1, []ed25519.PublicKey{otherPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := vmutil.P2SPMultiSigProgram([]ed25519.PublicKey{holderPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assetID := bc.AssetID{V0: 1}
+	whitelist := func(ctx context.Context, id bc.AssetID, prog []byte) (bool, error) {
+		return string(prog) == string(restricted), nil
+	}
+	cases := []struct {
+		name    string
+		outputs []*legacy.TxOutput
+		ok      bool
+	}{{
+		name:    "whitelisted restricted program",
+		outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, restricted, nil)},
+		ok:      true,
+	}, {
+		name:    "retirement and other assets",
+		outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, retirementProgram, nil), legacy.NewTxOutput(bc.AssetID{}, 1, plain, nil)},
+		ok:      true,
+	}, {
+		name:    "plain program",
+		outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, plain, nil)},
+	}, {
+		name:    "another issuer",
+		outputs: []*legacy.TxOutput{legacy.NewTxOutput(assetID, 1, foreign, nil)},
+	}}
+	for _, c := range cases {
+		err := CheckRestrictedTransfer(ctx, &legacy.TxData{Outputs: c.outputs}, assetID, issuer, whitelist)
+		if c.ok && err != nil {
+			t.Errorf("%s: got error %v", c.name, err)
+		}
+		if !c.ok && errors.Root(err) != ErrTransferNotAllowed {
+			t.Errorf("%s: got error %v, want %v", c.name, err, ErrTransferNotAllowed)
+		}
+	}
+}
+
+func TestAddCosigner(t *testing.T) {
+	tpl := &Template{
+		Transaction: legacy.NewTx(legacy.TxData{
+			Inputs: []*legacy.TxInput{
+				legacy.NewSpendInput(nil, bc.Hash{}, bc.AssetID{}, 1, 0, nil, bc.Hash{}, nil),
+			},
+			Outputs: []*legacy.TxOutput{
+				legacy.NewTxOutput(bc.AssetID{}, 1, []byte{1}, nil),
+			},
+		}),
+		SigningInstructions: []*SigningInstruction{{}},
+	}
+	si := tpl.SigningInstructions[0]
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddCosigner(tpl, si, []chainkd.XPub{xpub}, nil, 1); errors.Root(err) != ErrNotCosignable {
+		t.Fatalf("no holder component: got error %v, want %v", err, ErrNotCosignable)
+	}
+
+	si.AddWitnessKeys([]chainkd.XPub{xpub}, nil, 1)
+	for i := 0; i < 2; i++ {
+		if err := AddCosigner(tpl, si, []chainkd.XPub{xpub}, nil, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(si.SignatureWitnesses) != 2 {
+		t.Fatalf("got %d witness components, want 2", len(si.SignatureWitnesses))
+	}
+	if want := buildSigProgram(tpl, 0); string(si.SignatureWitnesses[1].Program) != string(want) {
+		t.Errorf("issuer predicate = %x, want %x", si.SignatureWitnesses[1].Program, want)
+	}
+}
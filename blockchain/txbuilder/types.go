@@ -36,13 +36,20 @@ func (t *Template) Hash(idx uint32) bc.Hash {
 
 // SigningInstruction gives directions for signing inputs in a TxTemplate.
 type SigningInstruction struct {
-	Position           uint32              `json:"position"`
+	Position uint32 `json:"position"`
+
+	// Arguments are placed in the input witness ahead of the
+	// signature witnesses, for control programs that need more than
+	// signatures, such as an HTLC preimage.
+	Arguments []chainjson.HexBytes `json:"arguments,omitempty"`
+
 	SignatureWitnesses []*signatureWitness `json:"witness_components,omitempty"`
 }
 
 func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	var pre struct {
-		Position           uint32 `json:"position"`
+		Position           uint32               `json:"position"`
+		Arguments          []chainjson.HexBytes `json:"arguments"`
 		SignatureWitnesses []struct {
 			Type string
 			signatureWitness
@@ -54,6 +61,7 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	}
 
 	si.Position = pre.Position
+	si.Arguments = pre.Arguments
 	si.SignatureWitnesses = make([]*signatureWitness, 0, len(pre.SignatureWitnesses))
 	for i, w := range pre.SignatureWitnesses {
 		if w.Type != "signature" {
@@ -38,6 +38,9 @@ func materializeWitnesses(txTemplate *Template) error {
 		}
 
 		var witness [][]byte
+		for _, arg := range sigInst.Arguments {
+			witness = append(witness, arg)
+		}
 		for j, sw := range sigInst.SignatureWitnesses {
 			err := sw.materialize(txTemplate, sigInst.Position, &witness)
 			if err != nil {
@@ -211,15 +214,17 @@ func (sw signatureWitness) materialize(tpl *Template, index uint32, args *[][]by
 
 func (sw signatureWitness) MarshalJSON() ([]byte, error) {
 	obj := struct {
-		Type   string               `json:"type"`
-		Quorum int                  `json:"quorum"`
-		Keys   []keyID              `json:"keys"`
-		Sigs   []chainjson.HexBytes `json:"signatures"`
+		Type    string               `json:"type"`
+		Quorum  int                  `json:"quorum"`
+		Keys    []keyID              `json:"keys"`
+		Program chainjson.HexBytes   `json:"program,omitempty"`
+		Sigs    []chainjson.HexBytes `json:"signatures"`
 	}{
-		Type:   "signature",
-		Quorum: sw.Quorum,
-		Keys:   sw.Keys,
-		Sigs:   sw.Sigs,
+		Type:    "signature",
+		Quorum:  sw.Quorum,
+		Keys:    sw.Keys,
+		Program: sw.Program,
+		Sigs:    sw.Sigs,
 	}
 	return json.Marshal(obj)
 }
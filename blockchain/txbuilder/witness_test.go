@@ -56,7 +56,8 @@ func TestWitnessJSON(t *testing.T) {
 					XPub:           testutil.TestXPub,
 					DerivationPath: []chainjson.HexBytes{{5, 6, 7}},
 				}},
-				Sigs: []chainjson.HexBytes{{8, 9, 10}},
+				Program: chainjson.HexBytes{1, 2, 3},
+				Sigs:    []chainjson.HexBytes{{8, 9, 10}},
 			},
 		},
 	}
@@ -37,6 +37,15 @@ type Snapshot struct {
 	// Nonces contains the record of recent nonces for ensuring
 	// uniqueness of issuances.
 	Nonces []*Snapshot_Nonce `protobuf:"bytes,2,rep,name=nonces" json:"nonces,omitempty"`
+	// Issued contains the total amount issued so far of each asset
+	// whose issuance program declares a maximum supply.
+	Issued []*Snapshot_AssetTotal `protobuf:"bytes,3,rep,name=issued" json:"issued,omitempty"`
+	// Retired contains the total amount retired so far of each asset.
+	Retired []*Snapshot_AssetTotal `protobuf:"bytes,4,rep,name=retired" json:"retired,omitempty"`
+	// CountsIssued is set in snapshots whose Issued counts every
+	// issuance of a capped asset. Snapshots written before issuance
+	// caps were added lack it.
+	CountsIssued bool `protobuf:"varint,5,opt,name=counts_issued,json=countsIssued" json:"counts_issued,omitempty"`
 }
 
 func (m *Snapshot) Reset()                    { *m = Snapshot{} }
@@ -58,6 +67,27 @@ func (m *Snapshot) GetNonces() []*Snapshot_Nonce {
 	return nil
 }
 
+func (m *Snapshot) GetIssued() []*Snapshot_AssetTotal {
+	if m != nil {
+		return m.Issued
+	}
+	return nil
+}
+
+func (m *Snapshot) GetRetired() []*Snapshot_AssetTotal {
+	if m != nil {
+		return m.Retired
+	}
+	return nil
+}
+
+func (m *Snapshot) GetCountsIssued() bool {
+	if m != nil {
+		return m.CountsIssued
+	}
+	return false
+}
+
 type Snapshot_Nonce struct {
 	Hash     []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
 	ExpiryMs uint64 `protobuf:"varint,2,opt,name=expiry_ms,json=expiryMs" json:"expiry_ms,omitempty"`
@@ -77,28 +107,45 @@ func (m *Snapshot_StateTreeNode) String() string            { return proto.Compa
 func (*Snapshot_StateTreeNode) ProtoMessage()               {}
 func (*Snapshot_StateTreeNode) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 1} }
 
+type Snapshot_AssetTotal struct {
+	AssetId []byte `protobuf:"bytes,1,opt,name=asset_id,json=assetId,proto3" json:"asset_id,omitempty"`
+	Amount  uint64 `protobuf:"varint,2,opt,name=amount" json:"amount,omitempty"`
+}
+
+func (m *Snapshot_AssetTotal) Reset()                    { *m = Snapshot_AssetTotal{} }
+func (m *Snapshot_AssetTotal) String() string            { return proto.CompactTextString(m) }
+func (*Snapshot_AssetTotal) ProtoMessage()               {}
+func (*Snapshot_AssetTotal) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 2} }
+
 func init() {
 	proto.RegisterType((*Snapshot)(nil), "chain.core.txdb.internal.storage.Snapshot")
 	proto.RegisterType((*Snapshot_Nonce)(nil), "chain.core.txdb.internal.storage.Snapshot.Nonce")
 	proto.RegisterType((*Snapshot_StateTreeNode)(nil), "chain.core.txdb.internal.storage.Snapshot.StateTreeNode")
+	proto.RegisterType((*Snapshot_AssetTotal)(nil), "chain.core.txdb.internal.storage.Snapshot.AssetTotal")
 }
 
 func init() { proto.RegisterFile("snapshot.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 218 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x90, 0x3b, 0x4f, 0xc4, 0x30,
-	0x10, 0x84, 0xe5, 0x7b, 0x71, 0xb7, 0x3c, 0x84, 0x5c, 0x45, 0x47, 0x13, 0xa8, 0x52, 0xad, 0x10,
-	0x34, 0xa9, 0xa9, 0x68, 0x48, 0xe1, 0x50, 0xd1, 0x20, 0x27, 0x59, 0xe1, 0x08, 0xf0, 0x46, 0xb6,
-	0x8b, 0xa4, 0xe4, 0x9f, 0xa3, 0x38, 0xa6, 0xa0, 0x42, 0x74, 0xa3, 0x91, 0xbe, 0x6f, 0x56, 0x0b,
-	0x17, 0xde, 0xea, 0xc1, 0x1b, 0x0e, 0x38, 0x38, 0x0e, 0x2c, 0xf3, 0xd6, 0xe8, 0xde, 0x62, 0xcb,
-	0x8e, 0x30, 0x8c, 0x5d, 0x83, 0xbd, 0x0d, 0xe4, 0xac, 0xfe, 0x40, 0x1f, 0xd8, 0xe9, 0x37, 0xba,
-	0xf9, 0x5a, 0xc1, 0xbe, 0x4e, 0x90, 0xac, 0x60, 0x6b, 0xb9, 0x23, 0x9f, 0x89, 0x7c, 0x5d, 0x9c,
-	0xde, 0x95, 0xf8, 0x17, 0x8e, 0x3f, 0x28, 0xd6, 0x41, 0x07, 0x7a, 0x76, 0x44, 0x15, 0x77, 0xa4,
-	0x16, 0x8d, 0x7c, 0x84, 0x9d, 0x65, 0xdb, 0x92, 0xcf, 0x56, 0x51, 0x78, 0xfb, 0x0f, 0x61, 0x35,
-	0x83, 0x2a, 0xf1, 0xc7, 0x12, 0xb6, 0xb1, 0x90, 0x12, 0x36, 0x46, 0x7b, 0x93, 0x89, 0x5c, 0x14,
-	0x67, 0x2a, 0x66, 0x79, 0x05, 0x07, 0x1a, 0x87, 0xde, 0x4d, 0xaf, 0x9f, 0xf3, 0x92, 0x28, 0x36,
-	0x6a, 0xbf, 0x14, 0x4f, 0xfe, 0x78, 0x0d, 0xe7, 0xbf, 0x6e, 0x93, 0x97, 0xb0, 0x7e, 0xa7, 0x29,
-	0x09, 0xe6, 0xf8, 0x70, 0x78, 0x39, 0x49, 0xf3, 0xcd, 0x2e, 0xfe, 0xed, 0xfe, 0x3b, 0x00, 0x00,
-	0xff, 0xff, 0x24, 0x3f, 0x72, 0xb5, 0x49, 0x01, 0x00, 0x00,
+	// 306 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa5, 0x92, 0x3f, 0x4f, 0xc3, 0x30,
+	0x10, 0xc5, 0x15, 0xf2, 0xa7, 0xe9, 0xd1, 0x22, 0xe4, 0x01, 0x95, 0xb0, 0x04, 0x58, 0x32, 0x59,
+	0x08, 0x84, 0xd4, 0x0d, 0xc1, 0x44, 0x87, 0x06, 0xc9, 0xed, 0xc4, 0x12, 0xb9, 0x89, 0x45, 0x2c,
+	0x5a, 0x3b, 0xb2, 0x5d, 0xa9, 0xfd, 0x04, 0x7c, 0x6d, 0x12, 0xc7, 0x15, 0x62, 0x42, 0x15, 0xdb,
+	0xdd, 0xd3, 0xbd, 0x9f, 0xef, 0x9e, 0x0c, 0x67, 0x5a, 0xd0, 0x46, 0xd7, 0xd2, 0xe0, 0x46, 0x49,
+	0x23, 0x51, 0x5a, 0xd6, 0x94, 0x0b, 0x5c, 0x4a, 0xc5, 0xb0, 0xd9, 0x55, 0x2b, 0xcc, 0x85, 0x61,
+	0x4a, 0xd0, 0x35, 0xd6, 0x46, 0x2a, 0xfa, 0xc1, 0x6e, 0xbe, 0x02, 0x88, 0x17, 0xce, 0x84, 0x72,
+	0x08, 0x85, 0xac, 0x98, 0x9e, 0x78, 0xa9, 0x9f, 0x9d, 0xde, 0x4f, 0xf1, 0x5f, 0x76, 0x7c, 0xb0,
+	0xe2, 0x85, 0xa1, 0x86, 0x2d, 0x15, 0x63, 0x79, 0x0b, 0x20, 0x3d, 0x06, 0xbd, 0x42, 0x24, 0xa4,
+	0x28, 0x5b, 0xe0, 0x89, 0x05, 0xde, 0x1d, 0x01, 0xcc, 0x3b, 0x23, 0x71, 0x7e, 0x34, 0x87, 0x88,
+	0x6b, 0xbd, 0x65, 0xd5, 0xc4, 0xb7, 0xa4, 0xc7, 0x23, 0x48, 0xcf, 0x5a, 0x33, 0xb3, 0x94, 0x86,
+	0xae, 0x89, 0x83, 0xa0, 0x37, 0x18, 0x28, 0x66, 0xb8, 0x6a, 0x79, 0xc1, 0x7f, 0x78, 0x07, 0x0a,
+	0xba, 0x85, 0x71, 0x29, 0xb7, 0xc2, 0xe8, 0xc2, 0xad, 0x19, 0xa6, 0x5e, 0x16, 0x93, 0x51, 0x2f,
+	0xce, 0xac, 0x96, 0x4c, 0x21, 0xb4, 0x57, 0x21, 0x04, 0x41, 0x4d, 0x75, 0xdd, 0xc6, 0xec, 0x65,
+	0x23, 0x62, 0x6b, 0x74, 0x05, 0x43, 0xb6, 0x6b, 0xb8, 0xda, 0x17, 0x9b, 0x2e, 0x2e, 0x2f, 0x0b,
+	0x48, 0xdc, 0x0b, 0x73, 0x9d, 0x5c, 0xc3, 0xf8, 0x57, 0xc0, 0xe8, 0x1c, 0xfc, 0x4f, 0xb6, 0x77,
+	0x80, 0xae, 0x4c, 0x9e, 0x00, 0x7e, 0x16, 0x43, 0x97, 0x10, 0xd3, 0xae, 0x2b, 0x78, 0xe5, 0x86,
+	0x06, 0xb6, 0x9f, 0x55, 0xe8, 0x02, 0x22, 0xba, 0xe9, 0xd6, 0x72, 0xaf, 0xb8, 0xee, 0x65, 0xf8,
+	0x3e, 0x70, 0xa7, 0xae, 0x22, 0xfb, 0x7b, 0x1e, 0xbe, 0x01, 0x7a, 0x3c, 0x11, 0x6d, 0x4f, 0x02,
+	0x00, 0x00,
 }
@@ -8,7 +8,9 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	"github.com/bytom/blockchain/txdb/internal/storage"
+	"github.com/bytom/consensus"
 	"github.com/bytom/errors"
+	"github.com/bytom/log/slowlog"
 	"github.com/bytom/protocol/patricia"
 	"github.com/bytom/protocol/state"
 	"github.com/bytom/protocol/bc"
@@ -20,6 +22,12 @@ func calcSnapshotKey(height uint64) []byte {
     return []byte(fmt.Sprintf("S:%v", height))
 }
 
+// ErrStaleSnapshot is returned for a snapshot at or above
+// consensus.IssuanceCapActivationHeight written before issuance caps
+// were added. It does not count the supply of capped assets, so the
+// core must sync the chain again from the genesis block.
+var ErrStaleSnapshot = errors.New("snapshot does not count issued supply")
+
 func calcLatestSnapshotHeight() []byte {
 	return []byte("LatestSnapshotHeight")
 }
@@ -31,10 +39,14 @@ func DecodeSnapshot(data []byte) (*state.Snapshot, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshaling state snapshot proto")
 	}
+	return fromStoredSnapshot(&storedSnapshot)
+}
 
+// fromStoredSnapshot rebuilds a snapshot from its protobuf message.
+func fromStoredSnapshot(storedSnapshot *storage.Snapshot) (*state.Snapshot, error) {
 	tree := new(patricia.Tree)
 	for _, node := range storedSnapshot.Nodes {
-		err = tree.Insert(node.Key)
+		err := tree.Insert(node.Key)
 		if err != nil {
 			return nil, errors.Wrap(err, "reconstructing state tree")
 		}
@@ -49,11 +61,35 @@ func DecodeSnapshot(data []byte) (*state.Snapshot, error) {
 	}
 
 	return &state.Snapshot{
-		Tree:   tree,
-		Nonces: nonces,
+		Tree:    tree,
+		Nonces:  nonces,
+		Issued:  decodeAssetTotals(storedSnapshot.Issued),
+		Retired: decodeAssetTotals(storedSnapshot.Retired),
 	}, nil
 }
 
+func decodeAssetTotals(totals []*storage.Snapshot_AssetTotal) map[bc.AssetID]uint64 {
+	m := make(map[bc.AssetID]uint64, len(totals))
+	for _, t := range totals {
+		var b32 [32]byte
+		copy(b32[:], t.AssetId)
+		m[bc.NewAssetID(b32)] = t.Amount
+	}
+	return m
+}
+
+func encodeAssetTotals(m map[bc.AssetID]uint64) []*storage.Snapshot_AssetTotal {
+	totals := make([]*storage.Snapshot_AssetTotal, 0, len(m))
+	for k, v := range m {
+		assetID := k
+		totals = append(totals, &storage.Snapshot_AssetTotal{
+			AssetId: assetID.Bytes(),
+			Amount:  v,
+		})
+	}
+	return totals
+}
+
 var latestSnapshotHeight = []byte("latestSnapshotHeight")
 
 type SnapshotHeightJSON struct {
@@ -84,7 +120,20 @@ func LoadSnapshotHeightJSON(db dbm.DB) SnapshotHeightJSON {
 }
 
 
-func storeStateSnapshot(ctx context.Context, db dbm.DB, snapshot *state.Snapshot, blockHeight uint64) error {
+// EncodeSnapshot encodes a snapshot in the binary, protobuf
+// representation DecodeSnapshot reads.
+func EncodeSnapshot(snapshot *state.Snapshot) ([]byte, error) {
+	storedSnapshot, err := toStoredSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(storedSnapshot)
+	return b, errors.Wrap(err, "marshaling state snapshot")
+}
+
+// toStoredSnapshot walks the state tree of snapshot, returning the
+// snapshot's protobuf message.
+func toStoredSnapshot(snapshot *state.Snapshot) (*storage.Snapshot, error) {
 	var storedSnapshot storage.Snapshot
 	err := patricia.Walk(snapshot.Tree, func(key []byte) error {
 		n := &storage.Snapshot_StateTreeNode{Key: key}
@@ -92,7 +141,7 @@ func storeStateSnapshot(ctx context.Context, db dbm.DB, snapshot *state.Snapshot
 		return nil
 	})
 	if err != nil {
-		return errors.Wrap(err, "walking patricia tree")
+		return nil, errors.Wrap(err, "walking patricia tree")
 	}
 
 	storedSnapshot.Nonces = make([]*storage.Snapshot_Nonce, 0, len(snapshot.Nonces))
@@ -104,16 +153,35 @@ func storeStateSnapshot(ctx context.Context, db dbm.DB, snapshot *state.Snapshot
 		})
 	}
 
-	b, err := proto.Marshal(&storedSnapshot)
+	storedSnapshot.Issued = encodeAssetTotals(snapshot.Issued)
+	storedSnapshot.Retired = encodeAssetTotals(snapshot.Retired)
+	storedSnapshot.CountsIssued = true
+	return &storedSnapshot, nil
+}
+
+func storeStateSnapshot(ctx context.Context, db dbm.DB, snapshot *state.Snapshot, blockHeight uint64) error {
+	timer := slowlog.Start(slowlog.SnapshotSave, "height", blockHeight)
+	defer timer.Finish(ctx)
+
+	storedSnapshot, err := toStoredSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	timer.Mark("walk")
+
+	b, err := proto.Marshal(storedSnapshot)
 	if err != nil {
 		return errors.Wrap(err, "marshaling state snapshot")
 	}
+	timer.Mark("marshal")
+	timer.Add("nodes", len(storedSnapshot.Nodes), "nonces", len(storedSnapshot.Nonces), "issued", len(storedSnapshot.Issued), "retired", len(storedSnapshot.Retired), "bytes", len(b))
 
 	// set new snapshot.
 	db.Set(calcSnapshotKey(blockHeight), b)
 	SnapshotHeightJSON{Height: blockHeight}.Save(db)
 	//TO DO: delete old snapshot.
 	db.SetSync(nil, nil)
+	timer.Mark("write")
 	return errors.Wrap(err, "deleting old snapshots")
 }
 
@@ -124,7 +192,14 @@ func getStateSnapshot(ctx context.Context, db dbm.DB) (*state.Snapshot, uint64,
 		return nil, height, errors.New("no this snapshot.")
 	}
 
-	snapshot, err := DecodeSnapshot(data)
+	var storedSnapshot storage.Snapshot
+	if err := proto.Unmarshal(data, &storedSnapshot); err != nil {
+		return nil, height, errors.Wrap(err, "decoding snapshot")
+	}
+	if !storedSnapshot.CountsIssued && height >= consensus.IssuanceCapActivationHeight {
+		return nil, height, errors.WithDetailf(ErrStaleSnapshot, "snapshot at height %d predates issuance caps", height)
+	}
+	snapshot, err := fromStoredSnapshot(&storedSnapshot)
 	if err != nil {
 		return nil, height, errors.Wrap(err, "decoding snapshot")
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/bytom/errors"
+	"github.com/bytom/log/slowlog"
 	"github.com/bytom/protocol/bc/legacy"
 	"github.com/bytom/protocol/state"
 	. "github.com/tendermint/tmlibs/common"
@@ -93,13 +94,20 @@ func (s *Store) Height() uint64 {
 }
 
 // GetBlock looks up the block with the provided block height.
-// If no block is found at that height, it returns an error.
-
+// If no block is found at that height, it returns an error. Blocks
+// above the height of the blockchain, left by a reorganization to a
+// shorter branch, are not found.
 func (s *Store) GetBlock(height uint64) (*legacy.Block, error) {
+	if height > s.Height() {
+		return nil, errors.New(Fmt("no block at height %v", height))
+	}
 	return s.cache.lookup(height)
 }
 
 func (s *Store) GetRawBlock(height uint64) ([]byte, error) {
+	if height > s.Height() {
+		return nil, errors.New("querying blocks from the db null")
+	}
 	bytez := s.db.Get(calcBlockKey(height))
 	if bytez == nil {
 		return nil, errors.New("querying blocks from the db null")
@@ -134,6 +142,9 @@ func (s *Store) GetSnapshot(ctx context.Context, height uint64) ([]byte, error)
 
 // SaveBlock persists a new block in the database.
 func (s *Store) SaveBlock(block *legacy.Block) error {
+	timer := slowlog.Start(slowlog.StoreWrite, "height", block.Height)
+	defer timer.Finish(nil)
+
 	s.cache.add(block)
 	height := block.Height
 
@@ -141,13 +152,17 @@ func (s *Store) SaveBlock(block *legacy.Block) error {
 	if err != nil {
 		PanicCrisis(Fmt("Error Marshal block meta: %v", err))
 	}
+	timer.Mark("marshal")
+	timer.Add("bytes", len(binaryBlock))
 	s.db.Set(calcBlockKey(height), binaryBlock)
+	timer.Mark("write")
 
 	// Save new BlockStoreStateJSON descriptor
 	BlockStoreStateJSON{Height: height}.Save(s.db)
 
 	// Flush
 	s.db.SetSync(nil, nil)
+	timer.Mark("sync")
 
 	return nil
 }
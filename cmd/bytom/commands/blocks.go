@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bytom/node"
+)
+
+var exportBlocksCmd = &cobra.Command{
+	Use:   "export-blocks <file> [start-height [end-height]]",
+	Short: "Write the blockchain to a block file while the node is stopped",
+	RunE:  exportBlocks,
+}
+
+var importBlocksCmd = &cobra.Command{
+	Use:   "import-blocks <file>",
+	Short: "Validate and add the blocks in a trusted block file while the node is stopped",
+	RunE:  importBlocks,
+}
+
+func init() {
+	RootCmd.AddCommand(exportBlocksCmd)
+	RootCmd.AddCommand(importBlocksCmd)
+}
+
+func exportBlocks(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return errors.New("export-blocks takes a file path and optional start and end heights")
+	}
+	var heights [2]uint64
+	for i, arg := range args[1:] {
+		h, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return err
+		}
+		heights[i] = h
+	}
+	n, err := node.ExportBlocks(config, args[0], heights[0], heights[1])
+	if err != nil {
+		return err
+	}
+	logger.Info("Exported blocks", "count", n, "file", args[0])
+	return nil
+}
+
+func importBlocks(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("import-blocks takes a file path")
+	}
+	n, err := node.ImportBlocks(config, args[0])
+	logger.Info("Imported blocks", "count", n, "file", args[0])
+	return err
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bytom/node"
+)
+
+var exportSnapshotCmd = &cobra.Command{
+	Use:   "export-snapshot <file>",
+	Short: "Write the latest stored state snapshot to a file while the node is stopped",
+	RunE:  exportSnapshot,
+}
+
+func init() {
+	RootCmd.AddCommand(exportSnapshotCmd)
+}
+
+func exportSnapshot(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("export-snapshot takes a file path")
+	}
+	f, err := node.ExportSnapshot(config, args[0])
+	if err != nil {
+		return err
+	}
+	logger.Info("Exported snapshot", "height", f.Height, "block", fmt.Sprintf("%x", f.BlockHash.Bytes()), "file", args[0])
+	return nil
+}
@@ -24,6 +24,8 @@ func init() {
 	runNodeCmd.Flags().Bool("p2p.skip_upnp", config.P2P.SkipUPNP, "Skip UPNP configuration")
 	runNodeCmd.Flags().Bool("p2p.pex", config.P2P.PexReactor, "Enable Peer-Exchange (dev feature)")
 
+	runNodeCmd.Flags().Bool("regtest", config.Regtest, "Run a regression test network, generating blocks on demand")
+
 	RootCmd.AddCommand(runNodeCmd)
 }
 
@@ -48,6 +50,17 @@ func runNode(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("not find genesis.json")
 	}
 
+	if config.Regtest {
+		// A regression test network is private: it dials no seeds and
+		// exchanges no addresses unless asked to on the command line.
+		if !cmd.Flags().Changed("p2p.seeds") {
+			config.P2P.Seeds = ""
+		}
+		if !cmd.Flags().Changed("p2p.pex") {
+			config.P2P.PexReactor = false
+		}
+	}
+
 	// Create & start node
 	n := node.NewNodeDefault(config, logger.With("module", "node_p2p"))
 	if _, err := n.Start(); err != nil {
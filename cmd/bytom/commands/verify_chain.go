@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bytom/node"
+)
+
+var verifyChainCmd = &cobra.Command{
+	Use:   "verify-chain",
+	Short: "Check the stored state against the blocks while the node is stopped",
+	RunE:  verifyChain,
+}
+
+func init() {
+	RootCmd.AddCommand(verifyChainCmd)
+}
+
+func verifyChain(cmd *cobra.Command, args []string) error {
+	r, err := node.VerifyChain(config)
+	if err != nil {
+		return err
+	}
+	logger.Info("Verified chain", "height", r.Height, "utxos", r.UTXOs)
+	for id, s := range r.Supply {
+		logger.Info("Asset supply", "asset", id, "issued", s.Issued, "retired", s.Retired, "unspent", s.Unspent)
+	}
+	for _, d := range r.Divergences {
+		logger.Error(d)
+	}
+	if len(r.Divergences) > 0 {
+		return fmt.Errorf("found %d divergences", len(r.Divergences))
+	}
+	return nil
+}
@@ -90,6 +90,11 @@ var commands = map[string]*command{
 	"sub-create-issue-tx":     {submitCreateIssueTransaction},
 	"reset-password":		   {resetPassword},
 	"update-alias":			   {updateAlias},
+	"generate":                {generate},
+	"export-blocks":           {exportBlocks},
+	"import-blocks":           {importBlocks},
+	"verify-chain":            {verifyChain},
+	"export-snapshot":         {exportSnapshot},
 }
 
 func main() {
@@ -954,3 +959,111 @@ func updateAlias(client *rpc.Client, args []string) {
 	key.XPub= *xpub
 	client.Call(context.Background(), "/update-alias", &key, nil)
 }
+
+func generate(client *rpc.Client, args []string) {
+	if len(args) != 2 {
+		fatalln("error: generate takes a block count and an account alias")
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil {
+		fatalln("error: generate %v", err)
+	}
+	req := struct {
+		Count        int    `json:"count"`
+		AccountAlias string `json:"account_alias"`
+	}{count, args[1]}
+	var resp struct {
+		BlockHashes []string `json:"block_hashes"`
+		Height      uint64   `json:"height"`
+	}
+	err = client.Call(context.Background(), "/generate", &req, &resp)
+	dieOnRPCError(err)
+	for _, h := range resp.BlockHashes {
+		fmt.Println(h)
+	}
+}
+
+func exportBlocks(client *rpc.Client, args []string) {
+	if len(args) < 1 || len(args) > 3 {
+		fatalln("error: export-blocks takes a file name and optional start and end heights")
+	}
+	var heights [2]uint64
+	for i, arg := range args[1:] {
+		h, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			fatalln("error: export-blocks %v", err)
+		}
+		heights[i] = h
+	}
+	req := struct {
+		Name        string `json:"name"`
+		StartHeight uint64 `json:"start_height"`
+		EndHeight   uint64 `json:"end_height"`
+	}{args[0], heights[0], heights[1]}
+	var resp struct {
+		Count uint64 `json:"count"`
+	}
+	err := client.Call(context.Background(), "/export-blocks", &req, &resp)
+	dieOnRPCError(err)
+	fmt.Printf("exported %d blocks to %s in the core's export directory\n", resp.Count, args[0])
+}
+
+func importBlocks(client *rpc.Client, args []string) {
+	if len(args) != 1 {
+		fatalln("error: import-blocks takes a file name")
+	}
+	req := struct {
+		Name string `json:"name"`
+	}{args[0]}
+	var resp struct {
+		Count  uint64 `json:"count"`
+		Height uint64 `json:"height"`
+	}
+	err := client.Call(context.Background(), "/import-blocks", &req, &resp)
+	dieOnRPCError(err)
+	fmt.Printf("imported %d blocks, height %d\n", resp.Count, resp.Height)
+}
+
+func verifyChain(client *rpc.Client, args []string) {
+	if len(args) != 0 {
+		fatalln("error: verify-chain takes no args")
+	}
+	var resp struct {
+		Height uint64 `json:"height"`
+		UTXOs  int    `json:"utxos"`
+		Supply map[string]struct {
+			Issued  uint64 `json:"issued"`
+			Retired uint64 `json:"retired"`
+			Unspent uint64 `json:"unspent"`
+		} `json:"supply"`
+		Divergences []string `json:"divergences"`
+	}
+	err := client.Call(context.Background(), "/verify-chain", nil, &resp)
+	dieOnRPCError(err)
+	fmt.Printf("height %d, %d unspent outputs\n", resp.Height, resp.UTXOs)
+	for id, s := range resp.Supply {
+		fmt.Printf("asset %s: issued %d, retired %d, unspent %d\n", id, s.Issued, s.Retired, s.Unspent)
+	}
+	for _, d := range resp.Divergences {
+		fmt.Println("divergence:", d)
+	}
+	if len(resp.Divergences) > 0 {
+		os.Exit(1)
+	}
+}
+
+func exportSnapshot(client *rpc.Client, args []string) {
+	if len(args) != 1 {
+		fatalln("error: export-snapshot takes a file name")
+	}
+	req := struct {
+		Name string `json:"name"`
+	}{args[0]}
+	var resp struct {
+		Height    uint64 `json:"height"`
+		BlockHash string `json:"block_hash"`
+	}
+	err := client.Call(context.Background(), "/export-snapshot", &req, &resp)
+	dieOnRPCError(err)
+	fmt.Printf("exported snapshot at height %d, block %s, to %s in the core's export directory\n", resp.Height, resp.BlockHash, args[0])
+}
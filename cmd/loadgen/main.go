@@ -0,0 +1,74 @@
+// Command loadgen generates a synthetic workload on a fresh chain and
+// prints how fast the chain validated and stored it.
+//
+// Usage:
+//
+//	loadgen [flags]
+//
+// By default the chain is kept in memory, measuring validation alone.
+// With -db, it is stored in a LevelDB database in that directory, which
+// must not hold a chain already, so storage is measured too.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/txdb"
+	"github.com/bytom/loadgen"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/prottest/memstore"
+)
+
+func main() {
+	config := loadgen.DefaultConfig()
+	flag.IntVar(&config.Blocks, "blocks", config.Blocks, "blocks to generate")
+	flag.IntVar(&config.TxsPerBlock, "txs", config.TxsPerBlock, "transactions per block")
+	flag.IntVar(&config.Inputs, "inputs", config.Inputs, "inputs per transaction")
+	flag.IntVar(&config.Outputs, "outputs", config.Outputs, "outputs per transaction")
+	flag.IntVar(&config.DataSize, "data", config.DataSize, "bytes of reference data per transaction")
+	flag.Uint64Var(&config.Fee, "fee", config.Fee, "fee paid by each transaction")
+	flag.IntVar(&config.Mix.Trivial, "trivial", config.Mix.Trivial, "weight of outputs paying to OP_TRUE")
+	flag.IntVar(&config.Mix.Hashlock, "hashlock", config.Mix.Hashlock, "weight of outputs locked by a hash preimage")
+	flag.IntVar(&config.Mix.Multisig, "multisig", config.Mix.Multisig, "weight of outputs needing 2 of 3 signatures")
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "random seed")
+	dir := flag.String("db", "", "store the chain in a LevelDB database in this directory")
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var store protocol.Store = memstore.New()
+	if *dir != "" {
+		db := dbm.NewDB("txdb", "leveldb", *dir)
+		defer db.Close()
+		s := txdb.NewStore(db)
+		if s.Height() > 0 {
+			fatalln("error: database in", *dir, "already holds a chain")
+		}
+		store = s
+	}
+
+	chain, txPool, err := loadgen.NewChain(ctx, store)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	g, err := loadgen.New(chain, txPool, config)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	r, err := g.Run(ctx)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	fmt.Print(r)
+}
+
+func fatalln(v ...interface{}) {
+	fmt.Fprintln(os.Stderr, v...)
+	os.Exit(2)
+}
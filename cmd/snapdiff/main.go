@@ -0,0 +1,75 @@
+// Command snapdiff compares two state snapshot files, exported with
+// export-snapshot from nodes that disagree about the state, and prints
+// the outputs, nonces and asset totals that differ.
+//
+// Usage:
+//
+//	snapdiff [flags] a.snap b.snap
+//
+// With -db, the outputs that differ are looked up in the blocks of a
+// stopped node's LevelDB database in that directory, to report the
+// assets and amounts they hold. Like diff, it exits with status 0 if
+// the snapshots are the same, 1 if they differ and 2 on error.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/snapdiff"
+	"github.com/bytom/blockchain/txdb"
+)
+
+func main() {
+	dir := flag.String("db", "", "resolve outputs in the blocks of the LevelDB database in this directory")
+	max := flag.Int("max", 10, "list at most this many IDs of each kind of difference")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: snapdiff [flags] a.snap b.snap")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a := readFile(flag.Arg(0))
+	b := readFile(flag.Arg(1))
+	r := snapdiff.Compare(a, b)
+	if *dir != "" && !r.Diff.Empty() {
+		db := dbm.NewDB("txdb", "leveldb", *dir)
+		err := r.Resolve(context.Background(), txdb.NewStore(db))
+		db.Close()
+		if err != nil {
+			fatalln("error:", err)
+		}
+	}
+	if err := r.WriteText(os.Stdout, *max); err != nil {
+		fatalln("error:", err)
+	}
+	if !r.Diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+func readFile(path string) *snapdiff.File {
+	f, err := os.Open(path)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	defer f.Close()
+	sf, err := snapdiff.Read(f)
+	if err != nil {
+		fatalln("error:", path, err)
+	}
+	return sf
+}
+
+func fatalln(v ...interface{}) {
+	fmt.Fprintln(os.Stderr, v...)
+	os.Exit(2)
+}
@@ -15,6 +15,10 @@ type Config struct {
 	// Options for services
 	RPC       *RPCConfig       `mapstructure:"rpc"`
 	P2P       *P2PConfig       `mapstructure:"p2p"`
+	SlowLog   *SlowLogConfig   `mapstructure:"slow_log"`
+	Federation *FederationConfig `mapstructure:"federation"`
+	Light      *LightConfig      `mapstructure:"light"`
+	Relay      *RelayConfig      `mapstructure:"relay"`
 }
 
 func DefaultConfig() *Config {
@@ -22,6 +26,10 @@ func DefaultConfig() *Config {
 		BaseConfig: DefaultBaseConfig(),
 		RPC:        DefaultRPCConfig(),
 		P2P:        DefaultP2PConfig(),
+		SlowLog:    DefaultSlowLogConfig(),
+		Federation: DefaultFederationConfig(),
+		Light:      DefaultLightConfig(),
+		Relay:      DefaultRelayConfig(),
 	}
 }
 
@@ -30,6 +38,10 @@ func TestConfig() *Config {
 		BaseConfig: TestBaseConfig(),
 		RPC:        TestRPCConfig(),
 		P2P:        TestP2PConfig(),
+		SlowLog:    TestSlowLogConfig(),
+		Federation: DefaultFederationConfig(),
+		Light:      DefaultLightConfig(),
+		Relay:      DefaultRelayConfig(),
 	}
 }
 
@@ -91,6 +103,14 @@ type BaseConfig struct {
 
 	ApiAddress string `mapstructure:"api_addr"`
 
+	// Directory the API exports files to and imports them from
+	ExportPath string `mapstructure:"export_dir"`
+
+	// Regtest runs a regression test network, with its own genesis
+	// block and P2P network name: blocks have trivial difficulty and
+	// are made only on demand, through /generate.
+	Regtest bool `mapstructure:"regtest"`
+
 	Time time.Time
 }
 
@@ -106,6 +126,7 @@ func DefaultBaseConfig() BaseConfig {
 		DBBackend:         "leveldb",
 		DBPath:            "data",
 		KeysPath:	   "keystore",
+		ExportPath:        "exports",
 		HsmUrl:		   "",
 	}
 }
@@ -130,6 +151,20 @@ func (b BaseConfig) KeysDir() string {
 	return rootify(b.KeysPath, b.RootDir)
 }
 
+func (b BaseConfig) ExportDir() string {
+	return rootify(b.ExportPath, b.RootDir)
+}
+
+// NetworkName returns the name peers must share to connect, which
+// keeps nodes of a regression test network apart from the main
+// network's.
+func (b BaseConfig) NetworkName() string {
+	if b.Regtest {
+		return "regtest"
+	}
+	return "chain0"
+}
+
 
 func DefaultLogLevel() string {
 	return "info"
@@ -206,6 +241,100 @@ func (p *P2PConfig) AddrBookFile() string {
 	return rootify(p.AddrBook, p.RootDir)
 }
 
+//-----------------------------------------------------------------------------
+// SlowLogConfig
+
+// SlowLogConfig holds the thresholds above which operations are logged
+// with a timing breakdown. A zero threshold disables logging for that
+// kind of operation.
+type SlowLogConfig struct {
+	BlockValidation time.Duration `mapstructure:"block_validation"`
+	SnapshotSave    time.Duration `mapstructure:"snapshot_save"`
+	StoreWrite      time.Duration `mapstructure:"store_write"`
+	APIRequest      time.Duration `mapstructure:"api_request"`
+}
+
+func DefaultSlowLogConfig() *SlowLogConfig {
+	return &SlowLogConfig{
+		BlockValidation: time.Second,
+		SnapshotSave:    5 * time.Second,
+		StoreWrite:      500 * time.Millisecond,
+		APIRequest:      2 * time.Second,
+	}
+}
+
+func TestSlowLogConfig() *SlowLogConfig {
+	conf := DefaultSlowLogConfig()
+	conf.BlockValidation = 0
+	conf.SnapshotSave = 0
+	conf.StoreWrite = 0
+	conf.APIRequest = 0
+	return conf
+}
+
+//-----------------------------------------------------------------------------
+// FederationConfig
+
+// FederationConfig makes this core a functionary of a federated
+// two-way peg, with this chain as the sidechain.
+type FederationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// The federation's root xpubs, in hex, and the number of them
+	// that must sign. Every functionary lists them in the same order.
+	XPubs  []string `mapstructure:"xpubs"`
+	Quorum int      `mapstructure:"quorum"`
+
+	// Mainchain blocks a peg-in must be buried under before it is
+	// minted.
+	Confirmations uint64 `mapstructure:"confirmations"`
+
+	// API address and access token of a core on the mainchain.
+	MainchainURL         string `mapstructure:"mainchain_url"`
+	MainchainAccessToken string `mapstructure:"mainchain_access_token"`
+}
+
+func DefaultFederationConfig() *FederationConfig {
+	return &FederationConfig{
+		Confirmations: 6,
+	}
+}
+
+//-----------------------------------------------------------------------------
+// LightConfig
+
+// LightConfig runs this core as a light client of a full node. It
+// syncs only block headers and compact filters, and submits
+// transactions through the full node.
+type LightConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// API address and access token of the full node.
+	FullNodeURL         string `mapstructure:"full_node_url"`
+	FullNodeAccessToken string `mapstructure:"full_node_access_token"`
+}
+
+func DefaultLightConfig() *LightConfig {
+	return &LightConfig{}
+}
+
+//-----------------------------------------------------------------------------
+// RelayConfig
+
+// RelayConfig makes this core prove transactions on another chain,
+// for programs here that check them with CHECKTXPROOF.
+type RelayConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// API address and access token of a core on the other chain.
+	ForeignChainURL         string `mapstructure:"foreign_chain_url"`
+	ForeignChainAccessToken string `mapstructure:"foreign_chain_access_token"`
+}
+
+func DefaultRelayConfig() *RelayConfig {
+	return &RelayConfig{}
+}
+
 //-----------------------------------------------------------------------------
 // Utils
 
@@ -40,6 +40,12 @@ laddr = "tcp://0.0.0.0:46657"
 [p2p]
 laddr = "tcp://0.0.0.0:46656"
 seeds = ""
+
+[slow_log]
+block_validation = "1s"
+snapshot_save = "5s"
+store_write = "500ms"
+api_request = "2s"
 `
 
 func defaultConfig(moniker string) string {
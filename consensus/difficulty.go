@@ -81,6 +81,10 @@ func BigToCompact(n *big.Int) uint64 {
 	return compact
 }
 
+// RegtestBits is the difficulty of blocks on a regression test
+// network. Every hash meets it, so any nonce solves a block.
+var RegtestBits = BigToCompact(new(big.Int).Lsh(big.NewInt(1), 256))
+
 func CheckProofOfWork(hash *bc.Hash, bits uint64) bool {
 	if HashToBig(hash).Cmp(CompactToBig(bits)) <= 0 {
 		return true
@@ -88,20 +92,37 @@ func CheckProofOfWork(hash *bc.Hash, bits uint64) bool {
 	return false
 }
 
+// CalcWork returns the work a block at difficulty bits proves: the
+// number of hashes it takes, on average, to find one at or below its
+// target. Every block proves at least one unit of work, so that
+// branches of regression test blocks compare by length.
+func CalcWork(bits uint64) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	work.Div(work, target.Add(target, big.NewInt(1)))
+	if work.Sign() == 0 {
+		work.SetInt64(1)
+	}
+	return work
+}
+
 func CalcNextRequiredDifficulty(lastBH, prevBH *legacy.BlockHeader) uint64 {
 	return uint64(2161727821138738707)
 
 	//TODO: test it and enable it
 	if lastBH == nil {
 		return powMinBits
-	} else if (lastBH.Height+1)%blocksPerRetarget != 0 {
+	} else if (lastBH.Height+1)%BlocksPerRetarget != 0 {
 		return lastBH.Bits
 	}
 
 	actualTimespan := int64(lastBH.Time().Sub(prevBH.Time()).Seconds())
 	oldTarget := CompactToBig(lastBH.Bits)
 	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(actualTimespan))
-	targetTimeSpan := int64(blocksPerRetarget * targetSecondsPerBlock)
+	targetTimeSpan := int64(BlocksPerRetarget * targetSecondsPerBlock)
 	newTarget.Div(newTarget, big.NewInt(targetTimeSpan))
 	newTargetBits := BigToCompact(newTarget)
 
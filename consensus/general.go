@@ -9,6 +9,10 @@ const (
 	MaxTxSize    = uint64(1024)
 	MaxBlockSzie = uint64(16384)
 
+	// MaxBlockTxs bounds the transactions in a block: each takes at
+	// least one byte of it.
+	MaxBlockTxs = MaxBlockSzie
+
 	//config parameter for coinbase reward
 	subsidyReductionInterval = uint64(560640)
 	baseSubsidy              = uint64(624000000000)
@@ -16,10 +20,22 @@ const (
 
 	// config for pow mining
 	powMinBits            = uint64(2161727821138738707)
-	blocksPerRetarget     = uint64(1024)
+	BlocksPerRetarget     = uint64(1024) // blocks between difficulty retargets
 	targetSecondsPerBlock = uint64(60)
 )
 
+// TxProofActivationHeight is the first block height at which the
+// CHECKTXPROOF instruction runs. Below it, its opcode is an expansion
+// opcode, as it was before the instruction was added, so nodes with
+// and without the instruction agree on blocks below it.
+const TxProofActivationHeight = uint64(100000)
+
+// IssuanceCapActivationHeight is the first block height at which the
+// maximum supply an issuance program declares is enforced. The supply
+// of a capped asset is counted from it, so a core upgraded below it
+// counts the same supply as one that synced from the genesis block.
+const IssuanceCapActivationHeight = uint64(100000)
+
 // define the BTM asset id, the soul asset of Bytom
 var BTMAssetID = &bc.AssetID{
 	V0: uint64(18446744073709551615),
@@ -38,3 +54,10 @@ func BlockSubsidy(height uint64) uint64 {
 func InitBlock() []byte {
 	return []byte("0301000000000000000000000000000000000000000000000000000000000000000000ece090e7eb2b4078a79ed5c640a026361c4af77a37342e503cc68493229996e11dd9be38b18f5b492159980684155da19e87de0d1b37b35c1a1123770ec1dcc710aabe77607cce00b1c5a181808080802e0107010700ece090e7eb2b000001012cffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff8080ccdee2a69fb314010151000000")
 }
+
+// RegtestInitBlock returns the genesis block of a regression test
+// network. It is InitBlock's block at RegtestBits, so a regression
+// test network shares no blocks with the main network.
+func RegtestInitBlock() []byte {
+	return []byte("0301000000000000000000000000000000000000000000000000000000000000000000ece090e7eb2b4078a79ed5c640a026361c4af77a37342e503cc68493229996e11dd9be38b18f5b492159980684155da19e87de0d1b37b35c1a1123770ec1dcc710aabe77607cce008080848080808080210107010700ece090e7eb2b000001012cffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff8080ccdee2a69fb314010151000000")
+}
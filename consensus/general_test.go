@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+
+	"github.com/bytom/protocol/bc/legacy"
 )
 
 func TestCalcNextRequiredDifficulty(t *testing.T) {
@@ -13,6 +15,40 @@ func TestCalcNextRequiredDifficulty(t *testing.T) {
 	fmt.Println(BigToCompact(y))
 }
 
+func TestCalcWork(t *testing.T) {
+	if work := CalcWork(RegtestBits); work.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("work of a regtest block = %s, want 1", work)
+	}
+	// A target of 2^255-1 is met by half of all hashes.
+	half := BigToCompact(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)))
+	if work := CalcWork(half); work.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("work of a block at target 2^255-1 = %s, want 2", work)
+	}
+	if CalcWork(powMinBits).Cmp(CalcWork(half)) <= 0 {
+		t.Error("work does not grow with difficulty")
+	}
+}
+
+func TestRegtestInitBlock(t *testing.T) {
+	var main, regtest legacy.Block
+	if err := main.UnmarshalText(InitBlock()); err != nil {
+		t.Fatal(err)
+	}
+	if err := regtest.UnmarshalText(RegtestInitBlock()); err != nil {
+		t.Fatal(err)
+	}
+	if regtest.Bits != RegtestBits {
+		t.Errorf("regtest genesis bits = %d, want %d", regtest.Bits, RegtestBits)
+	}
+	if regtest.Hash() == main.Hash() {
+		t.Error("regtest genesis block is the main network's")
+	}
+	regtest.Bits = main.Bits
+	if regtest.Hash() != main.Hash() {
+		t.Error("regtest genesis block differs from the main network's in more than its bits")
+	}
+}
+
 /*func TestSubsidy(t *testing.T) {
 	cases := []struct {
 		bh      *BlockHeader
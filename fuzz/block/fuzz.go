@@ -0,0 +1,44 @@
+// Package block fuzzes block decoding. See package fuzz.
+package block
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Fuzz decodes data, the binary encoding of a block, the way a core
+// decodes a block from a peer or its store: hex-encoded, with
+// UnmarshalText. It then maps the block to the entries validation
+// checks, and checks that it re-encodes stably.
+func Fuzz(data []byte) int {
+	var b legacy.Block
+	if err := b.UnmarshalText(hexText(data)); err != nil {
+		return 0
+	}
+	legacy.MapBlock(&b)
+
+	enc, err := b.MarshalText()
+	if err != nil {
+		panic(fmt.Sprintf("encoding decoded block: %v", err))
+	}
+	var again legacy.Block
+	if err := again.UnmarshalText(enc); err != nil {
+		panic(fmt.Sprintf("decoding re-encoded block: %v", err))
+	}
+	if again.Hash() != b.Hash() {
+		panic("re-encoded block has a different hash")
+	}
+	if enc2, _ := again.MarshalText(); !bytes.Equal(enc, enc2) {
+		panic("block encoding is not stable")
+	}
+	return 1
+}
+
+func hexText(data []byte) []byte {
+	text := make([]byte, hex.EncodedLen(len(data)))
+	hex.Encode(text, data)
+	return text
+}
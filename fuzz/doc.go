@@ -0,0 +1,20 @@
+// Package fuzz holds entry points for fuzzing the decoding and
+// execution paths a core runs on data from its peers, in the form
+// go-fuzz expects:
+//
+//	fuzz/block    blocks, as read from peers and the store
+//	fuzz/tx       transactions, as submitted and relayed
+//	fuzz/message  blockchain reactor p2p messages
+//	fuzz/program  VM programs and their arguments
+//
+// Each package has a Fuzz function and a seed corpus. To fuzz
+// blocks, for example:
+//
+//	go-fuzz-build github.com/bytom/fuzz/block
+//	go-fuzz -bin=block-fuzz.zip -workdir=$GOPATH/src/github.com/bytom/fuzz/block
+//
+// Fuzz functions return 1 for input that decodes, so the fuzzer
+// favors it, and 0 otherwise. They panic when decoded data breaks an
+// invariant, such as encoding to a form that does not decode back to
+// it.
+package fuzz
@@ -0,0 +1,28 @@
+// Package message fuzzes the blockchain reactor's p2p message
+// decoding. See package fuzz.
+package message
+
+import (
+	"github.com/bytom/blockchain"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Fuzz decodes data as the reactor decodes a message from a peer,
+// and decodes the block or transaction a message carries.
+func Fuzz(data []byte) int {
+	_, msg, err := blockchain.DecodeMessage(data)
+	if err != nil {
+		return 0
+	}
+	switch msg := msg.(type) {
+	case interface {
+		GetBlock() *legacy.Block
+	}:
+		msg.GetBlock()
+	case interface {
+		GetTransaction() *legacy.Tx
+	}:
+		msg.GetTransaction()
+	}
+	return 1
+}
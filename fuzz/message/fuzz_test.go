@@ -0,0 +1,24 @@
+package message
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestCorpus runs Fuzz on each seed, so seeds that panic fail
+// ordinary test runs.
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob("corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Fuzz(data)
+	}
+	Fuzz(nil)
+}
@@ -0,0 +1,78 @@
+// Package program fuzzes VM program execution. See package fuzz.
+package program
+
+import (
+	"github.com/bytom/protocol/validation"
+	"github.com/bytom/protocol/vm"
+)
+
+// runLimit bounds the cost of running one program, as a
+// transaction's gas does.
+const runLimit = 10000
+
+// Fuzz runs data as a program: its first byte is the number of
+// arguments, each argument is a length byte followed by that many
+// bytes, and the rest is the program. The program runs in a context
+// with every field present, so introspection instructions run too.
+// Fuzz also disassembles the program, as the API does to show it.
+func Fuzz(data []byte) int {
+	args, prog, ok := split(data)
+	if !ok {
+		return 0
+	}
+	vm.Disassemble(prog)
+
+	var (
+		version   = uint64(1)
+		zero      = uint64(0)
+		amount    = uint64(100)
+		numbers   = uint64(2)
+		hash      = make([]byte, 32)
+		entryData = []byte("entry")
+		txData    = []byte("tx")
+	)
+	context := &vm.Context{
+		VMVersion:     1,
+		Code:          prog,
+		Arguments:     args,
+		EntryID:       hash,
+		TxVersion:     &version,
+		BlockHeigh:    &numbers,
+		NumResults:    &numbers,
+		AssetID:       &hash,
+		Amount:        &amount,
+		MinTimeMS:     &zero,
+		MaxTimeMS:     &amount,
+		EntryData:     &entryData,
+		TxData:        &txData,
+		DestPos:       &zero,
+		AnchorID:      &hash,
+		SpentOutputID: &hash,
+		TxSigHash:     func() []byte { return hash },
+		CheckOutput: func(uint64, []byte, uint64, []byte, uint64, []byte, bool) (bool, error) {
+			return false, nil
+		},
+		CheckTxProof: validation.CheckTxProof,
+	}
+	if _, err := vm.Verify(context, runLimit); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// split splits data into arguments and a program.
+func split(data []byte) (args [][]byte, prog []byte, ok bool) {
+	if len(data) == 0 {
+		return nil, nil, false
+	}
+	n := int(data[0])
+	data = data[1:]
+	for i := 0; i < n; i++ {
+		if len(data) == 0 || len(data) < 1+int(data[0]) {
+			return nil, nil, false
+		}
+		args = append(args, data[1:1+int(data[0])])
+		data = data[1+int(data[0]):]
+	}
+	return args, data, true
+}
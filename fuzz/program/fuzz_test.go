@@ -0,0 +1,31 @@
+package program
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestCorpus runs Fuzz on each seed. The programs that need real
+// signatures or proofs fail, but must not panic.
+func TestCorpus(t *testing.T) {
+	succeed := map[string]bool{
+		"true":          true,
+		"arithmetic":    true,
+		"introspection": true,
+		"loop":          true,
+	}
+	files, err := filepath.Glob("corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Fuzz(data) == 1; got != succeed[filepath.Base(f)] {
+			t.Errorf("%s: program succeeded = %v, want %v", f, got, !got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package tx fuzzes transaction decoding and validation. See package
+// fuzz.
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/validation"
+)
+
+// genesis is the block transactions are validated against.
+var genesis *bc.Block
+
+func init() {
+	b := new(legacy.Block)
+	if err := b.UnmarshalText(consensus.InitBlock()); err != nil {
+		panic(err)
+	}
+	genesis = legacy.MapBlock(b)
+}
+
+// Fuzz decodes data, the binary encoding of a transaction, the way a
+// core decodes a transaction submitted to it or relayed by a peer:
+// hex-encoded, with UnmarshalText. It then validates the transaction,
+// and checks that it re-encodes stably.
+func Fuzz(data []byte) int {
+	var tx legacy.Tx
+	if err := tx.UnmarshalText(hexText(data)); err != nil {
+		return 0
+	}
+	validation.ValidateTx(tx.Tx, genesis)
+
+	enc, err := tx.MarshalText()
+	if err != nil {
+		panic(fmt.Sprintf("encoding decoded transaction: %v", err))
+	}
+	var again legacy.Tx
+	if err := again.UnmarshalText(enc); err != nil {
+		panic(fmt.Sprintf("decoding re-encoded transaction: %v", err))
+	}
+	if again.ID != tx.ID {
+		panic("re-encoded transaction has a different ID")
+	}
+	if enc2, _ := again.MarshalText(); !bytes.Equal(enc, enc2) {
+		panic("transaction encoding is not stable")
+	}
+	return 1
+}
+
+func hexText(data []byte) []byte {
+	text := make([]byte, hex.EncodedLen(len(data)))
+	hex.Encode(text, data)
+	return text
+}
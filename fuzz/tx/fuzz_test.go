@@ -0,0 +1,31 @@
+package tx
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestCorpus runs Fuzz on each seed, each of which is a valid
+// transaction.
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob("corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no seeds")
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Fuzz(data) != 1 {
+			t.Errorf("%s does not decode", f)
+		}
+	}
+	if Fuzz(nil) != 0 {
+		t.Error("empty input decodes")
+	}
+}
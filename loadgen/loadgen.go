@@ -0,0 +1,483 @@
+// Package loadgen generates synthetic transaction workloads on a test
+// chain and reports how fast the chain validates and stores them, so
+// performance regressions in validation and storage are measurable.
+//
+// A Generator funds a pool of outputs from coinbases, then makes
+// blocks of transactions spending them. The shape of the workload is
+// set by a Config: how many transactions go in each block, how many
+// inputs and outputs each has, how much reference data it carries,
+// and the mix of control programs its outputs pay to. Every
+// transaction is valid and every program is satisfied, so the chain
+// does the same work it would for real traffic.
+package loadgen
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
+)
+
+// fanOut is the number of outputs each funding transaction makes
+// from a coinbase. It is kept small so funding transactions stay
+// under consensus.MaxTxSize with any program mix.
+const fanOut = 4
+
+var (
+	// ErrBadConfig is returned for a Config that describes no
+	// workload.
+	ErrBadConfig = errors.New("invalid load generator config")
+
+	// ErrTxTooLarge is returned when the configured transactions
+	// exceed consensus.MaxTxSize.
+	ErrTxTooLarge = errors.New("generated transaction too large")
+)
+
+// Config describes a workload.
+type Config struct {
+	Blocks      int // blocks to generate
+	TxsPerBlock int // transactions offered for each block
+	Inputs      int // inputs per transaction
+	Outputs     int // outputs per transaction
+	DataSize    int // bytes of reference data per transaction
+
+	// Fee is paid by each transaction. It buys the gas its programs
+	// use, at one unit per 1000.
+	Fee uint64
+
+	Mix  Mix
+	Seed int64
+}
+
+// Mix weighs the kinds of control programs outputs pay to.
+type Mix struct {
+	Trivial  int // OP_TRUE
+	Hashlock int // revealing a SHA3 preimage
+	Multisig int // 2 of 3 signatures, as accounts use
+}
+
+// DefaultConfig returns a workload of one-in, two-out transactions
+// paying to an even mix of programs. Two inputs that need signatures
+// do not fit in a transaction of consensus.MaxTxSize.
+func DefaultConfig() Config {
+	return Config{
+		Blocks:      10,
+		TxsPerBlock: 20,
+		Inputs:      1,
+		Outputs:     2,
+		Fee:         20000000,
+		Mix:         Mix{Trivial: 1, Hashlock: 1, Multisig: 1},
+		Seed:        1,
+	}
+}
+
+func (c Config) check() error {
+	if c.Blocks < 1 || c.TxsPerBlock < 1 || c.Inputs < 1 || c.Outputs < 1 || c.DataSize < 0 {
+		return errors.WithDetail(ErrBadConfig, "blocks, transactions per block, inputs and outputs must be positive")
+	}
+	m := c.Mix
+	if m.Trivial < 0 || m.Hashlock < 0 || m.Multisig < 0 || m.Trivial+m.Hashlock+m.Multisig == 0 {
+		return errors.WithDetail(ErrBadConfig, "the program mix must have a positive weight")
+	}
+	return nil
+}
+
+type programKind int
+
+const (
+	trivial programKind = iota
+	hashlock
+	multisig
+)
+
+// A utxo is an output the generator can spend.
+type utxo struct {
+	out  *bc.Output
+	kind programKind
+}
+
+// Generator makes workloads on a chain.
+type Generator struct {
+	config Config
+	chain  *protocol.Chain
+	txPool *protocol.TxPool
+	rand   *rand.Rand
+
+	keys     []ed25519.PrivateKey
+	preimage []byte
+	progs    [3][]byte
+
+	utxos   []*utxo
+	pending map[bc.Hash]bool // transactions not yet in a block
+}
+
+// NewChain returns a chain stored in store, which must be empty,
+// holding only the genesis block, and its transaction pool. Nothing
+// relays the pool's new transactions, so they are drained until ctx
+// is done.
+func NewChain(ctx context.Context, store protocol.Store) (*protocol.Chain, *protocol.TxPool, error) {
+	genesis := new(legacy.Block)
+	if err := genesis.UnmarshalText(consensus.InitBlock()); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding genesis block")
+	}
+	txPool := protocol.NewTxPool()
+	chain, err := protocol.NewChain(ctx, genesis.Hash(), store, txPool, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := chain.AddBlock(ctx, genesis); err != nil {
+		return nil, nil, errors.Wrap(err, "adding genesis block")
+	}
+
+	// Drain the new transactions before the channel fills and blocks
+	// the pool.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-txPool.GetNewTxCh():
+			}
+		}
+	}()
+	return chain, txPool, nil
+}
+
+// New returns a generator making config's workload on chain, which
+// must hold only its genesis block, adding transactions to txPool.
+// The caller drains txPool's new-transaction channel, as NewChain
+// does.
+func New(chain *protocol.Chain, txPool *protocol.TxPool, config Config) (*Generator, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		config:   config,
+		chain:    chain,
+		txPool:   txPool,
+		rand:     rand.New(rand.NewSource(config.Seed)),
+		preimage: []byte("loadgen preimage"),
+		pending:  make(map[bc.Hash]bool),
+	}
+	if err := g.makePrograms(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Chain returns the chain the generator works on.
+func (g *Generator) Chain() *protocol.Chain {
+	return g.chain
+}
+
+func (g *Generator) makePrograms() error {
+	var pubkeys []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(g.rand)
+		if err != nil {
+			return err
+		}
+		pubkeys = append(pubkeys, pub)
+		g.keys = append(g.keys, priv)
+	}
+
+	var err error
+	g.progs[trivial] = []byte{byte(vm.OP_TRUE)}
+
+	var h [32]byte
+	sha3pool.Sum256(h[:], g.preimage)
+	g.progs[hashlock], err = vmutil.NewBuilder().AddOp(vm.OP_SHA3).AddData(h[:]).AddOp(vm.OP_EQUAL).Build()
+	if err != nil {
+		return err
+	}
+
+	g.progs[multisig], err = vmutil.P2SPMultiSigProgram(pubkeys, 2)
+	return err
+}
+
+// pickKind chooses a program kind by the config's mix.
+func (g *Generator) pickKind() programKind {
+	m := g.config.Mix
+	n := g.rand.Intn(m.Trivial + m.Hashlock + m.Multisig)
+	switch {
+	case n < m.Trivial:
+		return trivial
+	case n < m.Trivial+m.Hashlock:
+		return hashlock
+	default:
+		return multisig
+	}
+}
+
+// arguments returns the witness arguments spending an output of kind
+// from input n of tx.
+func (g *Generator) arguments(tx *legacy.Tx, n uint32, kind programKind) ([][]byte, error) {
+	switch kind {
+	case hashlock:
+		return [][]byte{g.preimage}, nil
+	case multisig:
+		h := tx.SigHash(n)
+		pred, err := vmutil.NewBuilder().AddData(h.Bytes()).AddOp(vm.OP_TXSIGHASH).AddOp(vm.OP_EQUAL).Build()
+		if err != nil {
+			return nil, err
+		}
+		var msg [32]byte
+		sha3pool.Sum256(msg[:], pred)
+		return [][]byte{
+			vm.Int64Bytes(0),
+			ed25519.Sign(g.keys[0], msg[:]),
+			ed25519.Sign(g.keys[1], msg[:]),
+			pred,
+		}, nil
+	}
+	return nil, nil
+}
+
+// buildTx returns a transaction spending ins to n outputs of kinds
+// chosen by the mix, with size bytes of reference data.
+func (g *Generator) buildTx(ins []*utxo, n, size int) (*legacy.Tx, error) {
+	var total uint64
+	data := &legacy.TxData{Version: 1}
+	for _, in := range ins {
+		value := in.out.Source.Value
+		total += value.Amount
+		data.Inputs = append(data.Inputs, legacy.NewSpendInput(nil, *in.out.Source.Ref, *value.AssetId, value.Amount, in.out.Source.Position, in.out.ControlProgram.Code, *in.out.Data, nil))
+	}
+	total -= g.config.Fee
+	for i := 0; i < n; i++ {
+		amount := total / uint64(n)
+		if i == n-1 {
+			amount = total - amount*uint64(n-1)
+		}
+		data.Outputs = append(data.Outputs, legacy.NewTxOutput(*consensus.BTMAssetID, amount, g.progs[g.pickKind()], nil))
+	}
+	if size > 0 {
+		data.ReferenceData = make([]byte, size)
+		g.rand.Read(data.ReferenceData)
+	}
+
+	tx := legacy.NewTx(*data)
+	for i, in := range ins {
+		args, err := g.arguments(tx, uint32(i), in.kind)
+		if err != nil {
+			return nil, err
+		}
+		tx.SetInputArguments(uint32(i), args)
+	}
+
+	// Round trip the transaction so it carries its serialized size,
+	// as one received from a peer does.
+	raw, err := tx.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	tx = new(legacy.Tx)
+	if err := tx.UnmarshalText(raw); err != nil {
+		return nil, err
+	}
+	if size := tx.SerializedSize; size > consensus.MaxTxSize {
+		return nil, errors.WithDetailf(ErrTxTooLarge, "%d bytes, limit %d", size, consensus.MaxTxSize)
+	}
+	return tx, nil
+}
+
+// submit validates tx and adds it to the pool.
+func (g *Generator) submit(tx *legacy.Tx) error {
+	if err := g.chain.ValidateTx(tx); err != nil {
+		return errors.Wrapf(err, "validating transaction %x", tx.ID.Bytes())
+	}
+	g.pending[tx.ID] = true
+	return nil
+}
+
+// addBlock makes a block of the pool's transactions, timing the
+// template and adding the block separately if r is not nil. The
+// outputs of the generator's transactions in the block go to the
+// spendable pool; its coinbase is returned.
+func (g *Generator) addBlock(ctx context.Context, r *Report) (*legacy.Block, *utxo, error) {
+	prev, _ := g.chain.State()
+	for bc.Millis(time.Now()) <= prev.TimestampMS {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Coinbases with the same amount and program have the same
+	// output ID, so each pays to a program unique to its height.
+	cbProg, err := vmutil.NewBuilder().AddInt64(int64(prev.Height + 1)).AddOp(vm.OP_DROP).AddOp(vm.OP_TRUE).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	b, err := mining.NewBlockTemplate(g.chain, g.txPool, cbProg)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.Bits = consensus.RegtestBits
+	for hash := b.Hash(); !consensus.CheckProofOfWork(&hash, b.Bits); hash = b.Hash() {
+		b.Nonce++
+	}
+	added := time.Now()
+	if err := g.chain.AddBlock(ctx, b); err != nil {
+		return nil, nil, errors.Wrapf(err, "adding block %d", b.Height)
+	}
+	if r != nil {
+		r.BlockTemplate += added.Sub(start)
+		r.BlockAdd += time.Since(added)
+	}
+
+	for _, tx := range b.Transactions[1:] {
+		if !g.pending[tx.ID] {
+			continue
+		}
+		delete(g.pending, tx.ID)
+		for _, id := range tx.ResultIds {
+			out, err := tx.Output(*id)
+			if err != nil {
+				return nil, nil, err
+			}
+			g.utxos = append(g.utxos, &utxo{out: out, kind: g.kindOf(out.ControlProgram.Code)})
+		}
+	}
+	// Transactions the template dropped as invalid will never
+	// confirm.
+	for id := range g.pending {
+		if !g.txPool.IsTransactionInPool(&id) {
+			delete(g.pending, id)
+		}
+	}
+
+	cb := b.Transactions[0]
+	out, err := cb.Output(*cb.ResultIds[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, &utxo{out: out, kind: trivial}, nil
+}
+
+func (g *Generator) kindOf(prog []byte) programKind {
+	for kind, p := range g.progs {
+		if string(p) == string(prog) {
+			return programKind(kind)
+		}
+	}
+	return trivial
+}
+
+// fund mines coinbases and fans each out to several outputs until the
+// pool has at least n outputs.
+func (g *Generator) fund(ctx context.Context, n int) error {
+	for len(g.utxos) < n {
+		var coinbases []*utxo
+		for i := 0; i < (n-len(g.utxos)+fanOut-1)/fanOut; i++ {
+			_, cb, err := g.addBlock(ctx, nil)
+			if err != nil {
+				return err
+			}
+			coinbases = append(coinbases, cb)
+		}
+		for _, cb := range coinbases {
+			tx, err := g.buildTx([]*utxo{cb}, fanOut, 0)
+			if err != nil {
+				return err
+			}
+			if err := g.submit(tx); err != nil {
+				return err
+			}
+		}
+		if _, _, err := g.addBlock(ctx, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeInputs removes inputs for one transaction from the pool,
+// dropping outputs too small to pay the fee. It returns nil if the
+// pool runs out.
+func (g *Generator) takeInputs() []*utxo {
+	var ins []*utxo
+	for len(g.utxos) > 0 && len(ins) < g.config.Inputs {
+		u := g.utxos[0]
+		g.utxos = g.utxos[1:]
+		if u.out.Source.Value.Amount > g.config.Fee+uint64(g.config.Outputs) {
+			ins = append(ins, u)
+		}
+	}
+	if len(ins) < g.config.Inputs {
+		g.utxos = append(ins, g.utxos...)
+		return nil
+	}
+	return ins
+}
+
+// Run generates the configured workload and reports its throughput.
+// Funding the workload is not measured.
+func (g *Generator) Run(ctx context.Context) (*Report, error) {
+	c := g.config
+	if err := g.fund(ctx, c.TxsPerBlock*c.Inputs); err != nil {
+		return nil, errors.Wrap(err, "funding")
+	}
+
+	r := new(Report)
+	var funding time.Duration
+	start := time.Now()
+	for i := 0; i < c.Blocks; i++ {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+
+		// Transactions that did not fit in the last block are
+		// offered again, so the pool holds one block's worth.
+		for len(g.pending) < c.TxsPerBlock {
+			ins := g.takeInputs()
+			if ins == nil {
+				if len(g.pending) > 0 {
+					// The block's outputs refill the pool.
+					break
+				}
+				fundStart := time.Now()
+				if err := g.fund(ctx, c.Inputs); err != nil {
+					return r, errors.Wrap(err, "funding")
+				}
+				funding += time.Since(fundStart)
+				continue
+			}
+			tx, err := g.buildTx(ins, c.Outputs, c.DataSize)
+			if err != nil {
+				return r, err
+			}
+			validated := time.Now()
+			if err := g.submit(tx); err != nil {
+				return r, err
+			}
+			r.TxValidation += time.Since(validated)
+			r.TxsValidated++
+		}
+
+		b, cb, err := g.addBlock(ctx, r)
+		if err != nil {
+			return r, err
+		}
+		g.utxos = append(g.utxos, cb)
+		r.Blocks++
+		for _, tx := range b.Transactions[1:] {
+			r.Txs++
+			r.Inputs += len(tx.Inputs)
+			r.Outputs += len(tx.Outputs)
+			r.Bytes += tx.SerializedSize
+		}
+	}
+	r.Elapsed = time.Since(start) - funding
+	return r, nil
+}
@@ -0,0 +1,64 @@
+package loadgen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/prottest"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := DefaultConfig()
+	config.Blocks = 3
+	config.TxsPerBlock = 5
+	config.DataSize = 32
+	c := prottest.NewChain(t)
+	g, err := New(c, prottest.TxPool(c), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := g.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Blocks != 3 || r.Txs != 15 || r.Inputs != 15 || r.Outputs != 30 {
+		t.Errorf("report = %+v", r)
+	}
+
+	// Every kind of program was spent.
+	var spent [3]bool
+	for h := uint64(1); h <= g.Chain().Height(); h++ {
+		b, err := g.Chain().GetBlock(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range b.Transactions {
+			for _, in := range tx.Inputs {
+				spent[g.kindOf(in.ControlProgram())] = true
+			}
+		}
+	}
+	if spent != [3]bool{true, true, true} {
+		t.Errorf("spent program kinds = %v", spent)
+	}
+}
+
+func TestRunTooLarge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := DefaultConfig()
+	config.DataSize = 2048
+	c := prottest.NewChain(t)
+	g, err := New(c, prottest.TxPool(c), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Run(ctx); errors.Root(err) != ErrTxTooLarge {
+		t.Errorf("got error %v, want %v", err, ErrTxTooLarge)
+	}
+}
@@ -0,0 +1,45 @@
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Report is the work a generator's run did and how long it took.
+type Report struct {
+	Blocks       int
+	Txs          int // transactions included in blocks
+	TxsValidated int // transactions validated on submission
+	Inputs       int
+	Outputs      int
+	Bytes        uint64 // serialized size of the included transactions
+
+	TxValidation  time.Duration // validating transactions for the pool
+	BlockTemplate time.Duration // making blocks from the pool
+	BlockAdd      time.Duration // validating, applying and storing blocks
+	Elapsed       time.Duration
+}
+
+func perSecond(n float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return n / d.Seconds()
+}
+
+// String formats the report's throughput for people.
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d blocks, %d transactions, %d inputs, %d outputs, %d bytes in %s\n",
+		r.Blocks, r.Txs, r.Inputs, r.Outputs, r.Bytes, r.Elapsed)
+	fmt.Fprintf(&buf, "transaction validation: %8.1f tx/s (%s)\n",
+		perSecond(float64(r.TxsValidated), r.TxValidation), r.TxValidation)
+	fmt.Fprintf(&buf, "block templates:        %8.1f blocks/s (%s)\n",
+		perSecond(float64(r.Blocks), r.BlockTemplate), r.BlockTemplate)
+	fmt.Fprintf(&buf, "block validation:       %8.1f blocks/s, %.1f tx/s, %.1f KB/s (%s)\n",
+		perSecond(float64(r.Blocks), r.BlockAdd), perSecond(float64(r.Txs), r.BlockAdd),
+		perSecond(float64(r.Bytes)/1024, r.BlockAdd), r.BlockAdd)
+	fmt.Fprintf(&buf, "overall:                %8.1f tx/s\n", perSecond(float64(r.Txs), r.Elapsed))
+	return buf.String()
+}
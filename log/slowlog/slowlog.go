@@ -0,0 +1,143 @@
+// Package slowlog logs operations that take longer than a
+// configurable threshold, together with a breakdown of where
+// the time was spent.
+//
+// A caller starts a Timer for a named operation, marks the end of
+// each interesting stage as it goes, and calls Finish when done.
+// If the total elapsed time exceeds the threshold for that
+// operation, a single log entry is written containing the total,
+// the duration of every stage, and any context key-value pairs
+// supplied by the caller. Fast operations produce no output.
+package slowlog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cfg "github.com/bytom/config"
+	"github.com/bytom/log"
+)
+
+// Operation names with thresholds in config.SlowLogConfig.
+const (
+	BlockValidation = "block-validation"
+	SnapshotSave    = "snapshot-save"
+	StoreWrite      = "store-write"
+	APIRequest      = "api-request"
+)
+
+// KeySlowOp is the log key under which the operation name is
+// written, so slow-op entries can be found with a single search.
+const KeySlowOp = "slow-op"
+
+var (
+	thresholdsMu sync.RWMutex
+	thresholds   = make(map[string]time.Duration)
+)
+
+func init() {
+	log.SkipFunc("github.com/bytom/log/slowlog.(*Timer).Finish")
+	Configure(cfg.DefaultSlowLogConfig())
+}
+
+// Configure sets the thresholds of the operations named above
+// from conf.
+func Configure(conf *cfg.SlowLogConfig) {
+	SetThreshold(BlockValidation, conf.BlockValidation)
+	SetThreshold(SnapshotSave, conf.SnapshotSave)
+	SetThreshold(StoreWrite, conf.StoreWrite)
+	SetThreshold(APIRequest, conf.APIRequest)
+}
+
+// SetThreshold sets the duration above which op is logged.
+// A zero or negative duration disables logging for op.
+func SetThreshold(op string, d time.Duration) {
+	thresholdsMu.Lock()
+	defer thresholdsMu.Unlock()
+	thresholds[op] = d
+}
+
+// Threshold returns the current threshold for op.
+// Unknown operations have a zero threshold, which
+// means they are never logged.
+func Threshold(op string) time.Duration {
+	thresholdsMu.RLock()
+	defer thresholdsMu.RUnlock()
+	return thresholds[op]
+}
+
+type stage struct {
+	name string
+	d    time.Duration
+}
+
+// A Timer measures a single run of an operation.
+// It is not safe for concurrent use.
+type Timer struct {
+	op      string
+	start   time.Time
+	last    time.Time
+	stages  []stage
+	keyvals []interface{}
+}
+
+// Start begins timing op. The optional keyval pairs are
+// included in the log entry if the operation turns out
+// to be slow.
+func Start(op string, keyval ...interface{}) *Timer {
+	now := time.Now()
+	return &Timer{
+		op:      op,
+		start:   now,
+		last:    now,
+		keyvals: keyval,
+	}
+}
+
+// Mark records the time spent since the previous mark
+// (or since Start) under the given stage name.
+func (t *Timer) Mark(name string) {
+	now := time.Now()
+	t.stages = append(t.stages, stage{name: name, d: now.Sub(t.last)})
+	t.last = now
+}
+
+// Add appends more context key-value pairs to the
+// eventual log entry, for details that only become known
+// partway through the operation.
+func (t *Timer) Add(keyval ...interface{}) {
+	t.keyvals = append(t.keyvals, keyval...)
+}
+
+// Elapsed returns the time since Start.
+func (t *Timer) Elapsed() time.Duration {
+	return time.Since(t.start)
+}
+
+// Finish stops the timer and, if the operation exceeded its
+// threshold, writes a log entry describing it. It reports
+// whether the operation was slow.
+func (t *Timer) Finish(ctx context.Context) bool {
+	elapsed := t.Elapsed()
+	limit := Threshold(t.op)
+	if limit <= 0 || elapsed <= limit {
+		return false
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	keyvals := make([]interface{}, 0, 6+2*len(t.stages)+len(t.keyvals))
+	keyvals = append(keyvals,
+		KeySlowOp, t.op,
+		"elapsed", elapsed,
+		"threshold", limit,
+	)
+	for _, s := range t.stages {
+		keyvals = append(keyvals, "stage."+s.name, s.d)
+	}
+	keyvals = append(keyvals, t.keyvals...)
+	log.Printkv(ctx, keyvals...)
+	return true
+}
@@ -0,0 +1,75 @@
+package slowlog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/bytom/config"
+	"github.com/bytom/log"
+)
+
+func TestFinishBelowThreshold(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stdout)
+
+	SetThreshold("test-fast", time.Hour)
+	timer := Start("test-fast", "height", 1)
+	timer.Mark("only")
+	if timer.Finish(context.Background()) {
+		t.Error("Finish reported a slow op below the threshold")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("log output = %q want empty", buf.String())
+	}
+}
+
+func TestFinishAboveThreshold(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stdout)
+
+	SetThreshold("test-slow", time.Nanosecond)
+	timer := Start("test-slow", "height", 7)
+	time.Sleep(time.Millisecond)
+	timer.Mark("validate")
+	timer.Add("txs", 3)
+	if !timer.Finish(nil) {
+		t.Fatal("Finish did not report a slow op above the threshold")
+	}
+
+	got := buf.String()
+	for _, want := range []string{"slow-op=test-slow", "stage.validate=", "height=7", "txs=3", "elapsed="} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log output = %q, should contain %q", got, want)
+		}
+	}
+}
+
+func TestDisabledThreshold(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stdout)
+
+	SetThreshold("test-disabled", 0)
+	timer := Start("test-disabled")
+	time.Sleep(time.Millisecond)
+	if timer.Finish(context.Background()) {
+		t.Error("Finish reported a slow op with logging disabled")
+	}
+	if Threshold("test-unknown") != 0 {
+		t.Error("unknown operation has a non-zero threshold")
+	}
+}
+
+func TestDefaultThresholds(t *testing.T) {
+	def := cfg.DefaultSlowLogConfig()
+	if Threshold(BlockValidation) != def.BlockValidation || Threshold(SnapshotSave) != def.SnapshotSave ||
+		Threshold(StoreWrite) != def.StoreWrite || Threshold(APIRequest) != def.APIRequest {
+		t.Error("thresholds do not default to the config's")
+	}
+}
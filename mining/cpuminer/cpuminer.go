@@ -25,7 +25,7 @@ const (
 // a concurrency-safe manner.
 type CPUMiner struct {
 	sync.Mutex
-	chain             *protocol.Chain
+	chain             protocol.Interface
 	txPool            *protocol.TxPool
 	numWorkers        uint64
 	started           bool
@@ -264,7 +264,7 @@ func (m *CPUMiner) NumWorkers() int32 {
 // New returns a new instance of a CPU miner for the provided configuration.
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
-func NewCPUMiner(c *protocol.Chain, txPool *protocol.TxPool) *CPUMiner {
+func NewCPUMiner(c protocol.Interface, txPool *protocol.TxPool) *CPUMiner {
 	return &CPUMiner{
 		chain:             c,
 		txPool:            txPool,
@@ -0,0 +1,42 @@
+package mining
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// Generate mines n blocks on c at the difficulty of a regression test
+// network, paying their coinbases to prog, and returns them. Each
+// block includes the transactions from txPool that fit, so generating
+// a block confirms pending transactions at once.
+func Generate(ctx context.Context, c protocol.Interface, txPool *protocol.TxPool, n int, prog []byte) ([]*legacy.Block, error) {
+	var blocks []*legacy.Block
+	for i := 0; i < n; i++ {
+		// Blocks made in quick succession must still have increasing
+		// timestamps.
+		prev, _ := c.State()
+		for bc.Millis(time.Now()) <= prev.TimestampMS {
+			time.Sleep(time.Millisecond)
+		}
+
+		b, err := NewBlockTemplate(c, txPool, prog)
+		if err != nil {
+			return blocks, err
+		}
+		b.Bits = consensus.RegtestBits
+		for hash := b.Hash(); !consensus.CheckProofOfWork(&hash, b.Bits); hash = b.Hash() {
+			b.Nonce++
+		}
+		if err := c.AddBlock(ctx, b); err != nil {
+			return blocks, errors.Wrapf(err, "adding block %d", b.Height)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
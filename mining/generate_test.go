@@ -0,0 +1,29 @@
+package mining
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/protocol/prottest"
+)
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	txPool := prottest.TxPool(c)
+
+	prog := []byte{0x51, 0x01}
+	blocks, err := Generate(ctx, c, txPool, 3, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 || c.Height() != 3 {
+		t.Fatalf("generated %d blocks to height %d", len(blocks), c.Height())
+	}
+	for _, b := range blocks {
+		out := b.Transactions[0].Outputs[0]
+		if string(out.ControlProgram) != string(prog) {
+			t.Errorf("block %d pays its coinbase to %x, want %x", b.Height, out.ControlProgram, prog)
+		}
+	}
+}
@@ -30,14 +30,19 @@ func standardCoinbaseScript(blockHeight uint64) ([]byte, error) {
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate subsidy
-// based on the passed block height to the provided address.  When the address
-// is nil, the coinbase transaction will instead be redeemable by anyone.
+// based on the passed block height to the provided address, a control
+// program.  When the address is empty, the coinbase transaction will instead
+// be redeemable by anyone.
 func createCoinbaseTx(amount uint64, blockHeight uint64, addr []byte) (*legacy.Tx, error) {
 	//TODO: make sure things works
 	amount += consensus.BlockSubsidy(blockHeight)
-	cbScript, err := standardCoinbaseScript(blockHeight)
-	if err != nil {
-		return nil, err
+	cbScript := addr
+	if len(cbScript) == 0 {
+		var err error
+		cbScript, err = standardCoinbaseScript(blockHeight)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	builder := txbuilder.NewBuilder(time.Now())
@@ -51,7 +56,7 @@ func createCoinbaseTx(amount uint64, blockHeight uint64, addr []byte) (*legacy.T
 }
 
 // NewBlockTemplate returns a new block template that is ready to be solved
-func NewBlockTemplate(c *protocol.Chain, txPool *protocol.TxPool, addr []byte) (*legacy.Block, error) {
+func NewBlockTemplate(c protocol.BlockReader, txPool *protocol.TxPool, addr []byte) (*legacy.Block, error) {
 	// Extend the most recently known best block.
 	var err error
 	preBlock, snap := c.State()
@@ -89,7 +94,7 @@ func NewBlockTemplate(c *protocol.Chain, txPool *protocol.TxPool, addr []byte) (
 		if blockWeight+txDesc.Weight > consensus.MaxBlockSzie-consensus.MaxTxSize {
 			break
 		}
-		if err := newSnap.ApplyTx(tx); err != nil {
+		if err := newSnap.ApplyTx(tx, nextBlockHeight); err != nil {
 			fmt.Println("mining block generate skip tx due to %v", err)
 			txPool.RemoveTransaction(&tx.ID)
 			continue
@@ -104,7 +109,7 @@ func NewBlockTemplate(c *protocol.Chain, txPool *protocol.TxPool, addr []byte) (
 	}
 
 	cbTx, _ := createCoinbaseTx(txFee, nextBlockHeight, addr)
-	if err := newSnap.ApplyTx(cbTx.Tx); err != nil {
+	if err := newSnap.ApplyTx(cbTx.Tx, nextBlockHeight); err != nil {
 		return nil, errors.Wrap(err, "fail on append coinbase transaction to snap")
 	}
 	appendTx(cbTx, 0, 0)
@@ -24,7 +24,7 @@ func TestNewInitBlock(t *testing.T) {
 		t.Error(err)
 	}
 	snap := state.Empty()
-	if err := snap.ApplyTx(coinbaseTx.Tx); err != nil {
+	if err := snap.ApplyTx(coinbaseTx.Tx, 0); err != nil {
 		t.Error(err)
 	}
 
@@ -0,0 +1,24 @@
+package node
+
+import (
+	"context"
+
+	cfg "github.com/bytom/config"
+	"github.com/bytom/protocol/audit"
+)
+
+// VerifyChain audits the chain in config's database against the
+// state snapshot stored with it, while the node is stopped.
+func VerifyChain(config *cfg.Config) (*audit.Report, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain, db, err := openChain(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// The output accounting starts empty in every process, so there
+	// is none to check here.
+	return audit.Verify(ctx, chain, false)
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"context"
+	"os"
+
+	"github.com/bytom/blockchain/blockfile"
+	"github.com/bytom/blockchain/txdb"
+	cfg "github.com/bytom/config"
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc/legacy"
+	dbm "github.com/tendermint/tmlibs/db"
+)
+
+// openChain opens the chain in config's database, starting it with
+// the genesis block of config's network if it is empty. The node must
+// not be running.
+func openChain(ctx context.Context, config *cfg.Config) (*protocol.Chain, dbm.DB, error) {
+	genesis := consensus.InitBlock()
+	if config.Regtest {
+		genesis = consensus.RegtestInitBlock()
+	}
+	genesisBlock := new(legacy.Block)
+	if err := genesisBlock.UnmarshalText(genesis); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding genesis block")
+	}
+
+	db := dbm.NewDB("txdb", config.DBBackend, config.DBDir())
+	store := txdb.NewStore(db)
+	chain, err := protocol.NewChain(ctx, genesisBlock.Hash(), store, protocol.NewTxPool(), nil)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if store.Height() < 1 {
+		if err := chain.AddBlock(ctx, genesisBlock); err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "adding genesis block")
+		}
+	}
+	return chain, db, nil
+}
+
+// ExportBlocks writes the blocks from height start to end of the chain
+// in config's database to the block file at path, while the node is
+// stopped.
+func ExportBlocks(config *cfg.Config, path string, start, end uint64) (uint64, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain, db, err := openChain(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "creating block file")
+	}
+	n, err := blockfile.Export(ctx, f, chain, start, end)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	return n, errors.Wrap(f.Close(), "closing block file")
+}
+
+// ImportBlocks validates the blocks in the block file at path and adds
+// them to the chain in config's database, while the node is stopped.
+// Without peers to wait on, this bootstraps a node much faster than
+// syncing.
+func ImportBlocks(config *cfg.Config, path string) (uint64, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain, db, err := openChain(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "opening block file")
+	}
+	defer f.Close()
+
+	n, err := blockfile.Import(ctx, f, chain)
+	if n > 0 {
+		// The chain saves snapshots in the background, at most hourly
+		// by block time; save the imported state so the node starts
+		// from it.
+		block, snapshot := chain.State()
+		if serr := chain.GetStore().SaveSnapshot(ctx, block.Height, snapshot); serr != nil && err == nil {
+			err = errors.Wrap(serr, "saving snapshot")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,41 @@
+package node
+
+import (
+	"net/http"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/federation"
+	"github.com/bytom/blockchain/rpc"
+	cfg "github.com/bytom/config"
+	"github.com/bytom/crypto/ed25519/chainkd"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol"
+)
+
+// newFederation makes this core a functionary of the federation
+// described in config, pegging chain to the configured mainchain.
+func newFederation(config *cfg.Config, chain *protocol.Chain) (*federation.Federation, error) {
+	fc := config.Federation
+	xpubs := make([]chainkd.XPub, len(fc.XPubs))
+	for i, s := range fc.XPubs {
+		if err := xpubs[i].UnmarshalText([]byte(s)); err != nil {
+			return nil, errors.Wrapf(err, "federation xpub %d", i)
+		}
+	}
+
+	mainchain := &federation.RemoteChain{
+		Client: &rpc.Client{
+			BaseURL:     fc.MainchainURL,
+			AccessToken: fc.MainchainAccessToken,
+			Client:      new(http.Client),
+		},
+	}
+	db := dbm.NewDB("federation", config.DBBackend, config.DBDir())
+	return federation.New(db, federation.Config{
+		XPubs:                 xpubs,
+		Quorum:                fc.Quorum,
+		Confirmations:         fc.Confirmations,
+		SidechainInitialBlock: chain.InitialBlockHash,
+	}, mainchain, chain, mainchain, federation.LocalSubmitter{Chain: chain})
+}
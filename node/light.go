@@ -0,0 +1,30 @@
+package node
+
+import (
+	"net/http"
+
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain/light"
+	"github.com/bytom/blockchain/rpc"
+	cfg "github.com/bytom/config"
+	"github.com/bytom/protocol/bc/legacy"
+)
+
+// newLightClient makes this core a light client of the full node
+// described in config, trusting the genesis block's header.
+func newLightClient(config *cfg.Config, genesis *legacy.Block) (*light.Client, error) {
+	lc := config.Light
+	peer := &rpc.Client{
+		BaseURL:     lc.FullNodeURL,
+		AccessToken: lc.FullNodeAccessToken,
+		Client:      new(http.Client),
+	}
+	db := dbm.NewDB("light", config.DBBackend, config.DBDir())
+	c, err := light.NewClient(db, peer, &genesis.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+	c.Regtest = config.Regtest
+	return c, nil
+}
@@ -13,6 +13,10 @@ import (
 	bc "github.com/bytom/blockchain"
 	"github.com/bytom/blockchain/account"
 	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/blockchain/blockwatch"
+	"github.com/bytom/blockchain/channel"
+	"github.com/bytom/blockchain/federation"
+	"github.com/bytom/blockchain/light"
 	"github.com/bytom/blockchain/pseudohsm"
 	"github.com/bytom/blockchain/txdb"
 	cfg "github.com/bytom/config"
@@ -35,6 +39,7 @@ import (
 	"github.com/bytom/env"
 	"github.com/bytom/errors"
 	bytomlog "github.com/bytom/log"
+	"github.com/bytom/log/slowlog"
 	"github.com/kr/secureheader"
 
 	_ "net/http/pprof"
@@ -158,6 +163,10 @@ func rpcInit(h *bc.BlockchainReactor, config *cfg.Config) {
 }
 
 func NewNode(config *cfg.Config, logger log.Logger) *Node {
+	if config.SlowLog != nil {
+		slowlog.Configure(config.SlowLog)
+	}
+
 	// Get store
 	tx_db := dbm.NewDB("txdb", config.DBBackend, config.DBDir())
 	store := txdb.NewStore(tx_db)
@@ -178,15 +187,27 @@ func NewNode(config *cfg.Config, logger log.Logger) *Node {
 	sw.SetLogger(p2pLogger)
 
 	fastSync := config.FastSync
+	lightMode := config.Light != nil && config.Light.Enabled
+	if lightMode {
+		// A light client never downloads full blocks.
+		fastSync = false
+	}
 
 	genesisBlock := &legacy.Block{
 		BlockHeader:  legacy.BlockHeader{},
 		Transactions: []*legacy.Tx{},
 	}
-	genesisBlock.UnmarshalText(consensus.InitBlock())
+	if config.Regtest {
+		genesisBlock.UnmarshalText(consensus.RegtestInitBlock())
+	} else {
+		genesisBlock.UnmarshalText(consensus.InitBlock())
+	}
 
 	txPool := protocol.NewTxPool()
 	chain, err := protocol.NewChain(context.Background(), genesisBlock.Hash(), store, txPool, nil)
+	if err != nil {
+		cmn.Exit(cmn.Fmt("Failed to load the chain: %v", err))
+	}
 
 	if store.Height() < 1 {
 		if err := chain.AddBlock(nil, genesisBlock); err != nil {
@@ -194,10 +215,28 @@ func NewNode(config *cfg.Config, logger log.Logger) *Node {
 		}
 	}
 
+	// In light mode the local chain is not synced; the wallet's
+	// indexers watch the light client instead.
+	var (
+		watchChain       blockwatch.Chain  = chain
+		channelSubmitter channel.Submitter = federation.LocalSubmitter{Chain: chain}
+		lightClient      *light.Client
+	)
+	if lightMode {
+		lightClient, err = newLightClient(config, genesisBlock)
+		if err != nil {
+			cmn.Exit(cmn.Fmt("initialize light client failed: %v", err))
+		}
+		go lightClient.Run(context.Background())
+		watchChain, channelSubmitter = lightClient, lightClient
+	}
+
 	accounts_db := dbm.NewDB("account", config.DBBackend, config.DBDir())
 	accounts := account.NewManager(accounts_db, chain)
+	go accounts.ProcessHTLCs(context.Background(), watchChain)
 	assets_db := dbm.NewDB("asset", config.DBBackend, config.DBDir())
-	assets := asset.NewRegistry(assets_db, chain)
+	assets := asset.NewRegistry(assets_db, chain, chain.InitialBlockHash)
+	go assets.ProcessBlocks(context.Background(), watchChain)
 
 	//Todo HSM
 	/*
@@ -217,6 +256,29 @@ func NewNode(config *cfg.Config, logger log.Logger) *Node {
 		cmn.Exit(cmn.Fmt("initialize HSM failed: %v", err))
 	}
 	bcReactor := bc.NewBlockchainReactor(store, chain, txPool, accounts, assets, hsm, fastSync)
+	if config.Regtest {
+		bcReactor.SetRegtest()
+	}
+	bcReactor.SetExportDir(config.ExportDir())
+	if lightClient != nil {
+		bcReactor.SetLight(lightClient)
+	}
+	channels_db := dbm.NewDB("channel", config.DBBackend, config.DBDir())
+	channels := channel.NewManager(channels_db, watchChain, channelSubmitter, accounts, hsm)
+	bcReactor.SetChannels(channels)
+	go channels.ProcessBlocks(context.Background())
+	if config.Federation != nil && config.Federation.Enabled {
+		fed, err := newFederation(config, chain)
+		if err != nil {
+			cmn.Exit(cmn.Fmt("initialize federation failed: %v", err))
+		}
+		bcReactor.SetFederation(fed)
+		go fed.WatchMainchain(context.Background())
+		go fed.WatchSidechain(context.Background())
+	}
+	if config.Relay != nil && config.Relay.Enabled {
+		bcReactor.SetRelayer(newRelayer(config))
+	}
 
 	bcReactor.SetLogger(logger.With("module", "blockchain"))
 	sw.AddReactor("BLOCKCHAIN", bcReactor)
@@ -390,7 +452,7 @@ func (n *Node) makeNodeInfo() *p2p.NodeInfo {
 	nodeInfo := &p2p.NodeInfo{
 		PubKey:  n.privKey.PubKey().Unwrap().(crypto.PubKeyEd25519),
 		Moniker: n.config.Moniker,
-		Network: "chain0",
+		Network: n.config.NetworkName(),
 		Version: version.Version,
 		Other: []string{
 			cmn.Fmt("wire_version=%v", wire.Version),
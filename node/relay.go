@@ -0,0 +1,24 @@
+package node
+
+import (
+	"net/http"
+
+	"github.com/bytom/blockchain/federation"
+	"github.com/bytom/blockchain/relay"
+	"github.com/bytom/blockchain/rpc"
+	cfg "github.com/bytom/config"
+)
+
+// newRelayer returns a relayer proving transactions on the foreign
+// chain described in config.
+func newRelayer(config *cfg.Config) *relay.Relayer {
+	rc := config.Relay
+	foreign := &federation.RemoteChain{
+		Client: &rpc.Client{
+			BaseURL:     rc.ForeignChainURL,
+			AccessToken: rc.ForeignChainAccessToken,
+			Client:      new(http.Client),
+		},
+	}
+	return relay.New(foreign)
+}
@@ -0,0 +1,45 @@
+package node
+
+import (
+	"context"
+	"os"
+
+	"github.com/bytom/blockchain/snapdiff"
+	cfg "github.com/bytom/config"
+	"github.com/bytom/errors"
+)
+
+// ExportSnapshot writes the latest state snapshot stored in config's
+// database to the snapshot file at path, while the node is stopped.
+// Snapshots are saved periodically, so it may be older than the
+// chain's tip; the file records the height it is at.
+func ExportSnapshot(config *cfg.Config, path string) (*snapdiff.File, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain, db, err := openChain(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	store := chain.GetStore()
+	snapshot, height, err := store.LatestSnapshot(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting latest snapshot")
+	}
+	block, err := store.GetBlock(height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting block %d", height)
+	}
+	sf := &snapdiff.File{Height: height, BlockHash: block.Hash(), Snapshot: snapshot}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating snapshot file")
+	}
+	if err := snapdiff.Write(f, sf); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return sf, errors.Wrap(f.Close(), "closing snapshot file")
+}
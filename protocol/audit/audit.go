@@ -0,0 +1,264 @@
+// Package audit checks a chain's state against its stored blocks.
+//
+// An audit replays every block from the genesis block into an empty
+// snapshot, checking each block's assets merkle root on the way, and
+// compares the result with the chain's live snapshot: the UTXO set,
+// the issued supply of capped assets, the retired supply of every
+// asset and the nonce set. It also recomputes each asset's supply
+// from the issuances, coinbases and retirements in the blocks and
+// checks it against the outputs left unspent, and, if asked,
+// recomputes the chain's per-asset output accounting.
+//
+// Run an audit after a crash or an upgrade, before trusting the
+// state the node restarted with.
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/patricia"
+	"github.com/bytom/protocol/state"
+)
+
+// maxListed limits the UTXOs listed in a divergence.
+const maxListed = 10
+
+// A Chain is the chain audited. protocol.Chain implements it.
+type Chain interface {
+	GetBlock(height uint64) (*legacy.Block, error)
+	State() (*legacy.Block, *state.Snapshot)
+	GetAssetsAmount() []interface{}
+}
+
+// Supply is an asset's supply, recomputed from the blocks.
+type Supply struct {
+	// Issued is the amount issued. For the native asset, it is the
+	// block subsidies minted by coinbases.
+	Issued  uint64 `json:"issued"`
+	Retired uint64 `json:"retired"`
+	Unspent uint64 `json:"unspent"`
+}
+
+// Report is what an audit found. The chain's state is sound when
+// Divergences is empty.
+type Report struct {
+	Height      uint64             `json:"height"`
+	UTXOs       int                `json:"utxos"`
+	Supply      map[string]*Supply `json:"supply"`
+	Divergences []string           `json:"divergences"`
+}
+
+func (r *Report) diverge(format string, args ...interface{}) {
+	r.Divergences = append(r.Divergences, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) supply(assetID bc.AssetID) *Supply {
+	s := r.Supply[assetID.String()]
+	if s == nil {
+		s = new(Supply)
+		r.Supply[assetID.String()] = s
+	}
+	return s
+}
+
+// Verify audits c up to the block its live state is at. If
+// accounting is true, it also checks the per-asset output totals c
+// keeps in memory. Those only count blocks added since the process
+// started, and are updated in the background after each block, so
+// check them on a chain that has synced from the genesis block and is
+// not adding blocks.
+//
+// Verify returns an error only if the audit cannot be done; what it
+// finds wrong with the chain is in the report.
+func Verify(ctx context.Context, c Chain, accounting bool) (*Report, error) {
+	tip, live := c.State()
+	if tip == nil || live == nil {
+		return nil, errors.New("chain has no state")
+	}
+	var amounts map[string]uint64
+	if accounting {
+		amounts = make(map[string]uint64)
+		for _, v := range c.GetAssetsAmount() {
+			if m, ok := v.(map[string]uint64); ok {
+				for k, n := range m {
+					amounts[k] = n
+				}
+			}
+		}
+	}
+
+	r := &Report{Height: tip.Height, Supply: make(map[string]*Supply)}
+	snapshot := state.Empty()
+	utxos := make(map[bc.Hash]*bc.AssetAmount)
+	outputTotals := make(map[string]uint64)
+
+	for h := uint64(0); h <= tip.Height; h++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, err := c.GetBlock(h)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting block %d", h)
+		}
+		if err := snapshot.ApplyBlock(legacy.MapBlock(b)); err != nil {
+			r.diverge("block %d does not apply to the state before it: %v", h, err)
+			return r, nil
+		}
+		if root := snapshot.Tree.RootHash(); root != b.AssetsMerkleRoot {
+			r.diverge("block %d has assets merkle root %x, recomputed state has %x", h, b.AssetsMerkleRoot.Bytes(), root.Bytes())
+		}
+		for i, tx := range b.Transactions {
+			r.applyTx(tx, h, utxos)
+			if i > 0 {
+				for _, out := range tx.Outputs {
+					outputTotals[out.AssetId.String()] += out.Amount
+				}
+			}
+		}
+	}
+	r.UTXOs = len(utxos)
+
+	r.compareState(snapshot, live)
+	r.checkSupply(snapshot)
+	if accounting {
+		compareAmounts(r, outputTotals, amounts)
+	}
+	return r, nil
+}
+
+// applyTx adds the supply changes in tx, a transaction in the block
+// at height, to r and applies its spends and outputs to utxos.
+func (r *Report) applyTx(tx *legacy.Tx, height uint64, utxos map[bc.Hash]*bc.AssetAmount) {
+	if len(tx.Inputs) == 0 {
+		// A coinbase mints the block subsidy, and passes on the fees
+		// of the block's other transactions.
+		r.supply(*consensus.BTMAssetID).Issued += consensus.BlockSubsidy(height)
+	}
+	for _, in := range tx.Inputs {
+		if ii, ok := in.TypedInput.(*legacy.IssuanceInput); ok {
+			r.supply(in.AssetID()).Issued += ii.Amount
+		}
+	}
+	for _, id := range tx.SpentOutputIDs {
+		if v, ok := utxos[id]; ok {
+			r.supply(*v.AssetId).Unspent -= v.Amount
+			delete(utxos, id)
+		}
+	}
+	for _, id := range tx.ResultIds {
+		switch e := tx.Entries[*id].(type) {
+		case *bc.Output:
+			if _, ok := utxos[*id]; ok {
+				// The state holds an output once, so its first
+				// value can no longer be spent.
+				r.diverge("block %d creates unspent output %x again, losing %d of asset %x", height, id.Bytes(), e.Source.Value.Amount, e.Source.Value.AssetId.Bytes())
+				continue
+			}
+			utxos[*id] = e.Source.Value
+			r.supply(*e.Source.Value.AssetId).Unspent += e.Source.Value.Amount
+		case *bc.Retirement:
+			r.supply(*e.Source.Value.AssetId).Retired += e.Source.Value.Amount
+		}
+	}
+}
+
+// compareState compares the recomputed snapshot with the live one.
+func (r *Report) compareState(recomputed, live *state.Snapshot) {
+	if a, b := recomputed.Tree.RootHash(), live.Tree.RootHash(); a != b {
+		r.diverge("live state tree has root %x, recomputed state has %x", b.Bytes(), a.Bytes())
+		r.compareTrees(recomputed.Tree, live.Tree)
+	}
+	compareAssets(r, "issued", recomputed.Issued, live.Issued)
+	compareAssets(r, "retired", recomputed.Retired, live.Retired)
+	if len(recomputed.Nonces) != len(live.Nonces) {
+		r.diverge("live state has %d nonces, recomputed state has %d", len(live.Nonces), len(recomputed.Nonces))
+	} else {
+		for id, exp := range recomputed.Nonces {
+			if live.Nonces[id] != exp {
+				r.diverge("nonce %x expires at %d in the live state, %d in the recomputed state", id.Bytes(), live.Nonces[id], exp)
+			}
+		}
+	}
+}
+
+// compareTrees lists the UTXOs in only one of two state trees.
+func (r *Report) compareTrees(recomputed, live *patricia.Tree) {
+	diff := func(a, b *patricia.Tree, msg string) {
+		var ids []string
+		n := 0
+		patricia.Walk(a, func(item []byte) error {
+			if !b.Contains(item) {
+				if n < maxListed {
+					ids = append(ids, fmt.Sprintf("%x", item))
+				}
+				n++
+			}
+			return nil
+		})
+		if n > 0 {
+			r.diverge("%d outputs %s, including %v", n, msg, ids)
+		}
+	}
+	diff(recomputed, live, "are missing from the live state")
+	diff(live, recomputed, "in the live state are not unspent")
+}
+
+func compareAssets(r *Report, what string, recomputed, live map[bc.AssetID]uint64) {
+	for assetID, n := range recomputed {
+		if live[assetID] != n {
+			r.diverge("live state has %d of asset %x %s, recomputed state has %d", live[assetID], assetID.Bytes(), what, n)
+		}
+	}
+	for assetID, n := range live {
+		if _, ok := recomputed[assetID]; !ok {
+			r.diverge("live state has %d of asset %x %s, recomputed state has none", n, assetID.Bytes(), what)
+		}
+	}
+}
+
+// checkSupply checks that no asset has more unspent than was issued
+// and not retired, and that the issued supply of capped assets
+// matches the recomputed state's.
+func (r *Report) checkSupply(recomputed *state.Snapshot) {
+	for id, s := range r.Supply {
+		if id == consensus.BTMAssetID.String() {
+			// Fees a coinbase does not claim are burned.
+			if s.Unspent+s.Retired > s.Issued {
+				r.diverge("%d of asset %s unspent and %d retired exceeds the %d minted", s.Unspent, id, s.Retired, s.Issued)
+			}
+			continue
+		}
+		if s.Unspent+s.Retired != s.Issued {
+			r.diverge("%d of asset %s unspent and %d retired does not match the %d issued", s.Unspent, id, s.Retired, s.Issued)
+		}
+	}
+	for assetID, n := range recomputed.Issued {
+		var issued uint64
+		if s := r.Supply[assetID.String()]; s != nil {
+			issued = s.Issued
+		}
+		if issued != n {
+			r.diverge("state has %d of capped asset %x issued, blocks issue %d", n, assetID.Bytes(), issued)
+		}
+	}
+}
+
+// compareAmounts compares the chain's per-asset output accounting
+// with the totals recomputed from the blocks.
+func compareAmounts(r *Report, recomputed, live map[string]uint64) {
+	for id, n := range recomputed {
+		if live[id] != n {
+			r.diverge("output accounting has %d of asset %s, blocks have %d", live[id], id, n)
+		}
+	}
+	for id, n := range live {
+		if _, ok := recomputed[id]; !ok {
+			r.diverge("output accounting has %d of asset %s, blocks have none", n, id)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest"
+)
+
+// spend returns a transaction spending the coinbase of b to prog, and
+// retiring some of it.
+func spend(t *testing.T, b *legacy.Block, prog []byte) *legacy.Tx {
+	cb := b.Transactions[0]
+	out, err := cb.Output(*cb.ResultIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := out.Source.Value
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *out.Source.Ref, *value.AssetId, value.Amount, out.Source.Position, out.ControlProgram.Code, *out.Data, nil)},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(*value.AssetId, value.Amount-2000000, prog, nil),
+			legacy.NewTxOutput(*value.AssetId, 1000000, []byte{0x6a}, nil),
+		},
+	})
+	raw, err := tx.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx = new(legacy.Tx)
+	if err := tx.UnmarshalText(raw); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// verify audits c, waiting for its output accounting to catch up.
+func verify(t *testing.T, c *protocol.Chain) *Report {
+	var r *Report
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		r, err = Verify(context.Background(), c, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Divergences) == 0 || time.Now().After(deadline) {
+			return r
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	txPool := prottest.TxPool(c)
+	// Each block pays a different program, so its coinbase output is
+	// unique.
+	var blocks []*legacy.Block
+	for _, prog := range [][]byte{{0x51}, {0x52}} {
+		b, err := mining.Generate(ctx, c, txPool, 1, prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b[0])
+	}
+	if err := c.ValidateTx(spend(t, blocks[0], []byte{0x53})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mining.Generate(ctx, c, txPool, 1, []byte{0x54}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := verify(t, c)
+	if len(r.Divergences) > 0 {
+		t.Fatalf("divergences: %v", r.Divergences)
+	}
+	if r.Height != 3 || r.UTXOs != 4 {
+		t.Errorf("audited %d UTXOs to height %d, want 4 to height 3", r.UTXOs, r.Height)
+	}
+	btm := r.Supply[consensus.BTMAssetID.String()]
+	var minted uint64
+	for h := uint64(0); h <= 3; h++ {
+		minted += consensus.BlockSubsidy(h)
+	}
+	if btm == nil || btm.Issued != minted || btm.Retired != 1000000 || btm.Unspent+btm.Retired != minted {
+		t.Errorf("native supply = %+v, want %d minted", btm, minted)
+	}
+
+	// An output missing from the live state is found.
+	_, live := c.State()
+	id := blocks[1].Transactions[0].ResultIds[0]
+	live.Tree.Delete(id.Bytes())
+	r, err := Verify(ctx, c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(r.Divergences, "1 outputs are missing from the live state") {
+		t.Errorf("missing output: divergences %v", r.Divergences)
+	}
+	if err := live.Tree.Insert(id.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// So is a difference in the retired supply.
+	live.Retired[*consensus.BTMAssetID]++
+	r, err = Verify(ctx, c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(r.Divergences, "retired") {
+		t.Errorf("retired supply: divergences %v", r.Divergences)
+	}
+	live.Retired[*consensus.BTMAssetID]--
+
+	// And output accounting that counted a block twice.
+	b, _ := c.GetBlock(3)
+	c.SetAssetsAmount(b)
+	r, err = Verify(ctx, c, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(r.Divergences, "output accounting") {
+		t.Errorf("accounting: divergences %v", r.Divergences)
+	}
+}
+
+func TestVerifyDuplicateCoinbase(t *testing.T) {
+	c := prottest.NewChain(t)
+	txPool := prottest.TxPool(c)
+	// Empty blocks paying the same program have identical coinbase
+	// outputs.
+	if _, err := mining.Generate(context.Background(), c, txPool, 2, []byte{0x51}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Verify(context.Background(), c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Divergences) != 1 || !contains(r.Divergences, "block 2 creates unspent output") {
+		t.Errorf("divergences: %v", r.Divergences)
+	}
+	var unspent uint64
+	for h := uint64(0); h <= 1; h++ {
+		unspent += consensus.BlockSubsidy(h)
+	}
+	if got := r.Supply[consensus.BTMAssetID.String()].Unspent; got != unspent {
+		t.Errorf("unspent = %d, want %d", got, unspent)
+	}
+}
+
+func contains(divergences []string, s string) bool {
+	for _, d := range divergences {
+		if strings.Contains(d, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,7 @@
+package bc
+
+var (
+	LeafHash         = leafHash
+	InteriorHash     = interiorHash
+	PrevPowerOfTwo64 = prevPowerOfTwo64
+)
@@ -1,7 +1,8 @@
 package bc
 
 import (
-	"math"
+	"errors"
+	"math/bits"
 
 	"github.com/bytom/crypto/sha3pool"
 )
@@ -11,6 +12,11 @@ var (
 	interiorPrefix = []byte{0x01}
 )
 
+// MaxMerkleProofCount is the largest number of transactions whose
+// merkle proofs ValidateMerkleProof checks. A proof for it has 32
+// hashes.
+const MaxMerkleProofCount = 1 << 32
+
 // MerkleRoot creates a merkle tree from a slice of transactions
 // and returns the root hash of the tree.
 func MerkleRoot(transactions []*Tx) (root Hash, err error) {
@@ -19,13 +25,7 @@ func MerkleRoot(transactions []*Tx) (root Hash, err error) {
 		return EmptyStringHash, nil
 
 	case len(transactions) == 1:
-		h := sha3pool.Get256()
-		defer sha3pool.Put256(h)
-
-		h.Write(leafPrefix)
-		transactions[0].ID.WriteTo(h)
-		root.ReadFrom(h)
-		return root, nil
+		return leafHash(transactions[0].ID), nil
 
 	default:
 		k := prevPowerOfTwo(len(transactions))
@@ -39,26 +39,107 @@ func MerkleRoot(transactions []*Tx) (root Hash, err error) {
 			return root, err
 		}
 
-		h := sha3pool.Get256()
-		defer sha3pool.Put256(h)
-		h.Write(interiorPrefix)
-		left.WriteTo(h)
-		right.WriteTo(h)
-		root.ReadFrom(h)
-		return root, nil
+		return interiorHash(left, right), nil
+	}
+}
+
+// MerkleProof returns the hashes that, together with the ID of the
+// transaction at index, recompute the merkle root of transactions.
+// They are ordered from the leaf up.
+func MerkleProof(transactions []*Tx, index int) ([]Hash, error) {
+	if index < 0 || index >= len(transactions) {
+		return nil, errors.New("transaction index out of range")
+	}
+	if len(transactions) == 1 {
+		return nil, nil
+	}
+
+	k := prevPowerOfTwo(len(transactions))
+	if index < k {
+		proof, err := MerkleProof(transactions[:k], index)
+		if err != nil {
+			return nil, err
+		}
+		right, err := MerkleRoot(transactions[k:])
+		return append(proof, right), err
+	}
+	proof, err := MerkleProof(transactions[k:], index-k)
+	if err != nil {
+		return nil, err
 	}
+	left, err := MerkleRoot(transactions[:k])
+	return append(proof, left), err
+}
+
+// ValidateMerkleProof reports whether proof shows that the
+// transaction id is at index among count transactions whose merkle
+// root is root. It rejects counts above MaxMerkleProofCount.
+func ValidateMerkleProof(root, id Hash, index, count uint64, proof []Hash) bool {
+	if index >= count || count > MaxMerkleProofCount {
+		return false
+	}
+
+	// Find from the root down which side of each node the
+	// transaction is on.
+	var left []bool
+	for count > 1 {
+		if len(left) == len(proof) {
+			return false
+		}
+		k := prevPowerOfTwo64(count)
+		if index < k {
+			left = append(left, true)
+			count = k
+		} else {
+			left = append(left, false)
+			index -= k
+			count -= k
+		}
+	}
+	if len(left) != len(proof) {
+		return false
+	}
+
+	h := leafHash(id)
+	for i, sibling := range proof {
+		if left[len(left)-1-i] {
+			h = interiorHash(h, sibling)
+		} else {
+			h = interiorHash(sibling, h)
+		}
+	}
+	return h == root
+}
+
+func leafHash(id Hash) (h Hash) {
+	hasher := sha3pool.Get256()
+	defer sha3pool.Put256(hasher)
+
+	hasher.Write(leafPrefix)
+	id.WriteTo(hasher)
+	h.ReadFrom(hasher)
+	return h
+}
+
+func interiorHash(left, right Hash) (h Hash) {
+	hasher := sha3pool.Get256()
+	defer sha3pool.Put256(hasher)
+
+	hasher.Write(interiorPrefix)
+	left.WriteTo(hasher)
+	right.WriteTo(hasher)
+	h.ReadFrom(hasher)
+	return h
 }
 
 // prevPowerOfTwo returns the largest power of two that is smaller than a given number.
 // In other words, for some input n, the prevPowerOfTwo k is a power of two such that
 // k < n <= 2k. This is a helper function used during the calculation of a merkle tree.
+// n must be at least 2.
 func prevPowerOfTwo(n int) int {
-	// If the number is a power of two, divide it by 2 and return.
-	if n&(n-1) == 0 {
-		return n / 2
-	}
+	return int(prevPowerOfTwo64(uint64(n)))
+}
 
-	// Otherwise, find the previous PoT.
-	exponent := uint(math.Log2(float64(n)))
-	return 1 << exponent // 2^exponent
+func prevPowerOfTwo64(n uint64) uint64 {
+	return 1 << uint(bits.Len64(n-1)-1)
 }
@@ -1,6 +1,7 @@
 package bc_test
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -139,6 +140,85 @@ func TestAllDuplicateLeaves(t *testing.T) {
 	}
 }
 
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var txs []*Tx
+		for i := 0; i < n; i++ {
+			txs = append(txs, legacy.NewTx(legacy.TxData{
+				Version:       1,
+				ReferenceData: []byte{byte(n), byte(i)},
+			}).Tx)
+		}
+		root, err := MerkleRoot(txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, tx := range txs {
+			proof, err := MerkleProof(txs, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ValidateMerkleProof(root, tx.ID, uint64(i), uint64(n), proof) {
+				t.Errorf("%d of %d: proof does not validate", i, n)
+			}
+			if n > 1 && ValidateMerkleProof(root, tx.ID, uint64((i+1)%n), uint64(n), proof) {
+				t.Errorf("%d of %d: proof validates at index %d", i, n, (i+1)%n)
+			}
+			if ValidateMerkleProof(root, txs[(i+1)%n].ID, uint64(i), uint64(n), proof) && n > 1 {
+				t.Errorf("%d of %d: proof validates another transaction", i, n)
+			}
+		}
+	}
+}
+
+func TestValidateMerkleProofHugeCount(t *testing.T) {
+	id := Hash{V0: 1}
+
+	// Index 0 of 2^32 transactions is the leftmost leaf of a balanced
+	// tree, under 32 right siblings.
+	var proof []Hash
+	root := LeafHash(id)
+	for i := 0; i < 32; i++ {
+		sibling := Hash{V0: uint64(i + 2)}
+		proof = append(proof, sibling)
+		root = InteriorHash(root, sibling)
+	}
+	if !ValidateMerkleProof(root, id, 0, MaxMerkleProofCount, proof) {
+		t.Error("proof of 2^32 transactions does not validate")
+	}
+
+	cases := []uint64{MaxMerkleProofCount + 1, 1<<60 - 1, 1<<63 - 1, math.MaxUint64}
+	for _, count := range cases {
+		if ValidateMerkleProof(root, id, 0, count, proof) {
+			t.Errorf("proof validates among %d transactions", count)
+		}
+		if ValidateMerkleProof(root, id, count-1, count, proof) {
+			t.Errorf("proof validates at index %d among %d transactions", count-1, count)
+		}
+	}
+}
+
+func TestPrevPowerOfTwo(t *testing.T) {
+	cases := []struct{ n, want uint64 }{
+		{2, 1},
+		{3, 2},
+		{4, 2},
+		{5, 4},
+		{1 << 32, 1 << 31},
+		{1<<32 + 1, 1 << 32},
+		{1<<60 - 1, 1 << 59},
+		{1 << 60, 1 << 59},
+		{1<<63 - 1, 1 << 62},
+		{math.MaxUint64, 1 << 63},
+	}
+	for _, c := range cases {
+		if got := PrevPowerOfTwo64(c.n); got != c.want {
+			t.Errorf("PrevPowerOfTwo64(%d) = %d, want %d", c.n, got, c.want)
+		}
+	}
+}
+
 func mustDecodeHash(s string) (h Hash) {
 	err := h.UnmarshalText([]byte(s))
 	if err != nil {
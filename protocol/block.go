@@ -6,6 +6,7 @@ import (
 
 	"github.com/bytom/errors"
 	"github.com/bytom/log"
+	"github.com/bytom/log/slowlog"
 	"github.com/bytom/protocol/bc/legacy"
 	"github.com/bytom/protocol/state"
 	"github.com/bytom/protocol/validation"
@@ -55,17 +56,24 @@ func (c *Chain) ValidateBlock(block, prev *legacy.Block) error {
 // block.
 func (c *Chain) ApplyValidBlock(block *legacy.Block) (*state.Snapshot, error) {
 	newSnapshot := state.Copy(c.state.snapshot)
-	err := newSnapshot.ApplyBlock(legacy.MapBlock(block))
-	if err != nil {
+	if err := applyBlock(newSnapshot, block); err != nil {
 		return nil, err
 	}
-	//fmt.Printf("want %v, ger %v \n", block.BlockHeader.AssetsMerkleRoot, newSnapshot.Tree.RootHash())
-	if block.AssetsMerkleRoot != newSnapshot.Tree.RootHash() {
-		return nil, ErrBadStateRoot
-	}
 	return newSnapshot, nil
 }
 
+// applyBlock applies block to snapshot in place, and checks the
+// resulting state against the block's assets merkle root.
+func applyBlock(snapshot *state.Snapshot, block *legacy.Block) error {
+	if err := snapshot.ApplyBlock(legacy.MapBlock(block)); err != nil {
+		return err
+	}
+	if block.AssetsMerkleRoot != snapshot.Tree.RootHash() {
+		return ErrBadStateRoot
+	}
+	return nil
+}
+
 // CommitBlock commits a block to the blockchain. The block
 // must already have been applied with ApplyValidBlock or
 // ApplyNewBlock, which will have produced the new snapshot that's
@@ -137,30 +145,53 @@ func (c *Chain) GetAssetsAmount() ([]interface{}) {
 	defer c.assets_utxo.cond.L.Unlock()
 
 	if(len(c.assets_utxo.assets_amount)>0) {
-		result = append(result,c.assets_utxo.assets_amount)
+		// Copy the amounts, which SetAssetsAmount goes on updating.
+		amounts := make(map[string]uint64, len(c.assets_utxo.assets_amount))
+		for k, v := range c.assets_utxo.assets_amount {
+			amounts[k] = v
+		}
+		result = append(result,amounts)
 	}
 
 	return result
 }
 
+// AddBlock validates block and adds it to the chain. A block that
+// does not extend the main branch is kept on a side branch, and the
+// chain switches to that branch once it has more work; see
+// addSideBlock.
 func (c *Chain) AddBlock(ctx context.Context, block *legacy.Block) error {
+	c.blockMu.Lock()
+	defer c.blockMu.Unlock()
+
 	currentBlock, _ := c.State()
+	if currentBlock != nil && block.PreviousBlockHash != currentBlock.Hash() {
+		return c.addSideBlock(ctx, block)
+	}
+
+	timer := slowlog.Start(slowlog.BlockValidation, "height", block.Height, "txs", len(block.Transactions))
+	defer timer.Finish(ctx)
+
 	if err := c.ValidateBlock(block, currentBlock); err != nil {
 		return err
 	}
+	timer.Mark("validate")
 
 	newSnap, err := c.ApplyValidBlock(block)
 	if err != nil {
 		return err
 	}
+	timer.Mark("apply")
 
 	if err := c.CommitAppliedBlock(ctx, block, newSnap); err != nil {
 		return err
 	}
+	timer.Mark("commit")
 
 	for _, tx := range block.Transactions {
 		c.txPool.RemoveTransaction(&tx.Tx.ID)
 	}
+	timer.Mark("mempool")
 	return nil
 }
 
@@ -0,0 +1,267 @@
+package protocol
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/log"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+)
+
+// maxSideBlocks bounds the blocks a chain keeps off its main branch.
+// Past it, the lowest are dropped first.
+const maxSideBlocks = 1024
+
+var (
+	// ErrOrphanBlock is returned for a block whose parent the chain
+	// does not have. The chain keeps the block, and connects it once
+	// its parent is added.
+	ErrOrphanBlock = errors.New("block's parent is unknown")
+
+	// ErrKnownBlock is returned for a block already on the main
+	// branch.
+	ErrKnownBlock = errors.New("block already in chain")
+)
+
+// addSideBlock keeps block, which does not extend the main branch,
+// and switches the main branch to the side branch it completes if
+// that branch has more work than the blocks of the main branch it
+// replaces. The side branch is fully validated only then.
+func (c *Chain) addSideBlock(ctx context.Context, block *legacy.Block) error {
+	hash := block.Hash()
+	if c.onMainBranch(hash, block.Height) {
+		return ErrKnownBlock
+	}
+	if !consensus.CheckProofOfWork(&hash, block.Bits) {
+		return errors.WithDetailf(ErrBadBlock, "block %x does not meet its target", hash.Bytes())
+	}
+	c.keepSideBlock(block)
+
+	fork, branch, ok := c.sideBranch(block)
+	if !ok {
+		return ErrOrphanBlock
+	}
+	mainWork, err := c.workAbove(fork)
+	if err != nil {
+		return err
+	}
+	if branchWork(branch).Cmp(mainWork) <= 0 {
+		return nil
+	}
+	return c.reorganize(ctx, fork, branch)
+}
+
+// onMainBranch reports whether the block with hash is the main
+// branch's block at height.
+func (c *Chain) onMainBranch(hash bc.Hash, height uint64) bool {
+	if height > c.Height() {
+		return false
+	}
+	b, err := c.store.GetBlock(height)
+	return err == nil && b.Hash() == hash
+}
+
+// keepSideBlock adds block to the side blocks, dropping the lowest
+// if there are too many.
+func (c *Chain) keepSideBlock(block *legacy.Block) {
+	if len(c.sideBlocks) >= maxSideBlocks {
+		var lowest *legacy.Block
+		for _, b := range c.sideBlocks {
+			if lowest == nil || b.Height < lowest.Height {
+				lowest = b
+			}
+		}
+		delete(c.sideBlocks, lowest.Hash())
+	}
+	c.sideBlocks[block.Hash()] = block
+}
+
+// sideBranch returns the side branch through block with the most
+// work, and the height of the main branch block it builds on. It
+// reports false if the branch does not reach the main branch.
+func (c *Chain) sideBranch(block *legacy.Block) (uint64, []*legacy.Block, bool) {
+	branch := []*legacy.Block{block}
+	for {
+		prev, ok := c.sideBlocks[branch[0].PreviousBlockHash]
+		if !ok {
+			break
+		}
+		branch = append([]*legacy.Block{prev}, branch...)
+	}
+	first := branch[0]
+	if first.Height == 0 || !c.onMainBranch(first.PreviousBlockHash, first.Height-1) {
+		return 0, nil, false
+	}
+	descendants, _ := c.bestDescendants(block.Hash())
+	return first.Height - 1, append(branch, descendants...), true
+}
+
+// bestDescendants returns the branch of side blocks built on the
+// block with hash that has the most work, and its work.
+func (c *Chain) bestDescendants(hash bc.Hash) ([]*legacy.Block, *big.Int) {
+	var (
+		best     []*legacy.Block
+		bestWork = new(big.Int)
+	)
+	for _, b := range c.sideBlocks {
+		if b.PreviousBlockHash != hash {
+			continue
+		}
+		descendants, work := c.bestDescendants(b.Hash())
+		work.Add(work, consensus.CalcWork(b.Bits))
+		if best == nil || work.Cmp(bestWork) > 0 {
+			best = append([]*legacy.Block{b}, descendants...)
+			bestWork = work
+		}
+	}
+	return best, bestWork
+}
+
+// workAbove returns the work of the main branch's blocks above
+// height.
+func (c *Chain) workAbove(height uint64) (*big.Int, error) {
+	work := new(big.Int)
+	for h := height + 1; h <= c.Height(); h++ {
+		b, err := c.store.GetBlock(h)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting block %d", h)
+		}
+		work.Add(work, consensus.CalcWork(b.Bits))
+	}
+	return work, nil
+}
+
+func branchWork(branch []*legacy.Block) *big.Int {
+	work := new(big.Int)
+	for _, b := range branch {
+		work.Add(work, consensus.CalcWork(b.Bits))
+	}
+	return work
+}
+
+// reorganize replaces the main branch's blocks above height fork
+// with branch. It validates branch against the state at fork first,
+// and leaves the chain as it was if any block is invalid. The
+// replaced blocks become side blocks, and their transactions return
+// to the pool if they are still valid.
+func (c *Chain) reorganize(ctx context.Context, fork uint64, branch []*legacy.Block) error {
+	prev, err := c.store.GetBlock(fork)
+	if err != nil {
+		return errors.Wrapf(err, "getting block %d", fork)
+	}
+	snapshot, err := c.snapshotAt(ctx, fork)
+	if err != nil {
+		return err
+	}
+	for _, b := range branch {
+		err := c.ValidateBlock(b, prev)
+		if err == nil {
+			err = applyBlock(snapshot, b)
+		}
+		if err != nil {
+			delete(c.sideBlocks, b.Hash())
+			return errors.Wrapf(err, "validating block %d of side branch", b.Height)
+		}
+		prev = b
+	}
+
+	var replaced []*legacy.Block
+	for h := fork + 1; h <= c.Height(); h++ {
+		b, err := c.store.GetBlock(h)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d", h)
+		}
+		replaced = append(replaced, b)
+	}
+	for _, b := range branch {
+		if err := c.store.SaveBlock(b); err != nil {
+			return errors.Wrap(err, "storing block")
+		}
+		delete(c.sideBlocks, b.Hash())
+	}
+	if err := c.store.FinalizeBlock(ctx, prev.Height); err != nil {
+		return errors.Wrap(err, "finalizing block")
+	}
+	c.queueSnapshot(ctx, prev.Height, prev.Time(), snapshot)
+	c.resetState(prev, snapshot)
+	log.Printf(ctx, "reorganized from height %d to %d at fork height %d", fork+uint64(len(replaced)), prev.Height, fork)
+
+	for _, b := range replaced {
+		c.keepSideBlock(b)
+		c.unsetAssetsAmount(b)
+	}
+	for _, b := range branch {
+		c.SetAssetsAmount(b)
+		for _, tx := range b.Transactions {
+			c.txPool.RemoveTransaction(&tx.Tx.ID)
+		}
+	}
+	for _, b := range replaced {
+		for _, tx := range b.Transactions[1:] {
+			c.ValidateTx(tx)
+		}
+	}
+	return nil
+}
+
+// snapshotAt returns the state after the main branch's block at
+// height. It replays the main branch onto the latest stored snapshot
+// if that is of a main branch block at or below height, and from the
+// genesis block otherwise.
+func (c *Chain) snapshotAt(ctx context.Context, height uint64) (*state.Snapshot, error) {
+	snapshot, from, err := c.store.LatestSnapshot(ctx)
+	start := from + 1
+	if err != nil || from > height || !c.snapshotOf(from, snapshot) {
+		snapshot, start = state.Empty(), 0
+	}
+	for h := start; h <= height; h++ {
+		b, err := c.store.GetBlock(h)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting block %d", h)
+		}
+		if err := applyBlock(snapshot, b); err != nil {
+			return nil, errors.Wrapf(err, "replaying block %d", h)
+		}
+	}
+	return snapshot, nil
+}
+
+// snapshotOf reports whether snapshot is the state after the main
+// branch's block at height: a snapshot saved before a reorganization
+// may be of a block no longer on it.
+func (c *Chain) snapshotOf(height uint64, snapshot *state.Snapshot) bool {
+	b, err := c.store.GetBlock(height)
+	return err == nil && b.AssetsMerkleRoot == snapshot.Tree.RootHash()
+}
+
+// resetState sets the chain's state to b and s, even if b is lower
+// than the current block.
+func (c *Chain) resetState(b *legacy.Block, s *state.Snapshot) {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+	c.state.block = b
+	c.state.snapshot = s
+	c.state.height = b.Height
+	c.state.cond.Broadcast()
+}
+
+// unsetAssetsAmount takes the outputs of block, which has left the
+// main branch, out of the amounts SetAssetsAmount counted.
+func (c *Chain) unsetAssetsAmount(block *legacy.Block) {
+	c.assets_utxo.cond.L.Lock()
+	defer c.assets_utxo.cond.L.Unlock()
+	for _, tx := range block.Transactions[1:] {
+		for _, out := range tx.Outputs {
+			key := out.AssetId.String()
+			if c.assets_utxo.assets_amount[key] > out.Amount {
+				c.assets_utxo.assets_amount[key] -= out.Amount
+			} else {
+				delete(c.assets_utxo.assets_amount, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package protocol_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest"
+)
+
+func newRegtestChain(t *testing.T) *protocol.Chain {
+	return prottest.NewChain(t, prottest.WithGenesis(consensus.RegtestInitBlock()))
+}
+
+func generate(t *testing.T, c *protocol.Chain, n int, prog byte) []*legacy.Block {
+	blocks, err := mining.Generate(context.Background(), c, prottest.TxPool(c), n, []byte{prog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks
+}
+
+func tip(c *protocol.Chain) bc.Hash {
+	b, _ := c.State()
+	return b.Hash()
+}
+
+func TestReorganize(t *testing.T) {
+	ctx := context.Background()
+	a, b := newRegtestChain(t), newRegtestChain(t)
+	generate(t, a, 2, 0x51)
+	long := generate(t, b, 3, 0x52)
+
+	// A branch with no more work than the main branch is only kept.
+	for _, block := range long[:2] {
+		if err := a.AddBlock(ctx, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := a.Height(); got != 2 || tip(a) == tip(b) {
+		t.Fatalf("switched to a branch with no more work: height %d", got)
+	}
+
+	if err := a.AddBlock(ctx, long[2]); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Height(); got != 3 || tip(a) != tip(b) {
+		t.Fatalf("height %d, tip %x after adding the longer branch, want 3, %x", got, tip(a).Bytes(), tip(b).Bytes())
+	}
+	for _, block := range long {
+		got, err := a.GetBlock(block.Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash() != block.Hash() {
+			t.Errorf("block %d is %x, want %x", block.Height, got.Hash().Bytes(), block.Hash().Bytes())
+		}
+	}
+	if err := a.AddBlock(ctx, long[1]); errors.Root(err) != protocol.ErrKnownBlock {
+		t.Errorf("adding a block again: got error %v, want %v", err, protocol.ErrKnownBlock)
+	}
+
+	// The new branch's state is a's now: it builds on it.
+	generate(t, a, 1, 0x51)
+}
+
+func TestReorganizeOrphans(t *testing.T) {
+	ctx := context.Background()
+	a, b := newRegtestChain(t), newRegtestChain(t)
+	generate(t, a, 1, 0x51)
+	long := generate(t, b, 3, 0x52)
+
+	for i := len(long) - 1; i > 0; i-- {
+		if err := a.AddBlock(ctx, long[i]); errors.Root(err) != protocol.ErrOrphanBlock {
+			t.Fatalf("adding block %d before its parent: got error %v, want %v", long[i].Height, err, protocol.ErrOrphanBlock)
+		}
+	}
+	if err := a.AddBlock(ctx, long[0]); err != nil {
+		t.Fatal(err)
+	}
+	if tip(a) != tip(b) {
+		t.Errorf("tip %x once the orphans' parent arrived, want %x", tip(a).Bytes(), tip(b).Bytes())
+	}
+}
+
+func TestReorganizeInvalidBranch(t *testing.T) {
+	ctx := context.Background()
+	a, b := newRegtestChain(t), newRegtestChain(t)
+	short := generate(t, a, 1, 0x51)
+	before := tip(a)
+	long := generate(t, b, 2, 0x52)
+
+	// A block whose transactions do not match its header.
+	bad := *long[1]
+	bad.Transactions = short[0].Transactions
+	if err := a.AddBlock(ctx, long[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddBlock(ctx, &bad); errors.Root(err) != protocol.ErrBadBlock {
+		t.Errorf("adding an invalid branch: got error %v, want %v", err, protocol.ErrBadBlock)
+	}
+	if got := a.Height(); got != 1 || tip(a) != before {
+		t.Errorf("height %d, tip %x after an invalid branch, want 1, %x", got, tip(a).Bytes(), before.Bytes())
+	}
+
+	// The valid branch still takes over once it is complete.
+	if err := a.AddBlock(ctx, long[1]); err != nil {
+		t.Fatal(err)
+	}
+	if tip(a) != tip(b) {
+		t.Errorf("tip %x, want %x", tip(a).Bytes(), tip(b).Bytes())
+	}
+}
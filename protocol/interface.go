@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"context"
+
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+)
+
+// BlockReader reads a chain's blocks and current state, and waits for
+// new blocks.
+type BlockReader interface {
+	Height() uint64
+	TimestampMS() uint64
+	GetBlock(height uint64) (*legacy.Block, error)
+	State() (*legacy.Block, *state.Snapshot)
+	BlockWaiter(height uint64) <-chan struct{}
+	BlockSoonWaiter(ctx context.Context, height uint64) <-chan error
+}
+
+// BlockWriter validates blocks and adds them to a chain.
+type BlockWriter interface {
+	ValidateBlock(block, prev *legacy.Block) error
+	ApplyValidBlock(block *legacy.Block) (*state.Snapshot, error)
+	CommitAppliedBlock(ctx context.Context, block *legacy.Block, snapshot *state.Snapshot) error
+	AddBlock(ctx context.Context, block *legacy.Block) error
+	Recover(ctx context.Context) (*legacy.Block, *state.Snapshot, error)
+}
+
+// TxValidator validates transactions against a chain's state.
+type TxValidator interface {
+	ValidateTx(tx *legacy.Tx) error
+}
+
+// Prover proves transactions and outputs are in a chain.
+type Prover interface {
+	ProveTx(height uint64, txID bc.Hash) (*TxProof, error)
+	ProveOutput(outputID bc.Hash) (*OutputProof, error)
+}
+
+// Interface is the public behavior of a Chain. Depend on it, or on
+// the narrowest of the interfaces it groups, rather than on *Chain, so
+// tests can substitute the mocks in package prottest/mock or a chain
+// from prottest.NewChain, which keeps everything in memory.
+type Interface interface {
+	BlockReader
+	BlockWriter
+	TxValidator
+	Prover
+
+	GetStore() Store
+	SetAssetsAmount(block *legacy.Block)
+	GetAssetsAmount() []interface{}
+}
+
+var _ Interface = (*Chain)(nil)
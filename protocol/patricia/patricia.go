@@ -98,6 +98,61 @@ func lookup(n *node, key []uint8) *node {
 	return lookup(n.children[bit], key)
 }
 
+// A ProofStep is the hash of a sibling on the path from an item's
+// leaf up to the root of a tree. Left reports whether the sibling is
+// the left child of their parent.
+type ProofStep struct {
+	Hash bc.Hash `json:"hash"`
+	Left bool    `json:"left"`
+}
+
+// Proof returns the siblings on the path from item's leaf up to the
+// root of t, leaf first, and whether t contains item. It is what
+// VerifyProof needs to check that item is in a tree with t's root
+// hash, without the rest of the tree.
+func (t *Tree) Proof(item []byte) ([]ProofStep, bool) {
+	if !t.Contains(item) {
+		return nil, false
+	}
+
+	key := bitKey(item)
+	var proof []ProofStep
+	for n := t.root; !n.isLeaf; {
+		bit := key[len(n.key)]
+		proof = append(proof, ProofStep{Hash: n.children[1-bit].Hash(), Left: bit == 1})
+		n = n.children[bit]
+	}
+	for i, j := 0, len(proof)-1; i < j; i, j = i+1, j-1 {
+		proof[i], proof[j] = proof[j], proof[i]
+	}
+	return proof, true
+}
+
+// VerifyProof reports whether proof shows that item is in a tree
+// whose root hash is root.
+func VerifyProof(root bc.Hash, item []byte, proof []ProofStep) bool {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	var hash bc.Hash
+	h.Write(leafPrefix)
+	h.Write(item)
+	hash.ReadFrom(h)
+	for _, step := range proof {
+		h.Reset()
+		h.Write(interiorPrefix)
+		if step.Left {
+			step.Hash.WriteTo(h)
+			hash.WriteTo(h)
+		} else {
+			hash.WriteTo(h)
+			step.Hash.WriteTo(h)
+		}
+		hash.ReadFrom(h)
+	}
+	return hash == root
+}
+
 // Insert inserts item into t.
 //
 // It is an error for item to be a prefix of an element
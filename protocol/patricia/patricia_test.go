@@ -211,6 +211,38 @@ func TestContains(t *testing.T) {
 	}
 }
 
+func TestProof(t *testing.T) {
+	tr := new(Tree)
+	items := [][]byte{bits("00000011"), bits("00000010"), bits("10000000"), bits("00110000")}
+	for _, item := range items {
+		tr.Insert(item)
+	}
+	root := tr.RootHash()
+
+	for _, item := range items {
+		proof, ok := tr.Proof(item)
+		if !ok {
+			t.Fatalf("no proof for %x", item)
+		}
+		if !VerifyProof(root, item, proof) {
+			t.Errorf("proof for %x does not verify", item)
+		}
+		if VerifyProof(root, bits("00000001"), proof) {
+			t.Errorf("proof for %x verifies another item", item)
+		}
+	}
+	if _, ok := tr.Proof(bits("00000000")); ok {
+		t.Error("got proof for missing item")
+	}
+
+	single := new(Tree)
+	single.Insert(items[0])
+	proof, ok := single.Proof(items[0])
+	if !ok || len(proof) != 0 || !VerifyProof(single.RootHash(), items[0], proof) {
+		t.Errorf("single item proof = %v, %v", proof, ok)
+	}
+}
+
 func TestInsert(t *testing.T) {
 	tr := new(Tree)
 
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/patricia"
+)
+
+var (
+	// ErrTxNotFound is returned when a transaction to prove is not in
+	// the block named.
+	ErrTxNotFound = errors.New("transaction not found in block")
+
+	// ErrOutputNotFound is returned when an output to prove is not
+	// in the current state.
+	ErrOutputNotFound = errors.New("output not found in state")
+)
+
+// TxProof shows that a transaction is included in a block: hashing
+// the transaction ID up through Proof gives the block's transactions
+// merkle root.
+type TxProof struct {
+	BlockHeight            uint64    `json:"block_height"`
+	BlockHash              bc.Hash   `json:"block_hash"`
+	TransactionsMerkleRoot bc.Hash   `json:"transactions_merkle_root"`
+	TransactionID          bc.Hash   `json:"transaction_id"`
+	Index                  uint64    `json:"index"`
+	Count                  uint64    `json:"transaction_count"`
+	Proof                  []bc.Hash `json:"proof"`
+}
+
+// OutputProof shows that an output is unspent in the state committed
+// to by a block: hashing the output ID up through Proof gives the
+// block's assets merkle root.
+type OutputProof struct {
+	BlockHeight      uint64               `json:"block_height"`
+	BlockHash        bc.Hash              `json:"block_hash"`
+	AssetsMerkleRoot bc.Hash              `json:"assets_merkle_root"`
+	OutputID         bc.Hash              `json:"output_id"`
+	Proof            []patricia.ProofStep `json:"proof"`
+}
+
+// ProveTx returns the proof that the transaction txID is included in
+// the block at height.
+func (c *Chain) ProveTx(height uint64, txID bc.Hash) (*TxProof, error) {
+	b, err := c.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*bc.Tx, len(b.Transactions))
+	index := -1
+	for i, tx := range b.Transactions {
+		txs[i] = tx.Tx
+		if tx.ID == txID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, errors.WithDetailf(ErrTxNotFound, "transaction %x, block %d", txID.Bytes(), height)
+	}
+	proof, err := bc.MerkleProof(txs, index)
+	if err != nil {
+		return nil, err
+	}
+	return &TxProof{
+		BlockHeight:            b.Height,
+		BlockHash:              b.Hash(),
+		TransactionsMerkleRoot: b.TransactionsMerkleRoot,
+		TransactionID:          txID,
+		Index:                  uint64(index),
+		Count:                  uint64(len(txs)),
+		Proof:                  proof,
+	}, nil
+}
+
+// ProveOutput returns the proof that the output outputID is unspent
+// in the current state.
+func (c *Chain) ProveOutput(outputID bc.Hash) (*OutputProof, error) {
+	b, snapshot := c.State()
+	if b == nil || snapshot == nil {
+		return nil, ErrStaleState
+	}
+	proof, ok := snapshot.Tree.Proof(outputID.Bytes())
+	if !ok {
+		return nil, errors.WithDetailf(ErrOutputNotFound, "output %x, block %d", outputID.Bytes(), b.Height)
+	}
+	return &OutputProof{
+		BlockHeight:      b.Height,
+		BlockHash:        b.Hash(),
+		AssetsMerkleRoot: b.AssetsMerkleRoot,
+		OutputID:         outputID,
+		Proof:            proof,
+	}, nil
+}
+
+// VerifyTxProof reports whether p shows that its transaction is
+// included in a block whose transactions merkle root is root. Callers
+// must get root from a block header they trust, not from p.
+func VerifyTxProof(root bc.Hash, p *TxProof) bool {
+	return bc.ValidateMerkleProof(root, p.TransactionID, p.Index, p.Count, p.Proof)
+}
+
+// VerifyOutputProof reports whether p shows that its output is
+// unspent in a state whose assets merkle root is root. Callers must
+// get root from a block header they trust, not from p.
+func VerifyOutputProof(root bc.Hash, p *OutputProof) bool {
+	return patricia.VerifyProof(root, p.OutputID.Bytes(), p.Proof)
+}
@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest/memstore"
+	"github.com/bytom/protocol/state"
+)
+
+func TestProofs(t *testing.T) {
+	ctx := context.Background()
+	txs := []*legacy.Tx{mockCoinbaseTx(1000, 1), mockCoinbaseTx(1000, 2), mockCoinbaseTx(1000, 3)}
+	snapshot := state.Empty()
+	var bctxs []*bc.Tx
+	for _, tx := range txs {
+		bctxs = append(bctxs, tx.Tx)
+		if err := snapshot.ApplyTx(tx.Tx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := bc.MerkleRoot(bctxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &legacy.Block{
+		BlockHeader: legacy.BlockHeader{
+			Height: 1,
+			BlockCommitment: legacy.BlockCommitment{
+				TransactionsMerkleRoot: root,
+				AssetsMerkleRoot:       snapshot.Tree.RootHash(),
+			},
+		},
+		Transactions: txs,
+	}
+	store := memstore.New()
+	store.SaveBlock(b)
+	store.SaveSnapshot(ctx, 1, snapshot)
+	c, err := NewChain(ctx, b.Hash(), store, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txProof, err := c.ProveTx(1, txs[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyTxProof(b.TransactionsMerkleRoot, txProof) {
+		t.Error("transaction proof does not verify")
+	}
+	if VerifyTxProof(b.AssetsMerkleRoot, txProof) {
+		t.Error("transaction proof verifies against another root")
+	}
+	if _, err := c.ProveTx(1, bc.Hash{V0: 1}); errors.Root(err) != ErrTxNotFound {
+		t.Errorf("proving missing transaction: got error %v, want %v", err, ErrTxNotFound)
+	}
+
+	outputID := txs[2].OutputID(0)
+	outProof, err := c.ProveOutput(*outputID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyOutputProof(b.AssetsMerkleRoot, outProof) {
+		t.Error("output proof does not verify")
+	}
+	outProof.OutputID = *txs[0].OutputID(0)
+	if VerifyOutputProof(b.AssetsMerkleRoot, outProof) {
+		t.Error("output proof verifies another output")
+	}
+	if _, err := c.ProveOutput(bc.Hash{V0: 1}); errors.Root(err) != ErrOutputNotFound {
+		t.Errorf("proving missing output: got error %v, want %v", err, ErrOutputNotFound)
+	}
+}
@@ -54,6 +54,13 @@ type Chain struct {
 	}
 	store Store
 
+	// blockMu serializes adding blocks, which may switch the chain to
+	// another branch. sideBlocks holds the blocks off the main branch
+	// by hash: those of branches with no more work than it, and
+	// orphans whose parents have not arrived yet.
+	blockMu    sync.Mutex
+	sideBlocks map[bc.Hash]*legacy.Block
+
 	lastQueuedSnapshot time.Time
 	pendingSnapshots   chan pendingSnapshot
 
@@ -74,6 +81,7 @@ func NewChain(ctx context.Context, initialBlockHash bc.Hash, store Store, txPool
 	c := &Chain{
 		InitialBlockHash: initialBlockHash,
 		store:            store,
+		sideBlocks:       make(map[bc.Hash]*legacy.Block),
 		pendingSnapshots: make(chan pendingSnapshot, 1),
 		txPool:           txPool,
 	}
@@ -89,7 +97,11 @@ func NewChain(ctx context.Context, initialBlockHash bc.Hash, store Store, txPool
 		c.state.snapshot = state.Empty()
 	} else {
 		c.state.block, _ = store.GetBlock(c.state.height)
-		c.state.snapshot, _, _ = store.LatestSnapshot(ctx)
+		snapshot, _, err := store.LatestSnapshot(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading state snapshot")
+		}
+		c.state.snapshot = snapshot
 	}
 
 	// Note that c.height.n may still be zero here.
@@ -118,8 +130,9 @@ func NewChain(ctx context.Context, initialBlockHash bc.Hash, store Store, txPool
 	return c, nil
 }
 
-func (c *Chain) GetStore() *Store {
-	return &(c.store)
+// GetStore returns the store underlying c.
+func (c *Chain) GetStore() Store {
+	return c.store
 }
 
 // Height returns the current height of the blockchain.
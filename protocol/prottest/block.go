@@ -1,13 +1,16 @@
 package prottest
 
 import (
+	"context"
 	"sync"
 	"testing"
 
+	"github.com/bytom/consensus"
 	"github.com/bytom/crypto/ed25519"
 	"github.com/bytom/protocol"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest/memstore"
 	"github.com/bytom/protocol/state"
 	"github.com/bytom/testutil"
 )
@@ -17,6 +20,7 @@ var (
 	states        = make(map[*protocol.Chain]*state.Snapshot)
 	blockPubkeys  = make(map[*protocol.Chain][]ed25519.PublicKey)
 	blockPrivkeys = make(map[*protocol.Chain][]ed25519.PrivateKey)
+	txPools       = make(map[*protocol.Chain]*protocol.TxPool)
 )
 
 type Option func(testing.TB, *config)
@@ -33,6 +37,19 @@ func WithOutputIDs(outputIDs ...bc.Hash) Option {
 	}
 }
 
+// WithGenesis starts the chain with the serialized block text, such
+// as consensus.RegtestInitBlock(), rather than consensus.InitBlock().
+func WithGenesis(text []byte) Option {
+	return func(_ testing.TB, conf *config) { conf.genesis = text }
+}
+
+// WithTxPool has the chain use txPool. Its new-transaction channel is
+// not drained: the caller reads it, as a blockchain reactor relaying
+// the transactions does.
+func WithTxPool(txPool *protocol.TxPool) Option {
+	return func(_ testing.TB, conf *config) { conf.txPool = txPool }
+}
+
 func WithBlockSigners(quorum, n int) Option {
 	return func(tb testing.TB, conf *config) {
 		conf.quorum = quorum
@@ -49,19 +66,68 @@ func WithBlockSigners(quorum, n int) Option {
 
 type config struct {
 	store        protocol.Store
+	genesis      []byte
+	txPool       *protocol.TxPool
 	initialState *state.Snapshot
 	pubkeys      []ed25519.PublicKey
 	privkeys     []ed25519.PrivateKey
 	quorum       int
 }
 
+// NewChain makes a new Chain starting with the genesis block. By
+// default it keeps everything in memory, in a memstore.MemStore. It
+// has its own transaction pool, whose new-transaction channel is
+// drained so validating any number of transactions never blocks.
+func NewChain(tb testing.TB, options ...Option) *protocol.Chain {
+	conf := config{store: memstore.New(), genesis: consensus.InitBlock(), initialState: state.Empty()}
+	for _, opt := range options {
+		opt(tb, &conf)
+	}
+
+	ctx := context.Background()
+	genesis := new(legacy.Block)
+	if err := genesis.UnmarshalText(conf.genesis); err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	txPool := conf.txPool
+	if txPool == nil {
+		txPool = protocol.NewTxPool()
+		go func() {
+			for range txPool.GetNewTxCh() {
+			}
+		}()
+	}
+	c, err := protocol.NewChain(ctx, genesis.Hash(), conf.store, txPool, nil)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+
+	// The genesis block's state, and any outputs the options add to
+	// it.
+	snapshot := conf.initialState
+	if err := snapshot.ApplyBlock(legacy.MapBlock(genesis)); err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	if err := c.CommitAppliedBlock(ctx, genesis, snapshot); err != nil {
+		testutil.FatalErr(tb, err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	states[c] = snapshot
+	blockPubkeys[c] = conf.pubkeys
+	blockPrivkeys[c] = conf.privkeys
+	txPools[c] = txPool
+	return c
+}
+
 // Initial returns the provided Chain's initial block.
 func Initial(tb testing.TB, c *protocol.Chain) *legacy.Block {
-	b1, err := c.GetBlock(1)
+	b0, err := c.GetBlock(0)
 	if err != nil {
 		testutil.FatalErr(tb, err)
 	}
-	return b1
+	return b0
 }
 
 // BlockKeyPairs returns the configured block-signing key-pairs
@@ -71,3 +137,10 @@ func BlockKeyPairs(c *protocol.Chain) ([]ed25519.PublicKey, []ed25519.PrivateKey
 	defer mutex.Unlock()
 	return blockPubkeys[c], blockPrivkeys[c]
 }
+
+// TxPool returns the transaction pool of a Chain made by NewChain.
+func TxPool(c *protocol.Chain) *protocol.TxPool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return txPools[c]
+}
@@ -1,5 +1,14 @@
 package prottest
 
+import (
+	"context"
+	"testing"
+
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/prottest/memstore"
+)
+
 /*func TestMakeBlock(t *testing.T) {
 	c := NewChain(t)
 	MakeBlock(t, c, nil)
@@ -11,3 +20,27 @@ package prottest
 		t.Errorf("c.Height() = %d want %d", got, want)
 	}
 }*/
+
+func TestNewChain(t *testing.T) {
+	store := memstore.New()
+	outputID := bc.NewHash([32]byte{1})
+	c := NewChain(t, WithStore(store), WithOutputIDs(outputID))
+	if c.GetStore() != store {
+		t.Error("chain does not use the store given")
+	}
+	if got := Initial(t, c).Hash(); got != c.InitialBlockHash {
+		t.Errorf("initial block %x, want %x", got.Bytes(), c.InitialBlockHash.Bytes())
+	}
+	_, snapshot := c.State()
+	if !snapshot.Tree.Contains(outputID.Bytes()) {
+		t.Error("initial state is missing the output given")
+	}
+
+	blocks, err := mining.Generate(context.Background(), c, TxPool(c), 2, []byte{0x51})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Height(); got != 2 || blocks[1].Height != 2 {
+		t.Errorf("height = %d after generating 2 blocks, want 2", got)
+	}
+}
@@ -19,6 +19,10 @@ type MemStore struct {
 	Blocks      map[uint64]*legacy.Block
 	State       *state.Snapshot
 	StateHeight uint64
+
+	// height is that of the last saved block. A chain that
+	// reorganizes to a shorter branch leaves blocks above it.
+	height uint64
 }
 
 // New returns a new MemStore
@@ -30,19 +34,15 @@ func (m *MemStore) Height() uint64 {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	return uint64(len(m.Blocks))
-
+	return m.height
 }
 
 func (m *MemStore) SaveBlock(b *legacy.Block) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	existing, ok := m.Blocks[b.Height]
-	if ok && existing.Hash() != b.Hash() {
-		return fmt.Errorf("already have a block at height %d", b.Height)
-	}
 	m.Blocks[b.Height] = b
+	m.height = b.Height
 	return nil
 }
 
@@ -59,7 +59,7 @@ func (m *MemStore) GetBlock(height uint64) (*legacy.Block, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	b, ok := m.Blocks[height]
-	if !ok {
+	if !ok || height > m.height {
 		return nil, fmt.Errorf("memstore: no block at height %d", height)
 	}
 	return b, nil
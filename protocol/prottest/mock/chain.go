@@ -0,0 +1,229 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+)
+
+// Chain is a mock protocol.Interface. Without a function or a wrapped
+// chain, BlockWaiter returns a channel that never receives, and
+// BlockSoonWaiter one that receives ErrUnmocked.
+type Chain struct {
+	recorder
+
+	// Chain, if set, is called by methods without a function.
+	Chain protocol.Interface
+
+	HeightFunc             func() uint64
+	TimestampMSFunc        func() uint64
+	GetBlockFunc           func(height uint64) (*legacy.Block, error)
+	StateFunc              func() (*legacy.Block, *state.Snapshot)
+	BlockWaiterFunc        func(height uint64) <-chan struct{}
+	BlockSoonWaiterFunc    func(ctx context.Context, height uint64) <-chan error
+	ValidateBlockFunc      func(block, prev *legacy.Block) error
+	ApplyValidBlockFunc    func(block *legacy.Block) (*state.Snapshot, error)
+	CommitAppliedBlockFunc func(ctx context.Context, block *legacy.Block, snapshot *state.Snapshot) error
+	AddBlockFunc           func(ctx context.Context, block *legacy.Block) error
+	RecoverFunc            func(ctx context.Context) (*legacy.Block, *state.Snapshot, error)
+	ValidateTxFunc         func(tx *legacy.Tx) error
+	ProveTxFunc            func(height uint64, txID bc.Hash) (*protocol.TxProof, error)
+	ProveOutputFunc        func(outputID bc.Hash) (*protocol.OutputProof, error)
+	GetStoreFunc           func() protocol.Store
+	SetAssetsAmountFunc    func(block *legacy.Block)
+	GetAssetsAmountFunc    func() []interface{}
+}
+
+var _ protocol.Interface = (*Chain)(nil)
+
+func (c *Chain) Height() uint64 {
+	c.record("Height")
+	if c.HeightFunc != nil {
+		return c.HeightFunc()
+	}
+	if c.Chain != nil {
+		return c.Chain.Height()
+	}
+	return 0
+}
+
+func (c *Chain) TimestampMS() uint64 {
+	c.record("TimestampMS")
+	if c.TimestampMSFunc != nil {
+		return c.TimestampMSFunc()
+	}
+	if c.Chain != nil {
+		return c.Chain.TimestampMS()
+	}
+	return 0
+}
+
+func (c *Chain) GetBlock(height uint64) (*legacy.Block, error) {
+	c.record("GetBlock", height)
+	if c.GetBlockFunc != nil {
+		return c.GetBlockFunc(height)
+	}
+	if c.Chain != nil {
+		return c.Chain.GetBlock(height)
+	}
+	return nil, ErrUnmocked
+}
+
+func (c *Chain) State() (*legacy.Block, *state.Snapshot) {
+	c.record("State")
+	if c.StateFunc != nil {
+		return c.StateFunc()
+	}
+	if c.Chain != nil {
+		return c.Chain.State()
+	}
+	return nil, nil
+}
+
+func (c *Chain) BlockWaiter(height uint64) <-chan struct{} {
+	c.record("BlockWaiter", height)
+	if c.BlockWaiterFunc != nil {
+		return c.BlockWaiterFunc(height)
+	}
+	if c.Chain != nil {
+		return c.Chain.BlockWaiter(height)
+	}
+	return make(chan struct{})
+}
+
+func (c *Chain) BlockSoonWaiter(ctx context.Context, height uint64) <-chan error {
+	c.record("BlockSoonWaiter", height)
+	if c.BlockSoonWaiterFunc != nil {
+		return c.BlockSoonWaiterFunc(ctx, height)
+	}
+	if c.Chain != nil {
+		return c.Chain.BlockSoonWaiter(ctx, height)
+	}
+	ch := make(chan error, 1)
+	ch <- ErrUnmocked
+	return ch
+}
+
+func (c *Chain) ValidateBlock(block, prev *legacy.Block) error {
+	c.record("ValidateBlock", block, prev)
+	if c.ValidateBlockFunc != nil {
+		return c.ValidateBlockFunc(block, prev)
+	}
+	if c.Chain != nil {
+		return c.Chain.ValidateBlock(block, prev)
+	}
+	return ErrUnmocked
+}
+
+func (c *Chain) ApplyValidBlock(block *legacy.Block) (*state.Snapshot, error) {
+	c.record("ApplyValidBlock", block)
+	if c.ApplyValidBlockFunc != nil {
+		return c.ApplyValidBlockFunc(block)
+	}
+	if c.Chain != nil {
+		return c.Chain.ApplyValidBlock(block)
+	}
+	return nil, ErrUnmocked
+}
+
+func (c *Chain) CommitAppliedBlock(ctx context.Context, block *legacy.Block, snapshot *state.Snapshot) error {
+	c.record("CommitAppliedBlock", block, snapshot)
+	if c.CommitAppliedBlockFunc != nil {
+		return c.CommitAppliedBlockFunc(ctx, block, snapshot)
+	}
+	if c.Chain != nil {
+		return c.Chain.CommitAppliedBlock(ctx, block, snapshot)
+	}
+	return ErrUnmocked
+}
+
+func (c *Chain) AddBlock(ctx context.Context, block *legacy.Block) error {
+	c.record("AddBlock", block)
+	if c.AddBlockFunc != nil {
+		return c.AddBlockFunc(ctx, block)
+	}
+	if c.Chain != nil {
+		return c.Chain.AddBlock(ctx, block)
+	}
+	return ErrUnmocked
+}
+
+func (c *Chain) Recover(ctx context.Context) (*legacy.Block, *state.Snapshot, error) {
+	c.record("Recover")
+	if c.RecoverFunc != nil {
+		return c.RecoverFunc(ctx)
+	}
+	if c.Chain != nil {
+		return c.Chain.Recover(ctx)
+	}
+	return nil, nil, ErrUnmocked
+}
+
+func (c *Chain) ValidateTx(tx *legacy.Tx) error {
+	c.record("ValidateTx", tx)
+	if c.ValidateTxFunc != nil {
+		return c.ValidateTxFunc(tx)
+	}
+	if c.Chain != nil {
+		return c.Chain.ValidateTx(tx)
+	}
+	return ErrUnmocked
+}
+
+func (c *Chain) ProveTx(height uint64, txID bc.Hash) (*protocol.TxProof, error) {
+	c.record("ProveTx", height, txID)
+	if c.ProveTxFunc != nil {
+		return c.ProveTxFunc(height, txID)
+	}
+	if c.Chain != nil {
+		return c.Chain.ProveTx(height, txID)
+	}
+	return nil, ErrUnmocked
+}
+
+func (c *Chain) ProveOutput(outputID bc.Hash) (*protocol.OutputProof, error) {
+	c.record("ProveOutput", outputID)
+	if c.ProveOutputFunc != nil {
+		return c.ProveOutputFunc(outputID)
+	}
+	if c.Chain != nil {
+		return c.Chain.ProveOutput(outputID)
+	}
+	return nil, ErrUnmocked
+}
+
+func (c *Chain) GetStore() protocol.Store {
+	c.record("GetStore")
+	if c.GetStoreFunc != nil {
+		return c.GetStoreFunc()
+	}
+	if c.Chain != nil {
+		return c.Chain.GetStore()
+	}
+	return nil
+}
+
+func (c *Chain) SetAssetsAmount(block *legacy.Block) {
+	c.record("SetAssetsAmount", block)
+	if c.SetAssetsAmountFunc != nil {
+		c.SetAssetsAmountFunc(block)
+		return
+	}
+	if c.Chain != nil {
+		c.Chain.SetAssetsAmount(block)
+	}
+}
+
+func (c *Chain) GetAssetsAmount() []interface{} {
+	c.record("GetAssetsAmount")
+	if c.GetAssetsAmountFunc != nil {
+		return c.GetAssetsAmountFunc()
+	}
+	if c.Chain != nil {
+		return c.Chain.GetAssetsAmount()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Package mock provides implementations of protocol.Interface and
+protocol.Store for tests that need control over what a chain or its
+store returns, or that want to check how they are called.
+
+Each mock has a function field for each method. A method calls its
+function if it is set, otherwise the wrapped implementation if there
+is one, otherwise it returns zero values and ErrUnmocked. Wrap
+prottest.NewChain or memstore.New to override only some methods of a
+working chain or store.
+
+Every call is recorded, and returned by Calls.
+*/
+package mock
+
+import (
+	"sync"
+
+	"github.com/bytom/errors"
+)
+
+// ErrUnmocked is returned by a mock method with neither a function
+// nor a wrapped implementation to call.
+var ErrUnmocked = errors.New("mock: method not mocked")
+
+// Call is a recorded call of a mock's method.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the calls made so far, in order.
+func (r *recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Count returns how many times method has been called.
+func (r *recorder) Count(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, c := range r.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest"
+	"github.com/bytom/protocol/prottest/memstore"
+)
+
+func TestChain(t *testing.T) {
+	var c Chain
+	if _, err := c.GetBlock(1); err != ErrUnmocked {
+		t.Errorf("unmocked GetBlock error = %v, want %v", err, ErrUnmocked)
+	}
+	if err := <-c.BlockSoonWaiter(context.Background(), 1); err != ErrUnmocked {
+		t.Errorf("unmocked BlockSoonWaiter error = %v, want %v", err, ErrUnmocked)
+	}
+
+	// Methods without a function call the wrapped chain.
+	c.Chain = prottest.NewChain(t)
+	genesis, err := c.GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HeightFunc = func() uint64 { return 7 }
+	if got := c.Height(); got != 7 {
+		t.Errorf("mocked Height = %d, want 7", got)
+	}
+	if b, _ := c.State(); b.Hash() != genesis.Hash() {
+		t.Errorf("wrapped State block %x, want genesis %x", b.Hash().Bytes(), genesis.Hash().Bytes())
+	}
+
+	want := []Call{
+		{Method: "GetBlock", Args: []interface{}{uint64(1)}},
+		{Method: "BlockSoonWaiter", Args: []interface{}{uint64(1)}},
+		{Method: "GetBlock", Args: []interface{}{uint64(0)}},
+		{Method: "Height"},
+		{Method: "State"},
+	}
+	if got := c.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %+v, want %+v", got, want)
+	}
+	if n := c.Count("GetBlock"); n != 2 {
+		t.Errorf("GetBlock called %d times, want 2", n)
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := &Store{Store: memstore.New()}
+	c := prottest.NewChain(t, prottest.WithStore(s))
+	if _, err := s.Store.GetBlock(0); err != nil {
+		t.Errorf("genesis block not saved to the wrapped store: %v", err)
+	}
+	if n := s.Count("SaveBlock"); n != 1 {
+		t.Errorf("SaveBlock called %d times, want 1", n)
+	}
+
+	// A store failing to save blocks stops the chain adding them.
+	errSave := errors.New("save failed")
+	s.SaveBlockFunc = func(*legacy.Block) error { return errSave }
+	if _, err := mining.Generate(ctx, c, prottest.TxPool(c), 1, []byte{0x51}); errors.Root(err) != errSave {
+		t.Errorf("generate error = %v, want %v", err, errSave)
+	}
+	if got := c.Height(); got != 0 {
+		t.Errorf("height = %d after failed save, want 0", got)
+	}
+
+	if err := (&Store{}).SaveBlock(new(legacy.Block)); err != ErrUnmocked {
+		t.Errorf("unmocked SaveBlock error = %v, want %v", err, ErrUnmocked)
+	}
+}
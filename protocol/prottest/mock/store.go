@@ -0,0 +1,92 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/state"
+)
+
+// Store is a mock protocol.Store.
+type Store struct {
+	recorder
+
+	// Store, if set, is called by methods without a function.
+	Store protocol.Store
+
+	HeightFunc         func() uint64
+	GetBlockFunc       func(height uint64) (*legacy.Block, error)
+	LatestSnapshotFunc func(ctx context.Context) (*state.Snapshot, uint64, error)
+	SaveBlockFunc      func(block *legacy.Block) error
+	FinalizeBlockFunc  func(ctx context.Context, height uint64) error
+	SaveSnapshotFunc   func(ctx context.Context, height uint64, snapshot *state.Snapshot) error
+}
+
+var _ protocol.Store = (*Store)(nil)
+
+func (s *Store) Height() uint64 {
+	s.record("Height")
+	if s.HeightFunc != nil {
+		return s.HeightFunc()
+	}
+	if s.Store != nil {
+		return s.Store.Height()
+	}
+	return 0
+}
+
+func (s *Store) GetBlock(height uint64) (*legacy.Block, error) {
+	s.record("GetBlock", height)
+	if s.GetBlockFunc != nil {
+		return s.GetBlockFunc(height)
+	}
+	if s.Store != nil {
+		return s.Store.GetBlock(height)
+	}
+	return nil, ErrUnmocked
+}
+
+func (s *Store) LatestSnapshot(ctx context.Context) (*state.Snapshot, uint64, error) {
+	s.record("LatestSnapshot")
+	if s.LatestSnapshotFunc != nil {
+		return s.LatestSnapshotFunc(ctx)
+	}
+	if s.Store != nil {
+		return s.Store.LatestSnapshot(ctx)
+	}
+	return nil, 0, ErrUnmocked
+}
+
+func (s *Store) SaveBlock(block *legacy.Block) error {
+	s.record("SaveBlock", block)
+	if s.SaveBlockFunc != nil {
+		return s.SaveBlockFunc(block)
+	}
+	if s.Store != nil {
+		return s.Store.SaveBlock(block)
+	}
+	return ErrUnmocked
+}
+
+func (s *Store) FinalizeBlock(ctx context.Context, height uint64) error {
+	s.record("FinalizeBlock", height)
+	if s.FinalizeBlockFunc != nil {
+		return s.FinalizeBlockFunc(ctx, height)
+	}
+	if s.Store != nil {
+		return s.Store.FinalizeBlock(ctx, height)
+	}
+	return ErrUnmocked
+}
+
+func (s *Store) SaveSnapshot(ctx context.Context, height uint64, snapshot *state.Snapshot) error {
+	s.record("SaveSnapshot", height, snapshot)
+	if s.SaveSnapshotFunc != nil {
+		return s.SaveSnapshotFunc(ctx, height, snapshot)
+	}
+	if s.Store != nil {
+		return s.Store.SaveSnapshot(ctx, height, snapshot)
+	}
+	return ErrUnmocked
+}
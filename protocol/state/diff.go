@@ -0,0 +1,113 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/patricia"
+)
+
+// Diff is the difference between two snapshots, A and B.
+type Diff struct {
+	AddedOutputs   []bc.Hash // in B's state tree but not A's
+	RemovedOutputs []bc.Hash // in A's state tree but not B's
+
+	AddedNonces   []bc.Hash // in B's nonce set but not A's
+	RemovedNonces []bc.Hash // in A's nonce set but not B's
+	ChangedNonces []bc.Hash // expiring at different times
+
+	Issued  []AssetDelta // capped assets issued in different amounts
+	Retired []AssetDelta // assets retired in different amounts
+}
+
+// AssetDelta is an asset total that differs between two snapshots.
+type AssetDelta struct {
+	AssetID bc.AssetID
+	A, B    uint64
+}
+
+// Compare returns the difference between a and b. Its lists are
+// sorted by ID.
+func Compare(a, b *Snapshot) *Diff {
+	d := new(Diff)
+	if a.Tree.RootHash() != b.Tree.RootHash() {
+		d.AddedOutputs = treeDiff(b.Tree, a.Tree)
+		d.RemovedOutputs = treeDiff(a.Tree, b.Tree)
+	}
+
+	for id, exp := range b.Nonces {
+		if aexp, ok := a.Nonces[id]; !ok {
+			d.AddedNonces = append(d.AddedNonces, id)
+		} else if aexp != exp {
+			d.ChangedNonces = append(d.ChangedNonces, id)
+		}
+	}
+	for id := range a.Nonces {
+		if _, ok := b.Nonces[id]; !ok {
+			d.RemovedNonces = append(d.RemovedNonces, id)
+		}
+	}
+	sortHashes(d.AddedNonces)
+	sortHashes(d.RemovedNonces)
+	sortHashes(d.ChangedNonces)
+
+	d.Issued = assetDeltas(a.Issued, b.Issued)
+	d.Retired = assetDeltas(a.Retired, b.Retired)
+	return d
+}
+
+// Empty tells whether the snapshots compared are the same.
+func (d *Diff) Empty() bool {
+	return len(d.AddedOutputs) == 0 && len(d.RemovedOutputs) == 0 &&
+		len(d.AddedNonces) == 0 && len(d.RemovedNonces) == 0 && len(d.ChangedNonces) == 0 &&
+		len(d.Issued) == 0 && len(d.Retired) == 0
+}
+
+// treeDiff returns the items of a not in b, in key order.
+func treeDiff(a, b *patricia.Tree) []bc.Hash {
+	var hashes []bc.Hash
+	patricia.Walk(a, func(item []byte) error {
+		if !b.Contains(item) {
+			var b32 [32]byte
+			copy(b32[:], item)
+			hashes = append(hashes, bc.NewHash(b32))
+		}
+		return nil
+	})
+	return hashes
+}
+
+func assetDeltas(a, b map[bc.AssetID]uint64) []AssetDelta {
+	var deltas []AssetDelta
+	for id, n := range b {
+		if a[id] != n {
+			deltas = append(deltas, AssetDelta{AssetID: id, A: a[id], B: n})
+		}
+	}
+	for id, n := range a {
+		if _, ok := b[id]; !ok {
+			deltas = append(deltas, AssetDelta{AssetID: id, A: n})
+		}
+	}
+	sort.Sort(byAssetID(deltas))
+	return deltas
+}
+
+func sortHashes(hashes []bc.Hash) {
+	sort.Sort(byHash(hashes))
+}
+
+type byHash []bc.Hash
+
+func (a byHash) Len() int           { return len(a) }
+func (a byHash) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byHash) Less(i, j int) bool { return bytes.Compare(a[i].Bytes(), a[j].Bytes()) < 0 }
+
+type byAssetID []AssetDelta
+
+func (a byAssetID) Len() int      { return len(a) }
+func (a byAssetID) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byAssetID) Less(i, j int) bool {
+	return bytes.Compare(a[i].AssetID.Bytes(), a[j].AssetID.Bytes()) < 0
+}
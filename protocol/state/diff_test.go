@@ -0,0 +1,57 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytom/protocol/bc"
+)
+
+func TestCompare(t *testing.T) {
+	h := func(b byte) bc.Hash { return bc.NewHash([32]byte{b}) }
+	asset := func(b byte) bc.AssetID { return bc.NewAssetID([32]byte{b}) }
+
+	a, b := Empty(), Empty()
+	if d := Compare(a, b); !d.Empty() {
+		t.Fatalf("empty snapshots differ: %+v", d)
+	}
+
+	for _, id := range []bc.Hash{h(1), h(2), h(3)} {
+		if err := a.Tree.Insert(id.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []bc.Hash{h(2), h(3), h(4), h(5)} {
+		if err := b.Tree.Insert(id.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Nonces[h(6)] = 10
+	a.Nonces[h(7)] = 10
+	b.Nonces[h(7)] = 20
+	b.Nonces[h(8)] = 10
+	a.Issued[asset(1)] = 100
+	b.Issued[asset(1)] = 100
+	a.Retired[asset(1)] = 5
+	b.Retired[asset(1)] = 7
+	b.Retired[asset(2)] = 1
+
+	got := Compare(a, b)
+	want := &Diff{
+		AddedOutputs:   []bc.Hash{h(4), h(5)},
+		RemovedOutputs: []bc.Hash{h(1)},
+		AddedNonces:    []bc.Hash{h(8)},
+		RemovedNonces:  []bc.Hash{h(6)},
+		ChangedNonces:  []bc.Hash{h(7)},
+		Retired: []AssetDelta{
+			{AssetID: asset(1), A: 5, B: 7},
+			{AssetID: asset(2), A: 0, B: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() = %+v, want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Error("Empty() = true, want false")
+	}
+}
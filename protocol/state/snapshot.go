@@ -2,28 +2,55 @@ package state
 
 import (
 	"fmt"
+	"math"
 
+	"github.com/bytom/consensus"
 	"github.com/bytom/errors"
+	"github.com/bytom/math/checked"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/patricia"
+	"github.com/bytom/protocol/vm/vmutil"
 )
 
 // Snapshot encompasses a snapshot of entire blockchain state. It
-// consists of a patricia state tree and the nonce set.
+// consists of a patricia state tree, the nonce set, the issued
+// supply of capped assets and the retired supply of every asset.
 //
 // Nonces maps a nonce entry's ID to the time (in Unix millis) at
 // which it should expire from the nonce set.
 //
+// Issued maps the ID of each asset whose issuance program declares a
+// maximum supply to the total amount of it issued from
+// consensus.IssuanceCapActivationHeight on. Issuances below that
+// height are neither capped nor counted.
+//
+// Retired maps an asset's ID to the total amount of it permanently
+// removed from circulation by retirement entries. It is bookkeeping
+// only, never a reason to reject a transaction: a total that would
+// overflow stays at math.MaxUint64.
+//
 // TODO: consider making type Snapshot truly immutable.  We already
 // handle it that way in many places (with explicit calls to Copy to
 // get the right behavior).  PruneNonces and the Apply functions would
 // have to produce new Snapshots rather than updating Snapshots in
 // place.
 type Snapshot struct {
-	Tree   *patricia.Tree
-	Nonces map[bc.Hash]uint64
+	Tree    *patricia.Tree
+	Nonces  map[bc.Hash]uint64
+	Issued  map[bc.AssetID]uint64
+	Retired map[bc.AssetID]uint64
 }
 
+var (
+	// ErrIssuanceCap is returned when a transaction would issue more
+	// of an asset than its issuance program allows.
+	ErrIssuanceCap = errors.New("issuance exceeds the asset's maximum supply")
+
+	// ErrUniqueIssuance is returned when a transaction issues a unique
+	// asset, one with a maximum supply of one, in another amount.
+	ErrUniqueIssuance = errors.New("unique asset must be issued in an amount of one")
+)
+
 // PruneNonces modifies a Snapshot, removing all nonce IDs with
 // expiration times earlier than the provided timestamp.
 func (s *Snapshot) PruneNonces(timestampMS uint64) {
@@ -35,25 +62,35 @@ func (s *Snapshot) PruneNonces(timestampMS uint64) {
 }
 
 // Copy makes a copy of provided snapshot. Copying a snapshot is an
-// O(n) operation where n is the number of nonces in the snapshot's
-// nonce set.
+// O(n) operation where n is the number of nonces and tracked assets
+// in the snapshot.
 func Copy(original *Snapshot) *Snapshot {
 	c := &Snapshot{
-		Tree:   new(patricia.Tree),
-		Nonces: make(map[bc.Hash]uint64, len(original.Nonces)),
+		Tree:    new(patricia.Tree),
+		Nonces:  make(map[bc.Hash]uint64, len(original.Nonces)),
+		Issued:  make(map[bc.AssetID]uint64, len(original.Issued)),
+		Retired: make(map[bc.AssetID]uint64, len(original.Retired)),
 	}
 	*c.Tree = *original.Tree
 	for k, v := range original.Nonces {
 		c.Nonces[k] = v
 	}
+	for k, v := range original.Issued {
+		c.Issued[k] = v
+	}
+	for k, v := range original.Retired {
+		c.Retired[k] = v
+	}
 	return c
 }
 
 // Empty returns an empty state snapshot.
 func Empty() *Snapshot {
 	return &Snapshot{
-		Tree:   new(patricia.Tree),
-		Nonces: make(map[bc.Hash]uint64),
+		Tree:    new(patricia.Tree),
+		Nonces:  make(map[bc.Hash]uint64),
+		Issued:  make(map[bc.AssetID]uint64),
+		Retired: make(map[bc.AssetID]uint64),
 	}
 }
 
@@ -61,7 +98,7 @@ func Empty() *Snapshot {
 func (s *Snapshot) ApplyBlock(block *bc.Block) error {
 	s.PruneNonces(block.TimestampMs)
 	for i, tx := range block.Transactions {
-		err := s.ApplyTx(tx)
+		err := s.ApplyTx(tx, block.Height)
 		if err != nil {
 			return errors.Wrapf(err, "applying block transaction %d", i)
 		}
@@ -69,8 +106,15 @@ func (s *Snapshot) ApplyBlock(block *bc.Block) error {
 	return nil
 }
 
-// ApplyTx updates s in place.
-func (s *Snapshot) ApplyTx(tx *bc.Tx) error {
+// ApplyTx updates s in place with tx, in a block at the given
+// height.
+func (s *Snapshot) ApplyTx(tx *bc.Tx, height uint64) error {
+	// Capped assets must not be issued beyond their maximum supply.
+	issued, err := s.issuedAfter(tx, height)
+	if err != nil {
+		return err
+	}
+
 	for _, n := range tx.NonceIDs {
 		// Add new nonces. They must not conflict with nonces already
 		// present.
@@ -90,10 +134,27 @@ func (s *Snapshot) ApplyTx(tx *bc.Tx) error {
 	}
 
 	// Add new outputs. They must not yet be present.
+	var retired map[bc.AssetID]uint64
 	for _, id := range tx.TxHeader.ResultIds {
 		// Ensure that this result is an output. It could be a retirement
-		// which should not be inserted into the state tree.
+		// which should not be inserted into the state tree, but is
+		// counted toward the asset's retired supply.
 		e := tx.Entries[*id]
+		if r, ok := e.(*bc.Retirement); ok {
+			if retired == nil {
+				retired = make(map[bc.AssetID]uint64)
+			}
+			assetID := *r.Source.Value.AssetId
+			total, seen := retired[assetID]
+			if !seen {
+				total = s.Retired[assetID]
+			}
+			if total, ok = checked.AddUint64(total, r.Source.Value.Amount); !ok {
+				total = math.MaxUint64
+			}
+			retired[assetID] = total
+			continue
+		}
 		if _, ok := e.(*bc.Output); !ok {
 			continue
 		}
@@ -103,5 +164,67 @@ func (s *Snapshot) ApplyTx(tx *bc.Tx) error {
 			return err
 		}
 	}
+
+	if len(issued) > 0 && s.Issued == nil {
+		s.Issued = make(map[bc.AssetID]uint64, len(issued))
+	}
+	for assetID, amount := range issued {
+		s.Issued[assetID] = amount
+	}
+	if len(retired) > 0 && s.Retired == nil {
+		s.Retired = make(map[bc.AssetID]uint64, len(retired))
+	}
+	for assetID, amount := range retired {
+		s.Retired[assetID] = amount
+	}
 	return nil
 }
+
+// CheckIssuance checks that tx, in a block at the given height, does
+// not issue more of any capped asset than its issuance program
+// allows, given the supply already issued in s. It does not modify s.
+func (s *Snapshot) CheckIssuance(tx *bc.Tx, height uint64) error {
+	_, err := s.issuedAfter(tx, height)
+	return err
+}
+
+// issuedAfter returns the new issued supply of each capped asset
+// that tx, in a block at the given height, issues.
+func (s *Snapshot) issuedAfter(tx *bc.Tx, height uint64) (map[bc.AssetID]uint64, error) {
+	if height < consensus.IssuanceCapActivationHeight {
+		return nil, nil
+	}
+	var issued map[bc.AssetID]uint64
+	for _, id := range tx.InputIDs {
+		iss, err := tx.Issuance(id)
+		if err != nil {
+			continue
+		}
+		def := iss.WitnessAssetDefinition
+		if def == nil || def.IssuanceProgram == nil {
+			continue
+		}
+		maxSupply, ok := vmutil.ParseIssuanceCap(def.IssuanceProgram.Code)
+		if !ok {
+			continue
+		}
+
+		assetID := *iss.Value.AssetId
+		if maxSupply == 1 && iss.Value.Amount != 1 {
+			return nil, errors.WithDetailf(ErrUniqueIssuance, "issuing %d units of unique asset %x", iss.Value.Amount, assetID.Bytes())
+		}
+		if issued == nil {
+			issued = make(map[bc.AssetID]uint64)
+		}
+		total, seen := issued[assetID]
+		if !seen {
+			total = s.Issued[assetID]
+		}
+		total, ok = checked.AddUint64(total, iss.Value.Amount)
+		if !ok || total > maxSupply {
+			return nil, errors.WithDetailf(ErrIssuanceCap, "issuing %d units of asset %x would exceed its maximum supply of %d", iss.Value.Amount, assetID.Bytes(), maxSupply)
+		}
+		issued[assetID] = total
+	}
+	return issued, nil
+}
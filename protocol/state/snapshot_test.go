@@ -1,13 +1,18 @@
 package state
 
 import (
+	"math"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/bctest"
 	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
 )
 
 func TestApplyTxSpend(t *testing.T) {
@@ -38,14 +43,14 @@ func TestApplyTxSpend(t *testing.T) {
 	})
 
 	// Apply the spend transaction.
-	err = snap.ApplyTx(tx)
+	err = snap.ApplyTx(tx, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if snap.Tree.Contains(spentOutputID.Bytes()) {
 		t.Error("snapshot contains spent prevout")
 	}
-	err = snap.ApplyTx(tx)
+	err = snap.ApplyTx(tx, 1)
 	if err == nil {
 		t.Error("expected error applying spend twice, got nil")
 	}
@@ -54,11 +59,11 @@ func TestApplyTxSpend(t *testing.T) {
 func TestApplyIssuanceTwice(t *testing.T) {
 	snap := Empty()
 	issuance := legacy.MapTx(&bctest.NewIssuanceTx(t, bc.EmptyStringHash).TxData)
-	err := snap.ApplyTx(issuance)
+	err := snap.ApplyTx(issuance, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = snap.ApplyTx(issuance)
+	err = snap.ApplyTx(issuance, 1)
 	if err == nil {
 		t.Errorf("expected error for duplicate nonce, got %s", err)
 	}
@@ -66,7 +71,7 @@ func TestApplyIssuanceTwice(t *testing.T) {
 
 func TestCopySnapshot(t *testing.T) {
 	snap := Empty()
-	err := snap.ApplyTx(legacy.MapTx(&bctest.NewIssuanceTx(t, bc.EmptyStringHash).TxData))
+	err := snap.ApplyTx(legacy.MapTx(&bctest.NewIssuanceTx(t, bc.EmptyStringHash).TxData), 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,7 +88,7 @@ func TestApplyBlock(t *testing.T) {
 		tx.MaxTime = maxTime
 	})
 	snap := Empty()
-	err := snap.ApplyTx(legacy.MapTx(&issuance.TxData))
+	err := snap.ApplyTx(legacy.MapTx(&issuance.TxData), 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -105,3 +110,115 @@ func TestApplyBlock(t *testing.T) {
 		t.Errorf("got %d nonces, want 0", n)
 	}
 }
+
+func TestApplyIssuanceCap(t *testing.T) {
+	prog, err := vmutil.IssuanceCapProgram(150, []byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(nonce byte, amount uint64) *bc.Tx {
+		txin := legacy.NewIssuanceInput([]byte{nonce}, amount, nil, bc.Hash{}, prog, nil, nil)
+		return legacy.MapTx(&legacy.TxData{
+			Version: 1,
+			MaxTime: 1,
+			Inputs:  []*legacy.TxInput{txin},
+			Outputs: []*legacy.TxOutput{
+				legacy.NewTxOutput(txin.AssetID(), amount, []byte{nonce}, nil),
+			},
+		})
+	}
+
+	// Below the activation height, caps are neither enforced nor
+	// counted.
+	snap := Empty()
+	if err := snap.ApplyTx(issue(0, 200), consensus.IssuanceCapActivationHeight-1); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Issued) != 0 {
+		t.Errorf("issued below the activation height = %v, want none", snap.Issued)
+	}
+
+	height := consensus.IssuanceCapActivationHeight
+	first := issue(1, 100)
+	if err := snap.ApplyTx(first, height); err != nil {
+		t.Fatal(err)
+	}
+	assetID := *first.Entries[first.InputIDs[0]].(*bc.Issuance).Value.AssetId
+	if got := snap.Issued[assetID]; got != 100 {
+		t.Errorf("issued = %d, want 100", got)
+	}
+
+	second := issue(2, 51)
+	if err := snap.CheckIssuance(second, height); errors.Root(err) != ErrIssuanceCap {
+		t.Errorf("CheckIssuance over cap: got error %v, want %v", err, ErrIssuanceCap)
+	}
+	if err := snap.ApplyTx(second, height); errors.Root(err) != ErrIssuanceCap {
+		t.Errorf("ApplyTx over cap: got error %v, want %v", err, ErrIssuanceCap)
+	}
+	if got := snap.Issued[assetID]; got != 100 {
+		t.Errorf("issued after rejected tx = %d, want 100", got)
+	}
+
+	if err := snap.ApplyTx(issue(3, 50), height); err != nil {
+		t.Errorf("issuing up to the cap: got error %v", err)
+	}
+	if got := snap.Issued[assetID]; got != 150 {
+		t.Errorf("issued = %d, want 150", got)
+	}
+
+	unique, err := vmutil.IssuanceCapProgram(1, []byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog = unique
+	if err := snap.CheckIssuance(issue(4, 0), height); errors.Root(err) != ErrUniqueIssuance {
+		t.Errorf("unique asset issued in amount zero: got error %v, want %v", err, ErrUniqueIssuance)
+	}
+}
+
+func TestApplyRetirement(t *testing.T) {
+	txin := legacy.NewIssuanceInput([]byte{1}, 100, nil, bc.Hash{}, []byte{byte(vm.OP_TRUE)}, nil, nil)
+	assetID := txin.AssetID()
+	tx := legacy.MapTx(&legacy.TxData{
+		Version: 1,
+		MaxTime: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(assetID, 60, []byte{0xbe, 0xef}, nil),
+			legacy.NewTxOutput(assetID, 40, []byte{byte(vm.OP_FAIL)}, nil),
+		},
+	})
+
+	snap := Empty()
+	if err := snap.ApplyTx(tx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := snap.Retired[assetID]; got != 40 {
+		t.Errorf("retired = %d, want 40", got)
+	}
+	if _, ok := snap.Issued[assetID]; ok {
+		t.Error("uncapped asset is tracked in issued supply")
+	}
+}
+
+func TestRetiredSupplySaturates(t *testing.T) {
+	txin := legacy.NewIssuanceInput([]byte{1}, 100, nil, bc.Hash{}, []byte{byte(vm.OP_TRUE)}, nil, nil)
+	assetID := txin.AssetID()
+	tx := legacy.MapTx(&legacy.TxData{
+		Version: 1,
+		MaxTime: 1,
+		Inputs:  []*legacy.TxInput{txin},
+		Outputs: []*legacy.TxOutput{
+			legacy.NewTxOutput(assetID, 100, []byte{byte(vm.OP_FAIL)}, nil),
+		},
+	})
+
+	snap := Empty()
+	snap.Retired[assetID] = math.MaxUint64 - 10
+	if err := snap.ApplyTx(tx, 1); err != nil {
+		t.Fatalf("retiring past the maximum total: got error %v", err)
+	}
+	if got := snap.Retired[assetID]; got != math.MaxUint64 {
+		t.Errorf("retired = %d, want %d", got, uint64(math.MaxUint64))
+	}
+}
@@ -18,6 +18,11 @@ func (c *Chain) ValidateTx(tx *legacy.Tx) error {
 	if err := c.checkIssuanceWindow(newTx); err != nil {
 		return err
 	}
+	if prev, snapshot := c.State(); prev != nil && snapshot != nil {
+		if err := snapshot.CheckIssuance(newTx, prev.Height+1); err != nil {
+			return errors.Sub(ErrBadTx, err)
+		}
+	}
 	if ok := c.txPool.HaveTransaction(&newTx.ID); ok {
 		return c.txPool.GetErrCache(&newTx.ID)
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/bytom/math/checked"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
 )
 
 const (
@@ -79,6 +80,7 @@ type validationState struct {
 
 var (
 	errGasCalculate             = errors.New("gas usage calculate got a math error")
+	errIssuanceCap              = errors.New("issuance exceeds maximum supply")
 	errEmptyResults             = errors.New("transaction has no results")
 	errMismatchedAssetID        = errors.New("mismatched asset id")
 	errMismatchedBlock          = errors.New("mismatched block")
@@ -98,6 +100,7 @@ var (
 	errWorkProof                = errors.New("invalid difficulty proof of work")
 	errTxVersion                = errors.New("invalid transaction version")
 	errUnbalanced               = errors.New("unbalanced")
+	errUniqueIssuance           = errors.New("unique asset must be issued in an amount of one")
 	errUntimelyTransaction      = errors.New("block timestamp outside transaction time range")
 	errVersionRegression        = errors.New("version regression")
 	errWrongBlockSize           = errors.New("block size is too big")
@@ -266,6 +269,17 @@ func checkValid(vs *validationState, e bc.Entry) (err error) {
 			return errors.WithDetailf(errMismatchedAssetID, "asset ID is %x, issuance wants %x", computedAssetID.Bytes(), e.Value.AssetId.Bytes())
 		}
 
+		// The total supply of a capped asset is enforced against the
+		// state snapshot; a single issuance can be checked here.
+		if maxSupply, ok := vmutil.ParseIssuanceCap(e.WitnessAssetDefinition.IssuanceProgram.Code); ok && vs.block.Height >= consensus.IssuanceCapActivationHeight {
+			if e.Value.Amount > maxSupply {
+				return errors.WithDetailf(errIssuanceCap, "issuing %d units of asset %x, maximum supply is %d", e.Value.Amount, e.Value.AssetId.Bytes(), maxSupply)
+			}
+			if maxSupply == 1 && e.Value.Amount != 1 {
+				return errors.WithDetailf(errUniqueIssuance, "issuing %d units of unique asset %x", e.Value.Amount, e.Value.AssetId.Bytes())
+			}
+		}
+
 		anchor, ok := vs.tx.Entries[*e.AnchorId]
 		if !ok {
 			return errors.Wrapf(bc.ErrMissingEntry, "entry for issuance anchor %x not found", e.AnchorId.Bytes())
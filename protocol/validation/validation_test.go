@@ -12,6 +12,7 @@ import (
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/legacy"
 	"github.com/bytom/protocol/vm"
+	"github.com/bytom/protocol/vm/vmutil"
 	"github.com/bytom/testutil"
 
 	"github.com/davecgh/go-spew/spew"
@@ -405,6 +406,87 @@ func TestTxValidation(t *testing.T) {
 	}
 }
 
+func TestIssuanceCapValidation(t *testing.T) {
+	inner, err := vm.Assemble("ADD 5 NUMEQUAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capped := func(maxSupply uint64) bc.Program {
+		code, err := vmutil.IssuanceCapProgram(maxSupply, inner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bc.Program{VmVersion: 1, Code: code}
+	}
+	// withIssuance returns a sample transaction whose issuance input,
+	// of an asset issued by prog, is for amount units instead of 10.
+	withIssuance := func(prog bc.Program, amount uint64) *txFixture {
+		base := sample(t, &txFixture{issuanceProg: prog})
+		inputs := []*legacy.TxInput{
+			legacy.NewIssuanceInput([]byte{3}, amount, []byte{4}, base.initialBlockID, prog.Code, base.issuanceArgs, base.assetDef),
+			base.txInputs[1],
+			base.txInputs[2],
+		}
+		outputs := []*legacy.TxOutput{
+			base.txOutputs[0],
+			legacy.NewTxOutput(base.assetID, 35+amount, base.txOutputs[1].ControlProgram, nil),
+		}
+		return sample(t, &txFixture{
+			issuanceProg: prog,
+			assetID:      base.assetID,
+			txInputs:     inputs,
+			txOutputs:    outputs,
+		})
+	}
+
+	cases := []struct {
+		desc    string
+		fixture *txFixture
+		err     error
+	}{
+		{
+			desc:    "issuance within cap",
+			fixture: sample(t, &txFixture{issuanceProg: capped(10)}),
+		},
+		{
+			desc:    "issuance above cap",
+			fixture: sample(t, &txFixture{issuanceProg: capped(9)}),
+			err:     errIssuanceCap,
+		},
+		{
+			desc:    "unique asset issued once",
+			fixture: withIssuance(capped(1), 1),
+		},
+		{
+			desc:    "unique asset issued in amount zero",
+			fixture: withIssuance(capped(1), 0),
+			err:     errUniqueIssuance,
+		},
+		{
+			desc:    "unique asset issued in amount two",
+			fixture: withIssuance(capped(1), 2),
+			err:     errIssuanceCap,
+		},
+	}
+
+	block := &bc.Block{BlockHeader: &bc.BlockHeader{Height: consensus.IssuanceCapActivationHeight}}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			tx := legacy.NewTx(*c.fixture.tx).Tx
+			_, err := ValidateTx(tx, block)
+			if rootErr(err) != c.err {
+				t.Errorf("got error %s, want %s", err, c.err)
+			}
+		})
+	}
+
+	// Below the activation height, caps are not enforced.
+	tx := legacy.NewTx(*cases[1].fixture.tx).Tx
+	if _, err := ValidateTx(tx, mockBlock()); err != nil {
+		t.Errorf("issuance above cap before activation: got error %s", err)
+	}
+}
+
 func TestValidateBlock(t *testing.T) {
 	cases := []struct {
 		block *bc.Block
@@ -3,9 +3,12 @@ package validation
 import (
 	"bytes"
 
+	"github.com/bytom/consensus"
 	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/encoding/blockchain"
 	"github.com/bytom/errors"
 	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
 	"github.com/bytom/protocol/vm"
 )
 
@@ -109,6 +112,9 @@ func NewTxVMContext(vs *validationState, entry bc.Entry, prog *bc.Program, args
 		SpentOutputID: spentOutputID,
 		CheckOutput:   ec.checkOutput,
 	}
+	if blockHeigh >= consensus.TxProofActivationHeight {
+		result.CheckTxProof = CheckTxProof
+	}
 
 	return result
 }
@@ -193,3 +199,64 @@ func (ec *entryContext) checkOutput(index uint64, data []byte, amount uint64, as
 
 	return false, vm.ErrContext
 }
+
+// CheckTxProof reports whether proof, the concatenated hashes of a
+// merkle branch from the leaf up, shows that the transaction txID is
+// at index among count transactions of the first block in headers,
+// and whether headers hold a chain of more than depth blocks whose
+// hashes all meet the target of bits. headers is the serialized
+// header of the block with the transaction, then those of the blocks
+// built on it, each prefixed with its length as a varint.
+//
+// Forging a proof costs as much as mining depth+1 blocks at bits.
+// The blocks may still be from any chain: a program must choose bits
+// and depth so that this costs more than what it guards.
+func CheckTxProof(headers, txID, proof []byte, index, count, bits, depth uint64) (bool, error) {
+	if len(txID) != 32 || len(proof)%32 != 0 {
+		return false, vm.ErrBadValue
+	}
+	if count > consensus.MaxBlockTxs {
+		return false, nil
+	}
+
+	var (
+		root       bc.Hash
+		prevHash   bc.Hash
+		prevHeight uint64
+		n          uint64
+	)
+	r := blockchain.NewReader(headers)
+	for r.Len() > 0 {
+		header, err := blockchain.ReadVarstr31(r)
+		if err != nil {
+			return false, nil
+		}
+		var bh legacy.BlockHeader
+		if err := bh.Scan(header); err != nil {
+			return false, nil
+		}
+		if n == 0 {
+			root = bh.TransactionsMerkleRoot
+		} else if bh.PreviousBlockHash != prevHash || bh.Height != prevHeight+1 {
+			return false, nil
+		}
+		prevHash, prevHeight = bh.Hash(), bh.Height
+		if !consensus.CheckProofOfWork(&prevHash, bits) {
+			return false, nil
+		}
+		n++
+	}
+	if n == 0 || n-1 < depth {
+		return false, nil
+	}
+
+	hashes := make([]bc.Hash, len(proof)/32)
+	for i := range hashes {
+		var b [32]byte
+		copy(b[:], proof[32*i:])
+		hashes[i] = bc.NewHash(b)
+	}
+	var id [32]byte
+	copy(id[:], txID)
+	return bc.ValidateMerkleProof(root, bc.NewHash(id), index, count, hashes), nil
+}
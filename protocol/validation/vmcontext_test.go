@@ -1,10 +1,14 @@
 package validation
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"testing"
 
+	"github.com/bytom/consensus"
+	"github.com/bytom/encoding/blockchain"
 	"github.com/bytom/errors"
 	"github.com/bytom/protocol/bc"
 	"github.com/bytom/protocol/bc/legacy"
@@ -110,3 +114,41 @@ func mustDecodeHex(h string) []byte {
 	}
 	return bits
 }
+
+func TestCheckTxProofCount(t *testing.T) {
+	tx := legacy.NewTx(legacy.TxData{Version: 1})
+	root, err := bc.MerkleRoot([]*bc.Tx{tx.Tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	easy := consensus.BigToCompact(new(big.Int).Lsh(big.NewInt(1), 256))
+	bh := legacy.BlockHeader{
+		Height:          1,
+		Bits:            easy,
+		BlockCommitment: legacy.BlockCommitment{TransactionsMerkleRoot: root},
+	}
+	header, err := bh.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers bytes.Buffer
+	blockchain.WriteVarstr31(&headers, header.([]byte))
+
+	cases := []struct {
+		count uint64
+		want  bool
+	}{
+		{1, true},
+		{consensus.MaxBlockTxs + 1, false},
+		{1<<63 - 1, false},
+	}
+	for _, c := range cases {
+		got, err := CheckTxProof(headers.Bytes(), tx.ID.Bytes(), nil, 0, c.count, easy, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("CheckTxProof(count %d) = %t, want %t", c.count, got, c.want)
+		}
+	}
+}
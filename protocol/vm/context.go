@@ -37,4 +37,11 @@ type Context struct {
 
 	TxSigHash   func() []byte
 	CheckOutput func(index uint64, data []byte, amount uint64, assetID []byte, vmVersion uint64, code []byte, expansion bool) (bool, error)
+
+	// CheckTxProof reports whether proof shows that txID is at index
+	// among count transactions of the first block in headers, and
+	// whether headers chain more than depth blocks that all meet the
+	// target of bits. It is nil where the CHECKTXPROOF instruction is
+	// not yet active, and the instruction is then an expansion opcode.
+	CheckTxProof func(headers, txID, proof []byte, index, count, bits, depth uint64) (bool, error)
 }
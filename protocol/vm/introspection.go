@@ -195,3 +195,58 @@ func opBlockHeigh(vm *virtualMachine) error {
 	}
 	return vm.pushInt64(int64(*vm.context.BlockHeigh), true)
 }
+
+// opCheckTxProof checks that a transaction is included in a block of
+// another chain, and that blocks were mined on top of it. It expects
+// the stack
+//
+//	[... HEADERS PROOF INDEX COUNT TXID BITS DEPTH]
+//
+// where HEADERS are the length-prefixed serialized headers of the
+// block and of at least DEPTH blocks built on it, PROOF the
+// concatenated hashes of the transaction's merkle branch from the
+// leaf up, and BITS the compact target every block's hash must meet.
+func opCheckTxProof(vm *virtualMachine) error {
+	depth, err := vm.popInt64(true)
+	if err != nil {
+		return err
+	}
+	bits, err := vm.popInt64(true)
+	if err != nil {
+		return err
+	}
+	txID, err := vm.pop(true)
+	if err != nil {
+		return err
+	}
+	count, err := vm.popInt64(true)
+	if err != nil {
+		return err
+	}
+	index, err := vm.popInt64(true)
+	if err != nil {
+		return err
+	}
+	proof, err := vm.pop(true)
+	if err != nil {
+		return err
+	}
+	headers, err := vm.pop(true)
+	if err != nil {
+		return err
+	}
+	if depth < 0 || bits < 0 || count < 0 || index < 0 || len(txID) != 32 || len(proof)%32 != 0 {
+		return ErrBadValue
+	}
+
+	err = vm.applyCost(512 + 4*int64(len(headers)) + 64*int64(len(proof)/32))
+	if err != nil {
+		return err
+	}
+
+	ok, err := vm.context.CheckTxProof(headers, txID, proof, uint64(index), uint64(count), uint64(bits), uint64(depth))
+	if err != nil {
+		return err
+	}
+	return vm.pushBool(ok, true)
+}
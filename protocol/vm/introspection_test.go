@@ -224,6 +224,59 @@ func TestIntrospectionOps(t *testing.T) {
 			context: &Context{},
 		},
 		wantErr: ErrRunLimitExceeded,
+	}, {
+		op: OP_CHECKTXPROOF,
+		startVM: &virtualMachine{
+			dataStack: [][]byte{
+				[]byte("headers"),
+				make([]byte, 64),
+				{1},
+				{3},
+				make([]byte, 32),
+				{1},
+				{6},
+			},
+			context: &Context{
+				CheckTxProof: func([]byte, []byte, []byte, uint64, uint64, uint64, uint64) (bool, error) {
+					return true, nil
+				},
+			},
+		},
+		wantVM: &virtualMachine{
+			runLimit:     49486,
+			deferredCost: -154,
+			dataStack:    [][]byte{{1}},
+		},
+	}, {
+		op: OP_CHECKTXPROOF,
+		startVM: &virtualMachine{
+			dataStack: [][]byte{
+				[]byte("headers"),
+				make([]byte, 63),
+				{1},
+				{3},
+				make([]byte, 32),
+				{1},
+				{6},
+			},
+			context: &Context{
+				CheckTxProof: func([]byte, []byte, []byte, uint64, uint64, uint64, uint64) (bool, error) {
+					return true, nil
+				},
+			},
+		},
+		wantErr: ErrBadValue,
+	}, {
+		// Until it is active, CHECKTXPROOF is an expansion opcode.
+		op: OP_CHECKTXPROOF,
+		startVM: &virtualMachine{
+			dataStack: [][]byte{{1}},
+			context:   &Context{},
+		},
+		wantVM: &virtualMachine{
+			runLimit:  49999,
+			dataStack: [][]byte{{1}},
+		},
 	}, {
 		op: OP_ASSET,
 		startVM: &virtualMachine{
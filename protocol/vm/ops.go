@@ -213,6 +213,8 @@ const (
 	OP_OUTPUTID    Op = 0xcb
 	OP_NONCE       Op = 0xcc
 	OP_BLOCKHEIGH  Op = 0xcd
+
+	OP_CHECKTXPROOF Op = 0xce
 )
 
 type opInfo struct {
@@ -323,6 +325,8 @@ var (
 		OP_OUTPUTID:    {OP_OUTPUTID, "OUTPUTID", opOutputID},
 		OP_NONCE:       {OP_NONCE, "NONCE", opNonce},
 		OP_BLOCKHEIGH:  {OP_BLOCKHEIGH, "BLOCKHEIGH", opBlockHeigh},
+
+		OP_CHECKTXPROOF: {OP_CHECKTXPROOF, "CHECKTXPROOF", opCheckTxProof},
 	}
 
 	opsByName map[string]opInfo
@@ -89,6 +89,15 @@ func (vm *virtualMachine) run() error {
 	return nil
 }
 
+// isExpansion reports whether op is an expansion opcode in vm's
+// context. An instruction that is not active yet is one.
+func (vm *virtualMachine) isExpansion(op Op) bool {
+	if op == OP_CHECKTXPROOF {
+		return vm.context == nil || vm.context.CheckTxProof == nil
+	}
+	return isExpansion[op]
+}
+
 func (vm *virtualMachine) step() error {
 	inst, err := ParseOp(vm.program, vm.pc)
 	if err != nil {
@@ -106,7 +115,7 @@ func (vm *virtualMachine) step() error {
 		fmt.Fprint(TraceOut, "\n")
 	}
 
-	if isExpansion[inst.Op] {
+	if vm.isExpansion(inst.Op) {
 		if vm.expansionReserved {
 			return ErrDisallowedOpcode
 		}
@@ -347,6 +347,30 @@ func TestStep(t *testing.T) {
 			pc:       1,
 			nextPC:   1,
 		},
+	}, {
+		// CHECKTXPROOF is an expansion opcode until it is active.
+		startVM: &virtualMachine{
+			program:   []byte{byte(OP_CHECKTXPROOF)},
+			runLimit:  100,
+			dataStack: [][]byte{{1}},
+			context:   &Context{},
+		},
+		wantVM: &virtualMachine{
+			program:   []byte{byte(OP_CHECKTXPROOF)},
+			runLimit:  99,
+			pc:        1,
+			nextPC:    1,
+			dataStack: [][]byte{{1}},
+			context:   &Context{},
+		},
+	}, {
+		startVM: &virtualMachine{
+			program:           []byte{byte(OP_CHECKTXPROOF)},
+			runLimit:          100,
+			expansionReserved: true,
+			context:           &Context{},
+		},
+		wantErr: ErrDisallowedOpcode,
 	}}
 
 	for i, c := range cases {
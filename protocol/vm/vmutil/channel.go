@@ -0,0 +1,13 @@
+package vmutil
+
+import "github.com/bytom/crypto/ed25519"
+
+// ChannelFundingProgram returns the control program of a payment
+// channel's funding output, which can only be spent with signatures
+// from a quorum of each party's keys over the same predicate. It has
+// the form of RestrictedTransferProgram, with the opener of the
+// channel in the place of the holder, so the opener's witness
+// component comes first.
+func ChannelFundingProgram(openerPubkeys []ed25519.PublicKey, openerQuorum int, acceptorPubkeys []ed25519.PublicKey, acceptorQuorum int) ([]byte, error) {
+	return RestrictedTransferProgram(openerPubkeys, openerQuorum, acceptorPubkeys, acceptorQuorum)
+}
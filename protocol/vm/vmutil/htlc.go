@@ -0,0 +1,162 @@
+package vmutil
+
+import (
+	"bytes"
+
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/vm"
+)
+
+var ErrHTLCFormat = errors.New("bad htlc program format")
+
+// HTLC describes a hash-time-locked contract. The recipient can claim
+// the locked value at any time by revealing a preimage of Hash under
+// SHA-256, the hash function used by other chains' HTLCs so that the
+// same secret can unlock both sides of an atomic swap. Once Deadline
+// (in milliseconds) has passed, the sender can reclaim the value.
+type HTLC struct {
+	Hash             []byte
+	Deadline         uint64
+	RecipientPubkeys []ed25519.PublicKey
+	RecipientQuorum  int
+	SenderPubkeys    []ed25519.PublicKey
+	SenderQuorum     int
+}
+
+// HTLC branches, selected by the last argument before the signature
+// witness.
+const (
+	HTLCRedeem = 0
+	HTLCRefund = 1
+)
+
+// HTLCProgram returns a control program enforcing h.
+//
+// Both branches end in a P2SP multisig check like that of
+// P2SPMultiSigProgram, so inputs are signed in the usual way. The
+// branch and preimage are passed as arguments ahead of the signature
+// witness, and must be the only arguments besides it:
+//
+//	redeem: [PREIMAGE 0 NARGS SIG SIG PREDICATE]
+//	refund: ['' 1 NARGS SIG SIG PREDICATE]
+//
+// The refund branch requires the transaction's mintime to be at
+// least the deadline.
+func HTLCProgram(h *HTLC) ([]byte, error) {
+	if len(h.Hash) != 32 {
+		return nil, errors.WithDetail(ErrBadValue, "htlc hash must be 32 bytes")
+	}
+	if h.Deadline > 1<<62 {
+		return nil, errors.WithDetail(ErrBadValue, "htlc deadline too big")
+	}
+	for _, party := range []struct {
+		pubkeys []ed25519.PublicKey
+		quorum  int
+	}{{h.RecipientPubkeys, h.RecipientQuorum}, {h.SenderPubkeys, h.SenderQuorum}} {
+		if err := checkMultiSigParams(int64(party.quorum), int64(len(party.pubkeys))); err != nil {
+			return nil, err
+		}
+		if party.quorum == 0 {
+			return nil, errors.WithDetail(ErrBadValue, "htlc parties need at least one key")
+		}
+	}
+
+	builder := NewBuilder()
+	refund := builder.NewJumpTarget()
+	check := builder.NewJumpTarget()
+
+	builder.AddOp(vm.OP_DUP).AddOp(vm.OP_TOALTSTACK) // stash a copy of the predicate
+	builder.AddOp(vm.OP_SHA3)                        // stack is now [PREIMAGE BRANCH NARGS SIG PREDICATEHASH]
+
+	// The number of signatures depends on the branch, so the branch
+	// and preimage are found by their distance from the bottom of
+	// the stack.
+	builder.AddOp(vm.OP_DEPTH).AddInt64(2).AddOp(vm.OP_SUB).AddOp(vm.OP_PICK) // copy BRANCH to the top
+	builder.AddJumpIf(refund)
+
+	// redeem
+	builder.AddOp(vm.OP_DEPTH).AddOp(vm.OP_1SUB).AddOp(vm.OP_PICK) // copy PREIMAGE to the top
+	builder.AddOp(vm.OP_SHA256).AddData(h.Hash).AddOp(vm.OP_EQUALVERIFY)
+	addPubkeys(builder, h.RecipientPubkeys, h.RecipientQuorum)
+	builder.AddJump(check)
+
+	// refund
+	builder.SetJumpTarget(refund)
+	builder.AddOp(vm.OP_MINTIME).AddInt64(int64(h.Deadline)).AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	addPubkeys(builder, h.SenderPubkeys, h.SenderQuorum)
+
+	builder.SetJumpTarget(check)
+	builder.AddOp(vm.OP_CHECKMULTISIG).AddOp(vm.OP_VERIFY) // stack is now [PREIMAGE BRANCH NARGS]
+	builder.AddOp(vm.OP_FROMALTSTACK)                      // stack is now [PREIMAGE BRANCH NARGS PREDICATE]
+	builder.AddInt64(0).AddOp(vm.OP_CHECKPREDICATE)
+	return builder.Build()
+}
+
+func addPubkeys(builder *Builder, pubkeys []ed25519.PublicKey, quorum int) {
+	for _, p := range pubkeys {
+		builder.AddData(p)
+	}
+	builder.AddInt64(int64(quorum))
+	builder.AddInt64(int64(len(pubkeys)))
+}
+
+// ParseHTLCProgram returns the contract enforced by a program built
+// with HTLCProgram.
+func ParseHTLCProgram(program []byte) (*HTLC, error) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	// DUP TOALTSTACK SHA3 DEPTH 2 SUB PICK JUMPIF DEPTH 1SUB PICK SHA256 <hash> EQUALVERIFY
+	const hashIndex = 12
+	if len(pops) < hashIndex+1 || pops[hashIndex-1].Op != vm.OP_SHA256 {
+		return nil, errors.Wrap(ErrHTLCFormat, "no hash check")
+	}
+	h := &HTLC{Hash: pops[hashIndex].Data}
+
+	i := hashIndex + 2
+	h.RecipientPubkeys, h.RecipientQuorum, i, err = parsePubkeys(pops, i)
+	if err != nil {
+		return nil, err
+	}
+	// JUMP MINTIME <deadline> GREATERTHANOREQUAL VERIFY
+	if i+4 >= len(pops) || pops[i+1].Op != vm.OP_MINTIME {
+		return nil, errors.Wrap(ErrHTLCFormat, "no deadline check")
+	}
+	deadline, err := vm.AsInt64(pops[i+2].Data)
+	if err != nil || deadline < 0 {
+		return nil, errors.Wrap(ErrHTLCFormat, "parsing deadline")
+	}
+	h.Deadline = uint64(deadline)
+	h.SenderPubkeys, h.SenderQuorum, _, err = parsePubkeys(pops, i+5)
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := HTLCProgram(h)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(want, program) {
+		return nil, errors.Wrap(ErrHTLCFormat, "not an htlc program")
+	}
+	return h, nil
+}
+
+// parsePubkeys reads a list of public keys followed by a quorum and
+// key count, starting at pops[i]. It returns the index after them.
+func parsePubkeys(pops []vm.Instruction, i int) ([]ed25519.PublicKey, int, int, error) {
+	var pubkeys []ed25519.PublicKey
+	for ; i < len(pops) && len(pops[i].Data) == ed25519.PublicKeySize; i++ {
+		pubkeys = append(pubkeys, ed25519.PublicKey(pops[i].Data))
+	}
+	if i+1 >= len(pops) {
+		return nil, 0, 0, vm.ErrShortProgram
+	}
+	quorum, err := vm.AsInt64(pops[i].Data)
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(ErrHTLCFormat, "parsing quorum")
+	}
+	return pubkeys, int(quorum), i + 2, nil
+}
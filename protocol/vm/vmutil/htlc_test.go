@@ -0,0 +1,81 @@
+package vmutil
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/protocol/vm"
+)
+
+func TestHTLCProgram(t *testing.T) {
+	recipientPub, recipientPrv, _ := ed25519.GenerateKey(nil)
+	senderPub1, senderPrv1, _ := ed25519.GenerateKey(nil)
+	senderPub2, senderPrv2, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("swap secret")
+	hash := sha256.Sum256(preimage)
+
+	h := &HTLC{
+		Hash:             hash[:],
+		Deadline:         1000,
+		RecipientPubkeys: []ed25519.PublicKey{recipientPub},
+		RecipientQuorum:  1,
+		SenderPubkeys:    []ed25519.PublicKey{senderPub1, senderPub2},
+		SenderQuorum:     2,
+	}
+	prog, err := HTLCProgram(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseHTLCProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("ParseHTLCProgram = %+v, want %+v", got, h)
+	}
+	if _, err := ParseHTLCProgram(prog[:len(prog)-1]); err == nil {
+		t.Error("truncated program parsed as htlc")
+	}
+
+	pred := []byte{byte(vm.OP_TRUE)}
+	var predHash [32]byte
+	sha3pool.Sum256(predHash[:], pred)
+	sign := func(prv ed25519.PrivateKey) []byte { return ed25519.Sign(prv, predHash[:]) }
+
+	cases := []struct {
+		name    string
+		mintime uint64
+		args    [][]byte
+		ok      bool
+	}{{
+		name: "redeem",
+		args: [][]byte{preimage, {}, {2}, sign(recipientPrv), pred},
+		ok:   true,
+	}, {
+		name: "redeem with wrong preimage",
+		args: [][]byte{[]byte("guess"), {}, {2}, sign(recipientPrv), pred},
+	}, {
+		name: "redeem signed by sender",
+		args: [][]byte{preimage, {}, {2}, sign(senderPrv1), pred},
+	}, {
+		name:    "refund after deadline",
+		mintime: 1000,
+		args:    [][]byte{{}, {1}, {2}, sign(senderPrv1), sign(senderPrv2), pred},
+		ok:      true,
+	}, {
+		name:    "refund before deadline",
+		mintime: 999,
+		args:    [][]byte{{}, {1}, {2}, sign(senderPrv1), sign(senderPrv2), pred},
+	}}
+	for _, c := range cases {
+		mintime := c.mintime
+		context := &vm.Context{VMVersion: 1, Code: prog, Arguments: c.args, MinTimeMS: &mintime}
+		_, err := vm.Verify(context, 100000)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: got error %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package vmutil
 
 import (
+	"bytes"
+	"math"
+
 	"github.com/bytom/crypto/ed25519"
 	"github.com/bytom/errors"
 	"github.com/bytom/protocol/vm"
@@ -116,6 +119,186 @@ func ParseP2SPMultiSigProgram(program []byte) ([]ed25519.PublicKey, int, error)
 	return pubkeys, int(nrequired), nil
 }
 
+// issuanceCapMarker is pushed at the start of an issuance program
+// that declares a maximum total supply.
+var issuanceCapMarker = []byte("maxsupply")
+
+// IssuanceCapProgram prefixes program with a declaration that no more
+// than maxSupply units of the asset may ever be issued. The prefix is
+// <"maxsupply"> <maxSupply> 2DROP, which has no effect when the program
+// runs; the cap is enforced by consensus when transactions are applied
+// to the state snapshot.
+func IssuanceCapProgram(maxSupply uint64, program []byte) ([]byte, error) {
+	if maxSupply > math.MaxInt64 {
+		return nil, errors.WithDetail(ErrBadValue, "maximum supply too big")
+	}
+	builder := NewBuilder()
+	builder.AddData(issuanceCapMarker)
+	builder.AddInt64(int64(maxSupply))
+	builder.AddOp(vm.OP_2DROP)
+	builder.AddRawBytes(program)
+	return builder.Build()
+}
+
+// ParseIssuanceCap returns the maximum supply declared by an issuance
+// program built with IssuanceCapProgram. It reports false if the
+// program declares no cap.
+func ParseIssuanceCap(program []byte) (maxSupply uint64, ok bool) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil || len(pops) < 3 {
+		return 0, false
+	}
+	if !bytes.Equal(pops[0].Data, issuanceCapMarker) {
+		return 0, false
+	}
+	if pops[1].Op > vm.OP_16 || pops[2].Op != vm.OP_2DROP {
+		return 0, false
+	}
+	n, err := vm.AsInt64(pops[1].Data)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return uint64(n), true
+}
+
+// UniqueAssetProgram prefixes program with a maximum supply of one,
+// making the asset non-fungible: it can be issued exactly once, in
+// an amount of exactly one unit.
+func UniqueAssetProgram(program []byte) ([]byte, error) {
+	return IssuanceCapProgram(1, program)
+}
+
+// IsUniqueAsset reports whether program is the issuance program of
+// a non-fungible asset.
+func IsUniqueAsset(program []byte) bool {
+	maxSupply, ok := ParseIssuanceCap(program)
+	return ok && maxSupply == 1
+}
+
+// restrictedMarker is pushed at the start of the issuance program
+// of an asset whose transfers must be co-signed by its issuer.
+var restrictedMarker = []byte("restricted")
+
+// RestrictedIssuanceProgram prefixes program with <"restricted"> DROP,
+// marking the asset as one that may only be held in control programs
+// built with RestrictedTransferProgram. Like the issuance cap, the
+// prefix has no effect when the program runs.
+func RestrictedIssuanceProgram(program []byte) ([]byte, error) {
+	builder := NewBuilder()
+	builder.AddData(restrictedMarker)
+	builder.AddOp(vm.OP_DROP)
+	builder.AddRawBytes(program)
+	return builder.Build()
+}
+
+// IsRestrictedIssuance reports whether program is the issuance
+// program of a restricted-transfer asset.
+func IsRestrictedIssuance(program []byte) bool {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return false
+	}
+	for i := 0; i+1 < len(pops); i++ {
+		if bytes.Equal(pops[i].Data, restrictedMarker) && pops[i+1].Op == vm.OP_DROP {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictedTransferProgram returns a control program that can only
+// be spent with signatures from both a quorum of the holder's keys
+// and a quorum of the issuer's keys, each over the same predicate.
+// The holder part is an ordinary P2SP multisig program, so
+// ParseP2SPMultiSigProgram returns the holder's keys.
+func RestrictedTransferProgram(holderPubkeys []ed25519.PublicKey, holderQuorum int, issuerPubkeys []ed25519.PublicKey, issuerQuorum int) ([]byte, error) {
+	err := checkMultiSigParams(int64(issuerQuorum), int64(len(issuerPubkeys)))
+	if err != nil {
+		return nil, err
+	}
+	if issuerQuorum == 0 {
+		return nil, errors.WithDetail(ErrBadValue, "restricted transfer requires at least one issuer signature")
+	}
+	holderProg, err := P2SPMultiSigProgram(holderPubkeys, holderQuorum)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder()
+	// Expected stack: [... NARGS HSIG HSIG HPRED N ISIG ISIG IPRED]
+	builder.AddOp(vm.OP_DUP).AddOp(vm.OP_TOALTSTACK) // stash a copy of the issuer's predicate
+	builder.AddOp(vm.OP_SHA3)                        // stack is now [... HPRED N ISIG ISIG IPREDHASH]
+	for _, p := range issuerPubkeys {
+		builder.AddData(p)
+	}
+	builder.AddInt64(int64(issuerQuorum))
+	builder.AddInt64(int64(len(issuerPubkeys)))
+	builder.AddOp(vm.OP_CHECKMULTISIG).AddOp(vm.OP_VERIFY) // stack is now [... NARGS HSIG HSIG HPRED N]
+	builder.AddOp(vm.OP_DROP)                              // stack is now [... NARGS HSIG HSIG HPRED]
+	builder.AddOp(vm.OP_FROMALTSTACK).AddOp(vm.OP_OVER)    // stack is now [... HPRED IPRED HPRED]
+	builder.AddOp(vm.OP_EQUALVERIFY)                       // both parties signed the same predicate
+	builder.AddRawBytes(holderProg)
+	return builder.Build()
+}
+
+// ParseRestrictedTransferProgram returns the holder and issuer keys
+// and quorums of a program built with RestrictedTransferProgram.
+func ParseRestrictedTransferProgram(program []byte) (holderPubkeys []ed25519.PublicKey, holderQuorum int, issuerPubkeys []ed25519.PublicKey, issuerQuorum int, err error) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return nil, 0, nil, 0, err
+	}
+	k := 0
+	for k < len(pops) && pops[k].Op != vm.OP_CHECKMULTISIG {
+		k++
+	}
+	if k < 5 || k == len(pops) {
+		return nil, 0, nil, 0, errors.Wrap(ErrMultisigFormat, "no issuer OP_CHECKMULTISIG")
+	}
+	for i := 3; i < k-2; i++ {
+		if len(pops[i].Data) != ed25519.PublicKeySize {
+			return nil, 0, nil, 0, errors.Wrap(ErrMultisigFormat, "bad issuer pubkey")
+		}
+		issuerPubkeys = append(issuerPubkeys, ed25519.PublicKey(pops[i].Data))
+	}
+	nrequired, err := vm.AsInt64(pops[k-2].Data)
+	if err != nil {
+		return nil, 0, nil, 0, errors.Wrap(ErrMultisigFormat, "parsing issuer nrequired")
+	}
+	issuerQuorum = int(nrequired)
+
+	holderPubkeys, holderQuorum, err = ParseP2SPMultiSigProgram(program)
+	if err != nil {
+		return nil, 0, nil, 0, err
+	}
+
+	// Rebuilding the program from the parsed keys and comparing is
+	// simpler, and stricter, than checking each opcode in turn.
+	want, err := RestrictedTransferProgram(holderPubkeys, holderQuorum, issuerPubkeys, issuerQuorum)
+	if err != nil {
+		return nil, 0, nil, 0, err
+	}
+	if !bytes.Equal(want, program) {
+		return nil, 0, nil, 0, errors.Wrap(ErrMultisigFormat, "not a restricted transfer program")
+	}
+	return holderPubkeys, holderQuorum, issuerPubkeys, issuerQuorum, nil
+}
+
+// SamePubkeys reports whether a and b hold the same keys in the same
+// order, as when comparing the issuer keys of a restricted transfer
+// program with those of the asset's issuance program.
+func SamePubkeys(a, b []ed25519.PublicKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func checkMultiSigParams(nrequired, npubkeys int64) error {
 	if nrequired < 0 {
 		return errors.WithDetail(ErrBadValue, "negative quorum")
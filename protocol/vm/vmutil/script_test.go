@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/crypto/sha3pool"
+	"github.com/bytom/protocol/vm"
 )
 
 // TestIsUnspendable ensures the IsUnspendable function returns the expected
@@ -57,3 +59,113 @@ func TestP2SP(t *testing.T) {
 		t.Errorf("expected second pubkey to be %x, got %x", pub2, pubs[1])
 	}
 }
+
+func TestIssuanceCapProgram(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	inner, err := P2SPMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ParseIssuanceCap(inner); ok {
+		t.Error("uncapped program parsed as capped")
+	}
+
+	for _, want := range []uint64{0, 1, 16, 17, 21000000 * 100000000} {
+		prog, err := IssuanceCapProgram(want, inner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := ParseIssuanceCap(prog)
+		if !ok || got != want {
+			t.Errorf("ParseIssuanceCap(IssuanceCapProgram(%d)) = %d, %v", want, got, ok)
+		}
+
+		// The cap prefix must not hide the issuance keys.
+		pubs, n, err := ParseP2SPMultiSigProgram(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 || len(pubs) != 1 || !bytes.Equal(pubs[0], pub) {
+			t.Errorf("ParseP2SPMultiSigProgram of capped program = %x, %d", pubs, n)
+		}
+	}
+
+	if _, err := IssuanceCapProgram(1<<63, inner); err == nil {
+		t.Error("expected error for maximum supply above MaxInt64")
+	}
+}
+
+func TestRestrictedTransferProgram(t *testing.T) {
+	holderPub, holderPrv, _ := ed25519.GenerateKey(nil)
+	issuerPub, issuerPrv, _ := ed25519.GenerateKey(nil)
+	prog, err := RestrictedTransferProgram([]ed25519.PublicKey{holderPub}, 1, []ed25519.PublicKey{issuerPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hpubs, hq, ipubs, iq, err := ParseRestrictedTransferProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hq != 1 || len(hpubs) != 1 || !bytes.Equal(hpubs[0], holderPub) {
+		t.Errorf("holder keys = %x, quorum %d", hpubs, hq)
+	}
+	if iq != 1 || len(ipubs) != 1 || !bytes.Equal(ipubs[0], issuerPub) {
+		t.Errorf("issuer keys = %x, quorum %d", ipubs, iq)
+	}
+	plain, _ := P2SPMultiSigProgram([]ed25519.PublicKey{holderPub}, 1)
+	if _, _, _, _, err := ParseRestrictedTransferProgram(plain); err == nil {
+		t.Error("plain multisig program parsed as restricted")
+	}
+
+	pred := []byte{byte(vm.OP_TRUE)}
+	other := []byte{byte(vm.OP_1), byte(vm.OP_VERIFY), byte(vm.OP_TRUE)}
+	sign := func(prv ed25519.PrivateKey, p []byte) []byte {
+		var h [32]byte
+		sha3pool.Sum256(h[:], p)
+		return ed25519.Sign(prv, h[:])
+	}
+	cases := []struct {
+		name string
+		args [][]byte
+		ok   bool
+	}{{
+		name: "both sign",
+		args: [][]byte{{}, sign(holderPrv, pred), pred, {3}, sign(issuerPrv, pred), pred},
+		ok:   true,
+	}, {
+		name: "issuer signs with holder key",
+		args: [][]byte{{}, sign(holderPrv, pred), pred, {3}, sign(holderPrv, pred), pred},
+	}, {
+		name: "different predicates",
+		args: [][]byte{{}, sign(holderPrv, pred), pred, {3}, sign(issuerPrv, other), other},
+	}}
+	for _, c := range cases {
+		_, err := vm.Verify(&vm.Context{VMVersion: 1, Code: prog, Arguments: c.args}, 100000)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: got error %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestRestrictedIssuanceProgram(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	inner, _ := P2SPMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if IsRestrictedIssuance(inner) {
+		t.Error("plain issuance program reported as restricted")
+	}
+	prog, err := RestrictedIssuanceProgram(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capped, err := IssuanceCapProgram(100, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsRestrictedIssuance(prog) || !IsRestrictedIssuance(capped) {
+		t.Error("restricted issuance program not recognized")
+	}
+	if pubs, _, err := ParseP2SPMultiSigProgram(capped); err != nil || !bytes.Equal(pubs[0], pub) {
+		t.Errorf("ParseP2SPMultiSigProgram of restricted program = %x, %v", pubs, err)
+	}
+}
@@ -0,0 +1,55 @@
+package vmutil
+
+import (
+	"github.com/bytom/crypto/ed25519"
+	"github.com/bytom/errors"
+	"github.com/bytom/protocol/vm"
+)
+
+// TxProofProgram returns a control program that can be spent by a
+// quorum of pubkeys once they prove that the transaction txID is
+// included in a block with at least depth blocks built on it, all of
+// whose hashes meet the target of bits. A quorum of zero lets anyone
+// with the proof spend it.
+//
+// The blocks may be from any chain, so forging a proof costs as much
+// as mining depth+1 blocks at bits. Choose bits and depth so that
+// costs more than the program guards.
+//
+// The proof is passed as arguments ahead of the signature witness,
+// and they must be the only arguments besides it:
+//
+//	[HEADERS PROOF INDEX COUNT NARGS SIG SIG PREDICATE]
+//
+// with the arguments as expected by the CHECKTXPROOF instruction.
+func TxProofProgram(txID []byte, bits, depth uint64, pubkeys []ed25519.PublicKey, quorum int) ([]byte, error) {
+	if len(txID) != 32 {
+		return nil, errors.WithDetail(ErrBadValue, "transaction id must be 32 bytes")
+	}
+	if bits > 1<<62 {
+		return nil, errors.WithDetail(ErrBadValue, "target bits too big")
+	}
+	if depth > 1<<62 {
+		return nil, errors.WithDetail(ErrBadValue, "depth too big")
+	}
+	if err := checkMultiSigParams(int64(quorum), int64(len(pubkeys))); err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder()
+	// The number of signatures is not fixed, so the proof is found
+	// by its distance from the bottom of the stack.
+	for i := int64(1); i <= 4; i++ {
+		builder.AddOp(vm.OP_DEPTH).AddInt64(i).AddOp(vm.OP_SUB).AddOp(vm.OP_PICK)
+	}
+	builder.AddData(txID).AddInt64(int64(bits)).AddInt64(int64(depth)) // stack is now [... HEADERS PROOF INDEX COUNT TXID BITS DEPTH]
+	builder.AddOp(vm.OP_CHECKTXPROOF).AddOp(vm.OP_VERIFY)
+
+	builder.AddOp(vm.OP_DUP).AddOp(vm.OP_TOALTSTACK) // stash a copy of the predicate
+	builder.AddOp(vm.OP_SHA3)                        // stack is now [... NARGS SIG SIG PREDICATEHASH]
+	addPubkeys(builder, pubkeys, quorum)
+	builder.AddOp(vm.OP_CHECKMULTISIG).AddOp(vm.OP_VERIFY) // stack is now [... NARGS]
+	builder.AddOp(vm.OP_FROMALTSTACK)                      // stack is now [... NARGS PREDICATE]
+	builder.AddInt64(0).AddOp(vm.OP_CHECKPREDICATE)
+	return builder.Build()
+}
@@ -0,0 +1,171 @@
+// Package testharness runs networks of in-process cores for
+// end-to-end tests of the protocol and the blockchain reactor.
+//
+// Each node keeps its chain in memory and talks to the others over
+// loopback connections through the same p2p switch and reactor a
+// core uses. Nodes are set up as a core run with --regtest is, so
+// blocks are made only when a test calls Generate, and the scenarios
+// in this package drive a network through syncing, partitions,
+// reorganizations and mempool relay, failing the test when the nodes
+// do not end up where they should.
+package testharness
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bytom/errors"
+	"github.com/bytom/p2p"
+	"github.com/bytom/protocol/bc"
+)
+
+// DefaultTimeout bounds how long a network is given to converge.
+// Peers exchange heights every few seconds, so it allows several
+// rounds.
+var DefaultTimeout = 30 * time.Second
+
+// pollInterval is how often a waiting network nudges peers for their
+// heights and checks whether it has converged.
+const pollInterval = 100 * time.Millisecond
+
+// Network is a set of in-process nodes.
+type Network struct {
+	Nodes []*Node
+}
+
+// New starts a network of n nodes, connected to each other. Callers
+// must Stop it when done.
+func New(tb testing.TB, n int) *Network {
+	net := new(Network)
+	for i := 0; i < n; i++ {
+		node, err := newNode(tb, fmt.Sprintf("node%d", i))
+		if err != nil {
+			net.Stop()
+			tb.Fatal(err)
+		}
+		net.Nodes = append(net.Nodes, node)
+	}
+	net.Heal()
+	return net
+}
+
+// Stop stops every node in net.
+func (net *Network) Stop() {
+	for _, n := range net.Nodes {
+		n.stop()
+	}
+}
+
+// Connect connects nodes i and j, if they are not already.
+func (net *Network) Connect(i, j int) {
+	a, b := net.Nodes[i], net.Nodes[j]
+	if i == j || a.connected(b.Name) {
+		return
+	}
+	p2p.Connect2Switches([]*p2p.Switch{a.Switch, b.Switch}, 0, 1)
+}
+
+// Disconnect drops the connection between nodes i and j.
+func (net *Network) Disconnect(i, j int) {
+	a, b := net.Nodes[i], net.Nodes[j]
+	for _, peer := range a.Switch.Peers().List() {
+		if peer.Moniker == b.Name {
+			a.Switch.StopPeerGracefully(peer)
+		}
+	}
+	for _, peer := range b.Switch.Peers().List() {
+		if peer.Moniker == a.Name {
+			b.Switch.StopPeerGracefully(peer)
+		}
+	}
+}
+
+// Partition splits net into groups of node indexes, dropping every
+// connection between nodes in different groups. Nodes not listed
+// keep their connections.
+func (net *Network) Partition(groups ...[]int) {
+	for g, group := range groups {
+		for _, other := range groups[g+1:] {
+			for _, i := range group {
+				for _, j := range other {
+					net.Disconnect(i, j)
+				}
+			}
+		}
+	}
+}
+
+// Heal connects every pair of nodes in net.
+func (net *Network) Heal() {
+	for i := range net.Nodes {
+		for j := i + 1; j < len(net.Nodes); j++ {
+			net.Connect(i, j)
+		}
+	}
+}
+
+// WaitSync waits until the nodes with the given indexes, or all of
+// them if none are given, have the same tip, and returns it.
+func (net *Network) WaitSync(timeout time.Duration, nodes ...int) (bc.Hash, error) {
+	if len(nodes) == 0 {
+		for i := range net.Nodes {
+			nodes = append(nodes, i)
+		}
+	}
+	var tip bc.Hash
+	err := net.wait(timeout, func() bool {
+		tip = net.Nodes[nodes[0]].Tip()
+		for _, i := range nodes[1:] {
+			if net.Nodes[i].Tip() != tip {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return bc.Hash{}, errors.Wrap(err, net.heights())
+	}
+	return tip, nil
+}
+
+// WaitTx waits until every node has the transaction txID in its
+// pool.
+func (net *Network) WaitTx(timeout time.Duration, txID bc.Hash) error {
+	return net.wait(timeout, func() bool {
+		for _, n := range net.Nodes {
+			if !n.HasTx(txID) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// wait polls done until it reports true or timeout passes. Between
+// polls, every node asks its peers for their heights, so block
+// requests go out without waiting for the reactor's own status
+// updates.
+func (net *Network) wait(timeout time.Duration, done func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out")
+		}
+		for _, n := range net.Nodes {
+			n.Reactor.BroadcastStatusRequest()
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+// heights describes the height and tip of every node, for failure
+// messages.
+func (net *Network) heights() string {
+	s := "heights:"
+	for _, n := range net.Nodes {
+		s += fmt.Sprintf(" %s=%d(%x)", n.Name, n.Chain.Height(), n.Tip().Bytes()[:4])
+	}
+	return s
+}
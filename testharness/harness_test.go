@@ -0,0 +1,17 @@
+package testharness
+
+import "testing"
+
+func run(t *testing.T, nodes int, scenario func(testing.TB, *Network)) {
+	if testing.Short() {
+		t.Skip("skipping network test in short mode.")
+	}
+	net := New(t, nodes)
+	defer net.Stop()
+	scenario(t, net)
+}
+
+func TestSync(t *testing.T)         { run(t, 3, Sync) }
+func TestPartition(t *testing.T)    { run(t, 4, Partition) }
+func TestReorg(t *testing.T)        { run(t, 4, Reorg) }
+func TestMempoolRelay(t *testing.T) { run(t, 3, MempoolRelay) }
@@ -0,0 +1,164 @@
+package testharness
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	crypto "github.com/tendermint/go-crypto"
+	dbm "github.com/tendermint/tmlibs/db"
+
+	"github.com/bytom/blockchain"
+	"github.com/bytom/blockchain/account"
+	"github.com/bytom/blockchain/asset"
+	"github.com/bytom/blockchain/pseudohsm"
+	"github.com/bytom/blockchain/txdb"
+	cfg "github.com/bytom/config"
+	"github.com/bytom/consensus"
+	"github.com/bytom/errors"
+	"github.com/bytom/mining"
+	"github.com/bytom/p2p"
+	"github.com/bytom/protocol"
+	"github.com/bytom/protocol/bc"
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/prottest"
+)
+
+// Node is an in-process core. Its chain, accounts and assets are
+// kept in memory, and its blockchain reactor syncs blocks and relays
+// transactions over loopback connections to the network's other
+// nodes.
+type Node struct {
+	Name    string
+	Chain   *protocol.Chain
+	TxPool  *protocol.TxPool
+	Reactor *blockchain.BlockchainReactor
+	Switch  *p2p.Switch
+
+	keysDir string
+}
+
+func newNode(tb testing.TB, name string) (*Node, error) {
+	// Nodes are set up as a core run with --regtest is.
+	config := cfg.DefaultConfig()
+	config.Regtest = true
+
+	// The reactor relays the pool's new transactions.
+	store := txdb.NewStore(dbm.NewMemDB())
+	txPool := protocol.NewTxPool()
+	chain := prottest.NewChain(tb,
+		prottest.WithStore(store),
+		prottest.WithGenesis(consensus.RegtestInitBlock()),
+		prottest.WithTxPool(txPool),
+	)
+
+	keysDir, err := ioutil.TempDir("", "testharness")
+	if err != nil {
+		return nil, err
+	}
+	hsm, err := pseudohsm.New(keysDir)
+	if err != nil {
+		os.RemoveAll(keysDir)
+		return nil, err
+	}
+	accounts := account.NewManager(dbm.NewMemDB(), chain)
+	assets := asset.NewRegistry(dbm.NewMemDB(), chain, chain.InitialBlockHash)
+
+	reactor := blockchain.NewBlockchainReactor(store, chain, txPool, accounts, assets, hsm, config.FastSync)
+	reactor.SetRegtest()
+
+	sw := p2p.NewSwitch(cfg.TestP2PConfig())
+	sw.AddReactor("BLOCKCHAIN", reactor)
+	privKey := crypto.GenPrivKeyEd25519()
+	sw.SetNodeInfo(&p2p.NodeInfo{
+		PubKey:     privKey.PubKey().Unwrap().(crypto.PubKeyEd25519),
+		Moniker:    name,
+		Network:    config.NetworkName(),
+		Version:    "0.1.0",
+		RemoteAddr: name + ":0",
+		ListenAddr: name + ":0",
+	})
+	sw.SetNodePrivKey(privKey)
+	if _, err := sw.Start(); err != nil {
+		os.RemoveAll(keysDir)
+		return nil, errors.Wrap(err, "starting switch")
+	}
+
+	return &Node{
+		Name:    name,
+		Chain:   chain,
+		TxPool:  txPool,
+		Reactor: reactor,
+		Switch:  sw,
+		keysDir: keysDir,
+	}, nil
+}
+
+func (n *Node) stop() {
+	n.Switch.Stop()
+	os.RemoveAll(n.keysDir)
+}
+
+// Tip returns the hash of the latest block on n's chain.
+func (n *Node) Tip() bc.Hash {
+	b, _ := n.Chain.State()
+	return b.Hash()
+}
+
+// Generate makes count blocks on n, confirming the transactions in
+// its pool. Their coinbases pay a program anyone can spend, so
+// SpendCoinbase can make transactions from them.
+func (n *Node) Generate(count int) ([]*legacy.Block, error) {
+	return mining.Generate(context.Background(), n.Chain, n.TxPool, count, nil)
+}
+
+// Submit adds tx to n's pool, from which the reactor relays it to
+// n's peers.
+func (n *Node) Submit(tx *legacy.Tx) error {
+	return n.Chain.ValidateTx(tx)
+}
+
+// HasTx reports whether tx is in n's pool.
+func (n *Node) HasTx(txID bc.Hash) bool {
+	return n.TxPool.IsTransactionInPool(&txID)
+}
+
+// connected reports whether n has a peer named name.
+func (n *Node) connected(name string) bool {
+	for _, peer := range n.Switch.Peers().List() {
+		if peer.Moniker == name {
+			return true
+		}
+	}
+	return false
+}
+
+// txFee is the fee SpendCoinbase leaves, enough gas to run the
+// spent program.
+const txFee = 1000000
+
+// SpendCoinbase returns a transaction spending the coinbase output of
+// b, a block made by Generate, to prog.
+func SpendCoinbase(b *legacy.Block, prog []byte) (*legacy.Tx, error) {
+	cb := b.Transactions[0]
+	out, err := cb.Output(*cb.ResultIds[0])
+	if err != nil {
+		return nil, err
+	}
+	value := out.Source.Value
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, *out.Source.Ref, *value.AssetId, value.Amount, out.Source.Position, out.ControlProgram.Code, *out.Data, nil)},
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(*value.AssetId, value.Amount-txFee, prog, nil)},
+	})
+
+	// Round trip the transaction so it carries its serialized size,
+	// as one received from a peer does.
+	raw, err := tx.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	tx = new(legacy.Tx)
+	return tx, tx.UnmarshalText(raw)
+}
@@ -0,0 +1,142 @@
+package testharness
+
+import (
+	"testing"
+
+	"github.com/bytom/protocol/bc/legacy"
+	"github.com/bytom/protocol/vm"
+)
+
+// Sync has the first node make blocks and checks that every other
+// node syncs them.
+func Sync(tb testing.TB, net *Network) {
+	blocks := generate(tb, net.Nodes[0], 5)
+	tip, err := net.WaitSync(DefaultTimeout)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if want := blocks[len(blocks)-1].Hash(); tip != want {
+		tb.Fatalf("synced to %x, want %x", tip.Bytes(), want.Bytes())
+	}
+}
+
+// Partition splits the network in two, has the first half make
+// blocks, and checks that they reach only that half until the
+// network heals.
+func Partition(tb testing.TB, net *Network) {
+	a, b := halves(tb, net)
+	before := net.Nodes[b[0]].Tip()
+	net.Partition(a, b)
+
+	generate(tb, net.Nodes[a[0]], 3)
+	tip, err := net.WaitSync(DefaultTimeout, a...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, i := range b {
+		if got := net.Nodes[i].Tip(); got != before {
+			tb.Fatalf("%s synced across the partition to %x", net.Nodes[i].Name, got.Bytes())
+		}
+	}
+
+	net.Heal()
+	healed, err := net.WaitSync(DefaultTimeout)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if healed != tip {
+		tb.Fatalf("healed network synced to %x, want %x", healed.Bytes(), tip.Bytes())
+	}
+}
+
+// Reorg splits the network in two, has each half make a fork of a
+// different length, and checks that once the network heals, every
+// node switches to the longer fork.
+func Reorg(tb testing.TB, net *Network) {
+	a, b := halves(tb, net)
+	net.Partition(a, b)
+
+	generate(tb, net.Nodes[a[0]], 2)
+	long := generate(tb, net.Nodes[b[0]], 4)
+	if _, err := net.WaitSync(DefaultTimeout, a...); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := net.WaitSync(DefaultTimeout, b...); err != nil {
+		tb.Fatal(err)
+	}
+
+	net.Heal()
+	tip, err := net.WaitSync(DefaultTimeout)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if want := long[len(long)-1].Hash(); tip != want {
+		tb.Fatalf("reorganized to %x, want the longer fork's %x", tip.Bytes(), want.Bytes())
+	}
+}
+
+// MempoolRelay submits a transaction to the first node, checks that
+// it reaches every node's pool, and that a block made by the last
+// node confirms it everywhere.
+func MempoolRelay(tb testing.TB, net *Network) {
+	funding := generate(tb, net.Nodes[0], 1)
+	if _, err := net.WaitSync(DefaultTimeout); err != nil {
+		tb.Fatal(err)
+	}
+
+	tx, err := SpendCoinbase(funding[0], []byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := net.Nodes[0].Submit(tx); err != nil {
+		tb.Fatal(err)
+	}
+	if err := net.WaitTx(DefaultTimeout, tx.ID); err != nil {
+		tb.Fatalf("relaying transaction %x: %v", tx.ID.Bytes(), err)
+	}
+
+	confirming := generate(tb, net.Nodes[len(net.Nodes)-1], 1)[0]
+	if !includes(confirming, tx) {
+		tb.Fatalf("block %d does not include the relayed transaction", confirming.Height)
+	}
+	if _, err := net.WaitSync(DefaultTimeout); err != nil {
+		tb.Fatal(err)
+	}
+	for _, n := range net.Nodes {
+		if n.HasTx(tx.ID) {
+			tb.Errorf("%s still has the confirmed transaction in its pool", n.Name)
+		}
+	}
+}
+
+func generate(tb testing.TB, n *Node, count int) []*legacy.Block {
+	blocks, err := n.Generate(count)
+	if err != nil {
+		tb.Fatalf("generating blocks on %s: %v", n.Name, err)
+	}
+	return blocks
+}
+
+// halves splits the indexes of net's nodes into two groups.
+func halves(tb testing.TB, net *Network) (a, b []int) {
+	if len(net.Nodes) < 2 {
+		tb.Fatal("scenario needs at least two nodes")
+	}
+	for i := range net.Nodes {
+		if i < len(net.Nodes)/2 {
+			a = append(a, i)
+		} else {
+			b = append(b, i)
+		}
+	}
+	return a, b
+}
+
+func includes(b *legacy.Block, tx *legacy.Tx) bool {
+	for _, btx := range b.Transactions {
+		if btx.ID == tx.ID {
+			return true
+		}
+	}
+	return false
+}